@@ -16,6 +16,16 @@ func TableCatalogSchema() *schema.Schema {
 	return schema.NewSchema([]*column.Column{oidColumn, nameColumn, firstPageColumn})
 }
 
+// version of layout of columns catalog. it is bumped when columns are appended to the layout
+// version 1: table_oid, type, name, fixed_length, variable_length, offset and has_index
+// version 2: index_kind
+// version 3: is_nullable, default_value and check_expr
+// version 4: ref_table_oid, ref_column and on_delete
+const ColumnsCatalogFormatVersion = 4
+
+// number of columns of columns catalog on each version. index is the version
+var columnsCatalogColumnNums = [ColumnsCatalogFormatVersion + 1]uint32{0, 7, 8, 11, 14}
+
 func ColumnsCatalogSchema() *schema.Schema {
 	tableOIDColumn := column.NewColumn("table_oid", types.Integer, false, nil)
 	typeColumn := column.NewColumn("type", types.Integer, false, nil)
@@ -24,6 +34,17 @@ func ColumnsCatalogSchema() *schema.Schema {
 	variableLengthColumn := column.NewColumn("variable_length", types.Integer, false, nil)
 	offsetColumn := column.NewColumn("offset", types.Integer, false, nil)
 	hasIndexColumn := column.NewColumn("has_index", types.Integer, false, nil)
+	indexKindColumn := column.NewColumn("index_kind", types.Integer, false, nil)
+	isNullableColumn := column.NewColumn("is_nullable", types.Integer, false, nil)
+	// default value in text form. NULL when DEFAULT is not specified
+	defaultValueColumn := column.NewColumn("default_value", types.Varchar, false, nil)
+	// condition of CHECK constraint in SQL text
+	checkExprColumn := column.NewColumn("check_expr", types.Varchar, false, nil)
+	// referenced table and column of foreign key. ref_column is NULL when the column has no foreign key
+	refTableOIDColumn := column.NewColumn("ref_table_oid", types.Integer, false, nil)
+	refColumnColumn := column.NewColumn("ref_column", types.Varchar, false, nil)
+	// column.ForeignKeyAction
+	onDeleteColumn := column.NewColumn("on_delete", types.Integer, false, nil)
 
 	return schema.NewSchema([]*column.Column{
 		tableOIDColumn,
@@ -32,5 +53,31 @@ func ColumnsCatalogSchema() *schema.Schema {
 		fixedLengthColumn,
 		variableLengthColumn,
 		offsetColumn,
-		hasIndexColumn})
+		hasIndexColumn,
+		indexKindColumn,
+		isNullableColumn,
+		defaultValueColumn,
+		checkExprColumn,
+		refTableOIDColumn,
+		refColumnColumn,
+		onDeleteColumn})
+}
+
+func IndexesCatalogSchema() *schema.Schema {
+	tableOIDColumn := column.NewColumn("table_oid", types.Integer, false, nil)
+	nameColumn := column.NewColumn("name", types.Varchar, false, nil)
+	typeColumn := column.NewColumn("type", types.Integer, false, nil)
+	// names of key columns separated by comma
+	keyColumnsColumn := column.NewColumn("key_columns", types.Varchar, false, nil)
+	// column.IndexConstraint (UNIQUE or PRIMARY KEY)
+	constraintColumn := column.NewColumn("constraint", types.Integer, false, nil)
+	headerPageColumn := column.NewColumn("header_page", types.Integer, false, nil)
+
+	return schema.NewSchema([]*column.Column{
+		tableOIDColumn,
+		nameColumn,
+		typeColumn,
+		keyColumnsColumn,
+		constraintColumn,
+		headerPageColumn})
 }
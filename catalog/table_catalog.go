@@ -4,11 +4,18 @@
 package catalog
 
 import (
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
 	"sync/atomic"
 
+	"github.com/ryogrid/SamehadaDB/errors"
 	"github.com/ryogrid/SamehadaDB/recovery"
 	"github.com/ryogrid/SamehadaDB/storage/access"
 	"github.com/ryogrid/SamehadaDB/storage/buffer"
+	"github.com/ryogrid/SamehadaDB/storage/index"
+	"github.com/ryogrid/SamehadaDB/storage/page"
 	"github.com/ryogrid/SamehadaDB/storage/table/column"
 	"github.com/ryogrid/SamehadaDB/storage/table/schema"
 	"github.com/ryogrid/SamehadaDB/storage/tuple"
@@ -25,12 +32,26 @@ const ColumnsCatalogPageId = 1
 
 const ColumnsCatalogOID = 0
 
+// IndexesCatalogOID is OID of the table which holds header page ids of indexes.
+// indexes are reopened from the header pages at reload
+const IndexesCatalogOID = 1
+
+const ErrIndexEntryNotFound = errors.Error("index is not found in indexes catalog")
+const ErrTableIsReferenced = errors.Error("table is referenced by foreign key of other table")
+const ErrExistingRowsViolateConstraint = errors.Error("existing rows violate the constraint")
+
 // Catalog is a non-persistent catalog that is designed for the executor to use.
 // It handles table creation and table lookup
 type Catalog struct {
 	bpm        *buffer.BufferPoolManager
 	tableIds   map[uint32]*TableMetadata
 	tableNames map[string]*TableMetadata
+	// names of dropped tables whose transactions are not finished.
+	// they are locked for restoring the tables on abort
+	droppingNames map[string]bool
+	// guards tableIds, tableNames and droppingNames.
+	// they are modified by DDL and its commit or abort while other transactions read them
+	mutex *sync.RWMutex
 	// incrementation must be atomic
 	nextTableId  uint32
 	tableHeap    *access.TableHeap
@@ -49,90 +70,500 @@ func Int32toBool(val int32) bool {
 // BootstrapCatalog bootstrap the systems' catalogs on the first database initialization
 func BootstrapCatalog(bpm *buffer.BufferPoolManager, log_manager *recovery.LogManager, lock_manager *access.LockManager, txn *access.Transaction) *Catalog {
 	tableCatalogHeap := access.NewTableHeap(bpm, log_manager, lock_manager, txn)
-	tableCatalog := &Catalog{bpm, make(map[uint32]*TableMetadata), make(map[string]*TableMetadata), 0, tableCatalogHeap, log_manager, lock_manager}
+	tableCatalog := &Catalog{bpm, make(map[uint32]*TableMetadata), make(map[string]*TableMetadata), make(map[string]bool), new(sync.RWMutex), 0, tableCatalogHeap, log_manager, lock_manager}
 	tableCatalog.CreateTable("columns_catalog", ColumnsCatalogSchema(), txn)
+	tableCatalog.CreateTable("indexes_catalog", IndexesCatalogSchema(), txn)
 	return tableCatalog
 }
 
-// TODO: (SDB) need call RecoveryCatalogFromCatalogPage when recovery or database re-launch
-// RecoveryCatalogFromCatalogPage get all information about tables and columns from disk and put it on memory
-func RecoveryCatalogFromCatalogPage(bpm *buffer.BufferPoolManager, log_manager *recovery.LogManager, lock_manager *access.LockManager, txn *access.Transaction) *Catalog {
-	tableCatalogHeapIt := access.InitTableHeap(bpm, TableCatalogPageId, log_manager, lock_manager).Iterator(txn)
+// IsSystemCatalog returns whether the table is a catalog table which is not defined by user
+func IsSystemCatalog(oid uint32) bool {
+	return oid == ColumnsCatalogOID || oid == IndexesCatalogOID
+}
 
-	tableIds := make(map[uint32]*TableMetadata)
-	tableNames := make(map[string]*TableMetadata)
+// hasIndexesCatalog returns false when db file was created before indexes catalog was introduced.
+// on such db, indexes are rebuilt at every reload
+func (c *Catalog) hasIndexesCatalog() bool {
+	indexesCatalog := c.GetTableByOID(IndexesCatalogOID)
+	return indexesCatalog != nil && indexesCatalog.Name() == "indexes_catalog"
+}
+
+// columnsCatalogVersion returns version of layout of columns catalog on the db file.
+// it is decided from number of columns recorded for columns catalog itself because the layout
+// has been extended by appending columns. columns which are not in the layout are not read.
+// while columns catalog itself is loaded, only columns of version 1 are read
+func (c *Catalog) columnsCatalogVersion() int {
+	columnsCatalog := c.GetTableByOID(ColumnsCatalogOID)
+	if columnsCatalog == nil {
+		return 1
+	}
+	version := 1
+	for ver, num := range columnsCatalogColumnNums {
+		if num <= columnsCatalog.GetColumnNum() {
+			version = ver
+		}
+	}
+	return version
+}
+
+// indexEntry is a row of indexes catalog
+type indexEntry struct {
+	name         string
+	kind         column.IndexKind
+	keyColumns   []string
+	constraint   column.IndexConstraint
+	headerPageId types.PageID
+	rid          page.RID
+}
 
+// findColumnIndexEntry returns entry of index of single column which is defined with flags of the column.
+// nil is returned when it is not found
+func findColumnIndexEntry(entries []*indexEntry, colName string) *indexEntry {
+	for _, entry := range entries {
+		if len(entry.keyColumns) == 1 && entry.keyColumns[0] == colName {
+			return entry
+		}
+	}
+	return nil
+}
+
+// RecoveryCatalogFromCatalogPage get all information about tables and columns from disk and put it on memory.
+// indexes are reopened from header pages recorded in indexes catalog. indexes which can't be
+// reopened (pages are broken or format is old) are recreated and rebuilt from table heaps
+func RecoveryCatalogFromCatalogPage(bpm *buffer.BufferPoolManager, log_manager *recovery.LogManager, lock_manager *access.LockManager, txn *access.Transaction) *Catalog {
+	c := &Catalog{bpm, make(map[uint32]*TableMetadata), make(map[string]*TableMetadata), make(map[string]bool), new(sync.RWMutex), 0, access.InitTableHeap(bpm, TableCatalogPageId, log_manager, lock_manager), log_manager, lock_manager}
+
+	// system catalogs are loaded first because indexes catalog is needed for loading user tables
+	tableCatalogHeapIt := c.tableHeap.Iterator(txn)
+	userTables := make([]*tuple.Tuple, 0)
 	for tuple := tableCatalogHeapIt.Current(); !tableCatalogHeapIt.End(); tuple = tableCatalogHeapIt.Next() {
 		oid := tuple.GetValue(TableCatalogSchema(), TableCatalogSchema().GetColIndex("oid")).ToInteger()
 		name := tuple.GetValue(TableCatalogSchema(), TableCatalogSchema().GetColIndex("name")).ToVarchar()
-		firstPage := tuple.GetValue(TableCatalogSchema(), TableCatalogSchema().GetColIndex("first_page")).ToInteger()
-
-		columns := []*column.Column{}
-		columnsCatalogHeapIt := access.InitTableHeap(bpm, ColumnsCatalogPageId, log_manager, lock_manager).Iterator(txn)
-		for tuple := columnsCatalogHeapIt.Current(); !columnsCatalogHeapIt.End(); tuple = columnsCatalogHeapIt.Next() {
-			tableOid := tuple.GetValue(ColumnsCatalogSchema(), ColumnsCatalogSchema().GetColIndex("table_oid")).ToInteger()
-			if tableOid != oid {
-				continue
+		// note: db files created before indexes catalog was introduced may have user table whose oid is IndexesCatalogOID
+		if oid == ColumnsCatalogOID || (oid == IndexesCatalogOID && name == "indexes_catalog") {
+			c.loadTable(tuple, nil, txn)
+		} else {
+			userTables = append(userTables, tuple)
+		}
+	}
+
+	// table oid -> entries of indexes on the table
+	indexEntries := make(map[uint32][]*indexEntry)
+	if c.hasIndexesCatalog() {
+		it := c.GetTableByOID(IndexesCatalogOID).Table().Iterator(txn)
+		for tuple := it.Current(); !it.End(); tuple = it.Next() {
+			tableOid := uint32(tuple.GetValue(IndexesCatalogSchema(), IndexesCatalogSchema().GetColIndex("table_oid")).ToInteger())
+			name := tuple.GetValue(IndexesCatalogSchema(), IndexesCatalogSchema().GetColIndex("name")).ToVarchar()
+			kind := tuple.GetValue(IndexesCatalogSchema(), IndexesCatalogSchema().GetColIndex("type")).ToInteger()
+			keyColumns := tuple.GetValue(IndexesCatalogSchema(), IndexesCatalogSchema().GetColIndex("key_columns")).ToVarchar()
+			constraint := tuple.GetValue(IndexesCatalogSchema(), IndexesCatalogSchema().GetColIndex("constraint")).ToInteger()
+			headerPage := tuple.GetValue(IndexesCatalogSchema(), IndexesCatalogSchema().GetColIndex("header_page")).ToInteger()
+			indexEntries[tableOid] = append(indexEntries[tableOid],
+				&indexEntry{name, column.IndexKind(kind), strings.Split(keyColumns, ","), column.IndexConstraint(constraint), types.PageID(headerPage), *tuple.GetRID()})
+		}
+	}
+
+	for _, tuple := range userTables {
+		c.loadTable(tuple, indexEntries, txn)
+	}
+
+	// oid of table created after reload must not collide with existing ones
+	for _, tableMetadata := range c.GetAllTables() {
+		if tableMetadata.OID() >= c.nextTableId {
+			c.nextTableId = tableMetadata.OID() + 1
+		}
+	}
+
+	return c
+}
+
+// loadTable reads columns of the table from columns catalog and opens indexes of it.
+// indexEntries is nil when the table is a system catalog
+func (c *Catalog) loadTable(tableTuple *tuple.Tuple, indexEntries map[uint32][]*indexEntry, txn *access.Transaction) {
+	oid := tableTuple.GetValue(TableCatalogSchema(), TableCatalogSchema().GetColIndex("oid")).ToInteger()
+	name := tableTuple.GetValue(TableCatalogSchema(), TableCatalogSchema().GetColIndex("name")).ToVarchar()
+	firstPage := tableTuple.GetValue(TableCatalogSchema(), TableCatalogSchema().GetColIndex("first_page")).ToInteger()
+
+	columns := []*column.Column{}
+	version := c.columnsCatalogVersion()
+	columnsCatalogHeapIt := access.InitTableHeap(c.bpm, ColumnsCatalogPageId, c.Log_manager, c.Lock_manager).Iterator(txn)
+	for tuple := columnsCatalogHeapIt.Current(); !columnsCatalogHeapIt.End(); tuple = columnsCatalogHeapIt.Next() {
+		tableOid := tuple.GetValue(ColumnsCatalogSchema(), ColumnsCatalogSchema().GetColIndex("table_oid")).ToInteger()
+		if tableOid != oid {
+			continue
+		}
+		columnType := tuple.GetValue(ColumnsCatalogSchema(), ColumnsCatalogSchema().GetColIndex("type")).ToInteger()
+		columnName := tuple.GetValue(ColumnsCatalogSchema(), ColumnsCatalogSchema().GetColIndex("name")).ToVarchar()
+		fixedLength := tuple.GetValue(ColumnsCatalogSchema(), ColumnsCatalogSchema().GetColIndex("fixed_length")).ToInteger()
+		variableLength := tuple.GetValue(ColumnsCatalogSchema(), ColumnsCatalogSchema().GetColIndex("variable_length")).ToInteger()
+		columnOffset := tuple.GetValue(ColumnsCatalogSchema(), ColumnsCatalogSchema().GetColIndex("offset")).ToInteger()
+		hasIndex := Int32toBool(tuple.GetValue(ColumnsCatalogSchema(), ColumnsCatalogSchema().GetColIndex("has_index")).ToInteger())
+
+		column_ := column.NewColumn(columnName, types.TypeID(columnType), false, nil)
+		column_.SetFixedLength(uint32(fixedLength))
+		column_.SetVariableLength(uint32(variableLength))
+		column_.SetOffset(uint32(columnOffset))
+		column_.SetHasIndex(hasIndex)
+		if version >= 2 {
+			indexKind := tuple.GetValue(ColumnsCatalogSchema(), ColumnsCatalogSchema().GetColIndex("index_kind")).ToInteger()
+			column_.SetIndexKind(column.IndexKind(indexKind))
+		}
+		if version >= 3 {
+			isNullable := Int32toBool(tuple.GetValue(ColumnsCatalogSchema(), ColumnsCatalogSchema().GetColIndex("is_nullable")).ToInteger())
+			defaultValue := tuple.GetValue(ColumnsCatalogSchema(), ColumnsCatalogSchema().GetColIndex("default_value"))
+			checkExpr := tuple.GetValue(ColumnsCatalogSchema(), ColumnsCatalogSchema().GetColIndex("check_expr")).ToVarchar()
+			column_.SetIsNullable(isNullable)
+			if !defaultValue.IsNull() {
+				column_.SetDefaultValue(valueFromString(defaultValue.ToVarchar(), types.TypeID(columnType)))
 			}
-			columnType := tuple.GetValue(ColumnsCatalogSchema(), ColumnsCatalogSchema().GetColIndex("type")).ToInteger()
-			columnName := tuple.GetValue(ColumnsCatalogSchema(), ColumnsCatalogSchema().GetColIndex("name")).ToVarchar()
-			fixedLength := tuple.GetValue(ColumnsCatalogSchema(), ColumnsCatalogSchema().GetColIndex("fixed_length")).ToInteger()
-			variableLength := tuple.GetValue(ColumnsCatalogSchema(), ColumnsCatalogSchema().GetColIndex("variable_length")).ToInteger()
-			columnOffset := tuple.GetValue(ColumnsCatalogSchema(), ColumnsCatalogSchema().GetColIndex("offset")).ToInteger()
-			hasIndex := Int32toBool(tuple.GetValue(ColumnsCatalogSchema(), ColumnsCatalogSchema().GetColIndex("has_index")).ToInteger())
+			column_.SetCheckExpr(checkExpr)
+		}
+		if version >= 4 {
+			refColumn := tuple.GetValue(ColumnsCatalogSchema(), ColumnsCatalogSchema().GetColIndex("ref_column"))
+			if !refColumn.IsNull() {
+				refTableOID := tuple.GetValue(ColumnsCatalogSchema(), ColumnsCatalogSchema().GetColIndex("ref_table_oid")).ToInteger()
+				onDelete := tuple.GetValue(ColumnsCatalogSchema(), ColumnsCatalogSchema().GetColIndex("on_delete")).ToInteger()
+				column_.SetForeignKey(column.NewForeignKey(uint32(refTableOID), refColumn.ToVarchar(), column.ForeignKeyAction(onDelete)))
+			}
+		}
+
+		columns = append(columns, column_)
+	}
+
+	schema_ := schema.NewSchema(columns)
+	tableHeap := access.InitTableHeap(c.bpm, types.PageID(firstPage), c.Log_manager, c.Lock_manager)
+	setLockTarget(tableHeap, uint32(oid))
+	tableMetadata := &TableMetadata{schema_, name, tableHeap, make([]index.Index, len(columns)), make([]index.Index, 0), new(sync.RWMutex), uint32(oid)}
+	rebuildTargets := make([]index.Index, 0)
+	// reopens index and recreates it when it can't be reopened
+	loadIndex := func(im *index.IndexMetadata, kind column.IndexKind, entry *indexEntry) index.Index {
+		var err error = ErrIndexEntryNotFound
+		var index_ index.Index
+		if entry != nil {
+			// constraint is recorded only in indexes catalog
+			im.SetConstraint(entry.constraint)
+			index_, err = openIndex(im, kind, c.bpm, entry.headerPageId)
+		}
+		if err != nil {
+			index_ = newIndex(im, kind, c.bpm)
+			rebuildTargets = append(rebuildTargets, index_)
+			if entry != nil {
+				c.updateIndexEntry(uint32(oid), index_, schema_, entry.rid, txn)
+			} else if c.hasIndexesCatalog() {
+				c.insertIndexEntry(uint32(oid), index_, schema_, txn)
+			}
+		}
+		return index_
+	}
+
+	for idx, column_ := range columns {
+		if column_.HasIndex() {
+			im := newIndexMetadata(schema_, name, idx)
+			// index created with CREATE INDEX has the name specified by user
+			entry := findColumnIndexEntry(indexEntries[uint32(oid)], column_.GetColumnName())
+			if entry != nil {
+				im.SetName(entry.name)
+			}
+			tableMetadata.indexes[idx] = loadIndex(im, column_.GetIndexKind(), entry)
+			column_.SetIndexConstraint(tableMetadata.indexes[idx].GetMetadata().GetConstraint())
+		}
+	}
+	// definitions of indexes of multiple columns exist only in indexes catalog
+	for _, entry := range indexEntries[uint32(oid)] {
+		if len(entry.keyColumns) <= 1 {
+			continue
+		}
+		keyAttrs := make([]uint32, 0, len(entry.keyColumns))
+		for _, colName := range entry.keyColumns {
+			keyAttrs = append(keyAttrs, schema_.GetColIndex(colName))
+		}
+		im := index.NewIndexMetadata(entry.name, name, schema_, keyAttrs)
+		tableMetadata.multiColumnIndexes = append(tableMetadata.multiColumnIndexes, loadIndex(im, entry.kind, entry))
+	}
 
-			column_ := column.NewColumn(columnName, types.TypeID(columnType), false, nil)
-			column_.SetFixedLength(uint32(fixedLength))
-			column_.SetVariableLength(uint32(variableLength))
-			column_.SetOffset(uint32(columnOffset))
-			column_.SetHasIndex(hasIndex)
+	c.putTable(tableMetadata)
+	fillIndexes(tableMetadata, rebuildTargets, txn)
+}
 
-			columns = append(columns, column_)
+// RebuildIndexes clears all indexes and fills them with entries of tuples in table heaps.
+// it is used when index pages may be inconsistent with table heaps
+// because index pages are not recovered with logs (e.g. after non-graceful shutdown)
+func (c *Catalog) RebuildIndexes(txn *access.Transaction) {
+	for _, tableMetadata := range c.GetAllTables() {
+		indexes := tableMetadata.GetIndexes()
+		for _, index_ := range indexes {
+			index_.Clear()
 		}
+		fillIndexes(tableMetadata, indexes, txn)
+	}
+}
 
-		tableMetadata := NewTableMetadata(
-			schema.NewSchema(columns),
-			name,
-			access.InitTableHeap(bpm, types.PageID(firstPage), log_manager, lock_manager),
-			uint32(oid))
+// fillIndexes inserts entries of all tuples in the table heap to the indexes
+func fillIndexes(tableMetadata *TableMetadata, indexes []index.Index, txn *access.Transaction) {
+	if len(indexes) == 0 {
+		return
+	}
 
-		tableIds[uint32(oid)] = tableMetadata
-		tableNames[name] = tableMetadata
+	it := tableMetadata.Table().Iterator(txn)
+	for tuple_ := it.Current(); !it.End(); tuple_ = it.Next() {
+		for _, index_ := range indexes {
+			index_.InsertEntry(tuple_, *tuple_.GetRID(), txn)
+		}
 	}
+}
 
-	return &Catalog{bpm, tableIds, tableNames, 1, access.InitTableHeap(bpm, 0, log_manager, lock_manager), log_manager, lock_manager}
+// fillIndexesWithCheck is fillIndexes which fails when rows violate UNIQUE or PRIMARY KEY constraint of the indexes
+func fillIndexesWithCheck(tableMetadata *TableMetadata, indexes []index.Index, txn *access.Transaction) error {
+	it := tableMetadata.table.Iterator(txn)
+	for tuple_ := it.Current(); !it.End(); tuple_ = it.Next() {
+		for _, index_ := range indexes {
+			if index_.GetMetadata().IsUnique() && hasSameKey(tableMetadata, index_, tuple_, txn) {
+				return ErrExistingRowsViolateConstraint
+			}
+			index_.InsertEntry(tuple_, *tuple_.GetRID(), txn)
+		}
+	}
+	return nil
+}
 
+// hasSameKey returns true when a row whose key is same with tuple_ is already in the index.
+// NULL key of primary key is treated as violation
+func hasSameKey(tableMetadata *TableMetadata, index_ index.Index, tuple_ *tuple.Tuple, txn *access.Transaction) bool {
+	schema_ := tableMetadata.schema
+	for _, colIdx := range index_.GetKeyAttrs() {
+		if tuple_.GetValue(schema_, colIdx).IsNull() {
+			return index_.GetMetadata().GetConstraint() == column.IndexConstraintPrimaryKey
+		}
+	}
+	// index may return entries of other keys, so keys of found rows are compared
+	for _, rid := range index_.ScanKey(tuple_, txn) {
+		found := tableMetadata.table.GetTuple(&rid, txn)
+		if found == nil {
+			continue
+		}
+		isSameKey := true
+		for _, colIdx := range index_.GetKeyAttrs() {
+			if !found.GetValue(schema_, colIdx).CompareEquals(tuple_.GetValue(schema_, colIdx)) {
+				isSameKey = false
+				break
+			}
+		}
+		if isSameKey {
+			return true
+		}
+	}
+	return false
 }
 
 func (c *Catalog) GetTableByName(table string) *TableMetadata {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
 	if table, ok := c.tableNames[table]; ok {
 		return table
 	}
 	return nil
 }
 
+// IsTableNameUsed returns true when a table of the name exists or the name is locked
+// by a transaction which dropped the table and is not finished
+func (c *Catalog) IsTableNameUsed(name string) bool {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	_, ok := c.tableNames[name]
+	return ok || c.droppingNames[name]
+}
+
 func (c *Catalog) GetTableByOID(oid uint32) *TableMetadata {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
 	if table, ok := c.tableIds[oid]; ok {
 		return table
 	}
 	return nil
 }
 
-// CreateTable creates a new table and return its metadata
+// GetAllTables returns metadata of all tables including system catalog in OID order
+func (c *Catalog) GetAllTables() []*TableMetadata {
+	c.mutex.RLock()
+	ret := make([]*TableMetadata, 0, len(c.tableIds))
+	for _, tableMetadata := range c.tableIds {
+		ret = append(ret, tableMetadata)
+	}
+	c.mutex.RUnlock()
+	sort.Slice(ret, func(i, j int) bool { return ret[i].OID() < ret[j].OID() })
+	return ret
+}
+
+// GetMaxPageLSN returns the largest LSN of pages of all table heaps including table catalog
+func (c *Catalog) GetMaxPageLSN() types.LSN {
+	ret := c.tableHeap.GetMaxPageLSN()
+	for _, tableMetadata := range c.GetAllTables() {
+		if lsn := tableMetadata.Table().GetMaxPageLSN(); lsn > ret {
+			ret = lsn
+		}
+	}
+	return ret
+}
+
+// putTable registers the table to the catalog on memory. a table of the same OID is replaced
+func (c *Catalog) putTable(tableMetadata *TableMetadata) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.tableIds[tableMetadata.oid] = tableMetadata
+	c.tableNames[tableMetadata.name] = tableMetadata
+}
+
+// removeTable unregisters the table from the catalog on memory.
+// when isDropping is true, the name is kept used until setDropFinished is called
+func (c *Catalog) removeTable(tableMetadata *TableMetadata, isDropping bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	delete(c.tableIds, tableMetadata.oid)
+	delete(c.tableNames, tableMetadata.name)
+	if isDropping {
+		c.droppingNames[tableMetadata.name] = true
+	}
+}
+
+// setDropFinished releases the name of the dropped table. when restore is true,
+// the table is registered again (abort of DROP TABLE)
+func (c *Catalog) setDropFinished(tableMetadata *TableMetadata, restore bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	delete(c.droppingNames, tableMetadata.name)
+	if restore {
+		c.tableIds[tableMetadata.oid] = tableMetadata
+		c.tableNames[tableMetadata.name] = tableMetadata
+	}
+}
+
+// ReferencingColumn is a column which references a column of other table with foreign key
+type ReferencingColumn struct {
+	Table  *TableMetadata
+	ColIdx uint32
+}
+
+// GetReferencingColumns returns columns of all tables which reference the column of the table
+func (c *Catalog) GetReferencingColumns(tableOID uint32, colName string) []*ReferencingColumn {
+	ret := make([]*ReferencingColumn, 0)
+	for _, tableMetadata := range c.GetAllTables() {
+		for ii, column_ := range tableMetadata.Schema().GetColumns() {
+			fk := column_.GetForeignKey()
+			if fk != nil && fk.GetRefTableOID() == tableOID && fk.GetRefColumnName() == colName {
+				ret = append(ret, &ReferencingColumn{tableMetadata, uint32(ii)})
+			}
+		}
+	}
+	return ret
+}
+
+// LockTable acquires lock of the mode on the table for txn.
+// txn is marked as aborted when the lock is not granted
+func (c *Catalog) LockTable(tableMetadata *TableMetadata, lock_mode access.LockMode, txn *access.Transaction) error {
+	if err := c.Lock_manager.LockTable(txn, tableMetadata.oid, lock_mode); err != nil {
+		txn.SetState(access.ABORTED)
+		return access.ErrTableLockFailed
+	}
+	return nil
+}
+
+// setLockTarget makes rows of user table locked with intention lock on the table.
+// rows of system catalogs are locked without table lock because DDL on different tables writes them concurrently
+func setLockTarget(tableHeap *access.TableHeap, oid uint32) {
+	if !IsSystemCatalog(oid) {
+		tableHeap.SetOID(oid)
+	}
+}
+
+// LockPredicate acquires lock on rows of the table which match the predicate for txn.
+// txn is marked as aborted when the lock is not granted
+func (c *Catalog) LockPredicate(tableMetadata *TableMetadata, predicate access.Predicate, txn *access.Transaction) error {
+	if err := c.Lock_manager.LockPredicate(txn, tableMetadata.oid, predicate); err != nil {
+		txn.SetState(access.ABORTED)
+		return err
+	}
+	return nil
+}
+
+// LockInsertion acquires lock on values of the tuple written to the table for txn.
+// txn is marked as aborted when the lock is not granted
+func (c *Catalog) LockInsertion(tableMetadata *TableMetadata, tuple_ *tuple.Tuple, txn *access.Transaction) error {
+	if err := c.Lock_manager.LockInsertion(txn, tableMetadata.oid, tuple_); err != nil {
+		txn.SetState(access.ABORTED)
+		return err
+	}
+	return nil
+}
+
+// CreateTable creates a new table and return its metadata.
+// the table is removed and its pages are released on abort of txn
 func (c *Catalog) CreateTable(name string, schema *schema.Schema, txn *access.Transaction) *TableMetadata {
 	oid := c.nextTableId
 	atomic.AddUint32(&c.nextTableId, 1)
 
 	tableHeap := access.NewTableHeap(c.bpm, c.Log_manager, c.Lock_manager, txn)
+	setLockTarget(tableHeap, oid)
 	tableMetadata := NewTableMetadata(schema, name, tableHeap, oid)
 
-	c.tableIds[oid] = tableMetadata
-	c.tableNames[name] = tableMetadata
+	c.putTable(tableMetadata)
+	txn.AddAbortAction(func() {
+		c.removeTable(tableMetadata, false)
+		for _, index_ := range tableMetadata.GetIndexes() {
+			index_.Drop()
+		}
+		tableHeap.Drop()
+	})
 	c.insertTable(tableMetadata, txn)
 
 	return tableMetadata
 }
 
+// DropTable removes the table from catalog and releases pages of its table heap and indexes.
+// rows of catalog tables are deleted in txn. the table disappears from catalog on memory
+// immediately and it is restored on abort. pages are released on commit.
+// the name can't be used by other tables until txn finishes (see IsTableNameUsed)
+func (c *Catalog) DropTable(tableMetadata *TableMetadata, txn *access.Transaction) error {
+	for _, column_ := range tableMetadata.Schema().GetColumns() {
+		for _, ref := range c.GetReferencingColumns(tableMetadata.OID(), column_.GetColumnName()) {
+			if ref.Table != tableMetadata {
+				return ErrTableIsReferenced
+			}
+		}
+	}
+
+	oid := int32(tableMetadata.OID())
+	c.markDeleteRows(c.tableHeap, TableCatalogSchema(), "oid", oid, txn)
+	c.markDeleteRows(c.GetTableByOID(ColumnsCatalogOID).Table(), ColumnsCatalogSchema(), "table_oid", oid, txn)
+	if c.hasIndexesCatalog() {
+		c.markDeleteRows(c.GetTableByOID(IndexesCatalogOID).Table(), IndexesCatalogSchema(), "table_oid", oid, txn)
+	}
+
+	c.removeTable(tableMetadata, true)
+	txn.AddAbortAction(func() {
+		c.setDropFinished(tableMetadata, true)
+	})
+	txn.AddCommitAction(func() error {
+		c.setDropFinished(tableMetadata, false)
+		return dropTableStorage(tableMetadata)
+	})
+	return nil
+}
+
+// markDeleteRows marks rows of the catalog table whose integer column has the value as deleted
+func (c *Catalog) markDeleteRows(tableHeap *access.TableHeap, schema_ *schema.Schema, colName string, val int32, txn *access.Transaction) {
+	colIdx := schema_.GetColIndex(colName)
+	rids := make([]page.RID, 0)
+	it := tableHeap.Iterator(txn)
+	for tuple_ := it.Current(); !it.End(); tuple_ = it.Next() {
+		if tuple_.GetValue(schema_, colIdx).ToInteger() == val {
+			rids = append(rids, *tuple_.GetRID())
+		}
+	}
+	for _, rid := range rids {
+		tableHeap.MarkDelete(&rid, txn)
+	}
+}
+
 func boolToInt32(val bool) int32 {
 	if val {
 		return 1
@@ -141,6 +572,69 @@ func boolToInt32(val bool) int32 {
 	}
 }
 
+// valueToString converts non NULL value to text form which is stored in catalog
+func valueToString(val *types.Value) string {
+	switch val.ValueType() {
+	case types.Integer:
+		return strconv.FormatInt(int64(val.ToInteger()), 10)
+	case types.Float:
+		return strconv.FormatFloat(float64(val.ToFloat()), 'g', -1, 32)
+	case types.Boolean:
+		return strconv.FormatBool(val.ToBoolean())
+	default:
+		return val.ToVarchar()
+	}
+}
+
+// valueFromString is reverse of valueToString
+func valueFromString(str string, valueType types.TypeID) *types.Value {
+	var ret types.Value
+	switch valueType {
+	case types.Integer:
+		parsed, _ := strconv.ParseInt(str, 10, 32)
+		ret = types.NewInteger(int32(parsed))
+	case types.Float:
+		parsed, _ := strconv.ParseFloat(str, 32)
+		ret = types.NewFloat(float32(parsed))
+	case types.Boolean:
+		parsed, _ := strconv.ParseBool(str)
+		ret = types.NewBoolean(parsed)
+	default:
+		ret = types.NewVarchar(str)
+	}
+	return &ret
+}
+
+// makeColumnTuple returns a row of columns catalog which defines the column
+func makeColumnTuple(tableOid uint32, column_ *column.Column) *tuple.Tuple {
+	row := make([]types.Value, 0)
+	row = append(row, types.NewInteger(int32(tableOid)))
+	row = append(row, types.NewInteger(int32(column_.GetType())))
+	row = append(row, types.NewVarchar(column_.GetColumnName()))
+	row = append(row, types.NewInteger(int32(column_.FixedLength())))
+	row = append(row, types.NewInteger(int32(column_.VariableLength())))
+	row = append(row, types.NewInteger(int32(column_.GetOffset())))
+	row = append(row, types.NewInteger(boolToInt32(column_.HasIndex())))
+	row = append(row, types.NewInteger(int32(column_.GetIndexKind())))
+	row = append(row, types.NewInteger(boolToInt32(column_.IsNullable())))
+	if column_.GetDefaultValue() != nil {
+		row = append(row, types.NewVarchar(valueToString(column_.GetDefaultValue())))
+	} else {
+		row = append(row, *types.NewVarchar("").SetNull())
+	}
+	row = append(row, types.NewVarchar(column_.GetCheckExpr()))
+	if fk := column_.GetForeignKey(); fk != nil {
+		row = append(row, types.NewInteger(int32(fk.GetRefTableOID())))
+		row = append(row, types.NewVarchar(fk.GetRefColumnName()))
+		row = append(row, types.NewInteger(int32(fk.GetOnDelete())))
+	} else {
+		row = append(row, types.NewInteger(0))
+		row = append(row, *types.NewVarchar("").SetNull())
+		row = append(row, types.NewInteger(0))
+	}
+	return tuple.NewTupleFromSchema(row, ColumnsCatalogSchema())
+}
+
 func (c *Catalog) insertTable(tableMetadata *TableMetadata, txn *access.Transaction) {
 	row := make([]types.Value, 0)
 
@@ -152,21 +646,262 @@ func (c *Catalog) insertTable(tableMetadata *TableMetadata, txn *access.Transact
 	// insert entry to TableCatalogPage (PageId = 0)
 	c.tableHeap.InsertTuple(first_tuple, txn)
 	for _, column_ := range tableMetadata.schema.GetColumns() {
-		row := make([]types.Value, 0)
-		row = append(row, types.NewInteger(int32(tableMetadata.oid)))
-		row = append(row, types.NewInteger(int32(column_.GetType())))
-		row = append(row, types.NewVarchar(column_.GetColumnName()))
-		row = append(row, types.NewInteger(int32(column_.FixedLength())))
-		row = append(row, types.NewInteger(int32(column_.VariableLength())))
-		row = append(row, types.NewInteger(int32(column_.GetOffset())))
-		row = append(row, types.NewInteger(boolToInt32(column_.HasIndex())))
-		new_tuple := tuple.NewTupleFromSchema(row, ColumnsCatalogSchema())
-
+		new_tuple := makeColumnTuple(tableMetadata.oid, column_)
 		// insert entry to ColumnsCatalogPage (PageId = 1)
-		c.tableIds[ColumnsCatalogOID].Table().InsertTuple(new_tuple, txn)
+		c.GetTableByOID(ColumnsCatalogOID).Table().InsertTuple(new_tuple, txn)
+	}
+	if c.hasIndexesCatalog() {
+		for _, index_ := range tableMetadata.GetIndexes() {
+			c.insertIndexEntry(tableMetadata.oid, index_, tableMetadata.schema, txn)
+		}
 	}
 	// flush a page having table definitions
 	c.bpm.FlushPage(TableCatalogPageId)
 	// flush a page having columns definitions on table
 	c.bpm.FlushPage(ColumnsCatalogPageId)
 }
+
+// CreateIndex creates index whose key consists of multiple columns on the table and fills it with existing rows.
+// the index is removed on abort of txn.
+// note: index of single column is defined with flag of the column (see CreateColumnIndex)
+func (c *Catalog) CreateIndex(tableMetadata *TableMetadata, indexName string, keyAttrs []uint32, kind column.IndexKind, constraint column.IndexConstraint, txn *access.Transaction) (index.Index, error) {
+	im := index.NewIndexMetadata(indexName, tableMetadata.name, tableMetadata.schema, keyAttrs)
+	im.SetConstraint(constraint)
+	index_ := newIndex(im, kind, c.bpm)
+	tableMetadata.addMultiColumnIndex(index_)
+	txn.AddAbortAction(func() {
+		tableMetadata.removeMultiColumnIndex(index_)
+		index_.Drop()
+	})
+	if err := fillIndexesWithCheck(tableMetadata, []index.Index{index_}, txn); err != nil {
+		return nil, err
+	}
+	if c.hasIndexesCatalog() {
+		c.insertIndexEntry(tableMetadata.oid, index_, tableMetadata.schema, txn)
+	}
+	return index_, nil
+}
+
+// CreateColumnIndex creates index of the column which has no index and fills it with existing rows.
+// when indexName is empty, default name of index of the column is used.
+// flags of the column and its row in columns catalog are updated. they are restored on abort of txn
+func (c *Catalog) CreateColumnIndex(tableMetadata *TableMetadata, colIdx uint32, indexName string, kind column.IndexKind, constraint column.IndexConstraint, txn *access.Transaction) (index.Index, error) {
+	column_ := tableMetadata.schema.GetColumn(colIdx)
+	oldKind, oldConstraint := column_.GetIndexKind(), column_.GetIndexConstraint()
+	column_.SetHasIndex(true)
+	column_.SetIndexKind(kind)
+	column_.SetIndexConstraint(constraint)
+	im := newIndexMetadata(tableMetadata.schema, tableMetadata.name, int(colIdx))
+	if indexName != "" {
+		im.SetName(indexName)
+	}
+	index_ := newIndex(im, kind, c.bpm)
+	tableMetadata.setIndex(colIdx, index_)
+	txn.AddAbortAction(func() {
+		column_.SetHasIndex(false)
+		column_.SetIndexKind(oldKind)
+		column_.SetIndexConstraint(oldConstraint)
+		tableMetadata.setIndex(colIdx, nil)
+		index_.Drop()
+	})
+	if err := fillIndexesWithCheck(tableMetadata, []index.Index{index_}, txn); err != nil {
+		return nil, err
+	}
+
+	c.updateColumnRow(tableMetadata, column_, txn)
+	if c.hasIndexesCatalog() {
+		c.insertIndexEntry(tableMetadata.oid, index_, tableMetadata.schema, txn)
+	}
+	return index_, nil
+}
+
+// updateColumnRow rewrites the row of columns catalog which defines the column of the table
+func (c *Catalog) updateColumnRow(tableMetadata *TableMetadata, column_ *column.Column, txn *access.Transaction) {
+	columnsCatalog := c.GetTableByOID(ColumnsCatalogOID)
+	it := columnsCatalog.Table().Iterator(txn)
+	for tuple_ := it.Current(); !it.End(); tuple_ = it.Next() {
+		tableOid := tuple_.GetValue(ColumnsCatalogSchema(), ColumnsCatalogSchema().GetColIndex("table_oid")).ToInteger()
+		name := tuple_.GetValue(ColumnsCatalogSchema(), ColumnsCatalogSchema().GetColIndex("name")).ToVarchar()
+		if uint32(tableOid) == tableMetadata.oid && name == column_.GetColumnName() {
+			columnsCatalog.Table().UpdateTuple(makeColumnTuple(tableMetadata.oid, column_), nil, nil, *tuple_.GetRID(), txn)
+			c.bpm.FlushPage(tuple_.GetRID().GetPageId())
+			return
+		}
+	}
+}
+
+// DropIndex removes the index from the table and catalog. flags of the column are cleared
+// when the index is defined with them. the index is restored on abort and its pages are released on commit
+func (c *Catalog) DropIndex(tableMetadata *TableMetadata, index_ index.Index, txn *access.Transaction) {
+	isColumnIndex := false
+	for colIdx := uint32(0); colIdx < tableMetadata.GetColumnNum(); colIdx++ {
+		if tableMetadata.GetIndex(int(colIdx)) != index_ {
+			continue
+		}
+		isColumnIndex = true
+		column_ := tableMetadata.schema.GetColumn(colIdx)
+		oldKind, oldConstraint := column_.GetIndexKind(), column_.GetIndexConstraint()
+		column_.SetHasIndex(false)
+		column_.SetIndexKind(column.IndexKindHash)
+		column_.SetIndexConstraint(column.IndexConstraintNone)
+		tableMetadata.setIndex(colIdx, nil)
+		c.updateColumnRow(tableMetadata, column_, txn)
+		txn.AddAbortAction(func() {
+			column_.SetHasIndex(true)
+			column_.SetIndexKind(oldKind)
+			column_.SetIndexConstraint(oldConstraint)
+			tableMetadata.setIndex(colIdx, index_)
+		})
+		break
+	}
+	if !isColumnIndex && tableMetadata.removeMultiColumnIndex(index_) {
+		txn.AddAbortAction(func() {
+			tableMetadata.addMultiColumnIndex(index_)
+		})
+	}
+
+	if c.hasIndexesCatalog() {
+		indexesCatalog := c.GetTableByOID(IndexesCatalogOID).Table()
+		it := indexesCatalog.Iterator(txn)
+		for tuple_ := it.Current(); !it.End(); tuple_ = it.Next() {
+			tableOid := tuple_.GetValue(IndexesCatalogSchema(), IndexesCatalogSchema().GetColIndex("table_oid")).ToInteger()
+			name := tuple_.GetValue(IndexesCatalogSchema(), IndexesCatalogSchema().GetColIndex("name")).ToVarchar()
+			if uint32(tableOid) == tableMetadata.oid && name == *index_.GetName() {
+				indexesCatalog.MarkDelete(tuple_.GetRID(), txn)
+				break
+			}
+		}
+	}
+	txn.AddCommitAction(func() error {
+		index_.Drop()
+		return nil
+	})
+}
+
+// AlterTable replaces schema of the table with schema_. existing rows are rewritten to a new table heap
+// in the layout of schema_ and all indexes are rebuilt.
+// srcColIdxs[ii] is index of the column of current schema whose values are moved to ii-th column of schema_.
+// when it is -1, the column is added and fillValues[ii] is stored to it.
+// validate is called on each rewritten row. indexes of multiple columns which include removed column are dropped.
+// the table keeps OID and name. old pages are released on commit of txn and new ones are released on abort
+func (c *Catalog) AlterTable(tableMetadata *TableMetadata, schema_ *schema.Schema, srcColIdxs []int, fillValues []types.Value, validate func(*tuple.Tuple) error, txn *access.Transaction) (*TableMetadata, error) {
+	tableHeap := access.NewTableHeap(c.bpm, c.Log_manager, c.Lock_manager, txn)
+	setLockTarget(tableHeap, tableMetadata.oid)
+	newTableMetadata := NewTableMetadata(schema_, tableMetadata.name, tableHeap, tableMetadata.oid)
+
+	newColIdxs := make(map[uint32]uint32)
+	for ii, srcColIdx := range srcColIdxs {
+		if srcColIdx < 0 {
+			continue
+		}
+		newColIdxs[uint32(srcColIdx)] = uint32(ii)
+		// name given with CREATE INDEX is kept (default name follows name of the column)
+		srcIndex, newIndex_ := tableMetadata.GetIndex(srcColIdx), newTableMetadata.indexes[ii]
+		if srcIndex != nil && newIndex_ != nil && *srcIndex.GetName() != *newIndexMetadata(tableMetadata.schema, tableMetadata.name, srcColIdx).GetName() {
+			newIndex_.GetMetadata().SetName(*srcIndex.GetName())
+		}
+	}
+	for _, index_ := range tableMetadata.GetMultiColumnIndexes() {
+		keyAttrs := make([]uint32, 0)
+		for _, colIdx := range index_.GetKeyAttrs() {
+			if newColIdx, ok := newColIdxs[colIdx]; ok {
+				keyAttrs = append(keyAttrs, newColIdx)
+			}
+		}
+		if len(keyAttrs) != len(index_.GetKeyAttrs()) {
+			continue
+		}
+		im := index.NewIndexMetadata(*index_.GetName(), tableMetadata.name, schema_, keyAttrs)
+		im.SetConstraint(index_.GetMetadata().GetConstraint())
+		newTableMetadata.multiColumnIndexes = append(newTableMetadata.multiColumnIndexes, newIndex(im, indexKindOf(index_), c.bpm))
+	}
+	txn.AddAbortAction(func() {
+		for _, index_ := range newTableMetadata.GetIndexes() {
+			index_.Drop()
+		}
+		tableHeap.Drop()
+	})
+
+	it := tableMetadata.table.Iterator(txn)
+	for tuple_ := it.Current(); !it.End(); tuple_ = it.Next() {
+		values := make([]types.Value, 0, len(srcColIdxs))
+		for ii, srcColIdx := range srcColIdxs {
+			if srcColIdx >= 0 {
+				values = append(values, tuple_.GetValue(tableMetadata.schema, uint32(srcColIdx)))
+			} else {
+				values = append(values, fillValues[ii])
+			}
+		}
+		newTuple := tuple.NewTupleFromSchema(values, schema_)
+		if err := validate(newTuple); err != nil {
+			return nil, err
+		}
+		if _, err := tableHeap.InsertTuple(newTuple, txn); err != nil {
+			return nil, err
+		}
+	}
+	if err := fillIndexesWithCheck(newTableMetadata, newTableMetadata.GetIndexes(), txn); err != nil {
+		return nil, err
+	}
+
+	oid := int32(tableMetadata.oid)
+	c.markDeleteRows(c.tableHeap, TableCatalogSchema(), "oid", oid, txn)
+	c.markDeleteRows(c.GetTableByOID(ColumnsCatalogOID).Table(), ColumnsCatalogSchema(), "table_oid", oid, txn)
+	if c.hasIndexesCatalog() {
+		c.markDeleteRows(c.GetTableByOID(IndexesCatalogOID).Table(), IndexesCatalogSchema(), "table_oid", oid, txn)
+	}
+	c.insertTable(newTableMetadata, txn)
+
+	c.putTable(newTableMetadata)
+	txn.AddAbortAction(func() {
+		c.putTable(tableMetadata)
+	})
+	txn.AddCommitAction(func() error {
+		return dropTableStorage(tableMetadata)
+	})
+	return newTableMetadata, nil
+}
+
+// dropTableStorage releases pages of the table heap and indexes of the table.
+// it is called on commit, so returned error is only reported to caller of the commit
+func dropTableStorage(tableMetadata *TableMetadata) error {
+	for _, index_ := range tableMetadata.GetIndexes() {
+		index_.Drop()
+	}
+	return tableMetadata.table.Drop()
+}
+
+// key columns of the index are recorded as comma separated column names
+func makeIndexEntryTuple(tableOid uint32, index_ index.Index, schema_ *schema.Schema) *tuple.Tuple {
+	keyColumns := make([]string, 0)
+	for _, colIdx := range index_.GetKeyAttrs() {
+		keyColumns = append(keyColumns, schema_.GetColumn(colIdx).GetColumnName())
+	}
+
+	row := make([]types.Value, 0)
+	row = append(row, types.NewInteger(int32(tableOid)))
+	row = append(row, types.NewVarchar(*index_.GetName()))
+	row = append(row, types.NewInteger(int32(indexKindOf(index_))))
+	row = append(row, types.NewVarchar(strings.Join(keyColumns, ",")))
+	row = append(row, types.NewInteger(int32(index_.GetMetadata().GetConstraint())))
+	row = append(row, types.NewInteger(int32(index_.GetHeaderPageId())))
+	return tuple.NewTupleFromSchema(row, IndexesCatalogSchema())
+}
+
+// insertIndexEntry records header page of the index to indexes catalog.
+// the header page is flushed for reopening the index even if the system exits in not graceful
+func (c *Catalog) insertIndexEntry(tableOid uint32, index_ index.Index, schema_ *schema.Schema, txn *access.Transaction) {
+	rid, err := c.GetTableByOID(IndexesCatalogOID).Table().InsertTuple(makeIndexEntryTuple(tableOid, index_, schema_), txn)
+	c.bpm.FlushPage(index_.GetHeaderPageId())
+	if err == nil {
+		c.bpm.FlushPage(rid.GetPageId())
+	}
+}
+
+// updateIndexEntry replaces header page recorded in the row of indexes catalog
+func (c *Catalog) updateIndexEntry(tableOid uint32, index_ index.Index, schema_ *schema.Schema, rid page.RID, txn *access.Transaction) {
+	indexesCatalog := c.GetTableByOID(IndexesCatalogOID)
+	indexesCatalog.Table().UpdateTuple(makeIndexEntryTuple(tableOid, index_, schema_), nil, nil, rid, txn)
+	c.bpm.FlushPage(index_.GetHeaderPageId())
+	c.bpm.FlushPage(rid.GetPageId())
+}
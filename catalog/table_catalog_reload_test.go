@@ -11,6 +11,7 @@ import (
 	"github.com/ryogrid/SamehadaDB/storage/buffer"
 	"github.com/ryogrid/SamehadaDB/storage/table/column"
 	"github.com/ryogrid/SamehadaDB/storage/table/schema"
+	"github.com/ryogrid/SamehadaDB/storage/tuple"
 	"github.com/ryogrid/SamehadaDB/test_util"
 	testingpkg "github.com/ryogrid/SamehadaDB/testing"
 	"github.com/ryogrid/SamehadaDB/types"
@@ -29,9 +30,20 @@ func TestTableCatalogReload(t *testing.T) {
 
 	columnA := column.NewColumn("a", types.Integer, false, nil)
 	columnB := column.NewColumn("b", types.Integer, true, nil)
+	columnA.SetIsNullable(false)
+	defaultValue := types.NewInteger(-1)
+	columnB.SetDefaultValue(&defaultValue)
+	columnB.SetCheckExpr("b >= -1")
 	schema_ := schema.NewSchema([]*column.Column{columnA, columnB})
 
-	catalog_old.CreateTable("test_1", schema_, txn)
+	tableMetadata := catalog_old.CreateTable("test_1", schema_, txn)
+	row := []types.Value{types.NewInteger(10), types.NewInteger(20)}
+	tuple_ := tuple.NewTupleFromSchema(row, schema_)
+	rid, _ := tableMetadata.Table().InsertTuple(tuple_, txn)
+	tableMetadata.GetIndex(1).InsertEntry(tuple_, *rid, txn)
+	headerPageId := tableMetadata.GetIndex(1).GetHeaderPageId()
+	// existing row is inserted to index created after insertion
+	catalog_old.CreateIndex(tableMetadata, "ab_index", []uint32{0, 1}, column.IndexKindBTree, column.IndexConstraintUnique, txn)
 	bpm.FlushAllPages()
 
 	fmt.Println("Shutdown system...")
@@ -41,11 +53,38 @@ func TestTableCatalogReload(t *testing.T) {
 	//catalog := GetCatalog(bpm)
 	catalog_recov := RecoveryCatalogFromCatalogPage(samehada_instance_new.GetBufferPoolManager(), samehada_instance_new.GetLogManager(), samehada_instance_new.GetLockManager(), txn_new)
 
-	columnToCheck := catalog_recov.GetTableByOID(1).Schema().GetColumn(1)
+	// columns catalog is read with the latest layout
+	testingpkg.Equals(t, ColumnsCatalogSchema().GetColumnCount(), columnsCatalogColumnNums[ColumnsCatalogFormatVersion])
+	testingpkg.Equals(t, ColumnsCatalogFormatVersion, catalog_recov.columnsCatalogVersion())
+
+	tableToCheck := catalog_recov.GetTableByName("test_1")
+	columnToCheck := tableToCheck.Schema().GetColumn(1)
 
 	testingpkg.Assert(t, columnToCheck.GetColumnName() == "b", "")
 	testingpkg.Assert(t, columnToCheck.GetType() == 4, "")
 	testingpkg.Assert(t, columnToCheck.HasIndex() == true, "")
+	testingpkg.Assert(t, columnToCheck.IsNullable(), "")
+	testingpkg.Equals(t, int32(-1), columnToCheck.GetDefaultValue().ToInteger())
+	testingpkg.Equals(t, "b >= -1", columnToCheck.GetCheckExpr())
+	testingpkg.Assert(t, !tableToCheck.Schema().GetColumn(0).IsNullable(), "")
+	testingpkg.Assert(t, tableToCheck.Schema().GetColumn(0).GetDefaultValue() == nil, "")
+
+	// index is reopened from the header page recorded in indexes catalog
+	indexToCheck := tableToCheck.GetIndex(1)
+	testingpkg.Equals(t, headerPageId, indexToCheck.GetHeaderPageId())
+	rids := indexToCheck.ScanKey(tuple.GenTupleForHashIndexSearch(schema_, 1, types.NewInteger(20)), txn_new)
+	testingpkg.Equals(t, 1, len(rids))
+	testingpkg.Equals(t, *rid, rids[0])
+
+	// definition of index of multiple columns is reloaded from indexes catalog
+	multiColumnIndex := tableToCheck.GetIndexByName("ab_index")
+	testingpkg.Assert(t, multiColumnIndex != nil, "ab_index should be reloaded")
+	testingpkg.Equals(t, []uint32{0, 1}, multiColumnIndex.GetKeyAttrs())
+	testingpkg.Equals(t, column.IndexConstraintUnique, multiColumnIndex.GetMetadata().GetConstraint())
+	rids = multiColumnIndex.ScanKey(tuple.GenTupleForIndexSearch(schema_, []uint32{0, 1}, row), txn_new)
+	testingpkg.Equals(t, 1, len(rids))
+	rids = multiColumnIndex.ScanKey(tuple.GenTupleForIndexSearch(schema_, []uint32{0, 1}, []types.Value{types.NewInteger(10), types.NewInteger(21)}), txn_new)
+	testingpkg.Equals(t, 0, len(rids))
 
 	samehada_instance.Finalize(true)
 }
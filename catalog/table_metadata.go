@@ -4,10 +4,15 @@
 package catalog
 
 import (
+	"sync"
+
 	"github.com/ryogrid/SamehadaDB/common"
 	"github.com/ryogrid/SamehadaDB/storage/access"
+	"github.com/ryogrid/SamehadaDB/storage/buffer"
 	"github.com/ryogrid/SamehadaDB/storage/index"
+	"github.com/ryogrid/SamehadaDB/storage/table/column"
 	"github.com/ryogrid/SamehadaDB/storage/table/schema"
+	"github.com/ryogrid/SamehadaDB/types"
 )
 
 type TableMetadata struct {
@@ -17,7 +22,11 @@ type TableMetadata struct {
 	// index data class obj of each column
 	// if column has no index, respond element is nil
 	indexes []index.Index
-	oid     uint32
+	// indexes whose key consists of multiple columns
+	multiColumnIndexes []index.Index
+	// guards indexes and multiColumnIndexes which are modified by CREATE INDEX and DROP INDEX
+	mutex *sync.RWMutex
+	oid   uint32
 }
 
 func NewTableMetadata(schema *schema.Schema, name string, table *access.TableHeap, oid uint32) *TableMetadata {
@@ -26,28 +35,73 @@ func NewTableMetadata(schema *schema.Schema, name string, table *access.TableHea
 	ret.name = name
 	ret.table = table
 	ret.oid = oid
+	ret.mutex = new(sync.RWMutex)
 
 	indexes := make([]index.Index, 0)
 	for idx, column_ := range schema.GetColumns() {
-		if column_.HasIndex() {
-			im := index.NewIndexMetadata(column_.GetColumnName()+"_index", name, schema, []uint32{uint32(idx)})
-			// TODO: (SDB) index bucket size is 50 (auto size extending is needed...)
-			//             note: one bucket uses one page for storing index key/value pairs.
-			indexes = append(indexes, index.NewLinearProbeHashTableIndex(im, table.GetBufferPoolManager(), uint32(idx), common.BucketSize))
+		// metadata without table heap is used for validation of definitions. it has no index
+		if column_.HasIndex() && table != nil {
+			im := newIndexMetadata(schema, name, idx)
+			indexes = append(indexes, newIndex(im, column_.GetIndexKind(), table.GetBufferPoolManager()))
 		} else {
 			indexes = append(indexes, nil)
 		}
 	}
 
 	ret.indexes = indexes
+	ret.multiColumnIndexes = make([]index.Index, 0)
 
 	return ret
 }
 
+// newIndexMetadata returns metadata of index of single column which is defined with flags of the column
+func newIndexMetadata(schema_ *schema.Schema, tableName string, colIdx int) *index.IndexMetadata {
+	column_ := schema_.GetColumn(uint32(colIdx))
+	ret := index.NewIndexMetadata(column_.GetColumnName()+"_index", tableName, schema_, []uint32{uint32(colIdx)})
+	ret.SetConstraint(column_.GetIndexConstraint())
+	return ret
+}
+
+// newIndex creates empty index of the kind
+func newIndex(im *index.IndexMetadata, kind column.IndexKind, bpm *buffer.BufferPoolManager) index.Index {
+	colIdx := im.GetKeyAttrs()[0]
+	switch kind {
+	case column.IndexKindBTree:
+		return index.NewBPlusTreeIndex(im, bpm, colIdx)
+	default:
+		// note: hash index starts with common.BucketSize blocks and grows when it becomes full
+		return index.NewLinearProbeHashTableIndex(im, bpm, colIdx, common.BucketSize)
+	}
+}
+
+// openIndex opens index stored in pages whose header page is headerPageId.
+// error is returned when the pages are not valid index of the kind
+func openIndex(im *index.IndexMetadata, kind column.IndexKind, bpm *buffer.BufferPoolManager, headerPageId types.PageID) (index.Index, error) {
+	colIdx := im.GetKeyAttrs()[0]
+	switch kind {
+	case column.IndexKindBTree:
+		return index.OpenBPlusTreeIndex(im, bpm, colIdx, headerPageId)
+	default:
+		return index.OpenLinearProbeHashTableIndex(im, bpm, colIdx, headerPageId)
+	}
+}
+
+// indexKindOf returns kind of the index object
+func indexKindOf(index_ index.Index) column.IndexKind {
+	if _, ok := index_.(*index.BPlusTreeIndex); ok {
+		return column.IndexKindBTree
+	}
+	return column.IndexKindHash
+}
+
 func (t *TableMetadata) Schema() *schema.Schema {
 	return t.schema
 }
 
+func (t *TableMetadata) Name() string {
+	return t.name
+}
+
 func (t *TableMetadata) OID() uint32 {
 	return t.oid
 }
@@ -57,6 +111,8 @@ func (t *TableMetadata) Table() *access.TableHeap {
 }
 
 func (t *TableMetadata) GetIndex(colIndex int) index.Index {
+	t.mutex.RLock()
+	defer t.mutex.RUnlock()
 	ret := t.indexes[colIndex]
 	if ret == nil {
 		return nil
@@ -68,3 +124,59 @@ func (t *TableMetadata) GetIndex(colIndex int) index.Index {
 func (t *TableMetadata) GetColumnNum() uint32 {
 	return t.schema.GetColumnCount()
 }
+
+// GetIndexes returns all indexes of the table including indexes of multiple columns
+func (t *TableMetadata) GetIndexes() []index.Index {
+	t.mutex.RLock()
+	defer t.mutex.RUnlock()
+	ret := make([]index.Index, 0)
+	for _, index_ := range t.indexes {
+		if index_ != nil {
+			ret = append(ret, index_)
+		}
+	}
+	return append(ret, t.multiColumnIndexes...)
+}
+
+// GetMultiColumnIndexes returns indexes whose key consists of multiple columns
+func (t *TableMetadata) GetMultiColumnIndexes() []index.Index {
+	t.mutex.RLock()
+	defer t.mutex.RUnlock()
+	return append(make([]index.Index, 0, len(t.multiColumnIndexes)), t.multiColumnIndexes...)
+}
+
+// setIndex replaces index of the column. nil means the column has no index
+func (t *TableMetadata) setIndex(colIdx uint32, index_ index.Index) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.indexes[colIdx] = index_
+}
+
+func (t *TableMetadata) addMultiColumnIndex(index_ index.Index) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.multiColumnIndexes = append(t.multiColumnIndexes, index_)
+}
+
+// removeMultiColumnIndex returns false when the index is not an index of multiple columns of the table
+func (t *TableMetadata) removeMultiColumnIndex(index_ index.Index) bool {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	for ii, multiColumnIndex := range t.multiColumnIndexes {
+		if multiColumnIndex == index_ {
+			t.multiColumnIndexes = append(t.multiColumnIndexes[:ii:ii], t.multiColumnIndexes[ii+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// GetIndexByName returns nil when the table has no index of the name
+func (t *TableMetadata) GetIndexByName(name string) index.Index {
+	for _, index_ := range t.GetIndexes() {
+		if *index_.GetName() == name {
+			return index_
+		}
+	}
+	return nil
+}
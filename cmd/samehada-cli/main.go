@@ -0,0 +1,53 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/ryogrid/SamehadaDB/samehada"
+)
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "usage: %s [-f script.sql] <db file>\n", os.Args[0])
+	flag.PrintDefaults()
+}
+
+func main() {
+	scriptPath := flag.String("f", "", "execute statements in the file and exit")
+	flag.Usage = usage
+	flag.Parse()
+	if flag.NArg() != 1 {
+		usage()
+		os.Exit(2)
+	}
+
+	db, err := samehada.Open(flag.Arg(0))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "can't open database: %v\n", err)
+		os.Exit(1)
+	}
+	defer db.Close()
+
+	input := os.Stdin
+	if *scriptPath != "" {
+		input, err = os.Open(*scriptPath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "can't open script: %v\n", err)
+			return
+		}
+		defer input.Close()
+	}
+
+	// prompt is shown only when user types statements on terminal
+	isInteractive := false
+	if fileInfo, err := input.Stat(); err == nil && (fileInfo.Mode()&os.ModeCharDevice) != 0 {
+		isInteractive = true
+	}
+
+	shell := NewShell(db, os.Stdout, isInteractive)
+	if shell.Run(input) > 0 && !isInteractive {
+		db.Close()
+		os.Exit(1)
+	}
+}
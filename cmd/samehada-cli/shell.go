@@ -0,0 +1,290 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/ryogrid/SamehadaDB/catalog"
+	"github.com/ryogrid/SamehadaDB/parser"
+	"github.com/ryogrid/SamehadaDB/samehada"
+	"github.com/ryogrid/SamehadaDB/storage/index"
+	"github.com/ryogrid/SamehadaDB/storage/table/column"
+	"github.com/ryogrid/SamehadaDB/types"
+)
+
+const prompt = "samehada> "
+const continuationPrompt = "       -> "
+
+const helpMessage = `.tables             list tables
+.schema <table>      show definition of the table
+.indexes             list indexes
+.checkpoint          flush all dirty pages and log
+.quit                exit this shell
+`
+
+/**
+ * Shell reads SQL statements and meta-commands (starting with ".") from input,
+ * executes them against the database and prints results.
+ */
+type Shell struct {
+	db_            *samehada.SamehadaDB
+	out_           io.Writer
+	isInteractive_ bool
+	// number of statements which failed
+	errNum_ int
+}
+
+func NewShell(db *samehada.SamehadaDB, out io.Writer, isInteractive bool) *Shell {
+	return &Shell{db, out, isInteractive, 0}
+}
+
+// Run processes input until EOF or .quit and returns number of failed statements
+func (s *Shell) Run(input io.Reader) int {
+	scanner := bufio.NewScanner(input)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+
+	pending := ""
+	stmtNum := 0
+	s.showPrompt(pending)
+	for scanner.Scan() {
+		line := scanner.Text()
+		trimmed := strings.TrimSpace(line)
+		if strings.TrimSpace(pending) == "" && strings.HasPrefix(trimmed, ".") {
+			if !s.execMetaCommand(trimmed) {
+				return s.errNum_
+			}
+			pending = ""
+			s.showPrompt(pending)
+			continue
+		}
+
+		var stmts []string
+		stmts, pending = parser.SplitStatements(pending + line + "\n")
+		for _, stmt := range stmts {
+			stmtNum++
+			s.execStatement(stmtNum, stmt)
+		}
+		s.showPrompt(pending)
+	}
+
+	// last statement may not be terminated with ";"
+	if strings.TrimSpace(pending) != "" {
+		stmtNum++
+		s.execStatement(stmtNum, pending)
+	}
+	if s.isInteractive_ {
+		fmt.Fprintln(s.out_)
+	}
+	return s.errNum_
+}
+
+func (s *Shell) showPrompt(pending string) {
+	if !s.isInteractive_ {
+		return
+	}
+	if strings.TrimSpace(pending) == "" {
+		fmt.Fprint(s.out_, prompt)
+	} else {
+		fmt.Fprint(s.out_, continuationPrompt)
+	}
+}
+
+func (s *Shell) execStatement(stmtNum int, stmt string) {
+	result, err := s.db_.ExecuteSQL(stmt)
+	if err != nil {
+		s.errNum_++
+		fmt.Fprintf(s.out_, "Error at statement %d: %v\n", stmtNum, err)
+		return
+	}
+
+	if len(result.ColumnNames) == 0 {
+		fmt.Fprintf(s.out_, "OK, %d rows affected\n", result.RowsAffected)
+		return
+	}
+	s.printTable(result)
+}
+
+// printTable prints result rows aligned with column headers
+func (s *Shell) printTable(result *samehada.Result) {
+	cells := make([][]string, 0, len(result.Rows))
+	widths := make([]int, len(result.ColumnNames))
+	for ii, name := range result.ColumnNames {
+		widths[ii] = utf8.RuneCountInString(name)
+	}
+	for _, row := range result.Rows {
+		line := make([]string, len(row))
+		for ii := range row {
+			line[ii] = formatValue(&row[ii])
+			if utf8.RuneCountInString(line[ii]) > widths[ii] {
+				widths[ii] = utf8.RuneCountInString(line[ii])
+			}
+		}
+		cells = append(cells, line)
+	}
+
+	printLine := func(line []string) {
+		padded := make([]string, len(line))
+		for ii, cell := range line {
+			padded[ii] = cell + strings.Repeat(" ", widths[ii]-utf8.RuneCountInString(cell))
+		}
+		fmt.Fprintln(s.out_, " "+strings.Join(padded, " | "))
+	}
+
+	printLine(result.ColumnNames)
+	separators := make([]string, len(widths))
+	for ii, width := range widths {
+		separators[ii] = strings.Repeat("-", width+2)
+	}
+	fmt.Fprintln(s.out_, strings.Join(separators, "+"))
+	for _, line := range cells {
+		printLine(line)
+	}
+	if len(cells) == 1 {
+		fmt.Fprintln(s.out_, "(1 row)")
+	} else {
+		fmt.Fprintf(s.out_, "(%d rows)\n", len(cells))
+	}
+}
+
+func formatValue(val *types.Value) string {
+	if val.IsNull() {
+		return "NULL"
+	}
+	switch val.ValueType() {
+	case types.Integer:
+		return strconv.Itoa(int(val.ToInteger()))
+	case types.Float:
+		return strconv.FormatFloat(float64(val.ToFloat()), 'g', -1, 32)
+	case types.Boolean:
+		return strconv.FormatBool(val.ToBoolean())
+	case types.Varchar:
+		return val.ToVarchar()
+	}
+	return ""
+}
+
+func typeName(typeID types.TypeID) string {
+	switch typeID {
+	case types.Integer:
+		return "INT"
+	case types.Float:
+		return "FLOAT"
+	case types.Boolean:
+		return "BOOLEAN"
+	case types.Varchar:
+		return "VARCHAR"
+	}
+	return "UNKNOWN"
+}
+
+// execMetaCommand executes a meta-command. false is returned when shell should exit
+func (s *Shell) execMetaCommand(line string) bool {
+	fields := strings.Fields(line)
+	switch fields[0] {
+	case ".quit", ".exit":
+		return false
+	case ".help":
+		fmt.Fprint(s.out_, helpMessage)
+	case ".tables":
+		for _, tableMetadata := range s.userTables() {
+			fmt.Fprintln(s.out_, tableMetadata.Name())
+		}
+	case ".schema":
+		if len(fields) != 2 {
+			fmt.Fprintln(s.out_, "usage: .schema <table>")
+			break
+		}
+		tableMetadata := s.db_.GetCatalog().GetTableByName(fields[1])
+		if tableMetadata == nil || catalog.IsSystemCatalog(tableMetadata.OID()) {
+			fmt.Fprintf(s.out_, "table not found: %s\n", fields[1])
+			break
+		}
+		s.printSchema(tableMetadata)
+	case ".indexes":
+		for _, tableMetadata := range s.userTables() {
+			for _, index_ := range tableMetadata.GetIndexes() {
+				fmt.Fprintf(s.out_, "%s ON %s (%s)\n", *index_.GetName(), tableMetadata.Name(), keyColumnNames(tableMetadata, index_))
+			}
+		}
+	case ".checkpoint":
+		checkpoint_manager := s.db_.GetCheckpointManager()
+		checkpoint_manager.BeginCheckpoint()
+		checkpoint_manager.EndCheckpoint()
+		fmt.Fprintln(s.out_, "OK")
+	default:
+		fmt.Fprintf(s.out_, "unknown command: %s (enter .help for usage)\n", fields[0])
+	}
+	return true
+}
+
+func (s *Shell) userTables() []*catalog.TableMetadata {
+	ret := make([]*catalog.TableMetadata, 0)
+	for _, tableMetadata := range s.db_.GetCatalog().GetAllTables() {
+		if !catalog.IsSystemCatalog(tableMetadata.OID()) {
+			ret = append(ret, tableMetadata)
+		}
+	}
+	return ret
+}
+
+func (s *Shell) printSchema(tableMetadata *catalog.TableMetadata) {
+	defs := make([]string, 0)
+	for _, col := range tableMetadata.Schema().GetColumns() {
+		def := col.GetColumnName() + " " + typeName(col.GetType())
+		if !col.IsNullable() {
+			def += " NOT NULL"
+		}
+		if defaultValue := col.GetDefaultValue(); defaultValue != nil {
+			if defaultValue.ValueType() == types.Varchar {
+				def += " DEFAULT '" + formatValue(defaultValue) + "'"
+			} else {
+				def += " DEFAULT " + formatValue(defaultValue)
+			}
+		}
+		if col.GetCheckExpr() != "" {
+			def += " CHECK (" + col.GetCheckExpr() + ")"
+		}
+		defs = append(defs, def)
+	}
+	for _, col := range tableMetadata.Schema().GetColumns() {
+		if fk := col.GetForeignKey(); fk != nil {
+			def := "FOREIGN KEY (" + col.GetColumnName() + ") REFERENCES "
+			def += s.db_.GetCatalog().GetTableByOID(fk.GetRefTableOID()).Name() + "(" + fk.GetRefColumnName() + ")"
+			switch fk.GetOnDelete() {
+			case column.ForeignKeyActionCascade:
+				def += " ON DELETE CASCADE"
+			case column.ForeignKeyActionSetNull:
+				def += " ON DELETE SET NULL"
+			}
+			defs = append(defs, def)
+		}
+	}
+	for _, index_ := range tableMetadata.GetIndexes() {
+		def := "INDEX "
+		switch index_.GetMetadata().GetConstraint() {
+		case column.IndexConstraintUnique:
+			def = "UNIQUE INDEX "
+		case column.IndexConstraintPrimaryKey:
+			def = "PRIMARY KEY "
+		}
+		def += *index_.GetName() + " (" + keyColumnNames(tableMetadata, index_) + ")"
+		if _, ok := index_.(*index.BPlusTreeIndex); ok {
+			def += " USING BTREE"
+		}
+		defs = append(defs, def)
+	}
+	fmt.Fprintf(s.out_, "CREATE TABLE %s(%s);\n", tableMetadata.Name(), strings.Join(defs, ", "))
+}
+
+// keyColumnNames returns comma separated names of key columns of the index
+func keyColumnNames(tableMetadata *catalog.TableMetadata, index_ index.Index) string {
+	names := make([]string, 0)
+	for _, colIdx := range index_.GetKeyAttrs() {
+		names = append(names, tableMetadata.Schema().GetColumn(colIdx).GetColumnName())
+	}
+	return strings.Join(names, ", ")
+}
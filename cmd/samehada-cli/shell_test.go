@@ -0,0 +1,55 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/ryogrid/SamehadaDB/samehada"
+	testingpkg "github.com/ryogrid/SamehadaDB/testing"
+)
+
+func TestShellScript(t *testing.T) {
+	os.Remove("test.db")
+	os.Remove("test.log")
+	defer os.Remove("test.db")
+	defer os.Remove("test.log")
+
+	db, err := samehada.Open("test.db")
+	testingpkg.Ok(t, err)
+	defer db.Close()
+
+	script := `CREATE TABLE name_age_list(id INT PRIMARY KEY, name VARCHAR(256) NOT NULL DEFAULT 'unknown', age INT CHECK (age >= 0), index name_age_idx (name, age) USING BTREE);
+INSERT INTO name_age_list(id, name, age) VALUES (1, 'Ryo', 30),
+  (2, 'Yuichiro', NULL);
+SELECT no_column FROM name_age_list;
+.tables
+.schema name_age_list
+.indexes
+SELECT id, name, age FROM name_age_list ORDER BY id;
+.checkpoint
+.quit
+SELECT id FROM name_age_list;
+`
+	out := new(bytes.Buffer)
+	shell := NewShell(db, out, false)
+	errNum := shell.Run(strings.NewReader(script))
+	testingpkg.Equals(t, 1, errNum)
+
+	expected := `OK, 0 rows affected
+OK, 2 rows affected
+Error at statement 3: column not found
+name_age_list
+CREATE TABLE name_age_list(id INT, name VARCHAR NOT NULL DEFAULT 'unknown', age INT CHECK (` + "`age` >= 0" + `), PRIMARY KEY id_index (id), INDEX name_age_idx (name, age) USING BTREE);
+id_index ON name_age_list (id)
+name_age_idx ON name_age_list (name, age)
+ id | name     | age 
+----+----------+------
+ 1  | Ryo      | 30  
+ 2  | Yuichiro | NULL
+(2 rows)
+OK
+`
+	testingpkg.Equals(t, expected, out.String())
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/ryogrid/SamehadaDB/samehada"
+	"github.com/ryogrid/SamehadaDB/server/http_server"
+	"github.com/ryogrid/SamehadaDB/server/mysql_server"
+	"github.com/ryogrid/SamehadaDB/server/pg_server"
+)
+
+// server is implemented by servers of each protocol.
+// Close returns after transactions of all sessions finished, so db can be closed after it
+type server interface {
+	ListenAndServe(addr string) error
+	Close() error
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "usage: %s [-pg addr] [-mysql addr] [-http addr] <db file>\n", os.Args[0])
+	flag.PrintDefaults()
+}
+
+func main() {
+	pgAddr := flag.String("pg", "127.0.0.1:5432", "address which PostgreSQL protocol server listens on (empty disables it)")
+	mysqlAddr := flag.String("mysql", "", "address which MySQL protocol server listens on (empty disables it)")
+	httpAddr := flag.String("http", "", "address which HTTP (REST) server listens on (empty disables it)")
+	flag.Usage = usage
+	flag.Parse()
+	if flag.NArg() != 1 || (*pgAddr == "" && *mysqlAddr == "" && *httpAddr == "") {
+		usage()
+		os.Exit(2)
+	}
+
+	db, err := samehada.Open(flag.Arg(0))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "can't open database: %v\n", err)
+		os.Exit(1)
+	}
+
+	servers := make([]server, 0)
+	errCh := make(chan error, 3)
+	start := func(srv server, addr string) {
+		servers = append(servers, srv)
+		go func() {
+			errCh <- srv.ListenAndServe(addr)
+		}()
+	}
+	if *pgAddr != "" {
+		start(pg_server.NewPgServer(db), *pgAddr)
+	}
+	if *mysqlAddr != "" {
+		start(mysql_server.NewMySQLServer(db), *mysqlAddr)
+	}
+	if *httpAddr != "" {
+		start(http_server.NewHttpServer(db), *httpAddr)
+	}
+
+	// database file is closed cleanly on Ctrl-C
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, os.Interrupt, syscall.SIGTERM)
+	select {
+	case err = <-errCh:
+		fmt.Fprintf(os.Stderr, "server stopped: %v\n", err)
+	case <-sigCh:
+	}
+
+	for _, srv := range servers {
+		srv.Close()
+	}
+	db.Close()
+	if err != nil {
+		os.Exit(1)
+	}
+}
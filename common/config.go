@@ -7,11 +7,17 @@ import (
 	"time"
 )
 
-var CycleDetectionInterval time.Duration
+var CycleDetectionInterval time.Duration = 50 * time.Millisecond
 var EnableLogging bool = false
 var LogTimeout time.Duration
 var EnableDebug bool = false
 
+// default time which transactions wait for a lock held by other transaction
+var LockWaitTimeout time.Duration = 5 * time.Second
+
+// default number of row locks in a table held by a transaction which causes escalation to table lock
+var LockEscalationThreshold int = 1000
+
 const (
 	// invalid page id
 	InvalidPageID = -1
@@ -27,7 +33,7 @@ const (
 	BufferPoolSize = 10
 	// size of a log buffer in byte
 	LogBufferSize = ((BufferPoolSize + 1) * PageSize)
-	// size of extendible hash bucket
+	// initial number of blocks of hash index. the index grows when it becomes full
 	BucketSize = 50
 )
 
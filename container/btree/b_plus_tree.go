@@ -0,0 +1,484 @@
+package btree
+
+import (
+	"bytes"
+	"encoding/binary"
+	"unsafe"
+
+	"github.com/ryogrid/SamehadaDB/common"
+	"github.com/ryogrid/SamehadaDB/errors"
+	"github.com/ryogrid/SamehadaDB/storage/buffer"
+	"github.com/ryogrid/SamehadaDB/storage/page"
+	"github.com/ryogrid/SamehadaDB/types"
+)
+
+const ErrKeyTooLong = errors.Error("key is too long for B+tree")
+const ErrDuplicatedEntry = errors.Error("duplicated values on the same key are not allowed")
+const ErrBrokenTree = errors.Error("pages of B+tree are broken")
+
+// size of RID which is appended to key for making entries unique
+const sizeRID = 8
+
+// MaxKeySize is max length of key which can be inserted
+const MaxKeySize = page.BPlusTreeMaxKeySize - sizeRID
+
+/**
+ * Implementation of B+tree that is backed by a buffer pool manager.
+ * Non-unique keys are supported. RID is appended to each key in the tree, so all
+ * entries are unique and an entry is deleted exactly.
+ *
+ * keys must be byte sequences which are ordered by bytes.Compare in the order
+ * of original values and which are not prefix of other keys (prefix free).
+ *
+ * concurrent accesses are serialized with latch crabbing: readers hold read latch of
+ * a node until read latch of the child is acquired. writers hold write latches of
+ * ancestors which may be modified by split of the child.
+ *
+ * TODO: (SDB) nodes are not merged or redistributed on deletion. empty leaves remain in the tree
+ */
+type BPlusTree struct {
+	headerPageId types.PageID
+	rootPageId   types.PageID
+	bpm          *buffer.BufferPoolManager
+	// protects rootPageId. this is treated as the latch of parent of root node on crabbing
+	root_latch common.ReaderWriterLatch
+}
+
+func NewBPlusTree(bpm *buffer.BufferPoolManager) *BPlusTree {
+	header := bpm.NewPage()
+	root := bpm.NewPage()
+	rootPage := (*page.BPlusTreeNodePage)(unsafe.Pointer(root.Data()))
+	rootPage.Init(root.ID(), page.BPlusTreeLeafNode)
+	headerPage := (*page.BPlusTreeHeaderPage)(unsafe.Pointer(header.Data()))
+	headerPage.Init(header.ID())
+	headerPage.SetRootPageId(root.ID())
+	bpm.UnpinPage(root.ID(), true)
+	bpm.UnpinPage(header.ID(), true)
+
+	return &BPlusTree{header.ID(), root.ID(), bpm, common.NewRWLatch()}
+}
+
+// OpenBPlusTree opens a B+tree which is already stored in pages.
+// ErrBrokenTree is returned when header page or root node is not valid
+func OpenBPlusTree(bpm *buffer.BufferPoolManager, headerPageId types.PageID) (*BPlusTree, error) {
+	header := bpm.FetchPage(headerPageId)
+	if header == nil {
+		return nil, ErrBrokenTree
+	}
+	headerPage := (*page.BPlusTreeHeaderPage)(unsafe.Pointer(header.Data()))
+	isValidHeader := headerPage.IsValid(headerPageId)
+	rootPageId := headerPage.GetRootPageId()
+	bpm.UnpinPage(headerPageId, false)
+	if !isValidHeader || rootPageId == common.InvalidPageID {
+		return nil, ErrBrokenTree
+	}
+
+	root := bpm.FetchPage(rootPageId)
+	if root == nil {
+		return nil, ErrBrokenTree
+	}
+	rootPage := (*page.BPlusTreeNodePage)(unsafe.Pointer(root.Data()))
+	isValidRoot := rootPage.GetPageId() == rootPageId
+	bpm.UnpinPage(rootPageId, false)
+	if !isValidRoot {
+		return nil, ErrBrokenTree
+	}
+
+	return &BPlusTree{headerPageId, rootPageId, bpm, common.NewRWLatch()}, nil
+}
+
+// Clear removes all entries. pages of old nodes are released, new empty root is allocated
+// and header page is reused
+func (tree *BPlusTree) Clear() {
+	tree.root_latch.WLock()
+	defer tree.root_latch.WUnlock()
+
+	tree.dropNode(tree.rootPageId)
+	root := tree.bpm.NewPage()
+	rootPage := (*page.BPlusTreeNodePage)(unsafe.Pointer(root.Data()))
+	rootPage.Init(root.ID(), page.BPlusTreeLeafNode)
+	tree.bpm.UnpinPage(root.ID(), true)
+
+	header := tree.bpm.FetchPage(tree.headerPageId)
+	headerPage := (*page.BPlusTreeHeaderPage)(unsafe.Pointer(header.Data()))
+	headerPage.Init(tree.headerPageId)
+	headerPage.SetRootPageId(root.ID())
+	tree.bpm.UnpinPage(tree.headerPageId, true)
+	tree.rootPageId = root.ID()
+}
+
+// Drop releases all pages of the tree including header page.
+// the tree must not be used after calling this
+func (tree *BPlusTree) Drop() {
+	tree.root_latch.WLock()
+	defer tree.root_latch.WUnlock()
+
+	tree.dropNode(tree.rootPageId)
+	tree.bpm.DeletePage(tree.headerPageId)
+	tree.rootPageId = common.InvalidPageID
+}
+
+// dropNode releases pages of the node and its descendants
+func (tree *BPlusTree) dropNode(pageId types.PageID) {
+	pg := tree.bpm.FetchPage(pageId)
+	common.SH_Assert(pg != nil, "B+tree node page can't be fetched")
+	node := (*page.BPlusTreeNodePage)(unsafe.Pointer(pg.Data()))
+	children := make([]types.PageID, 0)
+	if !node.IsLeaf() {
+		children = append(children, node.GetLeftmostChild())
+		for ii := 0; ii < node.NumKeys(); ii++ {
+			children = append(children, node.ChildAt(ii))
+		}
+	}
+	tree.bpm.UnpinPage(pageId, false)
+	for _, child := range children {
+		tree.dropNode(child)
+	}
+	tree.bpm.DeletePage(pageId)
+}
+
+func (tree *BPlusTree) GetHeaderPageId() types.PageID {
+	return tree.headerPageId
+}
+
+// latched node on descending
+type latchedNode struct {
+	pg   *page.Page
+	node *page.BPlusTreeNodePage
+}
+
+func (tree *BPlusTree) fetchNode(pageId types.PageID) latchedNode {
+	pg := tree.bpm.FetchPage(pageId)
+	common.SH_Assert(pg != nil, "B+tree node page can't be fetched")
+	return latchedNode{pg, (*page.BPlusTreeNodePage)(unsafe.Pointer(pg.Data()))}
+}
+
+func (tree *BPlusTree) releaseRead(n latchedNode) {
+	n.pg.RUnlatch()
+	tree.bpm.UnpinPage(n.pg.ID(), false)
+}
+
+func (tree *BPlusTree) releaseWrite(n latchedNode, isDirty bool) {
+	n.pg.WUnlatch()
+	tree.bpm.UnpinPage(n.pg.ID(), isDirty)
+}
+
+func makeEntryKey(key []byte, value uint64) []byte {
+	ret := make([]byte, len(key)+sizeRID)
+	copy(ret, key)
+	binary.BigEndian.PutUint64(ret[len(key):], value)
+	return ret
+}
+
+func entryValue(entryKey []byte) uint64 {
+	return binary.BigEndian.Uint64(entryKey[len(entryKey)-sizeRID:])
+}
+
+// findLeafForRead returns read latched leaf which key should be stored in
+func (tree *BPlusTree) findLeafForRead(key []byte) latchedNode {
+	tree.root_latch.RLock()
+	cur := tree.fetchNode(tree.rootPageId)
+	cur.pg.RLatch()
+	tree.root_latch.RUnlock()
+
+	for !cur.node.IsLeaf() {
+		child := tree.fetchNode(cur.node.LookupChild(key))
+		child.pg.RLatch()
+		tree.releaseRead(cur)
+		cur = child
+	}
+	return cur
+}
+
+// findLeafForWrite returns write latched leaf which key should be stored in.
+// internal nodes are latched with read latch (optimistic descending)
+func (tree *BPlusTree) findLeafForWrite(key []byte) latchedNode {
+	tree.root_latch.RLock()
+	cur := tree.fetchNode(tree.rootPageId)
+	if cur.node.IsLeaf() {
+		cur.pg.WLatch()
+		tree.root_latch.RUnlock()
+		return cur
+	}
+	cur.pg.RLatch()
+	tree.root_latch.RUnlock()
+
+	for {
+		child := tree.fetchNode(cur.node.LookupChild(key))
+		// level of leaves is fixed while parent is latched because splits don't change height of subtree
+		if child.node.IsLeaf() {
+			child.pg.WLatch()
+			tree.releaseRead(cur)
+			return child
+		}
+		child.pg.RLatch()
+		tree.releaseRead(cur)
+		cur = child
+	}
+}
+
+// Insert inserts key and value (packed RID) pair
+func (tree *BPlusTree) Insert(key []byte, value uint64) error {
+	if len(key) > MaxKeySize {
+		return ErrKeyTooLong
+	}
+	entryKey := makeEntryKey(key, value)
+
+	// most insertions don't split leaf. only the leaf is write latched on the case
+	leaf := tree.findLeafForWrite(entryKey)
+	idx := leaf.node.LowerBound(entryKey)
+	if idx < leaf.node.NumKeys() && bytes.Equal(leaf.node.KeyAt(idx), entryKey) {
+		tree.releaseWrite(leaf, false)
+		return ErrDuplicatedEntry
+	}
+	if leaf.node.InsertAt(idx, entryKey, common.InvalidPageID) {
+		tree.releaseWrite(leaf, true)
+		return nil
+	}
+	tree.releaseWrite(leaf, false)
+
+	return tree.insertPessimistic(entryKey)
+}
+
+// isSafeForInsert returns true when the node is not split by an insertion into it
+func isSafeForInsert(node *page.BPlusTreeNodePage) bool {
+	return node.FreeSpace() >= page.BPlusTreeMaxEntrySizeInNode
+}
+
+// insertPessimistic inserts entry with write latches of nodes which may be split
+func (tree *BPlusTree) insertPessimistic(entryKey []byte) error {
+	tree.root_latch.WLock()
+	isRootLatched := true
+	ancestors := make([]latchedNode, 0)
+	releaseAncestors := func() {
+		if isRootLatched {
+			tree.root_latch.WUnlock()
+			isRootLatched = false
+		}
+		for _, n := range ancestors {
+			tree.releaseWrite(n, false)
+		}
+		ancestors = ancestors[:0]
+	}
+
+	cur := tree.fetchNode(tree.rootPageId)
+	cur.pg.WLatch()
+	for {
+		if isSafeForInsert(cur.node) {
+			releaseAncestors()
+		}
+		if cur.node.IsLeaf() {
+			break
+		}
+		ancestors = append(ancestors, cur)
+		cur = tree.fetchNode(cur.node.LookupChild(entryKey))
+		cur.pg.WLatch()
+	}
+
+	idx := cur.node.LowerBound(entryKey)
+	if idx < cur.node.NumKeys() && bytes.Equal(cur.node.KeyAt(idx), entryKey) {
+		tree.releaseWrite(cur, false)
+		releaseAncestors()
+		return ErrDuplicatedEntry
+	}
+	if cur.node.InsertAt(idx, entryKey, common.InvalidPageID) {
+		tree.releaseWrite(cur, true)
+		releaseAncestors()
+		return nil
+	}
+
+	// split nodes from leaf to upper. ancestors holds all nodes which are split
+	sepKey, newChild := tree.split(cur, entryKey, common.InvalidPageID)
+	tree.releaseWrite(cur, true)
+	for len(ancestors) > 0 {
+		parent := ancestors[len(ancestors)-1]
+		ancestors = ancestors[:len(ancestors)-1]
+		idx := parent.node.UpperBound(sepKey)
+		if parent.node.InsertAt(idx, sepKey, newChild) {
+			tree.releaseWrite(parent, true)
+			releaseAncestors()
+			return nil
+		}
+		sepKey, newChild = tree.split(parent, sepKey, newChild)
+		tree.releaseWrite(parent, true)
+	}
+
+	// root was split
+	common.SH_Assert(isRootLatched, "root latch must be held on root split")
+	tree.growRoot(sepKey, newChild)
+	releaseAncestors()
+	return nil
+}
+
+// split inserts entry to the full node and moves upper half of entries to new right node.
+// key which separates the nodes and new node are returned
+func (tree *BPlusTree) split(n latchedNode, key []byte, child types.PageID) ([]byte, types.PageID) {
+	entries := n.node.Entries()
+	idx := n.node.UpperBound(key)
+	entries = append(entries, page.BPlusTreeNodeEntry{})
+	copy(entries[idx+1:], entries[idx:])
+	entries[idx] = page.BPlusTreeNodeEntry{Key: key, Child: child}
+
+	// split by size of entries
+	total := 0
+	for _, entry := range entries {
+		total += n.node.EntrySize(entry.Key)
+	}
+	// right node of leaf split must have one entry at least and one more
+	// entry is needed on internal node split because middle entry moves to parent
+	maxMid := len(entries) - 1
+	if !n.node.IsLeaf() {
+		maxMid = len(entries) - 2
+	}
+	leftSize := 0
+	mid := 0
+	for mid < maxMid && leftSize+n.node.EntrySize(entries[mid].Key) <= total/2 {
+		leftSize += n.node.EntrySize(entries[mid].Key)
+		mid++
+	}
+	if mid == 0 {
+		mid = 1
+	}
+
+	newPg := tree.bpm.NewPage()
+	common.SH_Assert(newPg != nil, "B+tree node page can't be allocated")
+	newNode := (*page.BPlusTreeNodePage)(unsafe.Pointer(newPg.Data()))
+
+	var sepKey []byte
+	if n.node.IsLeaf() {
+		newNode.Init(newPg.ID(), page.BPlusTreeLeafNode)
+		sepKey = entries[mid].Key
+		newNode.SetEntries(entries[mid:])
+		newNode.SetNextPageId(n.node.GetNextPageId())
+		n.node.SetNextPageId(newPg.ID())
+	} else {
+		// middle key moves to parent and its child becomes leftmost child of new node
+		newNode.Init(newPg.ID(), page.BPlusTreeInternalNode)
+		sepKey = entries[mid].Key
+		newNode.SetLeftmostChild(entries[mid].Child)
+		newNode.SetEntries(entries[mid+1:])
+	}
+	n.node.SetEntries(entries[:mid])
+	tree.bpm.UnpinPage(newPg.ID(), true)
+
+	return sepKey, newPg.ID()
+}
+
+// growRoot creates new root which has old root and newChild. root latch must be held
+func (tree *BPlusTree) growRoot(sepKey []byte, newChild types.PageID) {
+	newRoot := tree.bpm.NewPage()
+	common.SH_Assert(newRoot != nil, "B+tree node page can't be allocated")
+	rootNode := (*page.BPlusTreeNodePage)(unsafe.Pointer(newRoot.Data()))
+	rootNode.Init(newRoot.ID(), page.BPlusTreeInternalNode)
+	rootNode.SetLeftmostChild(tree.rootPageId)
+	rootNode.InsertAt(0, sepKey, newChild)
+	tree.bpm.UnpinPage(newRoot.ID(), true)
+
+	header := tree.bpm.FetchPage(tree.headerPageId)
+	headerPage := (*page.BPlusTreeHeaderPage)(unsafe.Pointer(header.Data()))
+	headerPage.SetRootPageId(newRoot.ID())
+	tree.bpm.UnpinPage(tree.headerPageId, true)
+	tree.rootPageId = newRoot.ID()
+}
+
+// Remove deletes key and value pair. deletion doesn't change structure of the tree,
+// so only the leaf is write latched
+func (tree *BPlusTree) Remove(key []byte, value uint64) {
+	entryKey := makeEntryKey(key, value)
+	leaf := tree.findLeafForWrite(entryKey)
+	idx := leaf.node.LowerBound(entryKey)
+	if idx < leaf.node.NumKeys() && bytes.Equal(leaf.node.KeyAt(idx), entryKey) {
+		leaf.node.RemoveAt(idx)
+		tree.releaseWrite(leaf, true)
+		return
+	}
+	tree.releaseWrite(leaf, false)
+}
+
+// GetValue returns values of the key
+func (tree *BPlusTree) GetValue(key []byte) []uint64 {
+	return tree.ScanRange(key, true, key, true)
+}
+
+// ScanRange returns values of keys between low and high in key order.
+// nil low or high means the range is not bounded on the side
+func (tree *BPlusTree) ScanRange(low []byte, lowInclusive bool, high []byte, highInclusive bool) []uint64 {
+	ret := make([]uint64, 0)
+	it := tree.newIterator(low, lowInclusive, high, highInclusive)
+	defer it.Close()
+	for value, ok := it.Next(); ok; value, ok = it.Next() {
+		ret = append(ret, value)
+	}
+	return ret
+}
+
+// bPlusTreeIterator iterates values in a range in key order. leaf which
+// current position is on is read latched until iterator moves to next leaf or is closed,
+// so the tree must not be modified by the iterating thread until it is closed
+type bPlusTreeIterator struct {
+	tree          *BPlusTree
+	leaf          *latchedNode
+	idx           int
+	low           []byte
+	lowInclusive  bool
+	high          []byte
+	highInclusive bool
+}
+
+func (tree *BPlusTree) newIterator(low []byte, lowInclusive bool, high []byte, highInclusive bool) *bPlusTreeIterator {
+	it := &bPlusTreeIterator{tree, nil, 0, low, lowInclusive, high, highInclusive}
+	var leaf latchedNode
+	if low == nil {
+		leaf = tree.findLeafForRead([]byte{})
+		it.idx = 0
+	} else {
+		leaf = tree.findLeafForRead(low)
+		it.idx = leaf.node.LowerBound(low)
+	}
+	it.leaf = &leaf
+	return it
+}
+
+// Next returns next value. false is returned when iteration is finished
+func (it *bPlusTreeIterator) Next() (uint64, bool) {
+	for it.leaf != nil {
+		if it.idx >= it.leaf.node.NumKeys() {
+			nextPageId := it.leaf.node.GetNextPageId()
+			if nextPageId == common.InvalidPageID {
+				it.Close()
+				return 0, false
+			}
+			// latches of leaves are always acquired from left to right
+			next := it.tree.fetchNode(nextPageId)
+			next.pg.RLatch()
+			it.tree.releaseRead(*it.leaf)
+			it.leaf = &next
+			it.idx = 0
+			continue
+		}
+
+		entryKey := it.leaf.node.KeyAt(it.idx)
+		key := entryKey[:len(entryKey)-sizeRID]
+		it.idx++
+		if it.low != nil && !it.lowInclusive && bytes.Equal(key, it.low) {
+			continue
+		}
+		if it.high != nil {
+			cmp := bytes.Compare(key, it.high)
+			if cmp > 0 || (cmp == 0 && !it.highInclusive) {
+				it.Close()
+				return 0, false
+			}
+		}
+		return entryValue(entryKey), true
+	}
+	return 0, false
+}
+
+// Close releases latch of the leaf. it must be called when iteration is stopped before end
+func (it *bPlusTreeIterator) Close() {
+	if it.leaf != nil {
+		it.tree.releaseRead(*it.leaf)
+		it.leaf = nil
+	}
+}
@@ -0,0 +1,144 @@
+package btree
+
+import (
+	"encoding/binary"
+	"math/rand"
+	"sync"
+	"testing"
+
+	"github.com/ryogrid/SamehadaDB/recovery"
+	"github.com/ryogrid/SamehadaDB/storage/buffer"
+	"github.com/ryogrid/SamehadaDB/storage/disk"
+	testingpkg "github.com/ryogrid/SamehadaDB/testing"
+)
+
+// intKey encodes val to ordered and prefix free (fixed length) key
+func intKey(val int) []byte {
+	buf := make([]byte, 4)
+	binary.BigEndian.PutUint32(buf, uint32(int32(val))^(1<<31))
+	return buf
+}
+
+func TestBPlusTree(t *testing.T) {
+	diskManager := disk.NewDiskManagerTest()
+	defer diskManager.ShutDown()
+	// small buffer pool makes nodes evicted and reloaded
+	bpm := buffer.NewBufferPoolManager(uint32(32), diskManager, recovery.NewLogManager(&diskManager))
+
+	tree := NewBPlusTree(bpm)
+	keyNum := 20000
+	keys := rand.Perm(keyNum)
+	for _, key := range keys {
+		// two values for each key
+		testingpkg.Ok(t, tree.Insert(intKey(key-keyNum/2), uint64(key)))
+		testingpkg.Ok(t, tree.Insert(intKey(key-keyNum/2), uint64(key+keyNum)))
+	}
+	testingpkg.Equals(t, ErrDuplicatedEntry, tree.Insert(intKey(0), uint64(keyNum/2)))
+
+	for ii := 0; ii < keyNum; ii += 97 {
+		testingpkg.Equals(t, []uint64{uint64(ii), uint64(ii + keyNum)}, tree.GetValue(intKey(ii-keyNum/2)))
+	}
+	testingpkg.Equals(t, 0, len(tree.GetValue(intKey(keyNum))))
+
+	// range scan returns values in key order
+	values := tree.ScanRange(intKey(-10), true, intKey(10), false)
+	testingpkg.Equals(t, 40, len(values))
+	for ii := 0; ii < 20; ii++ {
+		testingpkg.Equals(t, uint64(ii-10+keyNum/2), values[ii*2])
+	}
+	values = tree.ScanRange(intKey(-10), false, intKey(10), true)
+	testingpkg.Equals(t, 40, len(values))
+	testingpkg.Equals(t, uint64(-9+keyNum/2), values[0])
+	testingpkg.Equals(t, 2*keyNum, len(tree.ScanRange(nil, true, nil, true)))
+	testingpkg.Equals(t, 20, len(tree.ScanRange(intKey(keyNum/2-10), true, nil, true)))
+	testingpkg.Equals(t, 20, len(tree.ScanRange(nil, true, intKey(-keyNum/2+9), true)))
+
+	// remove one value of even keys
+	for ii := 0; ii < keyNum; ii += 2 {
+		tree.Remove(intKey(ii-keyNum/2), uint64(ii))
+	}
+	for ii := 0; ii < keyNum; ii += 101 {
+		if ii%2 == 0 {
+			testingpkg.Equals(t, []uint64{uint64(ii + keyNum)}, tree.GetValue(intKey(ii-keyNum/2)))
+		} else {
+			testingpkg.Equals(t, []uint64{uint64(ii), uint64(ii + keyNum)}, tree.GetValue(intKey(ii-keyNum/2)))
+		}
+	}
+	testingpkg.Equals(t, keyNum+keyNum/2, len(tree.ScanRange(nil, true, nil, true)))
+
+	// reopen from header page
+	reopened, err := OpenBPlusTree(bpm, tree.GetHeaderPageId())
+	testingpkg.Ok(t, err)
+	testingpkg.Equals(t, []uint64{uint64(1), uint64(1 + keyNum)}, reopened.GetValue(intKey(1-keyNum/2)))
+	// page which is not header of B+tree is detected
+	_, err = OpenBPlusTree(bpm, reopened.rootPageId)
+	testingpkg.Equals(t, ErrBrokenTree, err)
+
+	lastPage := bpm.NewPage()
+	bpm.UnpinPage(lastPage.ID(), false)
+	reopened.Clear()
+	testingpkg.Equals(t, 0, len(reopened.ScanRange(nil, true, nil, true)))
+	testingpkg.Ok(t, reopened.Insert(intKey(1), 1))
+	testingpkg.Equals(t, []uint64{uint64(1)}, reopened.GetValue(intKey(1)))
+	// pages of old nodes are reused
+	np := bpm.NewPage()
+	bpm.UnpinPage(np.ID(), false)
+	testingpkg.Assert(t, np.ID() < lastPage.ID(), "page of old node is not reused")
+}
+
+func TestBPlusTreeVariableLengthKey(t *testing.T) {
+	diskManager := disk.NewDiskManagerTest()
+	defer diskManager.ShutDown()
+	bpm := buffer.NewBufferPoolManager(uint32(32), diskManager, recovery.NewLogManager(&diskManager))
+
+	tree := NewBPlusTree(bpm)
+	// long keys make the tree deep
+	keyOf := func(ii int) []byte {
+		key := make([]byte, 200+ii%300)
+		binary.BigEndian.PutUint32(key, uint32(ii))
+		return key
+	}
+	for _, ii := range rand.Perm(3000) {
+		testingpkg.Ok(t, tree.Insert(keyOf(ii), uint64(ii)))
+	}
+	for ii := 0; ii < 3000; ii++ {
+		testingpkg.Equals(t, []uint64{uint64(ii)}, tree.GetValue(keyOf(ii)))
+	}
+	testingpkg.Equals(t, ErrKeyTooLong, tree.Insert(make([]byte, 2000), 0))
+}
+
+func TestBPlusTreeConcurrent(t *testing.T) {
+	diskManager := disk.NewDiskManagerTest()
+	defer diskManager.ShutDown()
+	bpm := buffer.NewBufferPoolManager(uint32(4096), diskManager, recovery.NewLogManager(&diskManager))
+
+	tree := NewBPlusTree(bpm)
+	threadNum := 8
+	keyNumPerThread := 5000
+	wg := new(sync.WaitGroup)
+	for th := 0; th < threadNum; th++ {
+		wg.Add(1)
+		go func(th int) {
+			defer wg.Done()
+			for _, ii := range rand.Perm(keyNumPerThread) {
+				key := ii*threadNum + th
+				tree.Insert(intKey(key), uint64(key))
+				// readers and deleters run concurrently with writers
+				if ii%3 == 0 {
+					tree.Remove(intKey(key), uint64(key))
+				}
+				tree.ScanRange(intKey(key-5), true, intKey(key+5), true)
+			}
+		}(th)
+	}
+	wg.Wait()
+
+	values := tree.ScanRange(nil, true, nil, true)
+	expected := make([]uint64, 0)
+	for key := 0; key < threadNum*keyNumPerThread; key++ {
+		if (key/threadNum)%3 != 0 {
+			expected = append(expected, uint64(key))
+		}
+	}
+	testingpkg.Equals(t, expected, values)
+}
@@ -8,6 +8,7 @@ import (
 	"testing"
 	"unsafe"
 
+	"github.com/ryogrid/SamehadaDB/common"
 	"github.com/ryogrid/SamehadaDB/recovery"
 	"github.com/ryogrid/SamehadaDB/storage/buffer"
 	"github.com/ryogrid/SamehadaDB/storage/disk"
@@ -44,21 +45,24 @@ func TestHashTableHeaderPage(t *testing.T) {
 		}
 	}
 
-	// add a few hypothetical block pages
+	// add a few hypothetical directory pages
 	for i := 0; i < 10; i++ {
-		headerPage.AddBlockPageId(types.PageID(i))
-		if uint32(i+1) != headerPage.NumBlocks() {
-			t.Errorf("NumBlocks shoud be %d, but got %d", i+1, headerPage.NumBlocks())
+		headerPage.AddDirectoryPageId(types.PageID(i))
+		if uint32(i+1) != headerPage.NumDirectories() {
+			t.Errorf("NumDirectories shoud be %d, but got %d", i+1, headerPage.NumDirectories())
 		}
 	}
 
-	// check for correct block page IDs
+	// check for correct directory page IDs
 	for i := 0; i < 10; i++ {
-		if types.PageID(i) != headerPage.GetBlockPageId(uint32(i)) {
-			t.Errorf("GetBlockPageId shoud be %d, but got %d", i, headerPage.GetBlockPageId(uint32(i)))
+		if types.PageID(i) != headerPage.GetDirectoryPageId(uint32(i)) {
+			t.Errorf("GetDirectoryPageId shoud be %d, but got %d", i, headerPage.GetDirectoryPageId(uint32(i)))
 		}
 	}
 
+	// header page fits in a page
+	testingpkg.Equals(t, uintptr(common.PageSize), unsafe.Sizeof(*headerPage))
+
 	// unpin the header page now that we are done
 	bpm.UnpinPage(headerPage.GetPageId(), true)
 	diskManager.ShutDown()
@@ -76,14 +80,14 @@ func TestHashTableBlockPage(t *testing.T) {
 	blockPage := (*page.HashTableBlockPage)(unsafe.Pointer(newPageData))
 
 	for i := 0; i < 10; i++ {
-		blockPage.Insert(uint32(i), uint32(i), uint32(i))
+		blockPage.Insert(uint32(i), uint32(i), uint64(i))
 	}
 
 	for i := 0; i < 10; i++ {
 		// equals(t, i, blockPage.KeyAt(i))
 		testingpkg.Assert(t, uint32(i) == blockPage.KeyAt(uint32(i)), "")
 		//equals(t, i, blockPage.ValueAt(i))
-		testingpkg.Assert(t, uint32(i) == blockPage.ValueAt(uint32(i)), "")
+		testingpkg.Assert(t, uint64(i) == blockPage.ValueAt(uint32(i)), "")
 	}
 
 	for i := 0; i < 10; i++ {
@@ -105,6 +109,11 @@ func TestHashTableBlockPage(t *testing.T) {
 		}
 	}
 
+	// 64bit values are stored and block page fits in a page
+	blockPage.Insert(uint32(20), uint32(20), uint64(0xffffffff00000001))
+	testingpkg.Equals(t, uint64(0xffffffff00000001), blockPage.ValueAt(uint32(20)))
+	testingpkg.Equals(t, uintptr(common.PageSize), unsafe.Sizeof(*blockPage))
+
 	bpm.UnpinPage(newPage.ID(), true)
 	bpm.FlushAllPages()
 	os.Remove("test.db")
@@ -7,11 +7,14 @@ import (
 	"bytes"
 	"encoding/binary"
 	"testing"
+	"unsafe"
 
 	"github.com/ryogrid/SamehadaDB/recovery"
 	"github.com/ryogrid/SamehadaDB/storage/buffer"
 	"github.com/ryogrid/SamehadaDB/storage/disk"
+	"github.com/ryogrid/SamehadaDB/storage/page"
 	testingpkg "github.com/ryogrid/SamehadaDB/testing"
+	"github.com/ryogrid/SamehadaDB/types"
 )
 
 func IntToBytes(val int) []byte {
@@ -28,12 +31,12 @@ func TestLinearProbeHashTable(t *testing.T) {
 	ht := NewLinearProbeHashTable(bpm, 1000)
 
 	for i := 0; i < 5; i++ {
-		ht.Insert(IntToBytes(i), uint32(i))
+		ht.Insert(IntToBytes(i), uint64(i))
 		res := ht.GetValue(IntToBytes(i))
 		if len(res) == 0 {
 			t.Errorf("result should not be nil")
 		} else {
-			testingpkg.Equals(t, uint32(i), res[0])
+			testingpkg.Equals(t, uint64(i), res[0])
 		}
 	}
 
@@ -42,29 +45,29 @@ func TestLinearProbeHashTable(t *testing.T) {
 		if len(res) == 0 {
 			t.Errorf("result should not be nil")
 		} else {
-			testingpkg.Equals(t, uint32(i), res[0])
+			testingpkg.Equals(t, uint64(i), res[0])
 		}
 	}
 
 	// test for duplicate values
 	for i := 0; i < 5; i++ {
 		if i == 0 {
-			testingpkg.Nok(t, ht.Insert(IntToBytes(i), uint32(2*i)))
+			testingpkg.Nok(t, ht.Insert(IntToBytes(i), uint64(2*i)))
 		} else {
-			testingpkg.Ok(t, ht.Insert(IntToBytes(i), uint32(2*i)))
+			testingpkg.Ok(t, ht.Insert(IntToBytes(i), uint64(2*i)))
 		}
-		ht.Insert(IntToBytes(i), uint32(2*i))
+		ht.Insert(IntToBytes(i), uint64(2*i))
 		res := ht.GetValue(IntToBytes(i))
 		if i == 0 {
 			testingpkg.Equals(t, 1, len(res))
-			testingpkg.Equals(t, uint32(i), res[0])
+			testingpkg.Equals(t, uint64(i), res[0])
 		} else {
 			testingpkg.Equals(t, 2, len(res))
-			if res[0] == uint32(i) {
-				testingpkg.Equals(t, uint32(2*i), res[1])
+			if res[0] == uint64(i) {
+				testingpkg.Equals(t, uint64(2*i), res[1])
 			} else {
-				testingpkg.Equals(t, uint32(2*i), res[0])
-				testingpkg.Equals(t, uint32(i), res[1])
+				testingpkg.Equals(t, uint64(2*i), res[0])
+				testingpkg.Equals(t, uint64(i), res[1])
 			}
 		}
 	}
@@ -75,16 +78,109 @@ func TestLinearProbeHashTable(t *testing.T) {
 
 	// delete some values
 	for i := 0; i < 5; i++ {
-		ht.Remove(IntToBytes(i), uint32(i))
+		ht.Remove(IntToBytes(i), uint64(i))
 		res := ht.GetValue(IntToBytes(i))
 
 		if i == 0 {
 			testingpkg.Equals(t, 0, len(res))
 		} else {
 			testingpkg.Equals(t, 1, len(res))
-			testingpkg.Equals(t, uint32(2*i), res[0])
+			testingpkg.Equals(t, uint64(2*i), res[0])
 		}
 	}
 
 	bpm.FlushAllPages()
 }
+
+func TestLinearProbeHashTableGrow(t *testing.T) {
+	diskManager := disk.NewDiskManagerTest()
+	defer diskManager.ShutDown()
+	bpm := buffer.NewBufferPoolManager(uint32(256), diskManager, recovery.NewLogManager(&diskManager))
+
+	// table starts with one block and grows many times
+	ht := NewLinearProbeHashTable(bpm, 1)
+
+	numKeys := 200000
+	for i := 0; i < numKeys; i++ {
+		testingpkg.Ok(t, ht.Insert(IntToBytes(i), uint64(i)))
+	}
+	// same key is stored twice
+	for i := 0; i < numKeys; i += 100 {
+		testingpkg.Ok(t, ht.Insert(IntToBytes(i), uint64(i+numKeys)))
+	}
+	for i := 0; i < numKeys; i += 10 {
+		ht.Remove(IntToBytes(i), uint64(i))
+	}
+
+	for i := 0; i < numKeys; i += 5 {
+		res := ht.GetValue(IntToBytes(i))
+		expected := make([]uint64, 0)
+		if i%10 != 0 {
+			expected = append(expected, uint64(i))
+		}
+		if i%100 == 0 {
+			expected = append(expected, uint64(i+numKeys))
+		}
+		// values of other keys can be returned on hash collision
+		for _, val := range expected {
+			found := false
+			for _, got := range res {
+				found = found || got == val
+			}
+			testingpkg.Assert(t, found, "value %d is not found for key %d", val, i)
+		}
+		if i%10 == 0 {
+			for _, got := range res {
+				testingpkg.Assert(t, got != uint64(i), "removed value %d is found", i)
+			}
+		}
+	}
+}
+
+func TestOpenAndClearLinearProbeHashTable(t *testing.T) {
+	diskManager := disk.NewDiskManagerTest()
+	defer diskManager.ShutDown()
+	bpm := buffer.NewBufferPoolManager(uint32(32), diskManager, recovery.NewLogManager(&diskManager))
+
+	ht := NewLinearProbeHashTable(bpm, 2)
+	for i := 0; i < 1000; i++ {
+		testingpkg.Ok(t, ht.Insert(IntToBytes(i), uint64(i)))
+	}
+
+	reopened, err := OpenLinearProbeHashTable(bpm, ht.GetHeaderPageId())
+	testingpkg.Ok(t, err)
+	testingpkg.Equals(t, []uint64{uint64(10)}, reopened.GetValue(IntToBytes(10)))
+
+	// page which is not header of hash table is detected
+	np := bpm.NewPage()
+	bpm.UnpinPage(np.ID(), true)
+	_, err = OpenLinearProbeHashTable(bpm, np.ID())
+	testingpkg.Equals(t, ErrBrokenHashTable, err)
+
+	oldPageIds := blockPageIdsOf(reopened)
+	reopened.Clear(1)
+	testingpkg.Equals(t, 0, len(reopened.GetValue(IntToBytes(10))))
+	testingpkg.Ok(t, reopened.Insert(IntToBytes(10), uint64(10)))
+	testingpkg.Equals(t, []uint64{uint64(10)}, reopened.GetValue(IntToBytes(10)))
+	// pages of old blocks are reused
+	np2 := bpm.NewPage()
+	bpm.UnpinPage(np2.ID(), false)
+	testingpkg.Assert(t, oldPageIds[np2.ID()], "page of old block is not reused")
+}
+
+// blockPageIdsOf returns ids of directory pages and block pages of the hash table
+func blockPageIdsOf(ht *LinearProbeHashTable) map[types.PageID]bool {
+	ret := make(map[types.PageID]bool)
+	headerPage := (*page.HashTableHeaderPage)(unsafe.Pointer(ht.bpm.FetchPage(ht.headerPageId).Data()))
+	for ii := uint32(0); ii < headerPage.NumDirectories(); ii++ {
+		dirPageId := headerPage.GetDirectoryPageId(ii)
+		ret[dirPageId] = true
+		dirPage := (*page.HashTableDirectoryPage)(unsafe.Pointer(ht.bpm.FetchPage(dirPageId).Data()))
+		for jj := uint32(0); jj < page.DirectoryArraySize && ii*page.DirectoryArraySize+jj < headerPage.NumBlocks(); jj++ {
+			ret[dirPage.GetBlockPageId(jj)] = true
+		}
+		ht.bpm.UnpinPage(dirPageId, false)
+	}
+	ht.bpm.UnpinPage(ht.headerPageId, false)
+	return ret
+}
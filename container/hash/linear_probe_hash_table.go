@@ -5,22 +5,28 @@ package hash
 
 import (
 	"encoding/binary"
-	"errors"
 	"unsafe"
 
 	"github.com/ryogrid/SamehadaDB/common"
+	"github.com/ryogrid/SamehadaDB/errors"
 	"github.com/ryogrid/SamehadaDB/storage/buffer"
 	"github.com/ryogrid/SamehadaDB/storage/page"
 	"github.com/ryogrid/SamehadaDB/types"
 	"github.com/spaolacci/murmur3"
 )
 
+const ErrHashTableFull = errors.Error("hash table is full")
+const ErrDuplicatedEntry = errors.Error("duplicated values on the same key are not allowed")
+const ErrBrokenHashTable = errors.Error("pages of hash table are broken or have old format")
+
+// the table is grown when occupied slots exceed this ratio of its size
+const maxLoadFactor = 0.75
+
 /**
  * Implementation of linear probing hash table that is backed by a buffer pool
  * manager. Non-unique keys are supported. Supports insert and delete. The
- * table dynamically grows once full.
+ * table dynamically grows once load factor exceeds maxLoadFactor.
  */
-// TODO: (SDB) LinearProbeHashTable does not dynamically grows...
 type LinearProbeHashTable struct {
 	headerPageId types.PageID
 	bpm          *buffer.BufferPoolManager
@@ -33,19 +39,92 @@ func NewLinearProbeHashTable(bpm *buffer.BufferPoolManager, numBuckets int) *Lin
 	headerPage := (*page.HashTableHeaderPage)(unsafe.Pointer(headerData))
 
 	headerPage.SetPageId(header.ID())
-	headerPage.SetSize(numBuckets * page.BlockArraySize)
-
-	for i := 0; i < numBuckets; i++ {
-		np := bpm.NewPage()
-		headerPage.AddBlockPageId(np.ID())
-		bpm.UnpinPage(np.ID(), true)
+	headerPage.SetVersion(page.HashTableFormatVersion)
+	ht := &LinearProbeHashTable{header.ID(), bpm, common.NewRWLatch()}
+	if numBuckets < 1 {
+		numBuckets = 1
 	}
+	ht.allocateBlocks(headerPage, uint32(numBuckets))
 	bpm.UnpinPage(header.ID(), true)
 
-	return &LinearProbeHashTable{header.ID(), bpm, common.NewRWLatch()}
+	return ht
 }
 
-func (ht *LinearProbeHashTable) GetValue(key []byte) []uint32 {
+// OpenLinearProbeHashTable opens a hash table which is already stored in pages.
+// ErrBrokenHashTable is returned when header page is not valid or its format is old
+func OpenLinearProbeHashTable(bpm *buffer.BufferPoolManager, headerPageId types.PageID) (*LinearProbeHashTable, error) {
+	header := bpm.FetchPage(headerPageId)
+	if header == nil {
+		return nil, ErrBrokenHashTable
+	}
+	headerPage := (*page.HashTableHeaderPage)(unsafe.Pointer(header.Data()))
+	isValid := headerPage.GetPageId() == headerPageId && headerPage.GetVersion() == page.HashTableFormatVersion &&
+		headerPage.NumBlocks() > 0 && headerPage.GetSize() == int(headerPage.NumBlocks())*page.BlockArraySize
+	bpm.UnpinPage(headerPageId, false)
+	if !isValid {
+		return nil, ErrBrokenHashTable
+	}
+
+	return &LinearProbeHashTable{headerPageId, bpm, common.NewRWLatch()}, nil
+}
+
+func (ht *LinearProbeHashTable) GetHeaderPageId() types.PageID {
+	return ht.headerPageId
+}
+
+// Clear removes all entries. pages of old blocks are released, new empty blocks are allocated
+// and header page is reused
+func (ht *LinearProbeHashTable) Clear(numBuckets int) {
+	ht.table_latch.WLock()
+	defer ht.table_latch.WUnlock()
+	hPageData := ht.bpm.FetchPage(ht.headerPageId).Data()
+	headerPage := (*page.HashTableHeaderPage)(unsafe.Pointer(hPageData))
+
+	headerPage.SetPageId(ht.headerPageId)
+	headerPage.SetVersion(page.HashTableFormatVersion)
+	if numBuckets < 1 {
+		numBuckets = 1
+	}
+	ht.deleteBlocks(headerPage)
+	ht.allocateBlocks(headerPage, uint32(numBuckets))
+	ht.bpm.UnpinPage(ht.headerPageId, true)
+}
+
+// Drop releases all pages of the hash table including header page.
+// the hash table must not be used after calling this
+func (ht *LinearProbeHashTable) Drop() {
+	ht.table_latch.WLock()
+	defer ht.table_latch.WUnlock()
+	hPageData := ht.bpm.FetchPage(ht.headerPageId).Data()
+	headerPage := (*page.HashTableHeaderPage)(unsafe.Pointer(hPageData))
+
+	ht.deleteBlocks(headerPage)
+	ht.bpm.UnpinPage(ht.headerPageId, false)
+	ht.bpm.DeletePage(ht.headerPageId)
+}
+
+// deleteBlocks releases directory pages and block pages recorded in header page.
+// header page is not updated. caller must hold table latch in write mode
+func (ht *LinearProbeHashTable) deleteBlocks(headerPage *page.HashTableHeaderPage) {
+	numBlocks := headerPage.NumBlocks()
+	for ii := uint32(0); ii < headerPage.NumDirectories(); ii++ {
+		dirPageId := headerPage.GetDirectoryPageId(ii)
+		dirPage := (*page.HashTableDirectoryPage)(unsafe.Pointer(ht.bpm.FetchPage(dirPageId).Data()))
+		for jj := uint32(0); jj < page.DirectoryArraySize && ii*page.DirectoryArraySize+jj < numBlocks; jj++ {
+			ht.bpm.DeletePage(dirPage.GetBlockPageId(jj))
+		}
+		ht.bpm.UnpinPage(dirPageId, false)
+		ht.bpm.DeletePage(dirPageId)
+	}
+}
+
+// slotOf returns block and offset in it where search of the hash starts
+func slotOf(headerPage *page.HashTableHeaderPage, hash uint32) (bucket uint32, offset uint32) {
+	slot := uint64(hash) % uint64(headerPage.GetSize())
+	return uint32(slot / page.BlockArraySize), uint32(slot % page.BlockArraySize)
+}
+
+func (ht *LinearProbeHashTable) GetValue(key []byte) []uint64 {
 	ht.table_latch.RLock()
 	defer ht.table_latch.RUnlock()
 	hPageData := ht.bpm.FetchPage(ht.headerPageId).Data()
@@ -53,12 +132,11 @@ func (ht *LinearProbeHashTable) GetValue(key []byte) []uint32 {
 
 	hash := ht.hash(key)
 
-	originalBucketIndex := hash % headerPage.NumBlocks()
-	originalBucketOffset := hash % page.BlockArraySize
+	originalBucketIndex, originalBucketOffset := slotOf(headerPage, hash)
 
 	iterator := newHashTableIterator(ht.bpm, headerPage, originalBucketIndex, originalBucketOffset)
 
-	result := []uint32{}
+	result := []uint64{}
 	blockPage, offset := iterator.blockPage, iterator.offset
 	var bucket uint32
 	for blockPage.IsOccupied(offset) { // stop the search and we find an empty spot
@@ -79,29 +157,41 @@ func (ht *LinearProbeHashTable) GetValue(key []byte) []uint32 {
 	return result
 }
 
-func (ht *LinearProbeHashTable) Insert(key []byte, value uint32) (err error) {
+func (ht *LinearProbeHashTable) Insert(key []byte, value uint64) (err error) {
 	ht.table_latch.WLock()
 	defer ht.table_latch.WUnlock()
 	hPageData := ht.bpm.FetchPage(ht.headerPageId).Data()
 	headerPage := (*page.HashTableHeaderPage)(unsafe.Pointer(hPageData))
 
-	hash := ht.hash(key)
+	if float64(headerPage.GetNumOccupied()+1) > float64(headerPage.GetSize())*maxLoadFactor {
+		ht.grow(headerPage)
+	}
+	err = ht.insertHash(headerPage, ht.hash(key), value, true)
+
+	ht.bpm.UnpinPage(ht.headerPageId, true)
+
+	return
+}
 
-	originalBucketIndex := hash % headerPage.NumBlocks()
-	originalBucketOffset := hash % page.BlockArraySize
+// insertHash inserts pair of the hash and value to first empty slot of probing sequence.
+// when checkDup is true, the pair which is already stored is not inserted
+func (ht *LinearProbeHashTable) insertHash(headerPage *page.HashTableHeaderPage, hash uint32, value uint64, checkDup bool) (err error) {
+	originalBucketIndex, originalBucketOffset := slotOf(headerPage, hash)
 
 	iterator := newHashTableIterator(ht.bpm, headerPage, originalBucketIndex, originalBucketOffset)
 
 	blockPage, offset := iterator.blockPage, iterator.offset
 	var bucket uint32
+	err = ErrHashTableFull
 	for {
-		if blockPage.IsOccupied(offset) && blockPage.ValueAt(offset) == value {
-			err = errors.New("duplicated values on the same key are not allowed")
+		if checkDup && blockPage.IsReadable(offset) && blockPage.KeyAt(offset) == hash && blockPage.ValueAt(offset) == value {
+			err = ErrDuplicatedEntry
 			break
 		}
 
 		if !blockPage.IsOccupied(offset) {
 			blockPage.Insert(offset, hash, value)
+			headerPage.SetNumOccupied(headerPage.GetNumOccupied() + 1)
 			err = nil
 			break
 		}
@@ -114,12 +204,11 @@ func (ht *LinearProbeHashTable) Insert(key []byte, value uint32) (err error) {
 	}
 
 	ht.bpm.UnpinPage(iterator.blockId, true)
-	ht.bpm.UnpinPage(ht.headerPageId, false)
 
 	return
 }
 
-func (ht *LinearProbeHashTable) Remove(key []byte, value uint32) {
+func (ht *LinearProbeHashTable) Remove(key []byte, value uint64) {
 	ht.table_latch.WLock()
 	defer ht.table_latch.WUnlock()
 	hPageData := ht.bpm.FetchPage(ht.headerPageId).Data()
@@ -127,8 +216,7 @@ func (ht *LinearProbeHashTable) Remove(key []byte, value uint32) {
 
 	hash := ht.hash(key)
 
-	originalBucketIndex := hash % headerPage.NumBlocks()
-	originalBucketOffset := hash % page.BlockArraySize
+	originalBucketIndex, originalBucketOffset := slotOf(headerPage, hash)
 
 	iterator := newHashTableIterator(ht.bpm, headerPage, originalBucketIndex, originalBucketOffset)
 
@@ -150,6 +238,55 @@ func (ht *LinearProbeHashTable) Remove(key []byte, value uint32) {
 	ht.bpm.UnpinPage(ht.headerPageId, false)
 }
 
+// allocateBlocks allocates empty block pages and directory pages which point them
+// and sets them to the header. pages used before are not released here
+func (ht *LinearProbeHashTable) allocateBlocks(headerPage *page.HashTableHeaderPage, numBlocks uint32) {
+	headerPage.ClearDirectoryPageIds()
+	for ii := uint32(0); ii < numBlocks; ii += page.DirectoryArraySize {
+		dir := ht.bpm.NewPage()
+		dirPage := (*page.HashTableDirectoryPage)(unsafe.Pointer(dir.Data()))
+		for jj := ii; jj < numBlocks && jj < ii+page.DirectoryArraySize; jj++ {
+			np := ht.bpm.NewPage()
+			dirPage.SetBlockPageId(jj-ii, np.ID())
+			ht.bpm.UnpinPage(np.ID(), true)
+		}
+		headerPage.AddDirectoryPageId(dir.ID())
+		ht.bpm.UnpinPage(dir.ID(), true)
+	}
+	headerPage.SetNumBlocks(numBlocks)
+	headerPage.SetSize(int(numBlocks) * page.BlockArraySize)
+	headerPage.SetNumOccupied(0)
+}
+
+// grow doubles number of blocks and moves readable pairs to new blocks.
+// slots of removed pairs are reclaimed. caller must hold table latch in write mode
+func (ht *LinearProbeHashTable) grow(headerPage *page.HashTableHeaderPage) {
+	oldNumBlocks := headerPage.NumBlocks()
+	oldDirPageIds := make([]types.PageID, headerPage.NumDirectories())
+	for ii := range oldDirPageIds {
+		oldDirPageIds[ii] = headerPage.GetDirectoryPageId(uint32(ii))
+	}
+
+	ht.allocateBlocks(headerPage, oldNumBlocks*2)
+
+	for ii, dirPageId := range oldDirPageIds {
+		dirPage := (*page.HashTableDirectoryPage)(unsafe.Pointer(ht.bpm.FetchPage(dirPageId).Data()))
+		for jj := uint32(0); jj < page.DirectoryArraySize && uint32(ii)*page.DirectoryArraySize+jj < oldNumBlocks; jj++ {
+			blockPageId := dirPage.GetBlockPageId(jj)
+			blockPage := (*page.HashTableBlockPage)(unsafe.Pointer(ht.bpm.FetchPage(blockPageId).Data()))
+			for offset := uint32(0); offset < page.BlockArraySize; offset++ {
+				if blockPage.IsReadable(offset) {
+					ht.insertHash(headerPage, blockPage.KeyAt(offset), blockPage.ValueAt(offset), false)
+				}
+			}
+			ht.bpm.UnpinPage(blockPageId, false)
+			ht.bpm.DeletePage(blockPageId)
+		}
+		ht.bpm.UnpinPage(dirPageId, false)
+		ht.bpm.DeletePage(dirPageId)
+	}
+}
+
 //func (ht *LinearProbeHashTable) hash(key int) int {
 func (ht *LinearProbeHashTable) hash(key []byte) uint32 {
 	h := murmur3.New128()
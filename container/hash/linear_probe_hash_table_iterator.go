@@ -21,7 +21,7 @@ type hashTableIterator struct {
 }
 
 func newHashTableIterator(bpm *buffer.BufferPoolManager, header *page.HashTableHeaderPage, bucket uint32, offset uint32) *hashTableIterator {
-	blockPageId := header.GetBlockPageId(bucket)
+	blockPageId := getBlockPageId(bpm, header, bucket)
 
 	bPageData := bpm.FetchPage(blockPageId).Data()
 	blockPage := (*page.HashTableBlockPage)(unsafe.Pointer(bPageData))
@@ -42,9 +42,18 @@ func (itr *hashTableIterator) next() {
 		}
 
 		itr.bpm.UnpinPage(itr.blockId, true)
-		itr.blockId = itr.headerPage.GetBlockPageId(itr.bucket)
+		itr.blockId = getBlockPageId(itr.bpm, itr.headerPage, itr.bucket)
 
 		bPageData := itr.bpm.FetchPage(itr.blockId).Data()
 		itr.blockPage = (*page.HashTableBlockPage)(unsafe.Pointer(bPageData))
 	}
 }
+
+// getBlockPageId returns page id of the block looking up directory page which holds it
+func getBlockPageId(bpm *buffer.BufferPoolManager, header *page.HashTableHeaderPage, bucket uint32) types.PageID {
+	dirPageId := header.GetDirectoryPageId(bucket / page.DirectoryArraySize)
+	dirPage := (*page.HashTableDirectoryPage)(unsafe.Pointer(bpm.FetchPage(dirPageId).Data()))
+	ret := dirPage.GetBlockPageId(bucket % page.DirectoryArraySize)
+	bpm.UnpinPage(dirPageId, false)
+	return ret
+}
@@ -0,0 +1,32 @@
+package executors
+
+import (
+	"github.com/ryogrid/SamehadaDB/catalog"
+	"github.com/ryogrid/SamehadaDB/errors"
+	"github.com/ryogrid/SamehadaDB/execution/expression"
+	"github.com/ryogrid/SamehadaDB/storage/access"
+	"github.com/ryogrid/SamehadaDB/storage/tuple"
+)
+
+const ErrNotNullViolation = errors.Error("NULL value violates NOT NULL constraint")
+const ErrCheckViolation = errors.Error("value violates CHECK constraint")
+
+// checkColumnConstraints checks NOT NULL constraints of columns and CHECK constraints
+// (compiled to predicates by planner) on tuple_ which is going to be written to the table.
+// when constraint is violated, the transaction is marked as aborted
+func checkColumnConstraints(tableMetadata *catalog.TableMetadata, tuple_ *tuple.Tuple, checkConstraints []expression.Expression, txn *access.Transaction) error {
+	schema_ := tableMetadata.Schema()
+	for ii, column_ := range schema_.GetColumns() {
+		if !column_.IsNullable() && tuple_.GetValue(schema_, uint32(ii)).IsNull() {
+			txn.SetState(access.ABORTED)
+			return ErrNotNullViolation
+		}
+	}
+	for _, check := range checkConstraints {
+		if !check.Evaluate(tuple_, schema_).ToBoolean() {
+			txn.SetState(access.ABORTED)
+			return ErrCheckViolation
+		}
+	}
+	return nil
+}
@@ -57,15 +57,11 @@ func (e *DeleteExecutor) Next() (*tuple.Tuple, Done, error) {
 				return nil, false, err
 			}
 
-			colNum := e.tableMetadata.GetColumnNum()
-			for ii := 0; ii < int(colNum); ii++ {
-				ret := e.tableMetadata.GetIndex(ii)
-				if ret == nil {
-					continue
-				} else {
-					index_ := ret
-					index_.DeleteEntry(e.it.Current(), *rid, e.txn)
-				}
+			if err := deleteIndexEntries(e.context.GetCatalog(), e.tableMetadata, e.it.Current(), *rid, e.txn); err != nil {
+				return nil, true, err
+			}
+			if err := deleteReferencingRows(e.context.GetCatalog(), e.tableMetadata, e.it.Current(), e.txn); err != nil {
+				return nil, true, err
 			}
 
 			return e.it.Current(), false, nil
@@ -20,10 +20,13 @@ type ExecutionEngine struct {
 // TODO: (SDB) after all Execute method calls are finished, transaction must be routed Commit or Abort according to state of the transaction
 //             (when constructiing database system form is started)
 func (e *ExecutionEngine) Execute(plan plans.Plan, context *ExecutorContext) []*tuple.Tuple {
+	tuples := []*tuple.Tuple{}
+	if err := LockTables(plan, context); err != nil {
+		return tuples
+	}
 	executor := e.CreateExecutor(plan, context)
 	executor.Init()
 
-	tuples := []*tuple.Tuple{}
 	for {
 		tuple, done, err := executor.Next()
 		if err != nil || done {
@@ -46,6 +49,10 @@ func (e *ExecutionEngine) CreateExecutor(plan plans.Plan, context *ExecutorConte
 		return NewSeqScanExecutor(context, p)
 	case *plans.HashScanIndexPlanNode:
 		return NewHashScanIndexExecutor(context, p)
+	case *plans.RangeScanIndexPlanNode:
+		return NewRangeScanIndexExecutor(context, p)
+	case *plans.PointScanIndexPlanNode:
+		return NewPointScanIndexExecutor(context, p)
 	case *plans.LimitPlanNode:
 		return NewLimitExecutor(context, p, e.CreateExecutor(plan.GetChildAt(0), context))
 	case *plans.DeletePlanNode:
@@ -680,6 +680,80 @@ func TestHashTableIndex(t *testing.T) {
 
 }
 
+func TestRangeScanIndex(t *testing.T) {
+	diskManager := disk.NewDiskManagerTest()
+	defer diskManager.ShutDown()
+	log_mgr := recovery.NewLogManager(&diskManager)
+	bpm := buffer.NewBufferPoolManager(uint32(32), diskManager, log_mgr)
+
+	txn_mgr := access.NewTransactionManager(access.NewLockManager(access.REGULAR, access.DETECTION), log_mgr)
+	txn := txn_mgr.Begin(nil)
+
+	c := catalog.BootstrapCatalog(bpm, log_mgr, access.NewLockManager(access.REGULAR, access.PREVENTION), txn)
+
+	columnA := column.NewColumn("a", types.Integer, true, nil)
+	columnA.SetIndexKind(column.IndexKindBTree)
+	columnB := column.NewColumn("b", types.Varchar, false, nil)
+	schema_ := schema.NewSchema([]*column.Column{columnA, columnB})
+
+	tableMetadata := c.CreateTable("test_1", schema_, txn)
+
+	// rows are inserted in reverse order of a
+	rows := make([][]types.Value, 0)
+	for ii := 99; ii >= 0; ii-- {
+		rows = append(rows, []types.Value{types.NewInteger(int32(ii)), types.NewVarchar(fmt.Sprintf("row%d", ii%2))})
+	}
+
+	executionEngine := &ExecutionEngine{}
+	executorContext := NewExecutorContext(c, bpm, txn)
+	executionEngine.Execute(plans.NewInsertPlanNode(rows, tableMetadata.OID()), executorContext)
+
+	txn_mgr.Commit(txn)
+
+	outSchema := schema.NewSchema([]*column.Column{column.NewColumn("a", types.Integer, false, nil)})
+	low := types.NewInteger(20)
+	high := types.NewInteger(30)
+	low95 := types.NewInteger(95)
+	// b = 'row0'
+	residual := expression.NewComparison(
+		expression.NewColumnValue(0, 1, types.Varchar),
+		expression.NewConstantValue(types.NewVarchar("row0"), types.Varchar),
+		expression.Equal, types.Boolean)
+
+	cases := []struct {
+		description   string
+		low           *types.Value
+		lowInclusive  bool
+		high          *types.Value
+		highInclusive bool
+		predicate     expression.Expression
+		expected      []int32
+	}{
+		{"20 <= a <= 30", &low, true, &high, true, nil, []int32{20, 21, 22, 23, 24, 25, 26, 27, 28, 29, 30}},
+		{"20 < a < 30", &low, false, &high, false, nil, []int32{21, 22, 23, 24, 25, 26, 27, 28, 29}},
+		{"a < 20", nil, false, &low, false, nil, []int32{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16, 17, 18, 19}},
+		{"a >= 95", &low95, true, nil, false, nil, []int32{95, 96, 97, 98, 99}},
+		{"30 <= a <= 20", &high, true, &low, true, nil, []int32{}},
+		{"20 <= a <= 30 AND b = 'row0'", &low, true, &high, true, residual, []int32{20, 22, 24, 26, 28, 30}},
+	}
+
+	for _, test := range cases {
+		t.Run(test.description, func(t *testing.T) {
+			txn := txn_mgr.Begin(nil)
+			executorContext.SetTransaction(txn)
+			plan := plans.NewRangeScanIndexPlanNode(outSchema, tableMetadata.OID(), 0, test.low, test.lowInclusive, test.high, test.highInclusive, test.predicate)
+			results := executionEngine.Execute(plan, executorContext)
+			txn_mgr.Commit(txn)
+
+			// rows are returned in key order
+			testingpkg.Equals(t, len(test.expected), len(results))
+			for ii, expected := range test.expected {
+				testingpkg.Equals(t, expected, results[ii].GetValue(outSchema, 0).ToInteger())
+			}
+		})
+	}
+}
+
 func TestSimpleDelete(t *testing.T) {
 	diskManager := disk.NewDiskManagerTest()
 	defer diskManager.ShutDown()
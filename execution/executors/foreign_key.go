@@ -0,0 +1,184 @@
+package executors
+
+import (
+	"github.com/ryogrid/SamehadaDB/catalog"
+	"github.com/ryogrid/SamehadaDB/errors"
+	"github.com/ryogrid/SamehadaDB/storage/access"
+	"github.com/ryogrid/SamehadaDB/storage/page"
+	"github.com/ryogrid/SamehadaDB/storage/table/column"
+	"github.com/ryogrid/SamehadaDB/storage/tuple"
+	"github.com/ryogrid/SamehadaDB/types"
+)
+
+const ErrReferencedRowNotFound = errors.Error("foreign key constraint is violated: referenced row is not found")
+const ErrRowIsReferenced = errors.Error("foreign key constraint is violated: row is referenced from other table")
+const ErrCascadeFailed = errors.Error("cascaded change on referencing row failed")
+
+// findRowsByKey returns rows whose value of the column equals to val with index of the column.
+// the table is locked with intention lock because it is not accessed by the plan.
+// found rows are locked with SHARED lock which is held until txn finishes, so they are not
+// deleted and their keys are not changed by other transactions until then
+func findRowsByKey(catalog_ *catalog.Catalog, tableMetadata *catalog.TableMetadata, colIdx uint32, val types.Value, txn *access.Transaction) ([]page.RID, []*tuple.Tuple, error) {
+	if err := catalog_.LockTable(tableMetadata, access.INTENTION_SHARED, txn); err != nil {
+		return nil, nil, err
+	}
+	schema_ := tableMetadata.Schema()
+	keyTuple := tuple.GenTupleForIndexSearch(schema_, []uint32{colIdx}, []types.Value{val})
+	rids := make([]page.RID, 0)
+	tuples := make([]*tuple.Tuple, 0)
+	for _, rid := range tableMetadata.GetIndex(int(colIdx)).ScanKey(keyTuple, txn) {
+		found := tableMetadata.Table().GetTupleIfExists(&rid, txn)
+		if found == nil {
+			if txn.GetState() == access.ABORTED {
+				return nil, nil, ErrGettingTupleFailed
+			}
+			// the tuple is deleted before it is locked
+			continue
+		}
+		// index may return entries of other keys (hash collision or key updated before it is locked)
+		if found.GetValue(schema_, colIdx).CompareEquals(val) {
+			rids = append(rids, rid)
+			tuples = append(tuples, found)
+		}
+	}
+	return rids, tuples, nil
+}
+
+// checkForeignKeys checks that rows referenced from tuple_ exist.
+// tuple_ is going to be written to the table (child table).
+// referenced rows keep existing until txn finishes because they are locked by findRowsByKey
+func checkForeignKeys(catalog_ *catalog.Catalog, tableMetadata *catalog.TableMetadata, tuple_ *tuple.Tuple, txn *access.Transaction) error {
+	schema_ := tableMetadata.Schema()
+	for ii, column_ := range schema_.GetColumns() {
+		fk := column_.GetForeignKey()
+		if fk == nil {
+			continue
+		}
+		val := tuple_.GetValue(schema_, uint32(ii))
+		if val.IsNull() {
+			continue
+		}
+		refTable := catalog_.GetTableByOID(fk.GetRefTableOID())
+		rids, _, err := findRowsByKey(catalog_, refTable, refTable.Schema().GetColIndex(fk.GetRefColumnName()), val, txn)
+		if err != nil {
+			return err
+		}
+		if len(rids) == 0 {
+			txn.SetState(access.ABORTED)
+			return ErrReferencedRowNotFound
+		}
+	}
+	return nil
+}
+
+// checkReferencingRowsOnUpdate checks that referenced values of oldTuple which are changed
+// by update to newTuple are not referenced from other tables.
+// the updated row must be locked with EXCLUSIVE lock before calling this. otherwise a transaction
+// which holds SHARED lock on the row can insert a referencing row after the check
+func checkReferencingRowsOnUpdate(catalog_ *catalog.Catalog, tableMetadata *catalog.TableMetadata, oldTuple *tuple.Tuple, newTuple *tuple.Tuple, txn *access.Transaction) error {
+	schema_ := tableMetadata.Schema()
+	for ii, column_ := range schema_.GetColumns() {
+		oldVal := oldTuple.GetValue(schema_, uint32(ii))
+		if oldVal.IsNull() || oldVal.CompareEquals(newTuple.GetValue(schema_, uint32(ii))) {
+			continue
+		}
+		for _, ref := range catalog_.GetReferencingColumns(tableMetadata.OID(), column_.GetColumnName()) {
+			rids, _, err := findRowsByKey(catalog_, ref.Table, ref.ColIdx, oldVal, txn)
+			if err != nil {
+				return err
+			}
+			if len(rids) > 0 {
+				txn.SetState(access.ABORTED)
+				return ErrRowIsReferenced
+			}
+		}
+	}
+	return nil
+}
+
+// deleteReferencingRows processes rows of other tables which reference tuple_ deleted from
+// the table according to ON DELETE action of their foreign keys.
+// changes on the rows are rolled back with the deletion on abort of the transaction
+func deleteReferencingRows(catalog_ *catalog.Catalog, tableMetadata *catalog.TableMetadata, tuple_ *tuple.Tuple, txn *access.Transaction) error {
+	schema_ := tableMetadata.Schema()
+	for ii, column_ := range schema_.GetColumns() {
+		val := tuple_.GetValue(schema_, uint32(ii))
+		if val.IsNull() {
+			continue
+		}
+		for _, ref := range catalog_.GetReferencingColumns(tableMetadata.OID(), column_.GetColumnName()) {
+			rids, tuples, err := findRowsByKey(catalog_, ref.Table, ref.ColIdx, val, txn)
+			if err != nil {
+				return err
+			}
+			if len(rids) == 0 {
+				continue
+			}
+			switch ref.Table.Schema().GetColumn(ref.ColIdx).GetForeignKey().GetOnDelete() {
+			case column.ForeignKeyActionCascade:
+				for jj := range rids {
+					if err := cascadeDelete(catalog_, ref.Table, tuples[jj], rids[jj], txn); err != nil {
+						return err
+					}
+				}
+			case column.ForeignKeyActionSetNull:
+				for jj := range rids {
+					if err := setNullOnReferencingRow(catalog_, ref.Table, tuples[jj], rids[jj], ref.ColIdx, txn); err != nil {
+						return err
+					}
+				}
+			default:
+				txn.SetState(access.ABORTED)
+				return ErrRowIsReferenced
+			}
+		}
+	}
+	return nil
+}
+
+func cascadeDelete(catalog_ *catalog.Catalog, tableMetadata *catalog.TableMetadata, tuple_ *tuple.Tuple, rid page.RID, txn *access.Transaction) error {
+	if !tableMetadata.Table().MarkDelete(&rid, txn) {
+		txn.SetState(access.ABORTED)
+		return ErrCascadeFailed
+	}
+	if err := deleteIndexEntries(catalog_, tableMetadata, tuple_, rid, txn); err != nil {
+		return err
+	}
+	// rows referencing the deleted row are processed after removal of index entries
+	// not to visit the row again when references are circular
+	return deleteReferencingRows(catalog_, tableMetadata, tuple_, txn)
+}
+
+func setNullOnReferencingRow(catalog_ *catalog.Catalog, tableMetadata *catalog.TableMetadata, tuple_ *tuple.Tuple, rid page.RID, colIdx uint32, txn *access.Transaction) error {
+	schema_ := tableMetadata.Schema()
+	values := make([]types.Value, 0, schema_.GetColumnCount())
+	for ii := uint32(0); ii < schema_.GetColumnCount(); ii++ {
+		values = append(values, tuple_.GetValue(schema_, ii))
+	}
+	values[colIdx] = *values[colIdx].SetNull()
+	newTuple := tuple.NewTupleFromSchema(values, schema_)
+	if err := checkColumnConstraints(tableMetadata, newTuple, nil, txn); err != nil {
+		return err
+	}
+	if err := catalog_.LockInsertion(tableMetadata, newTuple, txn); err != nil {
+		return err
+	}
+
+	isUpdated, newRID := tableMetadata.Table().UpdateTuple(newTuple, []int{int(colIdx)}, schema_, rid, txn)
+	if !isUpdated {
+		txn.SetState(access.ABORTED)
+		return ErrCascadeFailed
+	}
+	if err := checkReferencingRowsOnUpdate(catalog_, tableMetadata, tuple_, newTuple, txn); err != nil {
+		return err
+	}
+	if err := deleteIndexEntries(catalog_, tableMetadata, tuple_, rid, txn); err != nil {
+		return err
+	}
+	updatedRID := rid
+	if newRID != nil {
+		updatedRID = *newRID
+	}
+	insertIndexEntries(tableMetadata, newTuple, updatedRID, txn)
+	return nil
+}
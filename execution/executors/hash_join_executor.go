@@ -127,17 +127,20 @@ func (e *HashJoinExecutor) Next() (*tuple.Tuple, Done, error) {
 			e.index_ = 0
 			var done Done = false
 			var tmp_tuple *tuple.Tuple
-			if tmp_tuple, done, _ = e.right_.Next(); done {
-				if tmp_tuple == nil {
-					err := errors.New("e.right_.Next returned nil")
-					return nil, false, err
-				}
-
+			var err error
+			if tmp_tuple, done, err = e.right_.Next(); err != nil {
+				return nil, true, err
+			}
+			if done {
 				// hash join finished, delete all the tmp page we created
 				for _, tmp_page_id := range e.tmp_page_ids_ {
 					e.context.GetBufferPoolManager().DeletePage(tmp_page_id)
 				}
-				return tmp_tuple, true, nil
+				return nil, true, nil
+			}
+			if tmp_tuple == nil {
+				err := errors.New("e.right_.Next returned nil")
+				return nil, true, err
 			}
 			inner_next_cnt++
 			e.right_tuple_ = *tmp_tuple
@@ -0,0 +1,120 @@
+package executors
+
+import (
+	"github.com/ryogrid/SamehadaDB/catalog"
+	"github.com/ryogrid/SamehadaDB/errors"
+	"github.com/ryogrid/SamehadaDB/storage/access"
+	"github.com/ryogrid/SamehadaDB/storage/page"
+	"github.com/ryogrid/SamehadaDB/storage/table/column"
+	"github.com/ryogrid/SamehadaDB/storage/tuple"
+)
+
+const ErrDuplicateKey = errors.Error("duplicate key violates unique constraint")
+const ErrNullPrimaryKey = errors.Error("primary key must not be NULL")
+const ErrGettingTupleFailed = errors.Error("getting tuple failed")
+
+// checkIndexConstraints checks UNIQUE and PRIMARY KEY constraints of the table on tuple_
+// which is already written to table heap at rid. entries of tuple_ must be inserted to indexes before
+// calling this. a transaction inserting the same key concurrently finds the entry of tuple_ at its own check
+// and waits for the row lock, so check and insertion of the entry don't need to be done atomically.
+// entries of rows deleted by uncommitted transactions are already removed from indexes, so the key is
+// locked with predicate lock before the check. it waits for the deleting transaction (see deleteIndexEntries).
+// when constraint is violated, the transaction is marked as aborted and rollback of
+// the heap write and index entries is done on abort of the transaction
+func checkIndexConstraints(catalog_ *catalog.Catalog, tableMetadata *catalog.TableMetadata, tuple_ *tuple.Tuple, rid page.RID, txn *access.Transaction) error {
+	schema_ := tableMetadata.Schema()
+	for _, index_ := range tableMetadata.GetIndexes() {
+		metadata := index_.GetMetadata()
+		if !metadata.IsUnique() {
+			continue
+		}
+
+		hasNull := false
+		for _, colIdx := range index_.GetKeyAttrs() {
+			if tuple_.GetValue(schema_, colIdx).IsNull() {
+				hasNull = true
+			}
+		}
+		if hasNull {
+			if metadata.GetConstraint() == column.IndexConstraintPrimaryKey {
+				txn.SetState(access.ABORTED)
+				return ErrNullPrimaryKey
+			}
+			// keys which have NULL are not equal to any key
+			continue
+		}
+		if err := catalog_.LockPredicate(tableMetadata, keyPredicate(tableMetadata, index_.GetKeyAttrs(), tuple_), txn); err != nil {
+			return err
+		}
+
+		// index may return entries of other keys (hash collision or truncated key),
+		// so keys of found tuples are compared
+		for _, foundRID := range index_.ScanKey(tuple_, txn) {
+			if foundRID == rid {
+				continue
+			}
+			found := tableMetadata.Table().GetTupleIfExists(&foundRID, txn)
+			if found == nil {
+				if txn.GetState() == access.ABORTED {
+					return ErrGettingTupleFailed
+				}
+				// the tuple is already deleted
+				continue
+			}
+			isSameKey := true
+			for _, colIdx := range index_.GetKeyAttrs() {
+				if !found.GetValue(schema_, colIdx).CompareEquals(tuple_.GetValue(schema_, colIdx)) {
+					isSameKey = false
+					break
+				}
+			}
+			if isSameKey {
+				txn.SetState(access.ABORTED)
+				return ErrDuplicateKey
+			}
+		}
+	}
+	return nil
+}
+
+// insertIndexEntries inserts entries of tuple_ to all indexes of the table.
+// inserted entries are removed on abort of the transaction
+func insertIndexEntries(tableMetadata *catalog.TableMetadata, tuple_ *tuple.Tuple, rid page.RID, txn *access.Transaction) {
+	for _, index_ := range tableMetadata.GetIndexes() {
+		index_.InsertEntry(tuple_, rid, txn)
+		txn.AddIntoIndexWriteSet(access.NewIndexWriteRecord(rid, access.INSERT, tuple_, index_))
+	}
+}
+
+// deleteIndexEntries deletes entries of tuple_ from all indexes of the table.
+// deleted entries are inserted again on abort of the transaction.
+// when the table has unique index, values of tuple_ are locked like written tuple until the transaction
+// finishes, so that insertion of the same key waits for the deletion to be committed or rolled back
+func deleteIndexEntries(catalog_ *catalog.Catalog, tableMetadata *catalog.TableMetadata, tuple_ *tuple.Tuple, rid page.RID, txn *access.Transaction) error {
+	for _, index_ := range tableMetadata.GetIndexes() {
+		if index_.GetMetadata().IsUnique() {
+			if err := catalog_.LockInsertion(tableMetadata, tuple_, txn); err != nil {
+				return err
+			}
+			break
+		}
+	}
+	for _, index_ := range tableMetadata.GetIndexes() {
+		index_.DeleteEntry(tuple_, rid, txn)
+		txn.AddIntoIndexWriteSet(access.NewIndexWriteRecord(rid, access.DELETE, tuple_, index_))
+	}
+	return nil
+}
+
+// keyPredicate returns predicate which matches rows having the same key as tuple_
+func keyPredicate(tableMetadata *catalog.TableMetadata, keyAttrs []uint32, tuple_ *tuple.Tuple) access.Predicate {
+	schema_ := tableMetadata.Schema()
+	return func(other *tuple.Tuple) bool {
+		for _, colIdx := range keyAttrs {
+			if !other.GetValue(schema_, colIdx).CompareEquals(tuple_.GetValue(schema_, colIdx)) {
+				return false
+			}
+		}
+		return true
+	}
+}
@@ -39,21 +39,24 @@ func (e *InsertExecutor) Next() (*tuple.Tuple, Done, error) {
 
 	for _, values := range e.plan.GetRawValues() {
 		tuple_ := tuple.NewTupleFromSchema(values, e.tableMetadata.Schema())
+		if err := checkColumnConstraints(e.tableMetadata, tuple_, e.plan.GetCheckConstraints(), e.context.txn); err != nil {
+			return nil, true, err
+		}
+		if err := checkForeignKeys(e.context.GetCatalog(), e.tableMetadata, tuple_, e.context.txn); err != nil {
+			return nil, true, err
+		}
+		if err := e.context.GetCatalog().LockInsertion(e.tableMetadata, tuple_, e.context.txn); err != nil {
+			return nil, true, err
+		}
 		tableHeap := e.tableMetadata.Table()
 		rid, err := tableHeap.InsertTuple(tuple_, e.context.txn)
 		if err != nil {
 			return nil, true, err
 		}
 
-		colNum := e.tableMetadata.GetColumnNum()
-		for ii := 0; ii < int(colNum); ii++ {
-			ret := e.tableMetadata.GetIndex(ii)
-			if ret == nil {
-				continue
-			} else {
-				index_ := ret
-				index_.InsertEntry(tuple_, *rid, e.context.txn)
-			}
+		insertIndexEntries(e.tableMetadata, tuple_, *rid, e.context.txn)
+		if err := checkIndexConstraints(e.context.GetCatalog(), e.tableMetadata, tuple_, *rid, e.context.txn); err != nil {
+			return nil, true, err
 		}
 	}
 
@@ -33,6 +33,9 @@ func (e *LimitExecutor) Next() (*tuple.Tuple, Done, error) {
 	if err != nil {
 		return nil, done, err
 	}
+	if done {
+		return nil, true, nil
+	}
 	if tuple == nil {
 		err := errors.New("e.child.Next returned nil")
 		return nil, true, err
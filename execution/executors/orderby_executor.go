@@ -92,7 +92,6 @@ func (e *OrderbyExecutor) Init() {
 		}
 		return false
 	})
-	fmt.Printf("inserted_tuple_cnt %d\n", inserted_tuple_cnt)
 	// arrange tuple array (apply sort result)
 	tuple_cnt := len(e.sort_tuples_)
 	var tmp_tuples []*tuple.Tuple = make([]*tuple.Tuple, tuple_cnt)
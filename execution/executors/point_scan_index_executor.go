@@ -0,0 +1,88 @@
+package executors
+
+import (
+	"errors"
+
+	"github.com/ryogrid/SamehadaDB/catalog"
+	"github.com/ryogrid/SamehadaDB/execution/plans"
+	"github.com/ryogrid/SamehadaDB/storage/access"
+	"github.com/ryogrid/SamehadaDB/storage/page"
+	"github.com/ryogrid/SamehadaDB/storage/table/schema"
+	"github.com/ryogrid/SamehadaDB/storage/tuple"
+	"github.com/ryogrid/SamehadaDB/types"
+)
+
+/**
+ * PointScanIndexExecutor executes scan with index whose key consists of multiple columns.
+ * index may return rows whose key differs (hash collision or truncated key),
+ * so fetched rows are filtered with residual predicate.
+ */
+type PointScanIndexExecutor struct {
+	context       *ExecutorContext
+	plan          *plans.PointScanIndexPlanNode
+	tableMetadata *catalog.TableMetadata
+	txn           *access.Transaction
+	rids          []page.RID
+}
+
+func NewPointScanIndexExecutor(context *ExecutorContext, plan *plans.PointScanIndexPlanNode) Executor {
+	tableMetadata := context.GetCatalog().GetTableByOID(plan.GetTableOID())
+
+	return &PointScanIndexExecutor{context, plan, tableMetadata, context.GetTransaction(), make([]page.RID, 0)}
+}
+
+func (e *PointScanIndexExecutor) Init() {
+	index_ := e.tableMetadata.GetIndexByName(e.plan.GetIndexName())
+	if index_ == nil {
+		panic("PointScanIndexExecutor assumes that name of existing index is passed.")
+	}
+
+	searchTuple := tuple.GenTupleForIndexSearch(e.tableMetadata.Schema(), index_.GetKeyAttrs(), e.plan.GetKeyValues())
+	e.rids = index_.ScanKey(searchTuple, e.txn)
+}
+
+// Next fetches tuples of found RIDs one by one. shared lock of each tuple is
+// acquired by TableHeap::GetTuple
+func (e *PointScanIndexExecutor) Next() (*tuple.Tuple, Done, error) {
+	for len(e.rids) > 0 {
+		rid := e.rids[0]
+		e.rids = e.rids[1:]
+		tuple_ := e.tableMetadata.Table().GetTuple(&rid, e.txn)
+		if tuple_ == nil {
+			if e.txn.GetState() == access.ABORTED {
+				return nil, true, errors.New("getting tuple failed")
+			}
+			// the tuple was deleted after the index was scanned
+			continue
+		}
+		if e.selects(tuple_) {
+			return e.projects(tuple_), false, nil
+		}
+	}
+
+	return nil, true, nil
+}
+
+// selects evaluates residual predicate on the tuple
+func (e *PointScanIndexExecutor) selects(tuple_ *tuple.Tuple) bool {
+	predicate := e.plan.GetPredicate()
+	return predicate == nil || predicate.Evaluate(tuple_, e.tableMetadata.Schema()).ToBoolean()
+}
+
+// project applies the projection operator defined by the output schema
+// It transform the tuple into a new tuple that corresponds to the output schema
+func (e *PointScanIndexExecutor) projects(tuple_ *tuple.Tuple) *tuple.Tuple {
+	outputSchema := e.plan.OutputSchema()
+
+	values := []types.Value{}
+	for i := uint32(0); i < outputSchema.GetColumnCount(); i++ {
+		colIndex := e.tableMetadata.Schema().GetColIndex(outputSchema.GetColumns()[i].GetColumnName())
+		values = append(values, tuple_.GetValue(e.tableMetadata.Schema(), colIndex))
+	}
+
+	return tuple.NewTupleFromSchema(values, outputSchema)
+}
+
+func (e *PointScanIndexExecutor) GetOutputSchema() *schema.Schema {
+	return e.plan.OutputSchema()
+}
@@ -0,0 +1,64 @@
+package executors
+
+import (
+	"github.com/ryogrid/SamehadaDB/catalog"
+	"github.com/ryogrid/SamehadaDB/execution/expression"
+	"github.com/ryogrid/SamehadaDB/execution/plans"
+	"github.com/ryogrid/SamehadaDB/storage/access"
+	"github.com/ryogrid/SamehadaDB/storage/tuple"
+)
+
+// scanPredicate returns predicate which matches all rows the plan may read from the table.
+// it is used for predicate lock which prevents phantoms. nil is returned when the plan doesn't scan the table
+func scanPredicate(plan plans.Plan, tableMetadata *catalog.TableMetadata) access.Predicate {
+	schema_ := tableMetadata.Schema()
+	switch p := plan.(type) {
+	case *plans.SeqScanPlanNode:
+		return expressionPredicate(p.GetPredicate(), tableMetadata)
+	case *plans.UpdatePlanNode:
+		return expressionPredicate(p.GetPredicate(), tableMetadata)
+	case *plans.DeletePlanNode:
+		return expressionPredicate(p.GetPredicate(), tableMetadata)
+	case *plans.HashScanIndexPlanNode:
+		return expressionPredicate(p.GetPredicate(), tableMetadata)
+	case *plans.RangeScanIndexPlanNode:
+		// residual predicate is not used. matching a superset of read rows is safe
+		colIdx, low, lowInclusive, high, highInclusive := p.GetColIdx(), p.GetLowKey(), p.IsLowInclusive(), p.GetHighKey(), p.IsHighInclusive()
+		return func(tuple_ *tuple.Tuple) bool {
+			val := tuple_.GetValue(schema_, colIdx)
+			if low != nil && (val.CompareLessThan(*low) || (!lowInclusive && val.CompareEquals(*low))) {
+				return false
+			}
+			if high != nil && (val.CompareGreaterThan(*high) || (!highInclusive && val.CompareEquals(*high))) {
+				return false
+			}
+			return true
+		}
+	case *plans.PointScanIndexPlanNode:
+		keyAttrs := tableMetadata.GetIndexByName(p.GetIndexName()).GetKeyAttrs()
+		keyValues := p.GetKeyValues()
+		return func(tuple_ *tuple.Tuple) bool {
+			for ii, colIdx := range keyAttrs {
+				if !tuple_.GetValue(schema_, colIdx).CompareEquals(keyValues[ii]) {
+					return false
+				}
+			}
+			return true
+		}
+	default:
+		return nil
+	}
+}
+
+// expressionPredicate returns predicate which evaluates the expression. nil expression matches all rows
+func expressionPredicate(expr expression.Expression, tableMetadata *catalog.TableMetadata) access.Predicate {
+	schema_ := tableMetadata.Schema()
+	return func(tuple_ *tuple.Tuple) bool {
+		if expr == nil {
+			return true
+		}
+		// NULL result is treated as match for safety
+		val := expr.Evaluate(tuple_, schema_)
+		return val.IsNull() || val.ToBoolean()
+	}
+}
@@ -0,0 +1,95 @@
+package executors
+
+import (
+	"errors"
+
+	"github.com/ryogrid/SamehadaDB/catalog"
+	"github.com/ryogrid/SamehadaDB/execution/plans"
+	"github.com/ryogrid/SamehadaDB/storage/access"
+	"github.com/ryogrid/SamehadaDB/storage/index"
+	"github.com/ryogrid/SamehadaDB/storage/page"
+	"github.com/ryogrid/SamehadaDB/storage/table/schema"
+	"github.com/ryogrid/SamehadaDB/storage/tuple"
+	"github.com/ryogrid/SamehadaDB/types"
+)
+
+/**
+ * RangeScanIndexExecutor executes scan with ordered index. rows whose key is in the range
+ * are fetched in key order and rows which don't match residual predicate are filtered out.
+ */
+type RangeScanIndexExecutor struct {
+	context       *ExecutorContext
+	plan          *plans.RangeScanIndexPlanNode
+	tableMetadata *catalog.TableMetadata
+	txn           *access.Transaction
+	rids          []page.RID
+}
+
+func NewRangeScanIndexExecutor(context *ExecutorContext, plan *plans.RangeScanIndexPlanNode) Executor {
+	tableMetadata := context.GetCatalog().GetTableByOID(plan.GetTableOID())
+
+	return &RangeScanIndexExecutor{context, plan, tableMetadata, context.GetTransaction(), make([]page.RID, 0)}
+}
+
+func (e *RangeScanIndexExecutor) Init() {
+	index_, ok := e.tableMetadata.GetIndex(int(e.plan.GetColIdx())).(index.RangeScanIndex)
+	if !ok {
+		panic("RangeScanIndexExecutor assumes that column which has ordered index is passed.")
+	}
+
+	schema_ := e.tableMetadata.Schema()
+	var low, high *tuple.Tuple = nil, nil
+	if e.plan.GetLowKey() != nil {
+		low = tuple.GenTupleForHashIndexSearch(schema_, e.plan.GetColIdx(), *e.plan.GetLowKey())
+	}
+	if e.plan.GetHighKey() != nil {
+		high = tuple.GenTupleForHashIndexSearch(schema_, e.plan.GetColIdx(), *e.plan.GetHighKey())
+	}
+	e.rids = index_.ScanRange(low, e.plan.IsLowInclusive(), high, e.plan.IsHighInclusive(), e.txn)
+}
+
+// Next fetches tuples of found RIDs one by one. shared lock of each tuple is
+// acquired by TableHeap::GetTuple
+func (e *RangeScanIndexExecutor) Next() (*tuple.Tuple, Done, error) {
+	for len(e.rids) > 0 {
+		rid := e.rids[0]
+		e.rids = e.rids[1:]
+		tuple_ := e.tableMetadata.Table().GetTuple(&rid, e.txn)
+		if tuple_ == nil {
+			if e.txn.GetState() == access.ABORTED {
+				return nil, true, errors.New("getting tuple failed")
+			}
+			// the tuple was deleted after the index was scanned
+			continue
+		}
+		if e.selects(tuple_) {
+			return e.projects(tuple_), false, nil
+		}
+	}
+
+	return nil, true, nil
+}
+
+// selects evaluates residual predicate on the tuple
+func (e *RangeScanIndexExecutor) selects(tuple_ *tuple.Tuple) bool {
+	predicate := e.plan.GetPredicate()
+	return predicate == nil || predicate.Evaluate(tuple_, e.tableMetadata.Schema()).ToBoolean()
+}
+
+// project applies the projection operator defined by the output schema
+// It transform the tuple into a new tuple that corresponds to the output schema
+func (e *RangeScanIndexExecutor) projects(tuple_ *tuple.Tuple) *tuple.Tuple {
+	outputSchema := e.plan.OutputSchema()
+
+	values := []types.Value{}
+	for i := uint32(0); i < outputSchema.GetColumnCount(); i++ {
+		colIndex := e.tableMetadata.Schema().GetColIndex(outputSchema.GetColumns()[i].GetColumnName())
+		values = append(values, tuple_.GetValue(e.tableMetadata.Schema(), colIndex))
+	}
+
+	return tuple.NewTupleFromSchema(values, outputSchema)
+}
+
+func (e *RangeScanIndexExecutor) GetOutputSchema() *schema.Schema {
+	return e.plan.OutputSchema()
+}
@@ -0,0 +1,47 @@
+package executors
+
+import (
+	"github.com/ryogrid/SamehadaDB/errors"
+	"github.com/ryogrid/SamehadaDB/execution/plans"
+	"github.com/ryogrid/SamehadaDB/storage/access"
+)
+
+const ErrTableNotExist = errors.Error("table does not exist")
+
+// LockTables acquires intention locks on tables accessed by the plan tree.
+// INTENTION_EXCLUSIVE is acquired for tables written by the plan and INTENTION_SHARED for others.
+// DDL acquires EXCLUSIVE lock, so schemas and indexes of the tables are not changed during execution.
+// isolation between DML is left to locks on rows (they may be escalated to table lock)
+// and predicate locks on conditions of scans which prevent phantoms.
+// ErrTableNotExist is returned when a table of the plan was dropped after planning
+func LockTables(plan plans.Plan, context *ExecutorContext) error {
+	if p, ok := plan.(interface{ GetTableOID() uint32 }); ok {
+		tableMetadata := context.GetCatalog().GetTableByOID(p.GetTableOID())
+		if tableMetadata == nil {
+			return ErrTableNotExist
+		}
+		if err := context.GetCatalog().LockTable(tableMetadata, tableLockMode(plan), context.GetTransaction()); err != nil {
+			return err
+		}
+		if predicate := scanPredicate(plan, tableMetadata); predicate != nil {
+			if err := context.GetCatalog().LockPredicate(tableMetadata, predicate, context.GetTransaction()); err != nil {
+				return err
+			}
+		}
+	}
+	for _, child := range plan.GetChildren() {
+		if err := LockTables(child, context); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func tableLockMode(plan plans.Plan) access.LockMode {
+	switch plan.(type) {
+	case *plans.InsertPlanNode, *plans.UpdatePlanNode, *plans.DeletePlanNode:
+		return access.INTENTION_EXCLUSIVE
+	default:
+		return access.INTENTION_SHARED
+	}
+}
@@ -11,6 +11,7 @@ import (
 	"github.com/ryogrid/SamehadaDB/storage/access"
 	"github.com/ryogrid/SamehadaDB/storage/table/schema"
 	"github.com/ryogrid/SamehadaDB/storage/tuple"
+	"github.com/ryogrid/SamehadaDB/types"
 )
 
 /**
@@ -53,7 +54,21 @@ func (e *UpdateExecutor) Next() (*tuple.Tuple, Done, error) {
 			}
 			rid := e.it.Current().GetRID()
 			values := e.plan.GetRawValues()
+			if e.plan.GetUpdateColIdxs() != nil {
+				// values of columns which are not updated are dummy on the plan.
+				// they are replaced with current values for index entries and returned tuple
+				values = e.mergeValues(e.it.Current(), values)
+			}
 			new_tuple := tuple.NewTupleFromSchema(values, e.tableMetadata.Schema())
+			if err := checkColumnConstraints(e.tableMetadata, new_tuple, e.plan.GetCheckConstraints(), e.txn); err != nil {
+				return nil, true, err
+			}
+			if err := checkForeignKeys(e.context.GetCatalog(), e.tableMetadata, new_tuple, e.txn); err != nil {
+				return nil, true, err
+			}
+			if err := e.context.GetCatalog().LockInsertion(e.tableMetadata, new_tuple, e.txn); err != nil {
+				return nil, true, err
+			}
 
 			var is_updated bool = false
 			var new_rid *page.RID = nil
@@ -67,24 +82,22 @@ func (e *UpdateExecutor) Next() (*tuple.Tuple, Done, error) {
 				err := errors.New("tuple update failed. PageId:SlotNum = " + string(rid.GetPageId()) + ":" + fmt.Sprint(rid.GetSlotNum()))
 				return nil, false, err
 			}
+			// referencing rows are checked after the row is locked exclusively by the update
+			if err := checkReferencingRowsOnUpdate(e.context.GetCatalog(), e.tableMetadata, e.it.Current(), new_tuple, e.txn); err != nil {
+				return nil, true, err
+			}
 
-			colNum := e.tableMetadata.GetColumnNum()
-			for ii := 0; ii < int(colNum); ii++ {
-				ret := e.tableMetadata.GetIndex(ii)
-				if ret == nil {
-					continue
-				} else {
-					index_ := ret
-					index_.DeleteEntry(e.it.Current(), *rid, e.txn)
-					if new_rid != nil {
-						// when tuple is moved page location on update, RID is changed to new value
-						fmt.Println("UpdateExecuter: index entry insert with new_rid.")
-						index_.InsertEntry(new_tuple, *new_rid, e.txn)
-					} else {
-						index_.InsertEntry(new_tuple, *rid, e.txn)
-					}
-
-				}
+			if err := deleteIndexEntries(e.context.GetCatalog(), e.tableMetadata, e.it.Current(), *rid, e.txn); err != nil {
+				return nil, true, err
+			}
+			// when tuple is moved page location on update, RID is changed to new value
+			updated_rid := *rid
+			if new_rid != nil {
+				updated_rid = *new_rid
+			}
+			insertIndexEntries(e.tableMetadata, new_tuple, updated_rid, e.txn)
+			if err := checkIndexConstraints(e.context.GetCatalog(), e.tableMetadata, new_tuple, updated_rid, e.txn); err != nil {
+				return nil, true, err
 			}
 
 			return new_tuple, false, nil
@@ -94,6 +107,18 @@ func (e *UpdateExecutor) Next() (*tuple.Tuple, Done, error) {
 	return nil, true, nil
 }
 
+func (e *UpdateExecutor) mergeValues(cur *tuple.Tuple, values []types.Value) []types.Value {
+	schema_ := e.tableMetadata.Schema()
+	ret := make([]types.Value, 0, len(values))
+	for ii := range values {
+		ret = append(ret, cur.GetValue(schema_, uint32(ii)))
+	}
+	for _, idx := range e.plan.GetUpdateColIdxs() {
+		ret[idx] = values[idx]
+	}
+	return ret
+}
+
 // select evaluates an expression on the tuple
 func (e *UpdateExecutor) selects(tuple *tuple.Tuple, predicate expression.Expression) bool {
 	return predicate == nil || predicate.Evaluate(tuple, e.tableMetadata.Schema()).ToBoolean()
@@ -4,6 +4,7 @@
 package plans
 
 import (
+	"github.com/ryogrid/SamehadaDB/execution/expression"
 	"github.com/ryogrid/SamehadaDB/types"
 )
 
@@ -16,11 +17,19 @@ type InsertPlanNode struct {
 	*AbstractPlanNode
 	rawValues [][]types.Value
 	tableOID  uint32
+	// predicates which inserted tuples must satisfy (CHECK constraints)
+	checkConstraints []expression.Expression
 }
 
 // NewInsertPlanNode creates a new insert plan node for inserting raw values
 func NewInsertPlanNode(rawValues [][]types.Value, oid uint32) Plan {
-	return &InsertPlanNode{&AbstractPlanNode{nil, nil}, rawValues, oid}
+	return NewInsertPlanNodeWithChecks(rawValues, oid, nil)
+}
+
+// NewInsertPlanNodeWithChecks is same as NewInsertPlanNode but CHECK constraints
+// of the table are evaluated on inserted tuples
+func NewInsertPlanNodeWithChecks(rawValues [][]types.Value, oid uint32, checkConstraints []expression.Expression) Plan {
+	return &InsertPlanNode{&AbstractPlanNode{nil, nil}, rawValues, oid, checkConstraints}
 }
 
 // GetTableOID returns the identifier of the table that should be inserted into
@@ -33,6 +42,10 @@ func (p *InsertPlanNode) GetRawValues() [][]types.Value {
 	return p.rawValues
 }
 
+func (p *InsertPlanNode) GetCheckConstraints() []expression.Expression {
+	return p.checkConstraints
+}
+
 func (p *InsertPlanNode) GetType() PlanType {
 	return Insert
 }
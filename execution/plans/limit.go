@@ -10,7 +10,7 @@ type LimitPlanNode struct {
 }
 
 func NewLimitPlanNode(child Plan, limit uint32, offset uint32) Plan {
-	return &LimitPlanNode{&AbstractPlanNode{nil, []Plan{child}}, limit, offset}
+	return &LimitPlanNode{&AbstractPlanNode{child.OutputSchema(), []Plan{child}}, limit, offset}
 }
 
 func (p *LimitPlanNode) GetLimit() uint32 {
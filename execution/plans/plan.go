@@ -19,6 +19,9 @@ const (
 	HashJoin
 	Aggregation
 	Orderby
+	Update
+	RangeScanIndex
+	PointScanIndex
 )
 
 type Plan interface {
@@ -0,0 +1,44 @@
+package plans
+
+import (
+	"github.com/ryogrid/SamehadaDB/execution/expression"
+	"github.com/ryogrid/SamehadaDB/storage/table/schema"
+	"github.com/ryogrid/SamehadaDB/types"
+)
+
+/**
+ * PointScanIndexPlanNode use index whose key consists of multiple columns to fetch
+ * rows whose key columns equal keyValues. keyValues[i] is value of i-th key column.
+ * predicate is evaluated on fetched rows as residual filter (nil means no filtering).
+ */
+type PointScanIndexPlanNode struct {
+	*AbstractPlanNode
+	tableOID  uint32
+	indexName string
+	keyValues []types.Value
+	predicate expression.Expression
+}
+
+func NewPointScanIndexPlanNode(schema *schema.Schema, tableOID uint32, indexName string, keyValues []types.Value, predicate expression.Expression) Plan {
+	return &PointScanIndexPlanNode{&AbstractPlanNode{schema, nil}, tableOID, indexName, keyValues, predicate}
+}
+
+func (p *PointScanIndexPlanNode) GetTableOID() uint32 {
+	return p.tableOID
+}
+
+func (p *PointScanIndexPlanNode) GetIndexName() string {
+	return p.indexName
+}
+
+func (p *PointScanIndexPlanNode) GetKeyValues() []types.Value {
+	return p.keyValues
+}
+
+func (p *PointScanIndexPlanNode) GetPredicate() expression.Expression {
+	return p.predicate
+}
+
+func (p *PointScanIndexPlanNode) GetType() PlanType {
+	return PointScanIndex
+}
@@ -0,0 +1,59 @@
+package plans
+
+import (
+	"github.com/ryogrid/SamehadaDB/execution/expression"
+	"github.com/ryogrid/SamehadaDB/storage/table/schema"
+	"github.com/ryogrid/SamehadaDB/types"
+)
+
+/**
+ * RangeScanIndexPlanNode use ordered index (B+tree) to fetch rows whose key is in
+ * the range in key order. nil bound means unbounded. predicate is evaluated on
+ * fetched rows as residual filter (nil means no filtering).
+ */
+type RangeScanIndexPlanNode struct {
+	*AbstractPlanNode
+	tableOID      uint32
+	colIdx        uint32
+	lowKey        *types.Value
+	lowInclusive  bool
+	highKey       *types.Value
+	highInclusive bool
+	predicate     expression.Expression
+}
+
+func NewRangeScanIndexPlanNode(schema *schema.Schema, tableOID uint32, colIdx uint32, lowKey *types.Value, lowInclusive bool, highKey *types.Value, highInclusive bool, predicate expression.Expression) Plan {
+	return &RangeScanIndexPlanNode{&AbstractPlanNode{schema, nil}, tableOID, colIdx, lowKey, lowInclusive, highKey, highInclusive, predicate}
+}
+
+func (p *RangeScanIndexPlanNode) GetTableOID() uint32 {
+	return p.tableOID
+}
+
+func (p *RangeScanIndexPlanNode) GetColIdx() uint32 {
+	return p.colIdx
+}
+
+func (p *RangeScanIndexPlanNode) GetLowKey() *types.Value {
+	return p.lowKey
+}
+
+func (p *RangeScanIndexPlanNode) IsLowInclusive() bool {
+	return p.lowInclusive
+}
+
+func (p *RangeScanIndexPlanNode) GetHighKey() *types.Value {
+	return p.highKey
+}
+
+func (p *RangeScanIndexPlanNode) IsHighInclusive() bool {
+	return p.highInclusive
+}
+
+func (p *RangeScanIndexPlanNode) GetPredicate() expression.Expression {
+	return p.predicate
+}
+
+func (p *RangeScanIndexPlanNode) GetType() PlanType {
+	return RangeScanIndex
+}
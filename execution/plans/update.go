@@ -14,13 +14,21 @@ type UpdatePlanNode struct {
 	update_col_idxs []int
 	predicate       expression.Expression
 	tableOID        uint32
+	// predicates which updated tuples must satisfy (CHECK constraints)
+	checkConstraints []expression.Expression
 }
 
 // if you update all column, you can specify nil to update_col_idxs. then all data of existed tuple is replaced with rawValues
 // if you want update specifed columns only, you should specify columns with update_col_idxs and pass rawValues of all columns defined in schema.
 // but not update target column value can be dummy value!
 func NewUpdatePlanNode(rawValues []types.Value, update_col_idxs []int, predicate expression.Expression, oid uint32) Plan {
-	return &UpdatePlanNode{&AbstractPlanNode{nil, nil}, rawValues, update_col_idxs, predicate, oid}
+	return NewUpdatePlanNodeWithChecks(rawValues, update_col_idxs, predicate, oid, nil)
+}
+
+// NewUpdatePlanNodeWithChecks is same as NewUpdatePlanNode but CHECK constraints
+// of the table are evaluated on updated tuples
+func NewUpdatePlanNodeWithChecks(rawValues []types.Value, update_col_idxs []int, predicate expression.Expression, oid uint32, checkConstraints []expression.Expression) Plan {
+	return &UpdatePlanNode{&AbstractPlanNode{nil, nil}, rawValues, update_col_idxs, predicate, oid, checkConstraints}
 }
 
 func (p *UpdatePlanNode) GetTableOID() uint32 {
@@ -31,8 +39,12 @@ func (p *UpdatePlanNode) GetPredicate() expression.Expression {
 	return p.predicate
 }
 
+func (p *UpdatePlanNode) GetCheckConstraints() []expression.Expression {
+	return p.checkConstraints
+}
+
 func (p *UpdatePlanNode) GetType() PlanType {
-	return Delete
+	return Update
 }
 
 // GetRawValues returns the raw values to be overwrite data
@@ -3,11 +3,11 @@ module github.com/ryogrid/SamehadaDB
 go 1.14
 
 require (
-	github.com/devlights/gomy v0.4.0 // indirect
+	github.com/devlights/gomy v0.4.0
 	github.com/goccy/go-graphviz v0.0.9 // indirect
 	github.com/ofabry/go-callvis v0.6.1 // indirect
-	github.com/pingcap/parser v0.0.0-20200623164729-3a18f1e5dceb // indirect
-	github.com/pingcap/tidb v1.1.0-beta.0.20200630082100-328b6d0a955c // indirect
+	github.com/pingcap/parser v0.0.0-20200623164729-3a18f1e5dceb
+	github.com/pingcap/tidb v1.1.0-beta.0.20200630082100-328b6d0a955c
 	github.com/pkg/browser v0.0.0-20210911075715-681adbf594b8 // indirect
 	github.com/spaolacci/murmur3 v1.1.0
 	golang.org/x/image v0.0.0-20211028202545-6944b10bf410 // indirect
@@ -1,8 +0,0 @@
-package main
-
-import "github.com/ryogrid/SamehadaDB/parser"
-
-func main() {
-	//fmt.Printf("hello world!")
-	parser.ParserEntryFunc()
-}
@@ -24,6 +24,11 @@ func (v *AssignVisitor) Enter(in ast.Node) (ast.Node, bool) {
 	case *driver.ValueExpr:
 		v.Value_ = ValueExprToValue(node)
 		return in, true
+	case *ast.UnaryOperationExpr:
+		if val := UnaryOpExprToValue(node); val != nil {
+			v.Value_ = val
+			return in, true
+		}
 	default:
 	}
 
@@ -41,13 +41,29 @@ func (v *BinaryOpVisitor) Enter(in ast.Node) (ast.Node, bool) {
 				r_visitor.BinaryOpExpression_.LogicalOperationType_ == -1 {
 				v.BinaryOpExpression_.Right_ = r_visitor.BinaryOpExpression_.Left_
 			} else {
-				v.BinaryOpExpression_.Right_ = l_visitor.BinaryOpExpression_
+				v.BinaryOpExpression_.Right_ = r_visitor.BinaryOpExpression_
 			}
 		} else {
 			v.BinaryOpExpression_.Left_ = l_visitor.BinaryOpExpression_
 			v.BinaryOpExpression_.Right_ = r_visitor.BinaryOpExpression_
 		}
 		return in, true
+	case *ast.BetweenExpr:
+		// "x BETWEEN a AND b" is converted to "x >= a AND x <= b"
+		// and "x NOT BETWEEN a AND b" to "x < a OR x > b"
+		expr := v.operandOf(node.Expr)
+		lower := &BinaryOpExpression{-1, expression.GreaterThanOrEqual, expr, v.operandOf(node.Left)}
+		upper := &BinaryOpExpression{-1, expression.LessThanOrEqual, expr, v.operandOf(node.Right)}
+		v.BinaryOpExpression_.LogicalOperationType_ = expression.AND
+		if node.Not {
+			lower.ComparisonOperationType_ = expression.LessThan
+			upper.ComparisonOperationType_ = expression.GreaterThan
+			v.BinaryOpExpression_.LogicalOperationType_ = expression.OR
+		}
+		v.BinaryOpExpression_.ComparisonOperationType_ = -1
+		v.BinaryOpExpression_.Left_ = lower
+		v.BinaryOpExpression_.Right_ = upper
+		return in, true
 	case *ast.IsNullExpr:
 		cdv := &ChildDataVisitor{make([]interface{}, 0)}
 		node.Accept(cdv)
@@ -74,12 +90,30 @@ func (v *BinaryOpVisitor) Enter(in ast.Node) (ast.Node, bool) {
 		v.BinaryOpExpression_.ComparisonOperationType_ = -1
 		v.BinaryOpExpression_.Left_ = ValueExprToValue(node)
 		return in, true
+	case *ast.UnaryOperationExpr:
+		if val := UnaryOpExprToValue(node); val != nil {
+			v.BinaryOpExpression_.LogicalOperationType_ = -1
+			v.BinaryOpExpression_.ComparisonOperationType_ = -1
+			v.BinaryOpExpression_.Left_ = val
+			return in, true
+		}
 	default:
 	}
 
 	return in, false
 }
 
+// operandOf returns column name or value of the node. nested expression is returned as is
+func (v *BinaryOpVisitor) operandOf(node ast.ExprNode) interface{} {
+	visitor := &BinaryOpVisitor{v.QueryInfo_, new(BinaryOpExpression)}
+	node.Accept(visitor)
+	if visitor.BinaryOpExpression_.ComparisonOperationType_ == -1 &&
+		visitor.BinaryOpExpression_.LogicalOperationType_ == -1 {
+		return visitor.BinaryOpExpression_.Left_
+	}
+	return visitor.BinaryOpExpression_
+}
+
 func (v *BinaryOpVisitor) Leave(in ast.Node) (ast.Node, bool) {
 	return in, true
 }
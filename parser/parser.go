@@ -5,30 +5,42 @@ import (
 	"github.com/pingcap/parser"
 	"github.com/pingcap/parser/ast"
 	_ "github.com/pingcap/tidb/types/parser_driver"
+	"github.com/ryogrid/SamehadaDB/errors"
 	"github.com/ryogrid/SamehadaDB/types"
 )
 
+const ErrEmptyQuery = errors.Error("query is empty")
+const ErrUnsupportedValue = errors.Error("only literal is supported as value")
+
 type QueryInfo struct {
-	QueryType_           *QueryType
-	SelectFields_        []*SelectFieldExpression // SELECT
-	SetExpressions_      []*SetExpression         // UPDATE
-	NewTable_            *string                  // CREATE TABLE
-	ColDefExpressions_   []*ColDefExpression      // CREATE TABLE
-	IndexDefExpressions_ []*IndexDefExpression    // CREATE TABLE
-	TargetCols_          []*string                // INSERT
-	Values_              []*types.Value           // INSERT
-	OnExpressions_       *BinaryOpExpression      // SELECT (with JOIN)
-	JoinTables_          []*string                // SELECT
-	WhereExpression_     *BinaryOpExpression      // SELECT, UPDATE, DELETE
-	LimitNum_            int32                    // SELECT
-	OffsetNum_           int32                    // SELECT
-	OrderByExpressions_  []*OrderByExpression     // SELECT
+	QueryType_                *QueryType
+	SelectFields_             []*SelectFieldExpression    // SELECT
+	SetExpressions_           []*SetExpression            // UPDATE
+	NewTable_                 *string                     // CREATE TABLE
+	ColDefExpressions_        []*ColDefExpression         // CREATE TABLE
+	IndexDefExpressions_      []*IndexDefExpression       // CREATE TABLE, CREATE INDEX
+	ForeignKeyDefExpressions_ []*ForeignKeyDefExpression  // CREATE TABLE
+	TargetCols_               []*string                   // INSERT
+	Values_                   []*types.Value              // INSERT
+	OnExpressions_            *BinaryOpExpression         // SELECT (with JOIN)
+	JoinTables_               []*string                   // SELECT, INSERT, UPDATE, DELETE, ALTER TABLE, CREATE INDEX, DROP INDEX
+	WhereExpression_          *BinaryOpExpression         // SELECT, UPDATE, DELETE
+	LimitNum_                 int32                       // SELECT
+	OffsetNum_                int32                       // SELECT
+	OrderByExpressions_       []*OrderByExpression        // SELECT
+	DropTables_               []*string                   // DROP TABLE
+	IfExists_                 bool                        // DROP TABLE, DROP INDEX
+	AlterTableSpecs_          []*AlterTableSpecExpression // ALTER TABLE
+	DropIndex_                *string                     // DROP INDEX
 }
 
-func extractInfoFromAST(rootNode *ast.StmtNode) *QueryInfo {
+func extractInfoFromAST(rootNode *ast.StmtNode) (*QueryInfo, error) {
 	v := NewRootSQLVisitor()
 	(*rootNode).Accept(v)
-	return v.QueryInfo_
+	if v.Err_ != nil {
+		return nil, v.Err_
+	}
+	return v.QueryInfo_, nil
 }
 
 func parse(sqlStr *string) (*ast.StmtNode, error) {
@@ -38,20 +50,46 @@ func parse(sqlStr *string) (*ast.StmtNode, error) {
 	if err != nil {
 		return nil, err
 	}
+	if len(stmtNodes) == 0 {
+		return nil, ErrEmptyQuery
+	}
 
 	return &stmtNodes[0], nil
 }
 
 func ProcessSQLStr(sqlStr *string) *QueryInfo {
-	astNode, err := parse(sqlStr)
+	qi, err := ParseSQLStr(sqlStr)
 	if err != nil {
 		fmt.Printf("parse error: %v\n", err.Error())
 		return nil
 	}
 
+	return qi
+}
+
+// ParseSQLStr is same as ProcessSQLStr but returns parse error to caller
+// instead of printing it
+func ParseSQLStr(sqlStr *string) (*QueryInfo, error) {
+	astNode, err := parse(sqlStr)
+	if err != nil {
+		return nil, err
+	}
+
 	return extractInfoFromAST(astNode)
 }
 
+// ParseExpression parses condition expression such as CHECK constraint
+// and returns it in the same form with WHERE clause
+func ParseExpression(exprStr string) (*BinaryOpExpression, error) {
+	sqlStr := "SELECT * FROM t WHERE " + exprStr
+	qi, err := ParseSQLStr(&sqlStr)
+	if err != nil {
+		return nil, err
+	}
+
+	return qi.WhereExpression_, nil
+}
+
 // TODO: (SDB) for developing phase
 func ParserEntryFunc() {
 	//astNode, err := parse("SELECT a, b FROM t WHERE a = daylight")
@@ -3,6 +3,7 @@ package parser
 import (
 	"github.com/ryogrid/SamehadaDB/execution/expression"
 	"github.com/ryogrid/SamehadaDB/execution/plans"
+	"github.com/ryogrid/SamehadaDB/storage/table/column"
 	"github.com/ryogrid/SamehadaDB/types"
 )
 
@@ -21,11 +22,42 @@ type SetExpression struct {
 type ColDefExpression struct {
 	ColName_ *string
 	ColType_ *types.TypeID
+	// false when NOT NULL is specified
+	IsNullable_ bool
+	// nil when DEFAULT is not specified
+	DefaultValue_ *types.Value
+	// condition of CHECK constraint in SQL text. nil when it is not specified
+	CheckExpr_ *string
 }
 
 type IndexDefExpression struct {
 	IndexName_ *string
 	Colnames_  []*string
+	// true when "USING BTREE" is specified. otherwise hash index is used
+	IsBTree_ bool
+	// UNIQUE or PRIMARY KEY. index is created for enforcing the constraint
+	Constraint_ column.IndexConstraint
+}
+
+type ForeignKeyDefExpression struct {
+	Colnames_    []*string
+	RefTable_    *string
+	RefColnames_ []*string
+	// action on ON DELETE clause. RESTRICT when it is not specified
+	OnDelete_ column.ForeignKeyAction
+}
+
+type AlterTableSpecExpression struct {
+	AlterType_ AlterTableType
+	// definitions of added columns and constraints specified with them (ADD COLUMN),
+	// or definition of added index (ADD INDEX, ADD UNIQUE, ADD PRIMARY KEY)
+	ColDefExpressions_        []*ColDefExpression
+	IndexDefExpressions_      []*IndexDefExpression
+	ForeignKeyDefExpressions_ []*ForeignKeyDefExpression
+	// target column (DROP COLUMN, RENAME COLUMN)
+	ColName_ *string
+	// new name of the column (RENAME COLUMN)
+	NewColName_ *string
 }
 
 type SelectFieldExpression struct {
@@ -3,6 +3,7 @@ package parser
 import (
 	"github.com/ryogrid/SamehadaDB/execution/expression"
 	"github.com/ryogrid/SamehadaDB/execution/plans"
+	"github.com/ryogrid/SamehadaDB/storage/table/column"
 	testingpkg "github.com/ryogrid/SamehadaDB/testing"
 	"github.com/ryogrid/SamehadaDB/types"
 	"testing"
@@ -290,6 +291,36 @@ func TestIsNullIsNotNullSelectQuery(t *testing.T) {
 	testingpkg.SimpleAssert(t, bGT10.Right_.(*types.Value).ToInteger() == 10)
 }
 
+func TestBetweenSelectQuery(t *testing.T) {
+	// (a >= 20) AND (a <= 30)
+	sqlStr := "SELECT a FROM t WHERE a BETWEEN 20 AND 30;"
+	queryInfo := ProcessSQLStr(&sqlStr)
+	testingpkg.SimpleAssert(t, *queryInfo.QueryType_ == SELECT)
+	testingpkg.SimpleAssert(t, queryInfo.WhereExpression_.ComparisonOperationType_ == -1)
+	testingpkg.SimpleAssert(t, queryInfo.WhereExpression_.LogicalOperationType_ == expression.AND)
+
+	aGE20 := queryInfo.WhereExpression_.Left_.(*BinaryOpExpression)
+	testingpkg.SimpleAssert(t, aGE20.ComparisonOperationType_ == expression.GreaterThanOrEqual)
+	testingpkg.SimpleAssert(t, *aGE20.Left_.(*string) == "a")
+	testingpkg.SimpleAssert(t, aGE20.Right_.(*types.Value).ToInteger() == 20)
+
+	aLE30 := queryInfo.WhereExpression_.Right_.(*BinaryOpExpression)
+	testingpkg.SimpleAssert(t, aLE30.ComparisonOperationType_ == expression.LessThanOrEqual)
+	testingpkg.SimpleAssert(t, *aLE30.Left_.(*string) == "a")
+	testingpkg.SimpleAssert(t, aLE30.Right_.(*types.Value).ToInteger() == 30)
+
+	// (a < 20) OR (a > 30)
+	sqlStr = "SELECT a FROM t WHERE a NOT BETWEEN 20 AND 30;"
+	queryInfo = ProcessSQLStr(&sqlStr)
+	testingpkg.SimpleAssert(t, queryInfo.WhereExpression_.LogicalOperationType_ == expression.OR)
+	aLT20 := queryInfo.WhereExpression_.Left_.(*BinaryOpExpression)
+	testingpkg.SimpleAssert(t, aLT20.ComparisonOperationType_ == expression.LessThan)
+	testingpkg.SimpleAssert(t, aLT20.Right_.(*types.Value).ToInteger() == 20)
+	aGT30 := queryInfo.WhereExpression_.Right_.(*BinaryOpExpression)
+	testingpkg.SimpleAssert(t, aGT30.ComparisonOperationType_ == expression.GreaterThan)
+	testingpkg.SimpleAssert(t, aGT30.Right_.(*types.Value).ToInteger() == 30)
+}
+
 func TestSimpleJoinSelectQuery(t *testing.T) {
 	sqlStr := "SELECT staff.a, staff.b, staff.c, friend.d FROM staff INNER JOIN friend ON staff.c = friend.c WHERE friend.d = 10;"
 	queryInfo := ProcessSQLStr(&sqlStr)
@@ -376,6 +407,162 @@ func TestCreateTableWithIndexDefQuery(t *testing.T) {
 	testingpkg.SimpleAssert(t, *queryInfo.IndexDefExpressions_[1].IndexName_ == "name_age_idx")
 	testingpkg.SimpleAssert(t, *queryInfo.IndexDefExpressions_[1].Colnames_[0] == "name")
 	testingpkg.SimpleAssert(t, *queryInfo.IndexDefExpressions_[1].Colnames_[1] == "age")
+	testingpkg.SimpleAssert(t, !queryInfo.IndexDefExpressions_[0].IsBTree_)
+
+	sqlStr = "CREATE TABLE name_age_list(id INT, age FLOAT, index id_idx (id) USING BTREE, index age_idx USING HASH (age));"
+	queryInfo = ProcessSQLStr(&sqlStr)
+	testingpkg.SimpleAssert(t, queryInfo.IndexDefExpressions_[0].IsBTree_)
+	testingpkg.SimpleAssert(t, !queryInfo.IndexDefExpressions_[1].IsBTree_)
+}
+
+func TestCreateTableWithConstraintQuery(t *testing.T) {
+	sqlStr := "CREATE TABLE staff(id INT PRIMARY KEY, email VARCHAR(256) UNIQUE, dept INT, num INT, UNIQUE KEY dept_num_uq (dept, num), INDEX num_idx (num));"
+	queryInfo := ProcessSQLStr(&sqlStr)
+	testingpkg.SimpleAssert(t, *queryInfo.QueryType_ == CREATE_TABLE)
+	testingpkg.Equals(t, 4, len(queryInfo.ColDefExpressions_))
+	testingpkg.Equals(t, 4, len(queryInfo.IndexDefExpressions_))
+
+	testingpkg.SimpleAssert(t, *queryInfo.IndexDefExpressions_[0].Colnames_[0] == "id")
+	testingpkg.Equals(t, column.IndexConstraintPrimaryKey, queryInfo.IndexDefExpressions_[0].Constraint_)
+	testingpkg.SimpleAssert(t, *queryInfo.IndexDefExpressions_[1].Colnames_[0] == "email")
+	testingpkg.Equals(t, column.IndexConstraintUnique, queryInfo.IndexDefExpressions_[1].Constraint_)
+	testingpkg.SimpleAssert(t, *queryInfo.IndexDefExpressions_[2].IndexName_ == "dept_num_uq")
+	testingpkg.Equals(t, 2, len(queryInfo.IndexDefExpressions_[2].Colnames_))
+	testingpkg.Equals(t, column.IndexConstraintUnique, queryInfo.IndexDefExpressions_[2].Constraint_)
+	testingpkg.Equals(t, column.IndexConstraintNone, queryInfo.IndexDefExpressions_[3].Constraint_)
+
+	sqlStr = "CREATE TABLE t(a INT, b INT, PRIMARY KEY (a, b));"
+	queryInfo = ProcessSQLStr(&sqlStr)
+	testingpkg.Equals(t, 1, len(queryInfo.IndexDefExpressions_))
+	testingpkg.Equals(t, 2, len(queryInfo.IndexDefExpressions_[0].Colnames_))
+	testingpkg.Equals(t, column.IndexConstraintPrimaryKey, queryInfo.IndexDefExpressions_[0].Constraint_)
+}
+
+func TestCreateTableWithColumnOptionQuery(t *testing.T) {
+	sqlStr := "CREATE TABLE staff(id INT NOT NULL, name VARCHAR(256) NULL DEFAULT 'anonymous', age INT DEFAULT -1 CHECK (age >= -1 AND age < 200), note VARCHAR(256));"
+	queryInfo := ProcessSQLStr(&sqlStr)
+	testingpkg.SimpleAssert(t, *queryInfo.QueryType_ == CREATE_TABLE)
+	testingpkg.Equals(t, 4, len(queryInfo.ColDefExpressions_))
+	testingpkg.Equals(t, 0, len(queryInfo.IndexDefExpressions_))
+
+	testingpkg.SimpleAssert(t, !queryInfo.ColDefExpressions_[0].IsNullable_)
+	testingpkg.SimpleAssert(t, queryInfo.ColDefExpressions_[1].IsNullable_)
+	testingpkg.Equals(t, "anonymous", queryInfo.ColDefExpressions_[1].DefaultValue_.ToVarchar())
+	testingpkg.Equals(t, int32(-1), queryInfo.ColDefExpressions_[2].DefaultValue_.ToInteger())
+	testingpkg.SimpleAssert(t, queryInfo.ColDefExpressions_[3].IsNullable_)
+	testingpkg.SimpleAssert(t, queryInfo.ColDefExpressions_[3].DefaultValue_ == nil)
+	testingpkg.SimpleAssert(t, queryInfo.ColDefExpressions_[3].CheckExpr_ == nil)
+
+	// restored text of CHECK condition can be parsed again
+	boe, err := ParseExpression(*queryInfo.ColDefExpressions_[2].CheckExpr_)
+	testingpkg.Ok(t, err)
+	testingpkg.Equals(t, expression.AND, boe.LogicalOperationType_)
+	left := boe.Left_.(*BinaryOpExpression)
+	testingpkg.Equals(t, expression.GreaterThanOrEqual, left.ComparisonOperationType_)
+	testingpkg.Equals(t, "age", *left.Left_.(*string))
+	testingpkg.Equals(t, int32(-1), left.Right_.(*types.Value).ToInteger())
+	right := boe.Right_.(*BinaryOpExpression)
+	testingpkg.Equals(t, expression.LessThan, right.ComparisonOperationType_)
+	testingpkg.Equals(t, int32(200), right.Right_.(*types.Value).ToInteger())
+}
+
+func TestCreateTableWithForeignKeyQuery(t *testing.T) {
+	sqlStr := "CREATE TABLE staff(id INT, dept_id INT REFERENCES dept(id) ON DELETE CASCADE, boss_id INT, FOREIGN KEY (boss_id) REFERENCES boss(id) ON DELETE SET NULL, FOREIGN KEY fk_id (id) REFERENCES person(id));"
+	queryInfo := ProcessSQLStr(&sqlStr)
+	testingpkg.SimpleAssert(t, *queryInfo.QueryType_ == CREATE_TABLE)
+	testingpkg.Equals(t, 3, len(queryInfo.ColDefExpressions_))
+	testingpkg.Equals(t, 0, len(queryInfo.IndexDefExpressions_))
+	testingpkg.Equals(t, 3, len(queryInfo.ForeignKeyDefExpressions_))
+
+	fkdef := queryInfo.ForeignKeyDefExpressions_[0]
+	testingpkg.Equals(t, "dept_id", *fkdef.Colnames_[0])
+	testingpkg.Equals(t, "dept", *fkdef.RefTable_)
+	testingpkg.Equals(t, "id", *fkdef.RefColnames_[0])
+	testingpkg.Equals(t, column.ForeignKeyActionCascade, fkdef.OnDelete_)
+	fkdef = queryInfo.ForeignKeyDefExpressions_[1]
+	testingpkg.Equals(t, "boss_id", *fkdef.Colnames_[0])
+	testingpkg.Equals(t, "boss", *fkdef.RefTable_)
+	testingpkg.Equals(t, column.ForeignKeyActionSetNull, fkdef.OnDelete_)
+	fkdef = queryInfo.ForeignKeyDefExpressions_[2]
+	testingpkg.Equals(t, "person", *fkdef.RefTable_)
+	testingpkg.Equals(t, column.ForeignKeyActionRestrict, fkdef.OnDelete_)
+}
+
+func TestDropTableQuery(t *testing.T) {
+	sqlStr := "DROP TABLE staff, dept;"
+	queryInfo := ProcessSQLStr(&sqlStr)
+	testingpkg.SimpleAssert(t, *queryInfo.QueryType_ == DROP_TABLE)
+	testingpkg.Equals(t, 2, len(queryInfo.DropTables_))
+	testingpkg.Equals(t, "staff", *queryInfo.DropTables_[0])
+	testingpkg.Equals(t, "dept", *queryInfo.DropTables_[1])
+	testingpkg.SimpleAssert(t, !queryInfo.IfExists_)
+
+	sqlStr = "DROP TABLE IF EXISTS staff;"
+	queryInfo = ProcessSQLStr(&sqlStr)
+	testingpkg.SimpleAssert(t, *queryInfo.QueryType_ == DROP_TABLE)
+	testingpkg.Equals(t, "staff", *queryInfo.DropTables_[0])
+	testingpkg.SimpleAssert(t, queryInfo.IfExists_)
+}
+
+func TestAlterTableQuery(t *testing.T) {
+	sqlStr := "ALTER TABLE staff ADD COLUMN age INT NOT NULL DEFAULT 20 UNIQUE, DROP COLUMN name, RENAME COLUMN id TO staff_id, ADD UNIQUE INDEX dept_age (dept_id, age) USING BTREE, ADD COLUMN a INT FIRST;"
+	queryInfo := ProcessSQLStr(&sqlStr)
+	testingpkg.SimpleAssert(t, *queryInfo.QueryType_ == ALTER_TABLE)
+	testingpkg.Equals(t, "staff", *queryInfo.JoinTables_[0])
+	testingpkg.Equals(t, 5, len(queryInfo.AlterTableSpecs_))
+
+	spec := queryInfo.AlterTableSpecs_[0]
+	testingpkg.Equals(t, ALTER_ADD_COLUMN, spec.AlterType_)
+	testingpkg.Equals(t, "age", *spec.ColDefExpressions_[0].ColName_)
+	testingpkg.SimpleAssert(t, !spec.ColDefExpressions_[0].IsNullable_)
+	testingpkg.Equals(t, int32(20), spec.ColDefExpressions_[0].DefaultValue_.ToInteger())
+	testingpkg.Equals(t, column.IndexConstraintUnique, spec.IndexDefExpressions_[0].Constraint_)
+
+	spec = queryInfo.AlterTableSpecs_[1]
+	testingpkg.Equals(t, ALTER_DROP_COLUMN, spec.AlterType_)
+	testingpkg.Equals(t, "name", *spec.ColName_)
+
+	spec = queryInfo.AlterTableSpecs_[2]
+	testingpkg.Equals(t, ALTER_RENAME_COLUMN, spec.AlterType_)
+	testingpkg.Equals(t, "id", *spec.ColName_)
+	testingpkg.Equals(t, "staff_id", *spec.NewColName_)
+
+	spec = queryInfo.AlterTableSpecs_[3]
+	testingpkg.Equals(t, ALTER_ADD_INDEX, spec.AlterType_)
+	testingpkg.Equals(t, "dept_age", *spec.IndexDefExpressions_[0].IndexName_)
+	testingpkg.Equals(t, 2, len(spec.IndexDefExpressions_[0].Colnames_))
+	testingpkg.SimpleAssert(t, spec.IndexDefExpressions_[0].IsBTree_)
+
+	// position of added column can't be specified
+	testingpkg.Equals(t, ALTER_NOT_SUPPORTED, queryInfo.AlterTableSpecs_[4].AlterType_)
+}
+
+func TestCreateAndDropIndexQuery(t *testing.T) {
+	sqlStr := "CREATE UNIQUE INDEX dept_age ON staff (dept_id, age) USING BTREE;"
+	queryInfo := ProcessSQLStr(&sqlStr)
+	testingpkg.SimpleAssert(t, *queryInfo.QueryType_ == CREATE_INDEX)
+	testingpkg.Equals(t, "staff", *queryInfo.JoinTables_[0])
+	testingpkg.Equals(t, 1, len(queryInfo.IndexDefExpressions_))
+	idef := queryInfo.IndexDefExpressions_[0]
+	testingpkg.Equals(t, "dept_age", *idef.IndexName_)
+	testingpkg.Equals(t, "dept_id", *idef.Colnames_[0])
+	testingpkg.Equals(t, "age", *idef.Colnames_[1])
+	testingpkg.SimpleAssert(t, idef.IsBTree_)
+	testingpkg.Equals(t, column.IndexConstraintUnique, idef.Constraint_)
+
+	sqlStr = "CREATE INDEX name_idx ON staff (name);"
+	queryInfo = ProcessSQLStr(&sqlStr)
+	idef = queryInfo.IndexDefExpressions_[0]
+	testingpkg.Equals(t, "name_idx", *idef.IndexName_)
+	testingpkg.SimpleAssert(t, !idef.IsBTree_)
+	testingpkg.Equals(t, column.IndexConstraintNone, idef.Constraint_)
+
+	sqlStr = "DROP INDEX IF EXISTS name_idx ON staff;"
+	queryInfo = ProcessSQLStr(&sqlStr)
+	testingpkg.SimpleAssert(t, *queryInfo.QueryType_ == DROP_INDEX)
+	testingpkg.Equals(t, "staff", *queryInfo.JoinTables_[0])
+	testingpkg.Equals(t, "name_idx", *queryInfo.DropIndex_)
+	testingpkg.SimpleAssert(t, queryInfo.IfExists_)
 }
 
 func TestInsertQuery(t *testing.T) {
@@ -444,3 +631,42 @@ func TestSimpleUpdateQuery(t *testing.T) {
 	testingpkg.SimpleAssert(t, *queryInfo.WhereExpression_.Left_.(*string) == "gender")
 	testingpkg.SimpleAssert(t, queryInfo.WhereExpression_.Right_.(*types.Value).ToVarchar() == "M")
 }
+
+func TestNegativeAndNullValueQuery(t *testing.T) {
+	sqlStr := "INSERT INTO syain(id,name,romaji) VALUES (-1,'鈴木 一郎',NULL);"
+	queryInfo := ProcessSQLStr(&sqlStr)
+	testingpkg.SimpleAssert(t, *queryInfo.QueryType_ == INSERT)
+	testingpkg.SimpleAssert(t, queryInfo.Values_[0].ToInteger() == -1)
+	testingpkg.SimpleAssert(t, queryInfo.Values_[1].ToVarchar() == "鈴木 一郎")
+	testingpkg.SimpleAssert(t, queryInfo.Values_[2].IsNull())
+
+	sqlStr = "SELECT a FROM t WHERE a > -10.5;"
+	queryInfo = ProcessSQLStr(&sqlStr)
+	testingpkg.SimpleAssert(t, *queryInfo.WhereExpression_.Left_.(*string) == "a")
+	testingpkg.SimpleAssert(t, queryInfo.WhereExpression_.Right_.(*types.Value).ToFloat() == -10.5)
+
+	sqlStr = "SELECT a FROM t WHERE a IS NULL;"
+	queryInfo = ProcessSQLStr(&sqlStr)
+	testingpkg.SimpleAssert(t, queryInfo.WhereExpression_.ComparisonOperationType_ == expression.Equal)
+	testingpkg.SimpleAssert(t, *queryInfo.WhereExpression_.Left_.(*string) == "a")
+	testingpkg.SimpleAssert(t, queryInfo.WhereExpression_.Right_.(*types.Value).IsNull())
+
+	// only literal can be negated in VALUES
+	sqlStr = "INSERT INTO syain(id,name) VALUES (-(1 + 2),'鈴木');"
+	_, err := ParseSQLStr(&sqlStr)
+	testingpkg.Equals(t, ErrUnsupportedValue, err)
+}
+
+func TestSplitStatements(t *testing.T) {
+	stmts, rest := SplitStatements("SELECT a FROM t WHERE b = 'x;y'; -- comment;\nDELETE FROM t;\nSELECT")
+	testingpkg.Equals(t, []string{"SELECT a FROM t WHERE b = 'x;y';", "-- comment;\nDELETE FROM t;"}, stmts)
+	testingpkg.Equals(t, "\nSELECT", rest)
+}
+
+func TestTransactionControlQuery(t *testing.T) {
+	for sqlStr, queryType := range map[string]QueryType{"BEGIN;": BEGIN, "START TRANSACTION;": BEGIN, "COMMIT;": COMMIT, "ROLLBACK;": ROLLBACK} {
+		sqlStr_ := sqlStr
+		queryInfo := ProcessSQLStr(&sqlStr_)
+		testingpkg.SimpleAssert(t, *queryInfo.QueryType_ == queryType)
+	}
+}
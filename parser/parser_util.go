@@ -1,10 +1,13 @@
 package parser
 
 import (
+	"github.com/pingcap/parser/ast"
+	"github.com/pingcap/parser/format"
+	"github.com/pingcap/parser/opcode"
 	ptypes "github.com/pingcap/tidb/types"
 	driver "github.com/pingcap/tidb/types/parser_driver"
+	"github.com/ryogrid/SamehadaDB/storage/table/column"
 	"github.com/ryogrid/SamehadaDB/types"
-	"strconv"
 	"strings"
 )
 
@@ -16,22 +19,47 @@ const (
 	INSERT
 	DELETE
 	UPDATE
+	BEGIN
+	COMMIT
+	ROLLBACK
+	DROP_TABLE
+	ALTER_TABLE
+	CREATE_INDEX
+	DROP_INDEX
+)
+
+// AlterTableType is kind of change on ALTER TABLE
+type AlterTableType int32
+
+const (
+	ALTER_NOT_SUPPORTED AlterTableType = iota
+	ALTER_ADD_COLUMN
+	ALTER_DROP_COLUMN
+	ALTER_RENAME_COLUMN
+	ALTER_ADD_INDEX
 )
 
 func ValueExprToValue(expr *driver.ValueExpr) *types.Value {
 	switch expr.Datum.Kind() {
-	case ptypes.KindInt64, ptypes.KindUint64:
-		val_str := expr.String()
-		istr := strings.Split(val_str, " ")[1]
-		ival, _ := strconv.Atoi(istr)
-		ret := types.NewInteger(int32(ival))
+	case ptypes.KindNull:
+		ret := types.NewNull()
+		return &ret
+	case ptypes.KindInt64:
+		ret := types.NewInteger(int32(expr.Datum.GetInt64()))
+		return &ret
+	case ptypes.KindUint64:
+		ret := types.NewInteger(int32(expr.Datum.GetUint64()))
+		return &ret
+	case ptypes.KindFloat32, ptypes.KindFloat64:
+		ret := types.NewFloat(float32(expr.Datum.GetFloat64()))
 		return &ret
 	case ptypes.KindMysqlDecimal:
-		val_str := expr.String()
-		fstr := strings.Split(val_str, " ")[1]
-		fval, _ := strconv.ParseFloat(fstr, 32)
+		fval, _ := expr.Datum.GetMysqlDecimal().ToFloat64()
 		ret := types.NewFloat(float32(fval))
 		return &ret
+	case ptypes.KindString, ptypes.KindBytes:
+		ret := types.NewVarchar(expr.Datum.GetString())
+		return &ret
 	default:
 		val_str := expr.String()
 		target_str := strings.Split(val_str, " ")[1]
@@ -39,3 +67,127 @@ func ValueExprToValue(expr *driver.ValueExpr) *types.Value {
 		return &ret
 	}
 }
+
+// UnaryOpExprToValue converts negative literal (ex: -10) to Value.
+// when passed expression is not the form, nil is returned
+func UnaryOpExprToValue(expr *ast.UnaryOperationExpr) *types.Value {
+	valExpr, ok := expr.V.(*driver.ValueExpr)
+	if !ok {
+		return nil
+	}
+	val := ValueExprToValue(valExpr)
+	switch expr.Op {
+	case opcode.Plus:
+		return val
+	case opcode.Minus:
+		switch val.ValueType() {
+		case types.Integer:
+			ret := types.NewInteger(-val.ToInteger())
+			return &ret
+		case types.Float:
+			ret := types.NewFloat(-val.ToFloat())
+			return &ret
+		}
+	}
+	return nil
+}
+
+// NewForeignKeyDefExpression converts REFERENCES clause on columns to ForeignKeyDefExpression
+func NewForeignKeyDefExpression(colnames []*string, refer *ast.ReferenceDef) *ForeignKeyDefExpression {
+	ret := new(ForeignKeyDefExpression)
+	ret.Colnames_ = colnames
+	refTable := refer.Table.Name.String()
+	ret.RefTable_ = &refTable
+	for _, spec := range refer.IndexPartSpecifications {
+		refColname := spec.Column.Name.String()
+		ret.RefColnames_ = append(ret.RefColnames_, &refColname)
+	}
+	ret.OnDelete_ = column.ForeignKeyActionRestrict
+	if refer.OnDelete != nil {
+		switch refer.OnDelete.ReferOpt {
+		case ast.ReferOptionCascade:
+			ret.OnDelete_ = column.ForeignKeyActionCascade
+		case ast.ReferOptionSetNull:
+			ret.OnDelete_ = column.ForeignKeyActionSetNull
+		}
+	}
+	return ret
+}
+
+// NewAlterTableSpecExpression converts a change of ALTER TABLE to AlterTableSpecExpression.
+// column and constraint definitions are extracted in the same way as CREATE TABLE
+func NewAlterTableSpecExpression(spec *ast.AlterTableSpec) *AlterTableSpecExpression {
+	ret := new(AlterTableSpecExpression)
+	v := NewRootSQLVisitor()
+	*v.QueryInfo_.QueryType_ = CREATE_TABLE
+	switch spec.Tp {
+	case ast.AlterTableAddColumns:
+		// only appending columns to the tail is supported
+		if spec.Position != nil && spec.Position.Tp != ast.ColumnPositionNone {
+			break
+		}
+		ret.AlterType_ = ALTER_ADD_COLUMN
+		for _, colDef := range spec.NewColumns {
+			colDef.Accept(v)
+		}
+	case ast.AlterTableAddConstraint:
+		ret.AlterType_ = ALTER_ADD_INDEX
+		spec.Constraint.Accept(v)
+	case ast.AlterTableDropColumn:
+		ret.AlterType_ = ALTER_DROP_COLUMN
+		colname := spec.OldColumnName.Name.String()
+		ret.ColName_ = &colname
+	case ast.AlterTableRenameColumn:
+		ret.AlterType_ = ALTER_RENAME_COLUMN
+		colname := spec.OldColumnName.Name.String()
+		newColname := spec.NewColumnName.Name.String()
+		ret.ColName_ = &colname
+		ret.NewColName_ = &newColname
+	}
+	ret.ColDefExpressions_ = v.QueryInfo_.ColDefExpressions_
+	ret.IndexDefExpressions_ = v.QueryInfo_.IndexDefExpressions_
+	ret.ForeignKeyDefExpressions_ = v.QueryInfo_.ForeignKeyDefExpressions_
+	return ret
+}
+
+// ExprNodeToString restores SQL text of the expression. the text can be parsed with ParseExpression
+func ExprNodeToString(expr ast.ExprNode) string {
+	var sb strings.Builder
+	expr.Restore(format.NewRestoreCtx(format.DefaultRestoreFlags|format.RestoreSpacesAroundBinaryOperation, &sb))
+	return sb.String()
+}
+
+// SplitStatements splits buf to statements terminated with ";" which is not in
+// quoted string or comment. incomplete statement at the tail is returned as rest
+func SplitStatements(buf string) (stmts []string, rest string) {
+	var quote byte = 0
+	isComment := false
+	start := 0
+	for ii := 0; ii < len(buf); ii++ {
+		ch := buf[ii]
+		switch {
+		case isComment:
+			if ch == '\n' {
+				isComment = false
+			}
+		case quote != 0:
+			if ch == '\\' {
+				// skip escaped character
+				ii++
+			} else if ch == quote {
+				quote = 0
+			}
+		case ch == '\'' || ch == '"' || ch == '`':
+			quote = ch
+		case ch == '-' && ii+1 < len(buf) && buf[ii+1] == '-':
+			isComment = true
+		case ch == ';':
+			stmt := strings.TrimSpace(buf[start : ii+1])
+			if stmt != ";" {
+				stmts = append(stmts, stmt)
+			}
+			start = ii + 1
+		}
+	}
+	return stmts, buf[start:]
+}
@@ -2,13 +2,16 @@ package parser
 
 import (
 	"github.com/pingcap/parser/ast"
+	"github.com/pingcap/parser/model"
 	"github.com/pingcap/parser/mysql"
 	driver "github.com/pingcap/tidb/types/parser_driver"
+	"github.com/ryogrid/SamehadaDB/storage/table/column"
 	"github.com/ryogrid/SamehadaDB/types"
 )
 
 type RootSQLVisitor struct {
 	QueryInfo_ *QueryInfo
+	Err_       error
 }
 
 func NewRootSQLVisitor() *RootSQLVisitor {
@@ -19,6 +22,7 @@ func NewRootSQLVisitor() *RootSQLVisitor {
 	qinfo.SetExpressions_ = make([]*SetExpression, 0)
 	qinfo.ColDefExpressions_ = make([]*ColDefExpression, 0)
 	qinfo.IndexDefExpressions_ = make([]*IndexDefExpression, 0)
+	qinfo.ForeignKeyDefExpressions_ = make([]*ForeignKeyDefExpression, 0)
 	qinfo.TargetCols_ = make([]*string, 0)
 	qinfo.Values_ = make([]*types.Value, 0)
 	qinfo.OnExpressions_ = new(BinaryOpExpression)
@@ -27,6 +31,8 @@ func NewRootSQLVisitor() *RootSQLVisitor {
 	qinfo.LimitNum_ = -1
 	qinfo.OffsetNum_ = -1
 	qinfo.OrderByExpressions_ = make([]*OrderByExpression, 0)
+	qinfo.DropTables_ = make([]*string, 0)
+	qinfo.AlterTableSpecs_ = make([]*AlterTableSpecExpression, 0)
 	ret.QueryInfo_ = qinfo
 
 	return ret
@@ -48,6 +54,57 @@ func (v *RootSQLVisitor) Enter(in ast.Node) (ast.Node, bool) {
 		*v.QueryInfo_.QueryType_ = DELETE
 	case *ast.UpdateStmt:
 		*v.QueryInfo_.QueryType_ = UPDATE
+	case *ast.BeginStmt:
+		*v.QueryInfo_.QueryType_ = BEGIN
+	case *ast.CommitStmt:
+		*v.QueryInfo_.QueryType_ = COMMIT
+	case *ast.RollbackStmt:
+		*v.QueryInfo_.QueryType_ = ROLLBACK
+	case *ast.AlterTableStmt:
+		*v.QueryInfo_.QueryType_ = ALTER_TABLE
+		tbname := node.Table.Name.String()
+		v.QueryInfo_.JoinTables_ = append(v.QueryInfo_.JoinTables_, &tbname)
+		for _, spec := range node.Specs {
+			v.QueryInfo_.AlterTableSpecs_ = append(v.QueryInfo_.AlterTableSpecs_, NewAlterTableSpecExpression(spec))
+		}
+		return in, true
+	case *ast.DropTableStmt:
+		*v.QueryInfo_.QueryType_ = DROP_TABLE
+		v.QueryInfo_.IfExists_ = node.IfExists
+		for _, table := range node.Tables {
+			tbname := table.Name.String()
+			v.QueryInfo_.DropTables_ = append(v.QueryInfo_.DropTables_, &tbname)
+		}
+		return in, true
+	case *ast.CreateIndexStmt:
+		*v.QueryInfo_.QueryType_ = CREATE_INDEX
+		tbname := node.Table.Name.String()
+		v.QueryInfo_.JoinTables_ = append(v.QueryInfo_.JoinTables_, &tbname)
+		idf := new(IndexDefExpression)
+		idxname := node.IndexName
+		idf.IndexName_ = &idxname
+		idf.IsBTree_ = node.IndexOption != nil && node.IndexOption.Tp == model.IndexTypeBtree
+		if node.KeyType == ast.IndexKeyTypeUnique {
+			idf.Constraint_ = column.IndexConstraintUnique
+		}
+		for _, part := range node.IndexPartSpecifications {
+			// index on expression is not supported
+			if part.Column == nil {
+				panic("unknown node for visitor")
+			}
+			colname := part.Column.Name.String()
+			idf.Colnames_ = append(idf.Colnames_, &colname)
+		}
+		v.QueryInfo_.IndexDefExpressions_ = append(v.QueryInfo_.IndexDefExpressions_, idf)
+		return in, true
+	case *ast.DropIndexStmt:
+		*v.QueryInfo_.QueryType_ = DROP_INDEX
+		tbname := node.Table.Name.String()
+		v.QueryInfo_.JoinTables_ = append(v.QueryInfo_.JoinTables_, &tbname)
+		idxname := node.IndexName
+		v.QueryInfo_.DropIndex_ = &idxname
+		v.QueryInfo_.IfExists_ = node.IfExists
+		return in, true
 	case *ast.FieldList:
 	case *ast.SelectField:
 		sv := &SelectFieldsVisitor{v.QueryInfo_}
@@ -94,17 +151,77 @@ func (v *RootSQLVisitor) Enter(in ast.Node) (ast.Node, bool) {
 				ctype := types.Varchar
 				cdef.ColType_ = &ctype
 			}
+			cdef.IsNullable_ = true
 			v.QueryInfo_.ColDefExpressions_ = append(v.QueryInfo_.ColDefExpressions_, cdef)
+			for _, option := range node.Options {
+				// constraint specified as column option is same with one on the column specified at table level
+				idf := &IndexDefExpression{IndexName_: new(string), Colnames_: []*string{&cname}}
+				switch option.Tp {
+				case ast.ColumnOptionPrimaryKey:
+					idf.Constraint_ = column.IndexConstraintPrimaryKey
+				case ast.ColumnOptionUniqKey:
+					idf.Constraint_ = column.IndexConstraintUnique
+				case ast.ColumnOptionNotNull:
+					cdef.IsNullable_ = false
+					continue
+				case ast.ColumnOptionNull:
+					cdef.IsNullable_ = true
+					continue
+				case ast.ColumnOptionDefaultValue:
+					// only constant is supported as default value
+					switch expr := option.Expr.(type) {
+					case *driver.ValueExpr:
+						cdef.DefaultValue_ = ValueExprToValue(expr)
+					case *ast.UnaryOperationExpr:
+						cdef.DefaultValue_ = UnaryOpExprToValue(expr)
+					}
+					continue
+				case ast.ColumnOptionCheck:
+					checkExpr := ExprNodeToString(option.Expr)
+					cdef.CheckExpr_ = &checkExpr
+					continue
+				case ast.ColumnOptionReference:
+					fkdef := NewForeignKeyDefExpression([]*string{&cname}, option.Refer)
+					v.QueryInfo_.ForeignKeyDefExpressions_ = append(v.QueryInfo_.ForeignKeyDefExpressions_, fkdef)
+					continue
+				default:
+					continue
+				}
+				v.QueryInfo_.IndexDefExpressions_ = append(v.QueryInfo_.IndexDefExpressions_, idf)
+			}
 			return in, true
 		}
 	case *ast.Constraint:
 		// Index definition at CREATE TABLE
 		if *v.QueryInfo_.QueryType_ == CREATE_TABLE {
+			var constraint column.IndexConstraint
+			switch node.Tp {
+			case ast.ConstraintKey, ast.ConstraintIndex:
+				constraint = column.IndexConstraintNone
+			case ast.ConstraintUniq, ast.ConstraintUniqKey, ast.ConstraintUniqIndex:
+				constraint = column.IndexConstraintUnique
+			case ast.ConstraintPrimaryKey:
+				constraint = column.IndexConstraintPrimaryKey
+			case ast.ConstraintForeignKey:
+				colnames := make([]*string, 0, len(node.Keys))
+				for _, key := range node.Keys {
+					colname := key.Column.Name.String()
+					colnames = append(colnames, &colname)
+				}
+				fkdef := NewForeignKeyDefExpression(colnames, node.Refer)
+				v.QueryInfo_.ForeignKeyDefExpressions_ = append(v.QueryInfo_.ForeignKeyDefExpressions_, fkdef)
+				return in, true
+			default:
+				// constraints which are not enforced through index are ignored
+				return in, true
+			}
 			// get all specified column
 			cdv := &ChildDataVisitor{make([]interface{}, 0)}
 			node.Accept(cdv)
 			idf := new(IndexDefExpression)
 			idf.IndexName_ = &node.Name
+			idf.IsBTree_ = node.Option != nil && node.Option.Tp == model.IndexTypeBtree
+			idf.Constraint_ = constraint
 			for _, colname := range cdv.ChildDatas_ {
 				idf.Colnames_ = append(idf.Colnames_, colname.(*string))
 			}
@@ -128,11 +245,26 @@ func (v *RootSQLVisitor) Enter(in ast.Node) (ast.Node, bool) {
 		v.QueryInfo_.WhereExpression_.LogicalOperationType_ = logicType
 		v.QueryInfo_.WhereExpression_.ComparisonOperationType_ = compType
 
+		return in, true
+	case *ast.IsNullExpr, *ast.BetweenExpr:
+		// for WHERE clause which has IS NULL, IS NOT NULL or BETWEEN only
+		new_visitor := &BinaryOpVisitor{v.QueryInfo_, new(BinaryOpExpression)}
+		node.Accept(new_visitor)
+		v.QueryInfo_.WhereExpression_ = new_visitor.BinaryOpExpression_
 		return in, true
 	case *driver.ValueExpr:
 		// when INSERT
 		v.QueryInfo_.Values_ = append(v.QueryInfo_.Values_, ValueExprToValue(node))
 		return in, true
+	case *ast.UnaryOperationExpr:
+		// when INSERT (negative value)
+		if val := UnaryOpExprToValue(node); val != nil {
+			v.QueryInfo_.Values_ = append(v.QueryInfo_.Values_, val)
+			return in, true
+		}
+		// expression such as -(1 + 2) can't be converted to a value
+		v.Err_ = ErrUnsupportedValue
+		return in, true
 	case *ast.Limit:
 		cdv := &ChildDataVisitor{make([]interface{}, 0)}
 		node.Accept(cdv)
@@ -0,0 +1,241 @@
+package planner
+
+import (
+	"strings"
+
+	"github.com/ryogrid/SamehadaDB/catalog"
+	"github.com/ryogrid/SamehadaDB/parser"
+	"github.com/ryogrid/SamehadaDB/storage/table/column"
+	"github.com/ryogrid/SamehadaDB/storage/table/schema"
+	"github.com/ryogrid/SamehadaDB/storage/tuple"
+	"github.com/ryogrid/SamehadaDB/types"
+)
+
+// alterTable applies changes of ALTER TABLE in order.
+// adding, dropping and renaming of column rewrite all rows of the table to new layout.
+// adding index to existing columns fills the index with existing rows
+func (pner *SimplePlanner) alterTable() error {
+	tm := pner.catalog_.GetTableByName(*pner.qi_.JoinTables_[0])
+	if tm == nil {
+		return ErrTableNotFound
+	}
+	if catalog.IsSystemCatalog(tm.OID()) {
+		return ErrNotSupported
+	}
+	for _, spec := range pner.qi_.AlterTableSpecs_ {
+		var err error
+		switch spec.AlterType_ {
+		case parser.ALTER_ADD_COLUMN:
+			err = pner.addColumns(tm, spec)
+		case parser.ALTER_DROP_COLUMN:
+			err = pner.dropColumn(tm, *spec.ColName_)
+		case parser.ALTER_RENAME_COLUMN:
+			err = pner.renameColumn(tm, *spec.ColName_, *spec.NewColName_)
+		case parser.ALTER_ADD_INDEX:
+			err = pner.addIndexes(tm, spec)
+		default:
+			err = ErrNotSupported
+		}
+		if err != nil {
+			return err
+		}
+		// metadata is replaced when rows are rewritten
+		tm = pner.catalog_.GetTableByOID(tm.OID())
+	}
+	return nil
+}
+
+// copyColumns returns copies of columns of the schema. columns of current schema must not be
+// modified because they are used again when the transaction is aborted
+func copyColumns(schema_ *schema.Schema) []*column.Column {
+	ret := make([]*column.Column, 0, schema_.GetColumnCount())
+	for _, col := range schema_.GetColumns() {
+		copied := *col
+		ret = append(ret, &copied)
+	}
+	return ret
+}
+
+func hasPrimaryKey(tm *catalog.TableMetadata) bool {
+	for _, index_ := range tm.GetIndexes() {
+		if index_.GetMetadata().GetConstraint() == column.IndexConstraintPrimaryKey {
+			return true
+		}
+	}
+	return false
+}
+
+// checkNotReferenced returns error when the column is referenced by foreign key of other column
+func (pner *SimplePlanner) checkNotReferenced(tm *catalog.TableMetadata, colIdx uint32) error {
+	for _, ref := range pner.catalog_.GetReferencingColumns(tm.OID(), tm.Schema().GetColumn(colIdx).GetColumnName()) {
+		if ref.Table.OID() != tm.OID() || ref.ColIdx != colIdx {
+			return ErrColumnIsReferenced
+		}
+	}
+	return nil
+}
+
+// rewriteTable rewrites rows of the table to layout of cols. see catalog.AlterTable about srcColIdxs and fillValues.
+// rewritten rows are checked with NOT NULL and CHECK constraints of cols
+func (pner *SimplePlanner) rewriteTable(tm *catalog.TableMetadata, cols []*column.Column, srcColIdxs []int, fillValues []types.Value) error {
+	schema_ := schema.NewSchema(cols)
+	// CHECK constraints are compiled on temporal metadata which has no table heap and index
+	checks, err := buildCheckConstraints(catalog.NewTableMetadata(schema_, tm.Name(), nil, tm.OID()))
+	if err != nil {
+		return err
+	}
+	validate := func(tuple_ *tuple.Tuple) error {
+		for ii, col := range cols {
+			if !col.IsNullable() && tuple_.GetValue(schema_, uint32(ii)).IsNull() {
+				return catalog.ErrExistingRowsViolateConstraint
+			}
+		}
+		for _, check := range checks {
+			if !check.Evaluate(tuple_, schema_).ToBoolean() {
+				return catalog.ErrExistingRowsViolateConstraint
+			}
+		}
+		return nil
+	}
+	_, err = pner.catalog_.AlterTable(tm, schema_, srcColIdxs, fillValues, validate, pner.txn_)
+	return err
+}
+
+// identityColIdxs returns srcColIdxs which keeps all columns of the table
+func identityColIdxs(tm *catalog.TableMetadata) []int {
+	ret := make([]int, 0, tm.GetColumnNum())
+	for ii := 0; ii < int(tm.GetColumnNum()); ii++ {
+		ret = append(ret, ii)
+	}
+	return ret
+}
+
+// addColumns appends columns to the tail. existing rows have default value of the column (or NULL)
+func (pner *SimplePlanner) addColumns(tm *catalog.TableMetadata, spec *parser.AlterTableSpecExpression) error {
+	cols := copyColumns(tm.Schema())
+	srcColIdxs := identityColIdxs(tm)
+	fillValues := make([]types.Value, len(cols))
+	for _, cdef := range spec.ColDefExpressions_ {
+		if _, ok := findColIndex(schema.NewSchema(cols), *cdef.ColName_); ok {
+			return ErrColumnAlreadyExists
+		}
+		col, err := newColumnFromDef(cdef)
+		if err != nil {
+			return err
+		}
+		cols = append(cols, col)
+		srcColIdxs = append(srcColIdxs, -1)
+		if col.GetDefaultValue() != nil {
+			fillValues = append(fillValues, *col.GetDefaultValue())
+		} else {
+			fillValues = append(fillValues, *zeroValue(col.GetType()).SetNull())
+		}
+	}
+	// constraints specified as column options
+	for _, idef := range spec.IndexDefExpressions_ {
+		colIdx, _ := findColIndex(schema.NewSchema(cols), *idef.Colnames_[0])
+		col := cols[colIdx]
+		if idef.Constraint_ == column.IndexConstraintPrimaryKey && hasPrimaryKey(tm) {
+			return ErrMultiplePrimaryKeys
+		}
+		col.SetHasIndex(true)
+		if idef.Constraint_ > col.GetIndexConstraint() {
+			col.SetIndexConstraint(idef.Constraint_)
+		}
+	}
+	for _, fkdef := range spec.ForeignKeyDefExpressions_ {
+		col, err := pner.applyForeignKey(cols, fkdef)
+		if err != nil {
+			return err
+		}
+		// existence of referenced row is not checked on rewrite
+		if col.GetDefaultValue() != nil {
+			return ErrNotSupported
+		}
+	}
+	return pner.rewriteTable(tm, cols, srcColIdxs, fillValues)
+}
+
+func (pner *SimplePlanner) dropColumn(tm *catalog.TableMetadata, colName string) error {
+	colIdx, ok := findColIndex(tm.Schema(), colName)
+	if !ok {
+		return ErrColumnNotFound
+	}
+	if tm.GetColumnNum() == 1 {
+		// table must have at least one column
+		return ErrNotSupported
+	}
+	if err := pner.checkNotReferenced(tm, colIdx); err != nil {
+		return err
+	}
+	cols := make([]*column.Column, 0)
+	srcColIdxs := make([]int, 0)
+	for ii, col := range copyColumns(tm.Schema()) {
+		if uint32(ii) != colIdx {
+			cols = append(cols, col)
+			srcColIdxs = append(srcColIdxs, ii)
+		}
+	}
+	return pner.rewriteTable(tm, cols, srcColIdxs, make([]types.Value, len(cols)))
+}
+
+// renameColumn changes name of the column. CHECK constraints which refer the column are rewritten.
+// rows are rewritten because indexes are named with the column name
+func (pner *SimplePlanner) renameColumn(tm *catalog.TableMetadata, colName string, newColName string) error {
+	colIdx, ok := findColIndex(tm.Schema(), colName)
+	if !ok {
+		return ErrColumnNotFound
+	}
+	if _, ok := findColIndex(tm.Schema(), newColName); ok {
+		return ErrColumnAlreadyExists
+	}
+	if err := pner.checkNotReferenced(tm, colIdx); err != nil {
+		return err
+	}
+	cols := copyColumns(tm.Schema())
+	cols[colIdx].SetColumnName(newColName)
+	// column names in CHECK constraint are quoted with backquote (see parser.ExprNodeToString)
+	for _, col := range cols {
+		col.SetCheckExpr(strings.Replace(col.GetCheckExpr(), "`"+colName+"`", "`"+newColName+"`", -1))
+	}
+	return pner.rewriteTable(tm, cols, identityColIdxs(tm), make([]types.Value, len(cols)))
+}
+
+// addIndexes creates indexes (ADD INDEX, ADD UNIQUE and ADD PRIMARY KEY) on existing columns.
+// creation fails when existing rows violate UNIQUE or PRIMARY KEY constraint
+func (pner *SimplePlanner) addIndexes(tm *catalog.TableMetadata, spec *parser.AlterTableSpecExpression) error {
+	// adding foreign key needs check of existing rows
+	if len(spec.ForeignKeyDefExpressions_) > 0 {
+		return ErrNotSupported
+	}
+	for _, idef := range spec.IndexDefExpressions_ {
+		keyAttrs := make([]uint32, 0, len(idef.Colnames_))
+		for _, colname := range idef.Colnames_ {
+			colIdx, ok := findColIndex(tm.Schema(), *colname)
+			if !ok {
+				return ErrColumnNotFound
+			}
+			keyAttrs = append(keyAttrs, colIdx)
+		}
+		if idef.Constraint_ == column.IndexConstraintPrimaryKey && hasPrimaryKey(tm) {
+			return ErrMultiplePrimaryKeys
+		}
+		name := indexNameOf(idef)
+		if tm.GetIndexByName(name) != nil {
+			return ErrIndexAlreadyExists
+		}
+		if len(keyAttrs) == 1 {
+			if tm.GetIndex(int(keyAttrs[0])) != nil {
+				return ErrIndexAlreadyExists
+			}
+			if _, err := pner.catalog_.CreateColumnIndex(tm, keyAttrs[0], name, indexKindOf(idef), idef.Constraint_, pner.txn_); err != nil {
+				return err
+			}
+			continue
+		}
+		if _, err := pner.catalog_.CreateIndex(tm, name, keyAttrs, indexKindOf(idef), idef.Constraint_, pner.txn_); err != nil {
+			return err
+		}
+	}
+	return nil
+}
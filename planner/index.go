@@ -0,0 +1,48 @@
+package planner
+
+import (
+	"github.com/ryogrid/SamehadaDB/catalog"
+	"github.com/ryogrid/SamehadaDB/parser"
+)
+
+// createIndex creates the index on the existing table (CREATE INDEX).
+// the table is locked exclusively with LockTablesOfQuery while the index is filled with existing rows
+func (pner *SimplePlanner) createIndex() error {
+	tm := pner.catalog_.GetTableByName(*pner.qi_.JoinTables_[0])
+	if tm == nil {
+		return ErrTableNotFound
+	}
+	if catalog.IsSystemCatalog(tm.OID()) {
+		return ErrNotSupported
+	}
+	// same as ALTER TABLE ... ADD INDEX
+	spec := &parser.AlterTableSpecExpression{AlterType_: parser.ALTER_ADD_INDEX, IndexDefExpressions_: pner.qi_.IndexDefExpressions_}
+	return pner.addIndexes(tm, spec)
+}
+
+// dropIndex removes the index of the table (DROP INDEX). pages of the index are released on commit.
+// indexes of columns of foreign keys can't be dropped because they are used for checking the constraint
+func (pner *SimplePlanner) dropIndex() error {
+	tm := pner.catalog_.GetTableByName(*pner.qi_.JoinTables_[0])
+	if tm == nil {
+		return ErrTableNotFound
+	}
+	if catalog.IsSystemCatalog(tm.OID()) {
+		return ErrNotSupported
+	}
+	index_ := tm.GetIndexByName(*pner.qi_.DropIndex_)
+	if index_ == nil {
+		if pner.qi_.IfExists_ {
+			return nil
+		}
+		return ErrIndexNotFound
+	}
+	if keyAttrs := index_.GetKeyAttrs(); len(keyAttrs) == 1 && tm.GetIndex(int(keyAttrs[0])) == index_ {
+		column_ := tm.Schema().GetColumn(keyAttrs[0])
+		if column_.GetForeignKey() != nil || len(pner.catalog_.GetReferencingColumns(tm.OID(), column_.GetColumnName())) > 0 {
+			return ErrIndexIsUsedByForeignKey
+		}
+	}
+	pner.catalog_.DropIndex(tm, index_, pner.txn_)
+	return nil
+}
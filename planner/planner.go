@@ -0,0 +1,32 @@
+package planner
+
+import (
+	"github.com/ryogrid/SamehadaDB/errors"
+	"github.com/ryogrid/SamehadaDB/execution/plans"
+	"github.com/ryogrid/SamehadaDB/parser"
+	"github.com/ryogrid/SamehadaDB/storage/access"
+)
+
+const ErrTableNotFound = errors.Error("table not found")
+const ErrTableAlreadyExists = errors.Error("table already exists")
+const ErrColumnNotFound = errors.Error("column not found")
+const ErrAmbiguousColumn = errors.Error("column reference is ambiguous")
+const ErrValueCountMismatch = errors.Error("number of values does not match number of columns")
+const ErrTypeMismatch = errors.Error("value type does not match column type")
+const ErrNotSupported = errors.Error("query is not supported")
+const ErrIndexAlreadyExists = errors.Error("index already exists")
+const ErrMultiplePrimaryKeys = errors.Error("multiple primary keys are defined")
+const ErrReferencedKeyNotUnique = errors.Error("referenced column of foreign key must have UNIQUE or PRIMARY KEY constraint")
+const ErrColumnAlreadyExists = errors.Error("column already exists")
+const ErrColumnIsReferenced = errors.Error("column is referenced by foreign key")
+const ErrIndexNotFound = errors.Error("index not found")
+const ErrIndexIsUsedByForeignKey = errors.Error("index is used for checking foreign key")
+
+/**
+ * Planner makes plan tree from QueryInfo which is output of parser.
+ * when the query is DDL (ex: CREATE TABLE), it is executed at MakePlan
+ * and nil is returned as plan.
+ */
+type Planner interface {
+	MakePlan(*parser.QueryInfo, *access.Transaction) (plans.Plan, error)
+}
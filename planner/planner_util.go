@@ -0,0 +1,302 @@
+package planner
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/ryogrid/SamehadaDB/catalog"
+	"github.com/ryogrid/SamehadaDB/execution/expression"
+	"github.com/ryogrid/SamehadaDB/parser"
+	"github.com/ryogrid/SamehadaDB/storage/table/column"
+	"github.com/ryogrid/SamehadaDB/storage/table/schema"
+	"github.com/ryogrid/SamehadaDB/types"
+)
+
+// tableScope is the set of tables which column names in a query can refer.
+// on join query, index 0 is left (outer) table and index 1 is right (inner) table
+type tableScope struct {
+	tables []*catalog.TableMetadata
+}
+
+// columnRef is a column name in query resolved to a column of a table in the scope
+type columnRef struct {
+	tableIdx int
+	colIdx   uint32
+	column_  *column.Column
+}
+
+func (cr *columnRef) equals(other *columnRef) bool {
+	return cr.tableIdx == other.tableIdx && cr.colIdx == other.colIdx
+}
+
+// splitColumnName splits "table.column" form name. when table name is not specified,
+// empty string is returned as table name
+func splitColumnName(name string) (string, string) {
+	if strings.Contains(name, ".") {
+		splited := strings.SplitN(name, ".", 2)
+		return splited[0], splited[1]
+	}
+	return "", name
+}
+
+func findColIndex(schema_ *schema.Schema, colName string) (uint32, bool) {
+	for ii := uint32(0); ii < schema_.GetColumnCount(); ii++ {
+		if schema_.GetColumn(ii).GetColumnName() == colName {
+			return ii, true
+		}
+	}
+	return 0, false
+}
+
+func (s *tableScope) resolveColumn(name string) (*columnRef, error) {
+	tableName, colName := splitColumnName(name)
+	var ret *columnRef = nil
+	for ii, tm := range s.tables {
+		if tableName != "" && tableName != tm.Name() {
+			continue
+		}
+		colIdx, ok := findColIndex(tm.Schema(), colName)
+		if !ok {
+			continue
+		}
+		if ret != nil {
+			return nil, ErrAmbiguousColumn
+		}
+		ret = &columnRef{ii, colIdx, tm.Schema().GetColumn(colIdx)}
+	}
+	if ret == nil {
+		if tableName != "" && s.findTable(tableName) == nil {
+			return nil, ErrTableNotFound
+		}
+		return nil, ErrColumnNotFound
+	}
+	return ret, nil
+}
+
+func (s *tableScope) findTable(name string) *catalog.TableMetadata {
+	for _, tm := range s.tables {
+		if tm.Name() == name {
+			return tm
+		}
+	}
+	return nil
+}
+
+// allColumns returns all columns of tables in the scope (used for wildcard)
+func (s *tableScope) allColumns() []*columnRef {
+	ret := make([]*columnRef, 0)
+	for ii, tm := range s.tables {
+		for jj, col := range tm.Schema().GetColumns() {
+			ret = append(ret, &columnRef{ii, uint32(jj), col})
+		}
+	}
+	return ret
+}
+
+// makeOutputSchema creates a new schema which has same name and type columns with passed refs.
+// columns of table schema must not be reused because NewSchema overwrites offset of columns
+func makeOutputSchema(refs []*columnRef) *schema.Schema {
+	cols := make([]*column.Column, 0)
+	for _, ref := range refs {
+		col := column.NewColumn(ref.column_.GetColumnName(), ref.column_.GetType(), false, nil)
+		col.SetIsLeft(ref.tableIdx == 0)
+		cols = append(cols, col)
+	}
+	return schema.NewSchema(cols)
+}
+
+func hasWhereClause(boe *parser.BinaryOpExpression) bool {
+	return boe != nil && boe.Left_ != nil
+}
+
+func isLogicalOp(boe *parser.BinaryOpExpression) bool {
+	return boe.LogicalOperationType_ != -1 && boe.ComparisonOperationType_ == -1
+}
+
+// splitConjuncts splits AND connected expressions to list of them
+func splitConjuncts(boe *parser.BinaryOpExpression) []*parser.BinaryOpExpression {
+	if isLogicalOp(boe) && boe.LogicalOperationType_ == expression.AND {
+		ret := splitConjuncts(boe.Left_.(*parser.BinaryOpExpression))
+		return append(ret, splitConjuncts(boe.Right_.(*parser.BinaryOpExpression))...)
+	}
+	return []*parser.BinaryOpExpression{boe}
+}
+
+// joinConjuncts is reverse operation of splitConjuncts
+func joinConjuncts(boes []*parser.BinaryOpExpression) *parser.BinaryOpExpression {
+	if len(boes) == 0 {
+		return nil
+	}
+	ret := boes[0]
+	for _, boe := range boes[1:] {
+		ret = &parser.BinaryOpExpression{LogicalOperationType_: expression.AND, ComparisonOperationType_: -1, Left_: ret, Right_: boe}
+	}
+	return ret
+}
+
+// referredTables returns set of table index in scope which are referred in the expression
+func (s *tableScope) referredTables(boe *parser.BinaryOpExpression) (map[int]bool, error) {
+	ret := make(map[int]bool)
+	for _, operand := range []interface{}{boe.Left_, boe.Right_} {
+		switch o := operand.(type) {
+		case *string:
+			ref, err := s.resolveColumn(*o)
+			if err != nil {
+				return nil, err
+			}
+			ret[ref.tableIdx] = true
+		case *parser.BinaryOpExpression:
+			tables, err := s.referredTables(o)
+			if err != nil {
+				return nil, err
+			}
+			for tableIdx := range tables {
+				ret[tableIdx] = true
+			}
+		}
+	}
+	return ret, nil
+}
+
+// castValue converts constant value in query to the type of the column compared or stored.
+// Integer is implicitly converted to Float and Boolean. NULL is converted to NULL of the type.
+// Varchar is converted to Integer, Float and Boolean when it can be parsed as the type
+// (string parameters of client protocols are passed as Varchar)
+func castValue(val *types.Value, colType types.TypeID) (*types.Value, error) {
+	if val.IsNull() {
+		return zeroValue(colType).SetNull(), nil
+	}
+	if val.ValueType() == colType {
+		return val, nil
+	}
+	switch {
+	case val.ValueType() == types.Integer && colType == types.Float:
+		ret := types.NewFloat(float32(val.ToInteger()))
+		return &ret, nil
+	case val.ValueType() == types.Integer && colType == types.Boolean:
+		ret := types.NewBoolean(val.ToInteger() != 0)
+		return &ret, nil
+	case val.ValueType() == types.Varchar && colType == types.Integer:
+		if parsed, err := strconv.ParseInt(strings.TrimSpace(val.ToVarchar()), 10, 32); err == nil {
+			ret := types.NewInteger(int32(parsed))
+			return &ret, nil
+		}
+	case val.ValueType() == types.Varchar && colType == types.Float:
+		if parsed, err := strconv.ParseFloat(strings.TrimSpace(val.ToVarchar()), 32); err == nil {
+			ret := types.NewFloat(float32(parsed))
+			return &ret, nil
+		}
+	case val.ValueType() == types.Varchar && colType == types.Boolean:
+		if parsed, err := strconv.ParseBool(strings.TrimSpace(val.ToVarchar())); err == nil {
+			ret := types.NewBoolean(parsed)
+			return &ret, nil
+		}
+	}
+	return nil, ErrTypeMismatch
+}
+
+// zeroValue returns default value of the type. it is used as NULL value source and dummy value
+func zeroValue(colType types.TypeID) *types.Value {
+	var ret types.Value
+	switch colType {
+	case types.Integer:
+		ret = types.NewInteger(0)
+	case types.Float:
+		ret = types.NewFloat(0)
+	case types.Boolean:
+		ret = types.NewBoolean(false)
+	default:
+		ret = types.NewVarchar("")
+	}
+	return &ret
+}
+
+// buildPredicate converts BinaryOpExpression tree to expression.Expression tree.
+// ColumnValue in the returned tree refers column index on schema of table which has the column
+// and tuple index is index of the table in the scope (0 or 1)
+func (s *tableScope) buildPredicate(boe *parser.BinaryOpExpression) (expression.Expression, error) {
+	if isLogicalOp(boe) {
+		left, err := s.buildPredicate(boe.Left_.(*parser.BinaryOpExpression))
+		if err != nil {
+			return nil, err
+		}
+		right, err := s.buildPredicate(boe.Right_.(*parser.BinaryOpExpression))
+		if err != nil {
+			return nil, err
+		}
+		return expression.NewLogicalOp(left, right, boe.LogicalOperationType_, types.Boolean), nil
+	}
+
+	if boe.ComparisonOperationType_ == -1 {
+		return nil, ErrNotSupported
+	}
+
+	// decide type of constant with the column of other side
+	var colType types.TypeID = types.Invalid
+	for _, operand := range []interface{}{boe.Left_, boe.Right_} {
+		if colName, ok := operand.(*string); ok {
+			ref, err := s.resolveColumn(*colName)
+			if err != nil {
+				return nil, err
+			}
+			colType = ref.column_.GetType()
+		}
+	}
+
+	operands := make([]expression.Expression, 2)
+	for ii, operand := range []interface{}{boe.Left_, boe.Right_} {
+		switch o := operand.(type) {
+		case *string:
+			ref, _ := s.resolveColumn(*o)
+			operands[ii] = expression.NewColumnValue(uint32(ref.tableIdx), ref.colIdx, ref.column_.GetType())
+		case *types.Value:
+			val := o
+			if colType != types.Invalid {
+				var err error
+				val, err = castValue(o, colType)
+				if err != nil {
+					return nil, err
+				}
+			}
+			operands[ii] = expression.NewConstantValue(*val, val.ValueType())
+		case *parser.BinaryOpExpression:
+			sub, err := s.buildPredicate(o)
+			if err != nil {
+				return nil, err
+			}
+			operands[ii] = sub
+		default:
+			return nil, ErrNotSupported
+		}
+	}
+
+	return expression.NewComparison(operands[0], operands[1], boe.ComparisonOperationType_, types.Boolean), nil
+}
+
+// buildCheckConstraints converts CHECK constraints of columns of the table to predicates.
+// as with SQL standard, the constraint is satisfied when value of the column is NULL
+func buildCheckConstraints(tm *catalog.TableMetadata) ([]expression.Expression, error) {
+	scope := &tableScope{[]*catalog.TableMetadata{tm}}
+	ret := make([]expression.Expression, 0)
+	for _, col := range tm.Schema().GetColumns() {
+		if col.GetCheckExpr() == "" {
+			continue
+		}
+		boe, err := parser.ParseExpression(col.GetCheckExpr())
+		if err != nil {
+			return nil, err
+		}
+		if !hasWhereClause(boe) {
+			return nil, ErrNotSupported
+		}
+		colName := col.GetColumnName()
+		nullVal := types.NewNull()
+		isNull := &parser.BinaryOpExpression{LogicalOperationType_: -1, ComparisonOperationType_: expression.Equal, Left_: &colName, Right_: &nullVal}
+		pred, err := scope.buildPredicate(&parser.BinaryOpExpression{LogicalOperationType_: expression.OR, ComparisonOperationType_: -1, Left_: isNull, Right_: boe})
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, pred)
+	}
+	return ret, nil
+}
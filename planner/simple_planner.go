@@ -0,0 +1,839 @@
+package planner
+
+import (
+	"math"
+	"strings"
+
+	"github.com/ryogrid/SamehadaDB/catalog"
+	"github.com/ryogrid/SamehadaDB/execution/expression"
+	"github.com/ryogrid/SamehadaDB/execution/plans"
+	"github.com/ryogrid/SamehadaDB/parser"
+	"github.com/ryogrid/SamehadaDB/storage/access"
+	"github.com/ryogrid/SamehadaDB/storage/index"
+	"github.com/ryogrid/SamehadaDB/storage/table/column"
+	"github.com/ryogrid/SamehadaDB/storage/table/schema"
+	"github.com/ryogrid/SamehadaDB/types"
+)
+
+/**
+ * SimplePlanner makes plan tree with simple rules. it does not estimate costs.
+ * - access path: PointScanIndex is used when conjuncts of WHERE clause constrain all key columns
+ *                of an index of multiple columns by equality with constants.
+ *                RangeScanIndex is used when conjuncts of WHERE clause compare a column
+ *                which has B+tree index with constants. HashScanIndex is used when WHERE
+ *                clause is a single equality comparison on a indexed column.
+ *                otherwise SeqScan is used
+ * - join: two tables equi-join only. HashJoin is used and WHERE clause is pushed down
+ *         to scans of each table
+ * - aggregation: COUNT, SUM, MIN, MAX without GROUP BY
+ */
+type SimplePlanner struct {
+	qi_      *parser.QueryInfo
+	catalog_ *catalog.Catalog
+	txn_     *access.Transaction
+}
+
+func NewSimplePlanner(catalog_ *catalog.Catalog) *SimplePlanner {
+	return &SimplePlanner{nil, catalog_, nil}
+}
+
+// MakePlan makes plan of the query. DDL is executed here and nil plan is returned.
+// tables of the query should be locked with LockTablesOfQuery before calling it
+func (pner *SimplePlanner) MakePlan(qi *parser.QueryInfo, txn *access.Transaction) (plans.Plan, error) {
+	pner.qi_ = qi
+	pner.txn_ = txn
+
+	switch *qi.QueryType_ {
+	case parser.SELECT:
+		return pner.makeSelectPlan()
+	case parser.CREATE_TABLE:
+		return nil, pner.createTable()
+	case parser.INSERT:
+		return pner.makeInsertPlan()
+	case parser.DELETE:
+		return pner.makeDeletePlan()
+	case parser.UPDATE:
+		return pner.makeUpdatePlan()
+	case parser.DROP_TABLE:
+		return nil, pner.dropTable()
+	case parser.ALTER_TABLE:
+		return nil, pner.alterTable()
+	case parser.CREATE_INDEX:
+		return nil, pner.createIndex()
+	case parser.DROP_INDEX:
+		return nil, pner.dropIndex()
+	default:
+		return nil, ErrNotSupported
+	}
+}
+
+func (pner *SimplePlanner) makeScope() (*tableScope, error) {
+	tables := make([]*catalog.TableMetadata, 0)
+	for _, tableName := range pner.qi_.JoinTables_ {
+		tm := pner.catalog_.GetTableByName(*tableName)
+		if tm == nil {
+			return nil, ErrTableNotFound
+		}
+		tables = append(tables, tm)
+	}
+	if len(tables) == 0 {
+		return nil, ErrNotSupported
+	}
+	return &tableScope{tables}, nil
+}
+
+func selectFieldName(field *parser.SelectFieldExpression) string {
+	if field.TableName_ != nil {
+		return *field.TableName_ + "." + *field.ColName_
+	}
+	return *field.ColName_
+}
+
+func (pner *SimplePlanner) makeSelectPlan() (plans.Plan, error) {
+	scope, err := pner.makeScope()
+	if err != nil {
+		return nil, err
+	}
+	if len(scope.tables) > 2 {
+		return nil, ErrNotSupported
+	}
+
+	isAgg := false
+	for _, field := range pner.qi_.SelectFields_ {
+		if field.IsAgg_ {
+			isAgg = true
+		}
+	}
+
+	var plan plans.Plan
+	if isAgg {
+		plan, err = pner.makeAggregationPlan(scope)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		outRefs := make([]*columnRef, 0)
+		for _, field := range pner.qi_.SelectFields_ {
+			if *field.ColName_ == "*" {
+				outRefs = append(outRefs, scope.allColumns()...)
+				continue
+			}
+			ref, err := scope.resolveColumn(selectFieldName(field))
+			if err != nil {
+				return nil, err
+			}
+			outRefs = append(outRefs, ref)
+		}
+
+		plan, err = pner.makeSourcePlan(scope, outRefs)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(pner.qi_.OrderByExpressions_) > 0 {
+			plan, err = pner.makeOrderbyPlan(scope, outRefs, plan)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if pner.qi_.LimitNum_ != -1 || pner.qi_.OffsetNum_ != -1 {
+		var limit uint32 = math.MaxUint32
+		var offset uint32 = 0
+		if pner.qi_.LimitNum_ != -1 {
+			limit = uint32(pner.qi_.LimitNum_)
+		}
+		if pner.qi_.OffsetNum_ != -1 {
+			offset = uint32(pner.qi_.OffsetNum_)
+		}
+		plan = plans.NewLimitPlanNode(plan, limit, offset)
+	}
+
+	return plan, nil
+}
+
+// makeSourcePlan makes scan or join plan which outputs columns specified with outRefs
+func (pner *SimplePlanner) makeSourcePlan(scope *tableScope, outRefs []*columnRef) (plans.Plan, error) {
+	if len(scope.tables) == 1 {
+		var where *parser.BinaryOpExpression = nil
+		if hasWhereClause(pner.qi_.WhereExpression_) {
+			where = pner.qi_.WhereExpression_
+		}
+		return pner.makeScanPlan(scope, makeOutputSchema(outRefs), where)
+	}
+	return pner.makeHashJoinPlan(scope, outRefs)
+}
+
+// makeScanPlan makes scan plan of the table which is only one in scope
+func (pner *SimplePlanner) makeScanPlan(scope *tableScope, outSchema *schema.Schema, where *parser.BinaryOpExpression) (plans.Plan, error) {
+	tm := scope.tables[0]
+	if where == nil {
+		return plans.NewSeqScanPlanNode(outSchema, nil, tm.OID()), nil
+	}
+
+	pointPlan, err := pner.makePointScanPlan(scope, outSchema, where)
+	if pointPlan != nil || err != nil {
+		return pointPlan, err
+	}
+
+	rangePlan, err := pner.makeRangeScanPlan(scope, outSchema, where)
+	if rangePlan != nil || err != nil {
+		return rangePlan, err
+	}
+
+	if where.ComparisonOperationType_ == expression.Equal {
+		colName, isLeftCol := where.Left_.(*string)
+		val, isRightVal := where.Right_.(*types.Value)
+		if !isLeftCol {
+			colName, isLeftCol = where.Right_.(*string)
+			val, isRightVal = where.Left_.(*types.Value)
+		}
+		if isLeftCol && isRightVal && !val.IsNull() {
+			ref, err := scope.resolveColumn(*colName)
+			if err != nil {
+				return nil, err
+			}
+			if tm.GetIndex(int(ref.colIdx)) != nil {
+				casted, err := castValue(val, ref.column_.GetType())
+				if err != nil {
+					return nil, err
+				}
+				colVal := expression.NewColumnValue(0, ref.colIdx, ref.column_.GetType())
+				constVal := expression.NewConstantValue(*casted, casted.ValueType())
+				pred := expression.NewComparison(colVal, constVal, expression.Equal, types.Boolean)
+				return plans.NewHashScanIndexPlanNode(outSchema, pred.(*expression.Comparison), tm.OID()), nil
+			}
+		}
+	}
+
+	pred, err := scope.buildPredicate(where)
+	if err != nil {
+		return nil, err
+	}
+	return plans.NewSeqScanPlanNode(outSchema, pred, tm.OID()), nil
+}
+
+// makePointScanPlan makes PointScanIndex plan when conjuncts of WHERE clause constrain all key columns
+// of an index of multiple columns by equality with constants. index which has most key columns is preferred.
+// whole WHERE clause is evaluated on fetched rows as residual predicate. nil is returned when the plan can't be used
+func (pner *SimplePlanner) makePointScanPlan(scope *tableScope, outSchema *schema.Schema, where *parser.BinaryOpExpression) (plans.Plan, error) {
+	tm := scope.tables[0]
+	if len(tm.GetMultiColumnIndexes()) == 0 {
+		return nil, nil
+	}
+
+	// column idx -> constant which the column equals to
+	equalVals := make(map[uint32]types.Value)
+	for _, conjunct := range splitConjuncts(where) {
+		if isLogicalOp(conjunct) || conjunct.ComparisonOperationType_ != expression.Equal {
+			continue
+		}
+		colName, isLeftCol := conjunct.Left_.(*string)
+		val, isRightVal := conjunct.Right_.(*types.Value)
+		if !isLeftCol {
+			colName, isLeftCol = conjunct.Right_.(*string)
+			val, isRightVal = conjunct.Left_.(*types.Value)
+		}
+		if !isLeftCol || !isRightVal || val.IsNull() {
+			continue
+		}
+		ref, err := scope.resolveColumn(*colName)
+		if err != nil {
+			return nil, err
+		}
+		casted, err := castValue(val, ref.column_.GetType())
+		if err != nil {
+			// type mismatch is reported on building predicate
+			continue
+		}
+		equalVals[ref.colIdx] = *casted
+	}
+
+	var found index.Index = nil
+	for _, index_ := range tm.GetMultiColumnIndexes() {
+		covered := true
+		for _, colIdx := range index_.GetKeyAttrs() {
+			if _, ok := equalVals[colIdx]; !ok {
+				covered = false
+				break
+			}
+		}
+		if covered && (found == nil || index_.GetIndexColumnCount() > found.GetIndexColumnCount()) {
+			found = index_
+		}
+	}
+	if found == nil {
+		return nil, nil
+	}
+
+	keyValues := make([]types.Value, 0, found.GetIndexColumnCount())
+	for _, colIdx := range found.GetKeyAttrs() {
+		keyValues = append(keyValues, equalVals[colIdx])
+	}
+	pred, err := scope.buildPredicate(where)
+	if err != nil {
+		return nil, err
+	}
+	return plans.NewPointScanIndexPlanNode(outSchema, tm.OID(), *found.GetName(), keyValues, pred), nil
+}
+
+// rangeBound is range of key on a column which is narrowed by conjuncts of WHERE clause
+type rangeBound struct {
+	low           *types.Value
+	lowInclusive  bool
+	high          *types.Value
+	highInclusive bool
+}
+
+// narrow applies "column <op> val" to the range. tighter bound is kept
+func (rb *rangeBound) narrow(op expression.ComparisonType, val *types.Value) {
+	if op == expression.Equal || op == expression.GreaterThan || op == expression.GreaterThanOrEqual {
+		inclusive := op != expression.GreaterThan
+		if rb.low == nil || val.CompareGreaterThan(*rb.low) || (val.CompareEquals(*rb.low) && !inclusive) {
+			rb.low, rb.lowInclusive = val, inclusive
+		}
+	}
+	if op == expression.Equal || op == expression.LessThan || op == expression.LessThanOrEqual {
+		inclusive := op != expression.LessThan
+		if rb.high == nil || val.CompareLessThan(*rb.high) || (val.CompareEquals(*rb.high) && !inclusive) {
+			rb.high, rb.highInclusive = val, inclusive
+		}
+	}
+}
+
+// makeRangeScanPlan makes RangeScanIndex plan when some conjuncts of WHERE clause compare
+// a column which has ordered index with constants. whole WHERE clause is evaluated on
+// fetched rows as residual predicate. nil is returned when the plan can't be used
+func (pner *SimplePlanner) makeRangeScanPlan(scope *tableScope, outSchema *schema.Schema, where *parser.BinaryOpExpression) (plans.Plan, error) {
+	tm := scope.tables[0]
+	bounds := make(map[uint32]*rangeBound)
+	var colIdxs []uint32
+	for _, conjunct := range splitConjuncts(where) {
+		op := conjunct.ComparisonOperationType_
+		if isLogicalOp(conjunct) || op == expression.NotEqual {
+			continue
+		}
+		colName, isLeftCol := conjunct.Left_.(*string)
+		val, isRightVal := conjunct.Right_.(*types.Value)
+		if !isLeftCol {
+			// "val <op> column" is same with "column <reversed op> val"
+			colName, isLeftCol = conjunct.Right_.(*string)
+			val, isRightVal = conjunct.Left_.(*types.Value)
+			switch op {
+			case expression.GreaterThan:
+				op = expression.LessThan
+			case expression.GreaterThanOrEqual:
+				op = expression.LessThanOrEqual
+			case expression.LessThan:
+				op = expression.GreaterThan
+			case expression.LessThanOrEqual:
+				op = expression.GreaterThanOrEqual
+			}
+		}
+		if !isLeftCol || !isRightVal || val.IsNull() {
+			continue
+		}
+		ref, err := scope.resolveColumn(*colName)
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := tm.GetIndex(int(ref.colIdx)).(index.RangeScanIndex); !ok {
+			continue
+		}
+		casted, err := castValue(val, ref.column_.GetType())
+		if err != nil {
+			// type mismatch is reported on building predicate
+			continue
+		}
+		if bounds[ref.colIdx] == nil {
+			bounds[ref.colIdx] = new(rangeBound)
+			colIdxs = append(colIdxs, ref.colIdx)
+		}
+		bounds[ref.colIdx].narrow(op, casted)
+	}
+	if len(colIdxs) == 0 {
+		return nil, nil
+	}
+
+	// column bounded on both sides is preferred
+	colIdx := colIdxs[0]
+	for _, idx := range colIdxs {
+		if bounds[idx].low != nil && bounds[idx].high != nil {
+			colIdx = idx
+			break
+		}
+	}
+	pred, err := scope.buildPredicate(where)
+	if err != nil {
+		return nil, err
+	}
+	rb := bounds[colIdx]
+	return plans.NewRangeScanIndexPlanNode(outSchema, tm.OID(), colIdx, rb.low, rb.lowInclusive, rb.high, rb.highInclusive, pred), nil
+}
+
+func (pner *SimplePlanner) makeHashJoinPlan(scope *tableScope, outRefs []*columnRef) (plans.Plan, error) {
+	on := pner.qi_.OnExpressions_
+	if !hasWhereClause(on) || on.ComparisonOperationType_ != expression.Equal {
+		return nil, ErrNotSupported
+	}
+	leftName, ok1 := on.Left_.(*string)
+	rightName, ok2 := on.Right_.(*string)
+	if !ok1 || !ok2 {
+		return nil, ErrNotSupported
+	}
+	leftRef, err := scope.resolveColumn(*leftName)
+	if err != nil {
+		return nil, err
+	}
+	rightRef, err := scope.resolveColumn(*rightName)
+	if err != nil {
+		return nil, err
+	}
+	if leftRef.tableIdx == rightRef.tableIdx {
+		return nil, ErrNotSupported
+	}
+	if leftRef.tableIdx != 0 {
+		leftRef, rightRef = rightRef, leftRef
+	}
+	if leftRef.column_.GetType() != rightRef.column_.GetType() {
+		return nil, ErrTypeMismatch
+	}
+
+	// push down conjuncts of WHERE clause to scan of the table they refer
+	conjuncts := make([][]*parser.BinaryOpExpression, 2)
+	if hasWhereClause(pner.qi_.WhereExpression_) {
+		for _, conjunct := range splitConjuncts(pner.qi_.WhereExpression_) {
+			tables, err := scope.referredTables(conjunct)
+			if err != nil {
+				return nil, err
+			}
+			if len(tables) > 1 {
+				return nil, ErrNotSupported
+			}
+			tableIdx := 0
+			for idx := range tables {
+				tableIdx = idx
+			}
+			conjuncts[tableIdx] = append(conjuncts[tableIdx], conjunct)
+		}
+	}
+
+	// children output all columns, so column index on child output schema
+	// is same with one on table schema
+	children := make([]plans.Plan, 0)
+	for ii, tm := range scope.tables {
+		childScope := &tableScope{[]*catalog.TableMetadata{tm}}
+		child, err := pner.makeScanPlan(childScope, makeOutputSchema(childScope.allColumns()), joinConjuncts(conjuncts[ii]))
+		if err != nil {
+			return nil, err
+		}
+		children = append(children, child)
+	}
+
+	leftKey := expression.NewColumnValue(0, leftRef.colIdx, leftRef.column_.GetType())
+	rightKey := expression.NewColumnValue(1, rightRef.colIdx, rightRef.column_.GetType())
+	pred := expression.NewComparison(leftKey, rightKey, expression.Equal, types.Boolean)
+	return plans.NewHashJoinPlanNode(makeOutputSchema(outRefs), children, pred,
+		[]expression.Expression{leftKey}, []expression.Expression{rightKey}), nil
+}
+
+func (pner *SimplePlanner) makeOrderbyPlan(scope *tableScope, outRefs []*columnRef, child plans.Plan) (plans.Plan, error) {
+	colIdxs := make([]int, 0)
+	orderTypes := make([]plans.OrderbyType, 0)
+	for _, obe := range pner.qi_.OrderByExpressions_ {
+		ref, err := scope.resolveColumn(*obe.ColName_)
+		if err != nil {
+			return nil, err
+		}
+		// sort key must be output of child because there is no projection plan
+		colIdx := -1
+		for ii, outRef := range outRefs {
+			if outRef.equals(ref) {
+				colIdx = ii
+				break
+			}
+		}
+		if colIdx == -1 {
+			return nil, ErrNotSupported
+		}
+		colIdxs = append(colIdxs, colIdx)
+		if obe.IsDesc_ {
+			orderTypes = append(orderTypes, plans.DESC)
+		} else {
+			orderTypes = append(orderTypes, plans.ASC)
+		}
+	}
+	return plans.NewOrderbyPlanNode(child.OutputSchema(), child, colIdxs, orderTypes), nil
+}
+
+func aggregationName(aggType plans.AggregationType) string {
+	switch aggType {
+	case plans.COUNT_AGGREGATE:
+		return "count"
+	case plans.SUM_AGGREGATE:
+		return "sum"
+	case plans.MIN_AGGREGATE:
+		return "min"
+	default:
+		return "max"
+	}
+}
+
+func (pner *SimplePlanner) makeAggregationPlan(scope *tableScope) (plans.Plan, error) {
+	// GROUP BY is not supported by parser
+	if len(pner.qi_.OrderByExpressions_) > 0 {
+		return nil, ErrNotSupported
+	}
+
+	allRefs := scope.allColumns()
+	child, err := pner.makeSourcePlan(scope, allRefs)
+	if err != nil {
+		return nil, err
+	}
+
+	aggregates := make([]expression.Expression, 0)
+	aggTypes := make([]plans.AggregationType, 0)
+	outCols := make([]*column.Column, 0)
+	for ii, field := range pner.qi_.SelectFields_ {
+		if !field.IsAgg_ {
+			return nil, ErrNotSupported
+		}
+
+		colIdx := -1
+		if *field.ColName_ == "*" {
+			if field.AggType_ != plans.COUNT_AGGREGATE {
+				return nil, ErrNotSupported
+			}
+			colIdx = 0
+		} else {
+			ref, err := scope.resolveColumn(selectFieldName(field))
+			if err != nil {
+				return nil, err
+			}
+			for jj, allRef := range allRefs {
+				if allRef.equals(ref) {
+					colIdx = jj
+					break
+				}
+			}
+			// aggregation executor calculates with Integer only
+			if field.AggType_ != plans.COUNT_AGGREGATE && ref.column_.GetType() != types.Integer {
+				return nil, ErrNotSupported
+			}
+		}
+
+		aggregates = append(aggregates, expression.NewColumnValue(0, uint32(colIdx), allRefs[colIdx].column_.GetType()))
+		aggTypes = append(aggTypes, field.AggType_)
+		aggVal := expression.NewAggregateValueExpression(false, uint32(ii), types.Integer).(*expression.AggregateValueExpression)
+		outCols = append(outCols, column.NewColumn(aggregationName(field.AggType_)+"("+selectFieldName(field)+")", types.Integer, false, *aggVal))
+	}
+
+	return plans.NewAggregationPlanNode(schema.NewSchema(outCols), child, nil,
+		[]expression.Expression{}, aggregates, aggTypes), nil
+}
+
+func (pner *SimplePlanner) getTargetTable() (*catalog.TableMetadata, error) {
+	scope, err := pner.makeScope()
+	if err != nil {
+		return nil, err
+	}
+	return scope.tables[0], nil
+}
+
+func (pner *SimplePlanner) makePredicate(tm *catalog.TableMetadata) (expression.Expression, error) {
+	if !hasWhereClause(pner.qi_.WhereExpression_) {
+		return nil, nil
+	}
+	scope := &tableScope{[]*catalog.TableMetadata{tm}}
+	return scope.buildPredicate(pner.qi_.WhereExpression_)
+}
+
+func (pner *SimplePlanner) makeInsertPlan() (plans.Plan, error) {
+	tm, err := pner.getTargetTable()
+	if err != nil {
+		return nil, err
+	}
+	scope := &tableScope{[]*catalog.TableMetadata{tm}}
+
+	targets := make([]*columnRef, 0)
+	if len(pner.qi_.TargetCols_) == 0 {
+		targets = scope.allColumns()
+	} else {
+		for _, colName := range pner.qi_.TargetCols_ {
+			ref, err := scope.resolveColumn(*colName)
+			if err != nil {
+				return nil, err
+			}
+			targets = append(targets, ref)
+		}
+	}
+
+	values := pner.qi_.Values_
+	if len(values) == 0 || len(values)%len(targets) != 0 {
+		return nil, ErrValueCountMismatch
+	}
+
+	// columns which are not specified are filled with default value or NULL
+	rows := make([][]types.Value, 0)
+	for ii := 0; ii < len(values); ii += len(targets) {
+		row := make([]types.Value, tm.GetColumnNum())
+		for jj, col := range tm.Schema().GetColumns() {
+			if col.GetDefaultValue() != nil {
+				row[jj] = *col.GetDefaultValue()
+			} else {
+				row[jj] = *zeroValue(col.GetType()).SetNull()
+			}
+		}
+		for jj, target := range targets {
+			casted, err := castValue(values[ii+jj], target.column_.GetType())
+			if err != nil {
+				return nil, err
+			}
+			row[target.colIdx] = *casted
+		}
+		rows = append(rows, row)
+	}
+
+	checks, err := buildCheckConstraints(tm)
+	if err != nil {
+		return nil, err
+	}
+	return plans.NewInsertPlanNodeWithChecks(rows, tm.OID(), checks), nil
+}
+
+func (pner *SimplePlanner) makeDeletePlan() (plans.Plan, error) {
+	tm, err := pner.getTargetTable()
+	if err != nil {
+		return nil, err
+	}
+	pred, err := pner.makePredicate(tm)
+	if err != nil {
+		return nil, err
+	}
+	return plans.NewDeletePlanNode(pred, tm.OID()), nil
+}
+
+func (pner *SimplePlanner) makeUpdatePlan() (plans.Plan, error) {
+	tm, err := pner.getTargetTable()
+	if err != nil {
+		return nil, err
+	}
+	scope := &tableScope{[]*catalog.TableMetadata{tm}}
+
+	// values of columns which are not update target are dummy
+	row := make([]types.Value, tm.GetColumnNum())
+	for ii, col := range tm.Schema().GetColumns() {
+		row[ii] = *zeroValue(col.GetType())
+	}
+	updateColIdxs := make([]int, 0)
+	for _, setExp := range pner.qi_.SetExpressions_ {
+		if setExp.UpdateValue_ == nil {
+			return nil, ErrNotSupported
+		}
+		ref, err := scope.resolveColumn(*setExp.ColName_)
+		if err != nil {
+			return nil, err
+		}
+		casted, err := castValue(setExp.UpdateValue_, ref.column_.GetType())
+		if err != nil {
+			return nil, err
+		}
+		row[ref.colIdx] = *casted
+		updateColIdxs = append(updateColIdxs, int(ref.colIdx))
+	}
+
+	pred, err := pner.makePredicate(tm)
+	if err != nil {
+		return nil, err
+	}
+	checks, err := buildCheckConstraints(tm)
+	if err != nil {
+		return nil, err
+	}
+	return plans.NewUpdatePlanNodeWithChecks(row, updateColIdxs, pred, tm.OID(), checks), nil
+}
+
+func (pner *SimplePlanner) createTable() error {
+	tableName := *pner.qi_.NewTable_
+	if pner.catalog_.IsTableNameUsed(tableName) {
+		return ErrTableAlreadyExists
+	}
+
+	cols := make([]*column.Column, 0)
+	for _, cdef := range pner.qi_.ColDefExpressions_ {
+		col, err := newColumnFromDef(cdef)
+		if err != nil {
+			return err
+		}
+		cols = append(cols, col)
+	}
+	// CHECK constraints are validated on temporal metadata which has no table heap and index
+	if _, err := buildCheckConstraints(catalog.NewTableMetadata(schema.NewSchema(cols), tableName, nil, 0)); err != nil {
+		return err
+	}
+	// index of single column is defined with flag of the column.
+	// index of multiple columns is created after creation of the table
+	multiColumnIdefs := make([]*parser.IndexDefExpression, 0)
+	multiColumnNames := make([]string, 0)
+	multiColumnKeyAttrs := make([][]uint32, 0)
+	indexNames := make(map[string]bool)
+	hasPrimaryKey := false
+	for _, idef := range pner.qi_.IndexDefExpressions_ {
+		if idef.Constraint_ == column.IndexConstraintPrimaryKey {
+			if hasPrimaryKey {
+				return ErrMultiplePrimaryKeys
+			}
+			hasPrimaryKey = true
+		}
+		keyAttrs := make([]uint32, 0, len(idef.Colnames_))
+		for _, colname := range idef.Colnames_ {
+			found := false
+			for idx, col := range cols {
+				if col.GetColumnName() == *colname {
+					keyAttrs = append(keyAttrs, uint32(idx))
+					found = true
+				}
+			}
+			if !found {
+				return ErrColumnNotFound
+			}
+		}
+		if len(keyAttrs) == 1 {
+			col := cols[keyAttrs[0]]
+			col.SetHasIndex(true)
+			if idef.IsBTree_ {
+				col.SetIndexKind(column.IndexKindBTree)
+			}
+			// when some definitions are on the same column, strictest constraint is used
+			if idef.Constraint_ > col.GetIndexConstraint() {
+				col.SetIndexConstraint(idef.Constraint_)
+			}
+			indexNames[col.GetColumnName()+"_index"] = true
+			continue
+		}
+		multiColumnIdefs = append(multiColumnIdefs, idef)
+		multiColumnKeyAttrs = append(multiColumnKeyAttrs, keyAttrs)
+	}
+	for _, fkdef := range pner.qi_.ForeignKeyDefExpressions_ {
+		col, err := pner.applyForeignKey(cols, fkdef)
+		if err != nil {
+			return err
+		}
+		indexNames[col.GetColumnName()+"_index"] = true
+	}
+	for _, idef := range multiColumnIdefs {
+		name := indexNameOf(idef)
+		if indexNames[name] {
+			return ErrIndexAlreadyExists
+		}
+		indexNames[name] = true
+		multiColumnNames = append(multiColumnNames, name)
+	}
+
+	tm := pner.catalog_.CreateTable(tableName, schema.NewSchema(cols), pner.txn_)
+	for ii, idef := range multiColumnIdefs {
+		if _, err := pner.catalog_.CreateIndex(tm, multiColumnNames[ii], multiColumnKeyAttrs[ii], indexKindOf(idef), idef.Constraint_, pner.txn_); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// newColumnFromDef makes column of the definition. default value is converted to type of the column
+func newColumnFromDef(cdef *parser.ColDefExpression) (*column.Column, error) {
+	col := column.NewColumn(*cdef.ColName_, *cdef.ColType_, false, nil)
+	col.SetIsNullable(cdef.IsNullable_)
+	if cdef.DefaultValue_ != nil && !cdef.DefaultValue_.IsNull() {
+		defaultValue, err := castValue(cdef.DefaultValue_, *cdef.ColType_)
+		if err != nil {
+			return nil, err
+		}
+		col.SetDefaultValue(defaultValue)
+	}
+	if cdef.CheckExpr_ != nil {
+		col.SetCheckExpr(*cdef.CheckExpr_)
+	}
+	return col, nil
+}
+
+// applyForeignKey sets foreign key of the definition to the column in cols and returns the column.
+// referencing column is indexed for finding referencing rows on deletion of referenced row
+func (pner *SimplePlanner) applyForeignKey(cols []*column.Column, fkdef *parser.ForeignKeyDefExpression) (*column.Column, error) {
+	if len(fkdef.Colnames_) != 1 || len(fkdef.RefColnames_) != 1 {
+		return nil, ErrNotSupported
+	}
+	colIdx, ok := findColIndex(schema.NewSchema(cols), *fkdef.Colnames_[0])
+	if !ok {
+		return nil, ErrColumnNotFound
+	}
+	refTable := pner.catalog_.GetTableByName(*fkdef.RefTable_)
+	if refTable == nil {
+		return nil, ErrTableNotFound
+	}
+	refColIdx, ok := findColIndex(refTable.Schema(), *fkdef.RefColnames_[0])
+	if !ok {
+		return nil, ErrColumnNotFound
+	}
+	col := cols[colIdx]
+	refCol := refTable.Schema().GetColumn(refColIdx)
+	if !refCol.HasIndex() || refCol.GetIndexConstraint() == column.IndexConstraintNone {
+		return nil, ErrReferencedKeyNotUnique
+	}
+	if col.GetType() != refCol.GetType() {
+		return nil, ErrTypeMismatch
+	}
+	col.SetHasIndex(true)
+	col.SetForeignKey(column.NewForeignKey(refTable.OID(), refCol.GetColumnName(), fkdef.OnDelete_))
+	return col, nil
+}
+
+// indexNameOf returns name of the index of multiple columns. when name is not specified,
+// it is named with the same rule as index of single column
+func indexNameOf(idef *parser.IndexDefExpression) string {
+	if idef.IndexName_ != nil && *idef.IndexName_ != "" {
+		return *idef.IndexName_
+	}
+	colnames := make([]string, 0, len(idef.Colnames_))
+	for _, colname := range idef.Colnames_ {
+		colnames = append(colnames, *colname)
+	}
+	return strings.Join(colnames, "_") + "_index"
+}
+
+func indexKindOf(idef *parser.IndexDefExpression) column.IndexKind {
+	if idef.IsBTree_ {
+		return column.IndexKindBTree
+	}
+	return column.IndexKindHash
+}
+
+// dropTable drops tables in the transaction. when a table is not found, nothing is dropped
+// unless IF EXISTS is specified
+func (pner *SimplePlanner) dropTable() error {
+	tables := make([]*catalog.TableMetadata, 0)
+	isListed := make(map[uint32]bool)
+	for _, tableName := range pner.qi_.DropTables_ {
+		tm := pner.catalog_.GetTableByName(*tableName)
+		if tm == nil {
+			if pner.qi_.IfExists_ {
+				continue
+			}
+			return ErrTableNotFound
+		}
+		if catalog.IsSystemCatalog(tm.OID()) {
+			return ErrNotSupported
+		}
+		if isListed[tm.OID()] {
+			continue
+		}
+		isListed[tm.OID()] = true
+		tables = append(tables, tm)
+	}
+	for _, tm := range tables {
+		if err := pner.catalog_.DropTable(tm, pner.txn_); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,294 @@
+package planner
+
+import (
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/ryogrid/SamehadaDB/catalog"
+	"github.com/ryogrid/SamehadaDB/execution/executors"
+	"github.com/ryogrid/SamehadaDB/execution/plans"
+	"github.com/ryogrid/SamehadaDB/parser"
+	"github.com/ryogrid/SamehadaDB/storage/access"
+	"github.com/ryogrid/SamehadaDB/storage/tuple"
+	"github.com/ryogrid/SamehadaDB/test_util"
+	testingpkg "github.com/ryogrid/SamehadaDB/testing"
+	"github.com/ryogrid/SamehadaDB/types"
+)
+
+func executeSQL(t *testing.T, pner Planner, exec_ctx *executors.ExecutorContext, txn *access.Transaction, sqlStr string) (plans.Plan, []*tuple.Tuple) {
+	qi := parser.ProcessSQLStr(&sqlStr)
+	plan, err := pner.MakePlan(qi, txn)
+	testingpkg.Ok(t, err)
+	if plan == nil {
+		return nil, nil
+	}
+	engine := &executors.ExecutionEngine{}
+	return plan, engine.Execute(plan, exec_ctx)
+}
+
+func makePlanErr(pner Planner, txn *access.Transaction, sqlStr string) error {
+	qi := parser.ProcessSQLStr(&sqlStr)
+	_, err := pner.MakePlan(qi, txn)
+	return err
+}
+
+func TestSimplePlannerSingleTable(t *testing.T) {
+	os.Remove("test.db")
+	os.Remove("test.log")
+	shi := test_util.NewSamehadaInstance()
+	defer shi.Finalize(true)
+
+	txn_mgr := shi.GetTransactionManager()
+	txn := txn_mgr.Begin(nil)
+	c := catalog.BootstrapCatalog(shi.GetBufferPoolManager(), shi.GetLogManager(), shi.GetLockManager(), txn)
+	exec_ctx := executors.NewExecutorContext(c, shi.GetBufferPoolManager(), txn)
+	pner := NewSimplePlanner(c)
+
+	executeSQL(t, pner, exec_ctx, txn, "CREATE TABLE name_age_list(id INT, name VARCHAR(256), age INT, weight FLOAT, index id_idx (id));")
+	testingpkg.Assert(t, c.GetTableByName("name_age_list") != nil, "table should be created")
+	testingpkg.Assert(t, c.GetTableByName("name_age_list").GetIndex(0) != nil, "id column should have index")
+
+	executeSQL(t, pner, exec_ctx, txn, "INSERT INTO name_age_list(id, name, age, weight) VALUES (1, 'Ryo Kanbayashi', 30, 60.5), (2, 'Yui', 25, 45), (3, 'Ken', -5, 70.0);")
+	executeSQL(t, pner, exec_ctx, txn, "INSERT INTO name_age_list(id, name) VALUES (4, 'Nana');")
+
+	plan, results := executeSQL(t, pner, exec_ctx, txn, "SELECT name, age FROM name_age_list WHERE id = 2;")
+	testingpkg.Equals(t, plans.HashScanIndex, plan.GetType())
+	testingpkg.Equals(t, 1, len(results))
+	testingpkg.Assert(t, results[0].GetValue(plan.OutputSchema(), 0).CompareEquals(types.NewVarchar("Yui")), "name should be Yui")
+
+	// string constant is converted to type of the column
+	_, results = executeSQL(t, pner, exec_ctx, txn, "SELECT name FROM name_age_list WHERE id = '3';")
+	testingpkg.Equals(t, 1, len(results))
+
+	plan, results = executeSQL(t, pner, exec_ctx, txn, "SELECT * FROM name_age_list WHERE age < 30;")
+	testingpkg.Equals(t, plans.SeqScan, plan.GetType())
+	testingpkg.Equals(t, 2, len(results))
+	testingpkg.Equals(t, uint32(4), plan.OutputSchema().GetColumnCount())
+
+	_, results = executeSQL(t, pner, exec_ctx, txn, "SELECT id FROM name_age_list WHERE weight >= 60 AND name != 'Ken';")
+	testingpkg.Equals(t, 1, len(results))
+
+	_, results = executeSQL(t, pner, exec_ctx, txn, "SELECT id FROM name_age_list WHERE age IS NULL;")
+	testingpkg.Equals(t, 1, len(results))
+	testingpkg.Equals(t, int32(4), results[0].GetValue(plan.OutputSchema(), 0).ToInteger())
+
+	plan, results = executeSQL(t, pner, exec_ctx, txn, "SELECT id, age FROM name_age_list WHERE age IS NOT NULL ORDER BY age DESC LIMIT 2;")
+	testingpkg.Equals(t, plans.Limit, plan.GetType())
+	testingpkg.Equals(t, 2, len(results))
+	testingpkg.Equals(t, int32(1), results[0].GetValue(plan.OutputSchema(), 0).ToInteger())
+	testingpkg.Equals(t, int32(2), results[1].GetValue(plan.OutputSchema(), 0).ToInteger())
+
+	plan, results = executeSQL(t, pner, exec_ctx, txn, "SELECT count(*), sum(age), max(age) FROM name_age_list WHERE id < 4;")
+	testingpkg.Equals(t, plans.Aggregation, plan.GetType())
+	testingpkg.Equals(t, 1, len(results))
+	testingpkg.Equals(t, int32(3), results[0].GetValue(plan.OutputSchema(), 0).ToInteger())
+	testingpkg.Equals(t, int32(50), results[0].GetValue(plan.OutputSchema(), 1).ToInteger())
+	testingpkg.Equals(t, int32(30), results[0].GetValue(plan.OutputSchema(), 2).ToInteger())
+
+	executeSQL(t, pner, exec_ctx, txn, "UPDATE name_age_list SET age = 26 WHERE name = 'Yui';")
+	_, results = executeSQL(t, pner, exec_ctx, txn, "SELECT age FROM name_age_list WHERE name = 'Yui';")
+	testingpkg.Equals(t, 1, len(results))
+	testingpkg.Equals(t, int32(26), results[0].GetValue(plan.OutputSchema(), 0).ToInteger())
+
+	executeSQL(t, pner, exec_ctx, txn, "DELETE FROM name_age_list WHERE age < 0;")
+	_, results = executeSQL(t, pner, exec_ctx, txn, "SELECT id FROM name_age_list;")
+	testingpkg.Equals(t, 3, len(results))
+
+	txn_mgr.Commit(txn)
+}
+
+func TestSimplePlannerRangeScan(t *testing.T) {
+	os.Remove("test.db")
+	os.Remove("test.log")
+	shi := test_util.NewSamehadaInstance()
+	defer shi.Finalize(true)
+
+	txn_mgr := shi.GetTransactionManager()
+	txn := txn_mgr.Begin(nil)
+	c := catalog.BootstrapCatalog(shi.GetBufferPoolManager(), shi.GetLogManager(), shi.GetLockManager(), txn)
+	exec_ctx := executors.NewExecutorContext(c, shi.GetBufferPoolManager(), txn)
+	pner := NewSimplePlanner(c)
+
+	executeSQL(t, pner, exec_ctx, txn, "CREATE TABLE name_age_list(name VARCHAR(256), age INT, INDEX age_idx (age) USING BTREE);")
+	for ii := 0; ii < 50; ii++ {
+		executeSQL(t, pner, exec_ctx, txn, fmt.Sprintf("INSERT INTO name_age_list(name, age) VALUES ('name%d', %d);", ii, 49-ii))
+	}
+
+	plan, results := executeSQL(t, pner, exec_ctx, txn, "SELECT age FROM name_age_list WHERE age BETWEEN 20 AND 30;")
+	testingpkg.Equals(t, plans.RangeScanIndex, plan.GetType())
+	testingpkg.Equals(t, 11, len(results))
+	for ii, result := range results {
+		testingpkg.Equals(t, int32(20+ii), result.GetValue(plan.OutputSchema(), 0).ToInteger())
+	}
+
+	// tightest bounds are used and constant on left side is handled
+	plan, results = executeSQL(t, pner, exec_ctx, txn, "SELECT age FROM name_age_list WHERE age > 10 AND 15 > age AND age >= 12 AND name != 'name36';")
+	rangePlan := plan.(*plans.RangeScanIndexPlanNode)
+	testingpkg.Equals(t, int32(12), rangePlan.GetLowKey().ToInteger())
+	testingpkg.SimpleAssert(t, rangePlan.IsLowInclusive())
+	testingpkg.Equals(t, int32(15), rangePlan.GetHighKey().ToInteger())
+	testingpkg.SimpleAssert(t, !rangePlan.IsHighInclusive())
+	// age = 13 is filtered out by residual predicate
+	testingpkg.Equals(t, 2, len(results))
+
+	plan, results = executeSQL(t, pner, exec_ctx, txn, "SELECT name FROM name_age_list WHERE age = 40;")
+	testingpkg.Equals(t, plans.RangeScanIndex, plan.GetType())
+	testingpkg.Equals(t, 1, len(results))
+	testingpkg.Equals(t, "name9", results[0].GetValue(plan.OutputSchema(), 0).ToVarchar())
+
+	plan, results = executeSQL(t, pner, exec_ctx, txn, "SELECT name FROM name_age_list WHERE age < 5 OR age > 45;")
+	testingpkg.Equals(t, plans.SeqScan, plan.GetType())
+	testingpkg.Equals(t, 9, len(results))
+
+	txn_mgr.Commit(txn)
+}
+
+func TestSimplePlannerPointScan(t *testing.T) {
+	os.Remove("test.db")
+	os.Remove("test.log")
+	shi := test_util.NewSamehadaInstance()
+	defer shi.Finalize(true)
+
+	txn_mgr := shi.GetTransactionManager()
+	txn := txn_mgr.Begin(nil)
+	c := catalog.BootstrapCatalog(shi.GetBufferPoolManager(), shi.GetLogManager(), shi.GetLockManager(), txn)
+	exec_ctx := executors.NewExecutorContext(c, shi.GetBufferPoolManager(), txn)
+	pner := NewSimplePlanner(c)
+
+	executeSQL(t, pner, exec_ctx, txn, "CREATE TABLE staff(id INT, name VARCHAR(256), dept INT, age INT, INDEX name_dept_idx (name, dept), INDEX dept_age_idx (dept, age) USING BTREE);")
+	testingpkg.Equals(t, 2, len(c.GetTableByName("staff").GetMultiColumnIndexes()))
+	for ii := 0; ii < 30; ii++ {
+		executeSQL(t, pner, exec_ctx, txn, fmt.Sprintf("INSERT INTO staff VALUES (%d, 'name%d', %d, %d);", ii, ii%5, ii%3, 20+ii%4))
+	}
+
+	plan, results := executeSQL(t, pner, exec_ctx, txn, "SELECT id FROM staff WHERE name = 'name1' AND dept = 2;")
+	testingpkg.Equals(t, plans.PointScanIndex, plan.GetType())
+	testingpkg.Equals(t, "name_dept_idx", plan.(*plans.PointScanIndexPlanNode).GetIndexName())
+	// 11 and 26
+	testingpkg.Equals(t, 2, len(results))
+
+	// constant on left side and residual predicate
+	plan, results = executeSQL(t, pner, exec_ctx, txn, "SELECT id FROM staff WHERE 21 = age AND dept = 0 AND id > 10;")
+	testingpkg.Equals(t, plans.PointScanIndex, plan.GetType())
+	testingpkg.Equals(t, "dept_age_idx", plan.(*plans.PointScanIndexPlanNode).GetIndexName())
+	// 21
+	testingpkg.Equals(t, 1, len(results))
+	testingpkg.Equals(t, int32(21), results[0].GetValue(plan.OutputSchema(), 0).ToInteger())
+
+	// index can't be used when some key columns are not constrained
+	plan, results = executeSQL(t, pner, exec_ctx, txn, "SELECT id FROM staff WHERE dept = 0;")
+	testingpkg.Equals(t, plans.SeqScan, plan.GetType())
+	testingpkg.Equals(t, 10, len(results))
+
+	// entries are maintained on update and delete
+	executeSQL(t, pner, exec_ctx, txn, "UPDATE staff SET dept = 2 WHERE id = 1;")
+	executeSQL(t, pner, exec_ctx, txn, "DELETE FROM staff WHERE id = 26;")
+	_, results = executeSQL(t, pner, exec_ctx, txn, "SELECT id FROM staff WHERE name = 'name1' AND dept = 2;")
+	testingpkg.Equals(t, 2, len(results))
+	_, results = executeSQL(t, pner, exec_ctx, txn, "SELECT id FROM staff WHERE dept = 1 AND age = 21;")
+	// 13 and 25
+	testingpkg.Equals(t, 2, len(results))
+
+	testingpkg.Equals(t, ErrIndexAlreadyExists, makePlanErr(pner, txn, "CREATE TABLE t(a INT, b INT, INDEX ab_idx (a, b), INDEX ab_idx (b, a));"))
+	testingpkg.Equals(t, ErrColumnNotFound, makePlanErr(pner, txn, "CREATE TABLE t(a INT, b INT, INDEX ab_idx (a, x));"))
+
+	txn_mgr.Commit(txn)
+}
+
+func TestSimplePlannerHashJoin(t *testing.T) {
+	os.Remove("test.db")
+	os.Remove("test.log")
+	shi := test_util.NewSamehadaInstance()
+	defer shi.Finalize(true)
+
+	txn_mgr := shi.GetTransactionManager()
+	txn := txn_mgr.Begin(nil)
+	c := catalog.BootstrapCatalog(shi.GetBufferPoolManager(), shi.GetLogManager(), shi.GetLockManager(), txn)
+	exec_ctx := executors.NewExecutorContext(c, shi.GetBufferPoolManager(), txn)
+	pner := NewSimplePlanner(c)
+
+	executeSQL(t, pner, exec_ctx, txn, "CREATE TABLE staff(id INT, name VARCHAR(256), dept INT);")
+	executeSQL(t, pner, exec_ctx, txn, "CREATE TABLE dept(id INT, title VARCHAR(256));")
+	executeSQL(t, pner, exec_ctx, txn, "INSERT INTO staff VALUES (1, 'foo', 10), (2, 'bar', 20), (3, 'baz', 10);")
+	executeSQL(t, pner, exec_ctx, txn, "INSERT INTO dept VALUES (10, 'sales'), (20, 'dev');")
+
+	plan, results := executeSQL(t, pner, exec_ctx, txn, "SELECT staff.name, dept.title FROM staff INNER JOIN dept ON staff.dept = dept.id WHERE dept.title = 'sales';")
+	testingpkg.Equals(t, plans.HashJoin, plan.GetType())
+	testingpkg.Equals(t, 2, len(results))
+	for _, result := range results {
+		testingpkg.Assert(t, result.GetValue(plan.OutputSchema(), 1).CompareEquals(types.NewVarchar("sales")), "title should be sales")
+	}
+
+	// ON clause written in reverse order
+	_, results = executeSQL(t, pner, exec_ctx, txn, "SELECT name, title FROM staff INNER JOIN dept ON dept.id = staff.dept WHERE staff.id > 1;")
+	testingpkg.Equals(t, 2, len(results))
+
+	txn_mgr.Commit(txn)
+}
+
+func TestSimplePlannerErrors(t *testing.T) {
+	os.Remove("test.db")
+	os.Remove("test.log")
+	shi := test_util.NewSamehadaInstance()
+	defer shi.Finalize(true)
+
+	txn_mgr := shi.GetTransactionManager()
+	txn := txn_mgr.Begin(nil)
+	c := catalog.BootstrapCatalog(shi.GetBufferPoolManager(), shi.GetLogManager(), shi.GetLockManager(), txn)
+	exec_ctx := executors.NewExecutorContext(c, shi.GetBufferPoolManager(), txn)
+	pner := NewSimplePlanner(c)
+
+	executeSQL(t, pner, exec_ctx, txn, "CREATE TABLE t1(a INT, b VARCHAR(256));")
+	executeSQL(t, pner, exec_ctx, txn, "CREATE TABLE t2(a INT, c INT);")
+
+	testingpkg.Equals(t, ErrTableNotFound, makePlanErr(pner, txn, "SELECT a FROM no_table;"))
+	testingpkg.Equals(t, ErrTableNotFound, makePlanErr(pner, txn, "INSERT INTO no_table VALUES (1);"))
+	testingpkg.Equals(t, ErrColumnNotFound, makePlanErr(pner, txn, "SELECT x FROM t1;"))
+	testingpkg.Equals(t, ErrColumnNotFound, makePlanErr(pner, txn, "SELECT a FROM t1 WHERE x = 1;"))
+	testingpkg.Equals(t, ErrColumnNotFound, makePlanErr(pner, txn, "UPDATE t1 SET x = 1;"))
+	testingpkg.Equals(t, ErrAmbiguousColumn, makePlanErr(pner, txn, "SELECT a FROM t1 INNER JOIN t2 ON t1.a = t2.a;"))
+	testingpkg.Equals(t, ErrTableAlreadyExists, makePlanErr(pner, txn, "CREATE TABLE t1(a INT);"))
+	testingpkg.Equals(t, ErrMultiplePrimaryKeys, makePlanErr(pner, txn, "CREATE TABLE t3(a INT PRIMARY KEY, b INT, PRIMARY KEY (a, b));"))
+	testingpkg.Equals(t, ErrValueCountMismatch, makePlanErr(pner, txn, "INSERT INTO t1(a, b) VALUES (1, 'x', 2);"))
+	testingpkg.Equals(t, ErrTypeMismatch, makePlanErr(pner, txn, "INSERT INTO t1(a, b) VALUES ('x', 'y');"))
+
+	txn_mgr.Commit(txn)
+}
+
+func TestInferConstantTypes(t *testing.T) {
+	os.Remove("test.db")
+	os.Remove("test.log")
+	shi := test_util.NewSamehadaInstance()
+	defer shi.Finalize(true)
+
+	txn_mgr := shi.GetTransactionManager()
+	txn := txn_mgr.Begin(nil)
+	c := catalog.BootstrapCatalog(shi.GetBufferPoolManager(), shi.GetLogManager(), shi.GetLockManager(), txn)
+	exec_ctx := executors.NewExecutorContext(c, shi.GetBufferPoolManager(), txn)
+	pner := NewSimplePlanner(c)
+
+	executeSQL(t, pner, exec_ctx, txn, "CREATE TABLE t1(a INT, b VARCHAR(256), c FLOAT);")
+
+	inferTypes := func(sqlStr string) []types.TypeID {
+		qi := parser.ProcessSQLStr(&sqlStr)
+		inferred := InferConstantTypes(qi, c)
+		ret := make([]types.TypeID, 0)
+		for _, val := range qi.Values_ {
+			ret = append(ret, inferred[val])
+		}
+		for _, setExpr := range qi.SetExpressions_ {
+			ret = append(ret, inferred[setExpr.UpdateValue_])
+		}
+		if qi.WhereExpression_ != nil && qi.WhereExpression_.Left_ != nil {
+			ret = append(ret, inferred[qi.WhereExpression_.Right_.(*types.Value)])
+		}
+		return ret
+	}
+
+	testingpkg.Equals(t, []types.TypeID{types.Float, types.Integer, types.Float, types.Integer}, inferTypes("INSERT INTO t1(c, a) VALUES ('x', 'y'), ('z', 'w');"))
+	testingpkg.Equals(t, []types.TypeID{types.Varchar, types.Integer}, inferTypes("UPDATE t1 SET b = 'x' WHERE a = 'y';"))
+	testingpkg.Equals(t, []types.TypeID{types.Float}, inferTypes("DELETE FROM t1 WHERE c = 'x';"))
+
+	txn_mgr.Commit(txn)
+}
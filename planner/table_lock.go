@@ -0,0 +1,65 @@
+package planner
+
+import (
+	"github.com/ryogrid/SamehadaDB/catalog"
+	"github.com/ryogrid/SamehadaDB/parser"
+	"github.com/ryogrid/SamehadaDB/storage/access"
+)
+
+// LockTablesOfQuery acquires locks on tables accessed by the query. it must be called before MakePlan
+// and outside of lock which serializes planning, because it may wait for other transactions.
+// DDL acquires EXCLUSIVE lock on the target tables and DML acquires intention lock,
+// so columns and indexes bound to a plan are not changed by DDL until the transaction finishes.
+// tables referenced by foreign keys of defined columns are locked with INTENTION_SHARED for
+// preventing them from being dropped. tables which are not found are reported by planning
+func LockTablesOfQuery(catalog_ *catalog.Catalog, qi *parser.QueryInfo, txn *access.Transaction) error {
+	var targets []*string
+	lockMode := access.INTENTION_SHARED
+	refTables := make([]*string, 0)
+	switch *qi.QueryType_ {
+	case parser.SELECT:
+		targets = qi.JoinTables_
+	case parser.INSERT, parser.UPDATE, parser.DELETE:
+		targets = qi.JoinTables_
+		lockMode = access.INTENTION_EXCLUSIVE
+	case parser.ALTER_TABLE, parser.CREATE_INDEX, parser.DROP_INDEX:
+		targets = qi.JoinTables_
+		lockMode = access.EXCLUSIVE
+		for _, spec := range qi.AlterTableSpecs_ {
+			for _, fkdef := range spec.ForeignKeyDefExpressions_ {
+				refTables = append(refTables, fkdef.RefTable_)
+			}
+		}
+	case parser.DROP_TABLE:
+		targets = qi.DropTables_
+		lockMode = access.EXCLUSIVE
+	case parser.CREATE_TABLE:
+		for _, fkdef := range qi.ForeignKeyDefExpressions_ {
+			refTables = append(refTables, fkdef.RefTable_)
+		}
+	}
+
+	if err := lockTablesByName(catalog_, targets, lockMode, txn); err != nil {
+		return err
+	}
+	return lockTablesByName(catalog_, refTables, access.INTENTION_SHARED, txn)
+}
+
+// system catalogs are not locked because they are not changed with DDL.
+// when the name points other table after waiting (dropped and created again), the table is locked again
+func lockTablesByName(catalog_ *catalog.Catalog, names []*string, lockMode access.LockMode, txn *access.Transaction) error {
+	for _, name := range names {
+		tm := catalog_.GetTableByName(*name)
+		for tm != nil && !catalog.IsSystemCatalog(tm.OID()) {
+			if err := catalog_.LockTable(tm, lockMode, txn); err != nil {
+				return err
+			}
+			latest := catalog_.GetTableByName(*name)
+			if latest != nil && latest.OID() == tm.OID() {
+				break
+			}
+			tm = latest
+		}
+	}
+	return nil
+}
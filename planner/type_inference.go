@@ -0,0 +1,83 @@
+package planner
+
+import (
+	"github.com/ryogrid/SamehadaDB/catalog"
+	"github.com/ryogrid/SamehadaDB/parser"
+	"github.com/ryogrid/SamehadaDB/types"
+)
+
+// InferConstantTypes returns types of columns which each constant in the query is
+// stored to (INSERT, UPDATE) or compared with (WHERE, ON). constants whose type
+// can't be decided are not included in returned map.
+// it is used for deciding types of placeholder parameters of client protocols
+func InferConstantTypes(qi *parser.QueryInfo, catalog_ *catalog.Catalog) map[*types.Value]types.TypeID {
+	ret := make(map[*types.Value]types.TypeID)
+
+	tables := make([]*catalog.TableMetadata, 0)
+	for _, tableName := range qi.JoinTables_ {
+		tm := catalog_.GetTableByName(*tableName)
+		if tm == nil {
+			return ret
+		}
+		tables = append(tables, tm)
+	}
+	if len(tables) == 0 {
+		return ret
+	}
+	scope := &tableScope{tables}
+
+	switch *qi.QueryType_ {
+	case parser.INSERT:
+		targets := make([]*columnRef, 0)
+		if len(qi.TargetCols_) == 0 {
+			targets = scope.allColumns()
+		} else {
+			for _, colName := range qi.TargetCols_ {
+				ref, err := scope.resolveColumn(*colName)
+				if err != nil {
+					return ret
+				}
+				targets = append(targets, ref)
+			}
+		}
+		for ii, val := range qi.Values_ {
+			ret[val] = targets[ii%len(targets)].column_.GetType()
+		}
+	case parser.UPDATE:
+		for _, setExpr := range qi.SetExpressions_ {
+			if ref, err := scope.resolveColumn(*setExpr.ColName_); err == nil {
+				ret[setExpr.UpdateValue_] = ref.column_.GetType()
+			}
+		}
+	}
+
+	if hasWhereClause(qi.WhereExpression_) {
+		scope.inferComparedTypes(qi.WhereExpression_, ret)
+	}
+	if hasWhereClause(qi.OnExpressions_) {
+		scope.inferComparedTypes(qi.OnExpressions_, ret)
+	}
+	return ret
+}
+
+func (s *tableScope) inferComparedTypes(boe *parser.BinaryOpExpression, types_ map[*types.Value]types.TypeID) {
+	var colType types.TypeID = types.Invalid
+	for _, operand := range []interface{}{boe.Left_, boe.Right_} {
+		if colName, ok := operand.(*string); ok {
+			if ref, err := s.resolveColumn(*colName); err == nil {
+				colType = ref.column_.GetType()
+			}
+		}
+	}
+
+	for _, operand := range []interface{}{boe.Left_, boe.Right_} {
+		switch o := operand.(type) {
+		case *types.Value:
+			if colType != types.Invalid {
+				types_[o] = colType
+			}
+		case *parser.BinaryOpExpression:
+			s.inferComparedTypes(o, types_)
+		}
+	}
+}
@@ -52,6 +52,9 @@ func NewLogManager(disk_manager *disk.DiskManager) *LogManager {
 func (log_manager *LogManager) GetNextLSN() types.LSN       { return log_manager.next_lsn }
 func (log_manager *LogManager) GetPersistentLSN() types.LSN { return log_manager.persistent_lsn }
 
+// SetNextLSN sets LSN of the next log record. it must be called while no record is appended
+func (log_manager *LogManager) SetNextLSN(lsn types.LSN) { log_manager.next_lsn = lsn }
+
 //func (log_manager *LogManager) SetPersistentLSN(lsn types.LSN) { log_manager.persistent_lsn = lsn }
 //func (log_manager *LogManager) GetLogBuffer() []byte           { return log_manager.log_buffer }
 
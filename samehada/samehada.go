@@ -0,0 +1,329 @@
+package samehada
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/ryogrid/SamehadaDB/catalog"
+	"github.com/ryogrid/SamehadaDB/concurrency"
+	"github.com/ryogrid/SamehadaDB/errors"
+	"github.com/ryogrid/SamehadaDB/execution/executors"
+	"github.com/ryogrid/SamehadaDB/execution/plans"
+	"github.com/ryogrid/SamehadaDB/parser"
+	"github.com/ryogrid/SamehadaDB/planner"
+	"github.com/ryogrid/SamehadaDB/recovery"
+	"github.com/ryogrid/SamehadaDB/recovery/log_recovery"
+	"github.com/ryogrid/SamehadaDB/storage/access"
+	"github.com/ryogrid/SamehadaDB/storage/buffer"
+	"github.com/ryogrid/SamehadaDB/storage/disk"
+	"github.com/ryogrid/SamehadaDB/storage/tuple"
+	"github.com/ryogrid/SamehadaDB/types"
+)
+
+// BufferPoolFrameNum is number of frames of buffer pool used by SamehadaDB instance
+const BufferPoolFrameNum = 1024
+
+const ErrTxnAborted = errors.Error("transaction was aborted")
+
+/**
+ * SamehadaDB is embedded database facade.
+ * it holds all components of the database system which works on a db file
+ * and executes SQL strings passed from user.
+ */
+type SamehadaDB struct {
+	disk_manager_       disk.DiskManager
+	log_manager_        *recovery.LogManager
+	bpm_                *buffer.BufferPoolManager
+	lock_manager_       *access.LockManager
+	txn_manager_        *access.TransactionManager
+	checkpoint_manager_ *concurrency.CheckpointManager
+	catalog_            *catalog.Catalog
+	planner_            planner.Planner
+	exec_engine_        *executors.ExecutionEngine
+	// planner and catalog are not thread safe
+	planner_mutex_ *sync.Mutex
+}
+
+/**
+ * Result is result of a SQL statement.
+ * on SELECT, ColumnNames, ColumnTypes and Rows are filled.
+ * on INSERT, UPDATE and DELETE, RowsAffected is filled.
+ */
+type Result struct {
+	QueryType    parser.QueryType
+	ColumnNames  []string
+	ColumnTypes  []types.TypeID
+	Rows         [][]types.Value
+	RowsAffected int64
+}
+
+/**
+ * Options is settings of SamehadaDB instance passed to OpenWithOptions.
+ * DefaultOptions returns settings used by Open.
+ */
+type Options struct {
+	// how deadlocks between transactions are handled. DETECTION, WAIT_DIE and WOUND_WAIT are supported.
+	// with SS2PL_MODE, transactions in deadlock wait until lock wait timeout
+	DeadlockMode access.DeadlockMode
+}
+
+func DefaultOptions() *Options {
+	return &Options{DeadlockMode: access.SS2PL_MODE}
+}
+
+// Open opens db file at path with default options. when the file does not exist, new database is created.
+// when the file exists, recovery with log file runs and catalog is reloaded from the db file.
+// indexes are reopened from the db file and are rebuilt when previous process exited in not graceful
+func Open(path string) (*SamehadaDB, error) {
+	return OpenWithOptions(path, DefaultOptions())
+}
+
+// OpenWithOptions is same as Open but the database works with opts
+func OpenWithOptions(path string, opts *Options) (*SamehadaDB, error) {
+	disk_manager := disk.NewDiskManagerImpl(path)
+	if disk_manager == nil {
+		return nil, fmt.Errorf("can't open db file: %s", path)
+	}
+	log_manager := recovery.NewLogManager(&disk_manager)
+	bpm := buffer.NewBufferPoolManager(BufferPoolFrameNum, disk_manager, log_manager)
+	lock_manager := access.NewLockManager(access.STRICT, opts.DeadlockMode)
+	txn_manager := access.NewTransactionManager(lock_manager, log_manager)
+	checkpoint_manager := concurrency.NewCheckpointManager(txn_manager, log_manager, bpm)
+
+	isExistingDB := disk_manager.Size() > 0
+
+	var catalog_ *catalog.Catalog
+	if isExistingDB {
+		// log file is cleared on Close, so remaining log means the system exited in not graceful.
+		// index pages are not recovered with log and may be inconsistent with table heaps in the case
+		isCrashed := disk_manager.GetLogFileSize() > 0
+		log_manager.DeactivateLogging()
+		log_recovery := log_recovery.NewLogRecovery(disk_manager, bpm)
+		log_recovery.Redo()
+		log_recovery.Undo()
+		bpm.FlushAllPages()
+		// all changes in log are persisted to db file here
+		if err := disk_manager.GCLogFile(); err != nil {
+			disk_manager.ShutDown()
+			lock_manager.StopCycleDetection()
+			return nil, err
+		}
+
+		txn := txn_manager.Begin(nil)
+		catalog_ = catalog.RecoveryCatalogFromCatalogPage(bpm, log_manager, lock_manager, txn)
+		if isCrashed {
+			catalog_.RebuildIndexes(txn)
+			bpm.FlushAllPages()
+		}
+		txn_manager.Commit(txn)
+		// log file is cleared, so LSN continues from LSNs of pages. otherwise redo after next crash
+		// skips records whose LSN is smaller than LSN of the page written before the clearing
+		log_manager.SetNextLSN(catalog_.GetMaxPageLSN() + 1)
+		log_manager.ActivateLogging()
+	} else {
+		log_manager.ActivateLogging()
+		txn := txn_manager.Begin(nil)
+		catalog_ = catalog.BootstrapCatalog(bpm, log_manager, lock_manager, txn)
+		txn_manager.Commit(txn)
+	}
+
+	return &SamehadaDB{disk_manager, log_manager, bpm, lock_manager, txn_manager, checkpoint_manager,
+		catalog_, planner.NewSimplePlanner(catalog_), &executors.ExecutionEngine{}, new(sync.Mutex)}, nil
+}
+
+// Close persists all pages and shuts down the database.
+// all transactions must be finished before calling this
+func (sdb *SamehadaDB) Close() {
+	sdb.bpm_.FlushAllPages()
+	sdb.log_manager_.Flush()
+	// all changes are persisted to db file, so log is no longer needed
+	sdb.disk_manager_.GCLogFile()
+	sdb.log_manager_.DeactivateLogging()
+	sdb.disk_manager_.ShutDown()
+	sdb.lock_manager_.StopCycleDetection()
+}
+
+func (sdb *SamehadaDB) GetCatalog() *catalog.Catalog {
+	return sdb.catalog_
+}
+
+func (sdb *SamehadaDB) GetCheckpointManager() *concurrency.CheckpointManager {
+	return sdb.checkpoint_manager_
+}
+
+func (sdb *SamehadaDB) BeginTransaction() *access.Transaction {
+	return sdb.txn_manager_.Begin(nil)
+}
+
+// CommitTransaction commits txn. returned error is reported from release of pages
+// of dropped tables and txn is committed even in the case
+func (sdb *SamehadaDB) CommitTransaction(txn *access.Transaction) error {
+	return sdb.txn_manager_.Commit(txn)
+}
+
+func (sdb *SamehadaDB) AbortTransaction(txn *access.Transaction) {
+	sdb.txn_manager_.Abort(txn)
+}
+
+// ExecuteSQL executes a SQL statement in a new transaction.
+// the transaction is committed when execution succeeded and is aborted when it failed
+func (sdb *SamehadaDB) ExecuteSQL(sqlStr string) (*Result, error) {
+	txn := sdb.BeginTransaction()
+	result, err := sdb.ExecuteSQLWithTxn(sqlStr, txn)
+	if err != nil {
+		sdb.AbortTransaction(txn)
+		return nil, err
+	}
+	if err := sdb.CommitTransaction(txn); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// ExecuteSQLWithTxn executes a SQL statement in the passed transaction.
+// when error is returned, caller should abort the transaction
+func (sdb *SamehadaDB) ExecuteSQLWithTxn(sqlStr string, txn *access.Transaction) (*Result, error) {
+	if txn.GetState() == access.ABORTED {
+		return nil, ErrTxnAborted
+	}
+
+	qi, err := parseSQL(sqlStr)
+	if err != nil {
+		return nil, err
+	}
+	// tables are locked before planning because the lock may wait for other transactions
+	if err := planner.LockTablesOfQuery(sdb.catalog_, qi, txn); err != nil {
+		return nil, err
+	}
+	plan, err := sdb.makePlan(qi, txn)
+	if err != nil {
+		return nil, err
+	}
+	if plan == nil {
+		// DDL is already executed at planning
+		return &Result{QueryType: *qi.QueryType_}, nil
+	}
+
+	tuples, err := sdb.execute(plan, txn)
+	if err != nil {
+		return nil, err
+	}
+	if txn.GetState() == access.ABORTED {
+		return nil, ErrTxnAborted
+	}
+
+	ret := makeResult(plan, tuples)
+	ret.QueryType = *qi.QueryType_
+	return ret, nil
+}
+
+// DescribeSQL returns column names and types of result of a SQL statement without executing it.
+// nil slices are returned when the statement returns no rows (not SELECT).
+// when txn is nil, tables are locked in a temporal transaction
+func (sdb *SamehadaDB) DescribeSQL(sqlStr string, txn *access.Transaction) ([]string, []types.TypeID, error) {
+	qi, err := parseSQL(sqlStr)
+	if err != nil {
+		return nil, nil, err
+	}
+	if *qi.QueryType_ != parser.SELECT {
+		return nil, nil, nil
+	}
+	if txn == nil {
+		txn = sdb.BeginTransaction()
+		defer sdb.AbortTransaction(txn)
+	}
+	if err := planner.LockTablesOfQuery(sdb.catalog_, qi, txn); err != nil {
+		return nil, nil, err
+	}
+	// planning of SELECT has no side effect
+	plan, err := sdb.makePlan(qi, txn)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	colNames := make([]string, 0)
+	colTypes := make([]types.TypeID, 0)
+	for _, col := range plan.OutputSchema().GetColumns() {
+		colNames = append(colNames, col.GetColumnName())
+		colTypes = append(colTypes, col.GetType())
+	}
+	return colNames, colTypes, nil
+}
+
+func parseSQL(sqlStr string) (qi *parser.QueryInfo, err error) {
+	// parser panics when it meets unsupported syntax
+	defer func() {
+		if r := recover(); r != nil {
+			qi = nil
+			err = planner.ErrNotSupported
+		}
+	}()
+
+	return parser.ParseSQLStr(&sqlStr)
+}
+
+func (sdb *SamehadaDB) makePlan(qi *parser.QueryInfo, txn *access.Transaction) (plans.Plan, error) {
+	sdb.planner_mutex_.Lock()
+	defer sdb.planner_mutex_.Unlock()
+
+	return sdb.planner_.MakePlan(qi, txn)
+}
+
+// execute is same as ExecutionEngine::Execute but error is returned to caller
+func (sdb *SamehadaDB) execute(plan plans.Plan, txn *access.Transaction) ([]*tuple.Tuple, error) {
+	exec_ctx := executors.NewExecutorContext(sdb.catalog_, sdb.bpm_, txn)
+	if err := executors.LockTables(plan, exec_ctx); err != nil {
+		return nil, err
+	}
+	executor := sdb.exec_engine_.CreateExecutor(plan, exec_ctx)
+	if executor == nil {
+		return nil, planner.ErrNotSupported
+	}
+	executor.Init()
+
+	tuples := []*tuple.Tuple{}
+	for {
+		tuple_, done, err := executor.Next()
+		if err != nil {
+			return nil, err
+		}
+		if txn.GetState() == access.ABORTED {
+			return nil, ErrTxnAborted
+		}
+		if done {
+			break
+		}
+		if tuple_ != nil {
+			tuples = append(tuples, tuple_)
+		}
+	}
+
+	return tuples, nil
+}
+
+func makeResult(plan plans.Plan, tuples []*tuple.Tuple) *Result {
+	ret := new(Result)
+	switch plan.GetType() {
+	case plans.Insert:
+		ret.RowsAffected = int64(len(plan.(*plans.InsertPlanNode).GetRawValues()))
+		return ret
+	case plans.Delete, plans.Update:
+		ret.RowsAffected = int64(len(tuples))
+		return ret
+	}
+
+	outSchema := plan.OutputSchema()
+	for _, col := range outSchema.GetColumns() {
+		ret.ColumnNames = append(ret.ColumnNames, col.GetColumnName())
+		ret.ColumnTypes = append(ret.ColumnTypes, col.GetType())
+	}
+	ret.Rows = make([][]types.Value, 0, len(tuples))
+	for _, tuple_ := range tuples {
+		row := make([]types.Value, outSchema.GetColumnCount())
+		for ii := uint32(0); ii < outSchema.GetColumnCount(); ii++ {
+			row[ii] = tuple_.GetValue(outSchema, ii)
+		}
+		ret.Rows = append(ret.Rows, row)
+	}
+	return ret
+}
@@ -0,0 +1,113 @@
+package samehada_driver
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"sync"
+
+	"github.com/ryogrid/SamehadaDB/errors"
+	"github.com/ryogrid/SamehadaDB/samehada"
+	"github.com/ryogrid/SamehadaDB/storage/access"
+)
+
+const ErrTxAlreadyStarted = errors.Error("transaction is already started on the connection")
+const ErrLastInsertIdNotSupported = errors.Error("LastInsertId is not supported")
+const ErrInvalidArgNum = errors.Error("number of arguments does not match number of placeholders")
+const ErrUnsupportedArgType = errors.Error("argument type is not supported")
+
+func init() {
+	sql.Register("samehada", &SamehadaDriver{})
+}
+
+// SamehadaDriver is database/sql driver of SamehadaDB.
+// data source name passed to sql.Open is path of db file
+type SamehadaDriver struct {
+}
+
+// openedDB is SamehadaDB instance shared by connections which open same db file
+type openedDB struct {
+	db_      *samehada.SamehadaDB
+	connNum_ int
+}
+
+var openedDBs = make(map[string]*openedDB)
+var openedDBsMutex = new(sync.Mutex)
+
+func (d *SamehadaDriver) Open(name string) (driver.Conn, error) {
+	openedDBsMutex.Lock()
+	defer openedDBsMutex.Unlock()
+
+	odb, ok := openedDBs[name]
+	if !ok {
+		db, err := samehada.Open(name)
+		if err != nil {
+			return nil, err
+		}
+		odb = &openedDB{db, 0}
+		openedDBs[name] = odb
+	}
+	odb.connNum_++
+
+	return &Conn{name, odb.db_, nil, false}, nil
+}
+
+/**
+ * Conn is a connection to SamehadaDB.
+ * when no transaction is started, each statement is executed in its own transaction
+ */
+type Conn struct {
+	name_ string
+	db_   *samehada.SamehadaDB
+	txn_  *access.Transaction
+	// true when a statement in current transaction failed. such transaction can't be committed
+	isFailed_ bool
+}
+
+func (c *Conn) Prepare(query string) (driver.Stmt, error) {
+	return &Stmt{c, query, countPlaceholders(query)}, nil
+}
+
+// Close closes the connection. db is closed when all connections to it are closed
+func (c *Conn) Close() error {
+	if c.txn_ != nil {
+		c.db_.AbortTransaction(c.txn_)
+		c.txn_ = nil
+	}
+
+	openedDBsMutex.Lock()
+	defer openedDBsMutex.Unlock()
+
+	odb := openedDBs[c.name_]
+	odb.connNum_--
+	if odb.connNum_ == 0 {
+		odb.db_.Close()
+		delete(openedDBs, c.name_)
+	}
+	return nil
+}
+
+func (c *Conn) Begin() (driver.Tx, error) {
+	if c.txn_ != nil {
+		return nil, ErrTxAlreadyStarted
+	}
+	c.txn_ = c.db_.BeginTransaction()
+	c.isFailed_ = false
+	return &Tx{c}, nil
+}
+
+// execute runs the query in current transaction. when it fails, the transaction rejects
+// following statements and is rolled back on commit (same as samehada.Session)
+func (c *Conn) execute(query string) (*samehada.Result, error) {
+	if c.txn_ == nil {
+		return c.db_.ExecuteSQL(query)
+	}
+	if c.isFailed_ {
+		return nil, samehada.ErrInFailedTxn
+	}
+	result, err := c.db_.ExecuteSQLWithTxn(query, c.txn_)
+	if err != nil {
+		c.isFailed_ = true
+		return nil, err
+	}
+	return result, nil
+}
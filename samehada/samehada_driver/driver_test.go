@@ -0,0 +1,109 @@
+package samehada_driver
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"os"
+	"testing"
+
+	"github.com/ryogrid/SamehadaDB/samehada"
+	testingpkg "github.com/ryogrid/SamehadaDB/testing"
+)
+
+func TestBindArgs(t *testing.T) {
+	query, err := bindArgs("SELECT a FROM t WHERE b = ? AND c = '?' AND d = ?;", []driver.Value{int64(-1), "it's\\"})
+	testingpkg.Ok(t, err)
+	testingpkg.Equals(t, "SELECT a FROM t WHERE b = -1 AND c = '?' AND d = 'it''s\\\\';", query)
+
+	query, err = bindArgs("INSERT INTO t VALUES (?, ?, ?);", []driver.Value{float64(2), nil, true})
+	testingpkg.Ok(t, err)
+	testingpkg.Equals(t, "INSERT INTO t VALUES (2.0, NULL, TRUE);", query)
+
+	_, err = bindArgs("SELECT a FROM t WHERE b = ?;", []driver.Value{})
+	testingpkg.Equals(t, ErrInvalidArgNum, err)
+}
+
+func TestDatabaseSQL(t *testing.T) {
+	os.Remove("test.db")
+	os.Remove("test.log")
+	defer os.Remove("test.db")
+	defer os.Remove("test.log")
+
+	db, err := sql.Open("samehada", "test.db")
+	testingpkg.Ok(t, err)
+	defer db.Close()
+
+	_, err = db.Exec("CREATE TABLE name_age_list(id INT, name VARCHAR(256), age INT, weight FLOAT);")
+	testingpkg.Ok(t, err)
+
+	stmt, err := db.Prepare("INSERT INTO name_age_list(id, name, age, weight) VALUES (?, ?, ?, ?);")
+	testingpkg.Ok(t, err)
+	testingpkg.Ok(t, func() error { _, err := stmt.Exec(1, "Ryo", 30, 60.5); return err }())
+	testingpkg.Ok(t, func() error { _, err := stmt.Exec(2, "Yui", nil, 45.0); return err }())
+	stmt.Close()
+
+	rows, err := db.Query("SELECT id, name, age, weight FROM name_age_list WHERE id >= ?;", 1)
+	testingpkg.Ok(t, err)
+	cols, err := rows.Columns()
+	testingpkg.Ok(t, err)
+	testingpkg.Equals(t, []string{"id", "name", "age", "weight"}, cols)
+	cnt := 0
+	for rows.Next() {
+		var id int
+		var name string
+		var age sql.NullInt64
+		var weight float64
+		testingpkg.Ok(t, rows.Scan(&id, &name, &age, &weight))
+		switch id {
+		case 1:
+			testingpkg.Equals(t, "Ryo", name)
+			testingpkg.Equals(t, sql.NullInt64{Int64: 30, Valid: true}, age)
+			testingpkg.Equals(t, 60.5, weight)
+		case 2:
+			testingpkg.Equals(t, false, age.Valid)
+		}
+		cnt++
+	}
+	testingpkg.Ok(t, rows.Err())
+	rows.Close()
+	testingpkg.Equals(t, 2, cnt)
+
+	// rolled back changes must not be visible
+	tx, err := db.Begin()
+	testingpkg.Ok(t, err)
+	result, err := tx.Exec("DELETE FROM name_age_list WHERE id = ?;", 1)
+	testingpkg.Ok(t, err)
+	affected, _ := result.RowsAffected()
+	testingpkg.Equals(t, int64(1), affected)
+	testingpkg.Ok(t, tx.Rollback())
+
+	var count int
+	testingpkg.Ok(t, db.QueryRow("SELECT count(*) FROM name_age_list;").Scan(&count))
+	testingpkg.Equals(t, 2, count)
+
+	tx, err = db.Begin()
+	testingpkg.Ok(t, err)
+	_, err = tx.Exec("UPDATE name_age_list SET name = ? WHERE id = ?;", "Yuki", 2)
+	testingpkg.Ok(t, err)
+	testingpkg.Ok(t, tx.Commit())
+
+	var name string
+	testingpkg.Ok(t, db.QueryRow("SELECT name FROM name_age_list WHERE id = 2;").Scan(&name))
+	testingpkg.Equals(t, "Yuki", name)
+
+	_, err = db.Exec("SELECT x FROM name_age_list;")
+	testingpkg.Nok(t, err)
+
+	// transaction including failed statement is rolled back on commit
+	tx, err = db.Begin()
+	testingpkg.Ok(t, err)
+	_, err = tx.Exec("UPDATE name_age_list SET name = ? WHERE id = ?;", "Ken", 2)
+	testingpkg.Ok(t, err)
+	_, err = tx.Exec("INSERT INTO not_exist VALUES (1);")
+	testingpkg.Nok(t, err)
+	_, err = tx.Exec("DELETE FROM name_age_list WHERE id = ?;", 1)
+	testingpkg.Equals(t, samehada.ErrInFailedTxn, err)
+	testingpkg.Equals(t, samehada.ErrTxnAborted, tx.Commit())
+	testingpkg.Ok(t, db.QueryRow("SELECT name FROM name_age_list WHERE id = 2;").Scan(&name))
+	testingpkg.Equals(t, "Yuki", name)
+}
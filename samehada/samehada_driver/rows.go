@@ -0,0 +1,71 @@
+package samehada_driver
+
+import (
+	"database/sql/driver"
+	"io"
+
+	"github.com/ryogrid/SamehadaDB/samehada"
+	"github.com/ryogrid/SamehadaDB/types"
+)
+
+// Rows is iterator of rows in result of Query
+type Rows struct {
+	result_ *samehada.Result
+	idx_    int
+}
+
+func newRows(result *samehada.Result) *Rows {
+	return &Rows{result, 0}
+}
+
+func (r *Rows) Columns() []string {
+	return r.result_.ColumnNames
+}
+
+func (r *Rows) Close() error {
+	return nil
+}
+
+func (r *Rows) Next(dest []driver.Value) error {
+	if r.idx_ >= len(r.result_.Rows) {
+		return io.EOF
+	}
+	for ii, val := range r.result_.Rows[r.idx_] {
+		dest[ii] = ToDriverValue(&val)
+	}
+	r.idx_++
+	return nil
+}
+
+// ColumnTypeDatabaseTypeName implements driver.RowsColumnTypeDatabaseTypeName
+func (r *Rows) ColumnTypeDatabaseTypeName(index int) string {
+	switch r.result_.ColumnTypes[index] {
+	case types.Integer:
+		return "INTEGER"
+	case types.Float:
+		return "FLOAT"
+	case types.Varchar:
+		return "VARCHAR"
+	case types.Boolean:
+		return "BOOLEAN"
+	}
+	return ""
+}
+
+// ToDriverValue converts types.Value to driver.Value
+func ToDriverValue(val *types.Value) driver.Value {
+	if val.IsNull() {
+		return nil
+	}
+	switch val.ValueType() {
+	case types.Integer:
+		return int64(val.ToInteger())
+	case types.Float:
+		return float64(val.ToFloat())
+	case types.Varchar:
+		return val.ToVarchar()
+	case types.Boolean:
+		return val.ToBoolean()
+	}
+	return nil
+}
@@ -0,0 +1,146 @@
+package samehada_driver
+
+import (
+	"database/sql/driver"
+	"strconv"
+	"strings"
+)
+
+// Stmt is a prepared statement. placeholders ("?") in the query are replaced
+// with literals of passed arguments at execution
+type Stmt struct {
+	conn_     *Conn
+	query_    string
+	numInput_ int
+}
+
+func (s *Stmt) Close() error {
+	return nil
+}
+
+func (s *Stmt) NumInput() int {
+	return s.numInput_
+}
+
+func (s *Stmt) Exec(args []driver.Value) (driver.Result, error) {
+	query, err := bindArgs(s.query_, args)
+	if err != nil {
+		return nil, err
+	}
+	result, err := s.conn_.execute(query)
+	if err != nil {
+		return nil, err
+	}
+	return &Result{result.RowsAffected}, nil
+}
+
+func (s *Stmt) Query(args []driver.Value) (driver.Rows, error) {
+	query, err := bindArgs(s.query_, args)
+	if err != nil {
+		return nil, err
+	}
+	result, err := s.conn_.execute(query)
+	if err != nil {
+		return nil, err
+	}
+	return newRows(result), nil
+}
+
+// Result is result of Exec
+type Result struct {
+	rowsAffected_ int64
+}
+
+func (r *Result) LastInsertId() (int64, error) {
+	return 0, ErrLastInsertIdNotSupported
+}
+
+func (r *Result) RowsAffected() (int64, error) {
+	return r.rowsAffected_, nil
+}
+
+// forEachPlaceholder calls fn with position of each placeholder which is not in quoted string
+func forEachPlaceholder(query string, fn func(pos int)) {
+	var quote byte = 0
+	for ii := 0; ii < len(query); ii++ {
+		ch := query[ii]
+		switch {
+		case quote != 0:
+			if ch == '\\' {
+				// skip escaped character
+				ii++
+			} else if ch == quote {
+				quote = 0
+			}
+		case ch == '\'' || ch == '"' || ch == '`':
+			quote = ch
+		case ch == '?':
+			fn(ii)
+		}
+	}
+}
+
+func countPlaceholders(query string) int {
+	ret := 0
+	forEachPlaceholder(query, func(pos int) { ret++ })
+	return ret
+}
+
+func bindArgs(query string, args []driver.Value) (string, error) {
+	if len(args) != countPlaceholders(query) {
+		return "", ErrInvalidArgNum
+	}
+	if len(args) == 0 {
+		return query, nil
+	}
+
+	var sb strings.Builder
+	var err error = nil
+	last := 0
+	argIdx := 0
+	forEachPlaceholder(query, func(pos int) {
+		sb.WriteString(query[last:pos])
+		last = pos + 1
+		literal, err_ := toLiteral(args[argIdx])
+		if err_ != nil {
+			err = err_
+		}
+		sb.WriteString(literal)
+		argIdx++
+	})
+	if err != nil {
+		return "", err
+	}
+	sb.WriteString(query[last:])
+	return sb.String(), nil
+}
+
+// parser treats backslash in string literal as escape character
+var literalEscaper = strings.NewReplacer("'", "''", "\\", "\\\\")
+
+// toLiteral converts a argument to SQL literal
+func toLiteral(arg driver.Value) (string, error) {
+	switch v := arg.(type) {
+	case nil:
+		return "NULL", nil
+	case int64:
+		return strconv.FormatInt(v, 10), nil
+	case float64:
+		literal := strconv.FormatFloat(v, 'g', -1, 64)
+		if !strings.ContainsAny(literal, ".eEIN") {
+			// keep the literal float
+			literal += ".0"
+		}
+		return literal, nil
+	case bool:
+		if v {
+			return "TRUE", nil
+		}
+		return "FALSE", nil
+	case string:
+		return "'" + literalEscaper.Replace(v) + "'", nil
+	case []byte:
+		return "'" + literalEscaper.Replace(string(v)) + "'", nil
+	}
+	return "", ErrUnsupportedArgType
+}
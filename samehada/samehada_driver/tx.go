@@ -0,0 +1,30 @@
+package samehada_driver
+
+import (
+	"github.com/ryogrid/SamehadaDB/samehada"
+	"github.com/ryogrid/SamehadaDB/storage/access"
+)
+
+// Tx is a transaction started by Conn.Begin
+type Tx struct {
+	conn_ *Conn
+}
+
+// Commit commits the transaction. when a statement in the transaction failed or the transaction
+// was already aborted by a failure of concurrency control, it is rolled back and error is returned
+func (tx *Tx) Commit() error {
+	txn := tx.conn_.txn_
+	tx.conn_.txn_ = nil
+	if tx.conn_.isFailed_ || txn.GetState() == access.ABORTED {
+		tx.conn_.db_.AbortTransaction(txn)
+		return samehada.ErrTxnAborted
+	}
+	return tx.conn_.db_.CommitTransaction(txn)
+}
+
+func (tx *Tx) Rollback() error {
+	txn := tx.conn_.txn_
+	tx.conn_.txn_ = nil
+	tx.conn_.db_.AbortTransaction(txn)
+	return nil
+}
@@ -0,0 +1,1107 @@
+package samehada
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ryogrid/SamehadaDB/catalog"
+	"github.com/ryogrid/SamehadaDB/common"
+	"github.com/ryogrid/SamehadaDB/execution/executors"
+	"github.com/ryogrid/SamehadaDB/parser"
+	"github.com/ryogrid/SamehadaDB/planner"
+	"github.com/ryogrid/SamehadaDB/storage/access"
+	"github.com/ryogrid/SamehadaDB/storage/index"
+	"github.com/ryogrid/SamehadaDB/storage/table/column"
+	testingpkg "github.com/ryogrid/SamehadaDB/testing"
+	"github.com/ryogrid/SamehadaDB/types"
+)
+
+func TestExecuteSQL(t *testing.T) {
+	os.Remove("test.db")
+	os.Remove("test.log")
+	defer os.Remove("test.db")
+	defer os.Remove("test.log")
+
+	db, err := Open("test.db")
+	testingpkg.Ok(t, err)
+
+	_, err = db.ExecuteSQL("CREATE TABLE name_age_list(id INT, name VARCHAR(256), age INT, index id_idx (id));")
+	testingpkg.Ok(t, err)
+	result, err := db.ExecuteSQL("INSERT INTO name_age_list(id, name, age) VALUES (1, 'Ryo', 30), (2, 'Yui', 25), (3, 'Ken', 40);")
+	testingpkg.Ok(t, err)
+	testingpkg.Equals(t, int64(3), result.RowsAffected)
+
+	result, err = db.ExecuteSQL("SELECT name, age FROM name_age_list WHERE age > 26;")
+	testingpkg.Ok(t, err)
+	testingpkg.Equals(t, []string{"name", "age"}, result.ColumnNames)
+	testingpkg.Equals(t, []types.TypeID{types.Varchar, types.Integer}, result.ColumnTypes)
+	testingpkg.Equals(t, 2, len(result.Rows))
+
+	result, err = db.ExecuteSQL("UPDATE name_age_list SET age = 26 WHERE name = 'Yui';")
+	testingpkg.Ok(t, err)
+	testingpkg.Equals(t, int64(1), result.RowsAffected)
+	result, err = db.ExecuteSQL("SELECT age FROM name_age_list WHERE id = 2;")
+	testingpkg.Ok(t, err)
+	testingpkg.Equals(t, 1, len(result.Rows))
+	testingpkg.Equals(t, int32(26), result.Rows[0][0].ToInteger())
+
+	result, err = db.ExecuteSQL("DELETE FROM name_age_list WHERE id = 3;")
+	testingpkg.Ok(t, err)
+	testingpkg.Equals(t, int64(1), result.RowsAffected)
+
+	_, err = db.ExecuteSQL("SELECT x FROM name_age_list;")
+	testingpkg.Nok(t, err)
+	_, err = db.ExecuteSQL("SELEC * FROM name_age_list;")
+	testingpkg.Nok(t, err)
+
+	// aborted transaction must not be visible
+	txn := db.BeginTransaction()
+	_, err = db.ExecuteSQLWithTxn("INSERT INTO name_age_list(id, name, age) VALUES (4, 'Nana', 20);", txn)
+	testingpkg.Ok(t, err)
+	db.AbortTransaction(txn)
+
+	db.Close()
+
+	// reopen and check catalog and data are reloaded
+	db, err = Open("test.db")
+	testingpkg.Ok(t, err)
+
+	result, err = db.ExecuteSQL("SELECT id, name, age FROM name_age_list;")
+	testingpkg.Ok(t, err)
+	testingpkg.Equals(t, 2, len(result.Rows))
+
+	// index is usable after reload
+	result, err = db.ExecuteSQL("SELECT age FROM name_age_list WHERE id = 2;")
+	testingpkg.Ok(t, err)
+	testingpkg.Equals(t, 1, len(result.Rows))
+	testingpkg.Equals(t, int32(26), result.Rows[0][0].ToInteger())
+
+	// table created after reload must not overwrite existing one
+	_, err = db.ExecuteSQL("CREATE TABLE dept(id INT, title VARCHAR(256));")
+	testingpkg.Ok(t, err)
+	_, err = db.ExecuteSQL("INSERT INTO dept VALUES (10, 'sales');")
+	testingpkg.Ok(t, err)
+	result, err = db.ExecuteSQL("SELECT title FROM dept;")
+	testingpkg.Ok(t, err)
+	testingpkg.Equals(t, 1, len(result.Rows))
+	testingpkg.Equals(t, "sales", result.Rows[0][0].ToVarchar())
+
+	db.Close()
+}
+
+func TestSession(t *testing.T) {
+	os.Remove("test.db")
+	os.Remove("test.log")
+	defer os.Remove("test.db")
+	defer os.Remove("test.log")
+
+	db, err := Open("test.db")
+	testingpkg.Ok(t, err)
+	defer db.Close()
+
+	session := db.NewSession()
+	_, err = session.ExecuteSQL("CREATE TABLE t(id INT, val INT);")
+	testingpkg.Ok(t, err)
+	testingpkg.SimpleAssert(t, !session.InTransaction())
+
+	result, err := session.ExecuteSQL("BEGIN;")
+	testingpkg.Ok(t, err)
+	testingpkg.Equals(t, parser.BEGIN, result.QueryType)
+	testingpkg.SimpleAssert(t, session.InTransaction())
+	_, err = session.ExecuteSQL("INSERT INTO t VALUES (1, 10);")
+	testingpkg.Ok(t, err)
+	result, err = session.ExecuteSQL("COMMIT;")
+	testingpkg.Ok(t, err)
+	testingpkg.Equals(t, parser.COMMIT, result.QueryType)
+
+	// failed transaction rejects statements and is rolled back by COMMIT
+	_, err = session.ExecuteSQL("BEGIN;")
+	testingpkg.Ok(t, err)
+	_, err = session.ExecuteSQL("INSERT INTO t VALUES (2, 20);")
+	testingpkg.Ok(t, err)
+	_, err = session.ExecuteSQL("SELECT * FROM not_exist;")
+	testingpkg.Nok(t, err)
+	testingpkg.SimpleAssert(t, session.IsFailed())
+	_, err = session.ExecuteSQL("SELECT * FROM t;")
+	testingpkg.Equals(t, ErrInFailedTxn, err)
+	result, err = session.ExecuteSQL("COMMIT;")
+	testingpkg.Ok(t, err)
+	testingpkg.Equals(t, parser.ROLLBACK, result.QueryType)
+
+	result, err = session.ExecuteSQL("SELECT * FROM t;")
+	testingpkg.Ok(t, err)
+	testingpkg.Equals(t, 1, len(result.Rows))
+	session.Close()
+}
+
+func TestBTreeIndexTable(t *testing.T) {
+	os.Remove("test.db")
+	os.Remove("test.log")
+	defer os.Remove("test.db")
+	defer os.Remove("test.log")
+
+	db, err := Open("test.db")
+	testingpkg.Ok(t, err)
+
+	_, err = db.ExecuteSQL("CREATE TABLE t(id INT, name VARCHAR(256), INDEX id_idx (id) USING BTREE);")
+	testingpkg.Ok(t, err)
+	testingpkg.Equals(t, column.IndexKindBTree, db.GetCatalog().GetTableByName("t").Schema().GetColumn(0).GetIndexKind())
+	for ii := 0; ii < 300; ii++ {
+		_, err = db.ExecuteSQL(fmt.Sprintf("INSERT INTO t(id, name) VALUES (%d, 'name%d');", ii, ii))
+		testingpkg.Ok(t, err)
+	}
+	_, err = db.ExecuteSQL("UPDATE t SET id = 1000 WHERE id = 10;")
+	testingpkg.Ok(t, err)
+	_, err = db.ExecuteSQL("DELETE FROM t WHERE id = 20;")
+	testingpkg.Ok(t, err)
+
+	result, err := db.ExecuteSQL("SELECT name FROM t WHERE id = 1000;")
+	testingpkg.Ok(t, err)
+	testingpkg.Equals(t, [][]types.Value{{types.NewVarchar("name10")}}, result.Rows)
+	result, err = db.ExecuteSQL("SELECT name FROM t WHERE id = 20;")
+	testingpkg.Ok(t, err)
+	testingpkg.Equals(t, 0, len(result.Rows))
+	db.Close()
+
+	// kind of index is kept after reload
+	db, err = Open("test.db")
+	testingpkg.Ok(t, err)
+	defer db.Close()
+	index_ := db.GetCatalog().GetTableByName("t").GetIndex(0)
+	_, ok := index_.(*index.BPlusTreeIndex)
+	testingpkg.SimpleAssert(t, ok)
+	result, err = db.ExecuteSQL("SELECT name FROM t WHERE id = 299;")
+	testingpkg.Ok(t, err)
+	testingpkg.Equals(t, 1, len(result.Rows))
+}
+
+func TestIndexRebuildAfterCrash(t *testing.T) {
+	os.Remove("test.db")
+	os.Remove("test.log")
+	defer os.Remove("test.db")
+	defer os.Remove("test.log")
+
+	db, err := Open("test.db")
+	testingpkg.Ok(t, err)
+	_, err = db.ExecuteSQL("CREATE TABLE t(id INT, name VARCHAR(256), INDEX id_idx (id));")
+	testingpkg.Ok(t, err)
+	headerPageId := db.GetCatalog().GetTableByName("t").GetIndex(0).GetHeaderPageId()
+	// note: redo can't initialize page of table heap which has never been written to db file
+	db.bpm_.FlushAllPages()
+	for ii := 0; ii < 100; ii++ {
+		_, err = db.ExecuteSQL(fmt.Sprintf("INSERT INTO t(id, name) VALUES (%d, 'name%d');", ii, ii))
+		testingpkg.Ok(t, err)
+	}
+
+	// exit without flushing pages. log file remains
+	db.log_manager_.Flush()
+	db.disk_manager_.ShutDown()
+
+	db, err = Open("test.db")
+	testingpkg.Ok(t, err)
+	defer db.Close()
+	// index pages are reused and entries are rebuilt from table heap
+	testingpkg.Equals(t, headerPageId, db.GetCatalog().GetTableByName("t").GetIndex(0).GetHeaderPageId())
+	for ii := 0; ii < 100; ii += 7 {
+		result, err := db.ExecuteSQL(fmt.Sprintf("SELECT name FROM t WHERE id = %d;", ii))
+		testingpkg.Ok(t, err)
+		testingpkg.Equals(t, [][]types.Value{{types.NewVarchar(fmt.Sprintf("name%d", ii))}}, result.Rows)
+	}
+}
+
+func TestRecoveryAfterReopen(t *testing.T) {
+	os.Remove("test.db")
+	os.Remove("test.log")
+	defer os.Remove("test.db")
+	defer os.Remove("test.log")
+
+	db, err := Open("test.db")
+	testingpkg.Ok(t, err)
+	_, err = db.ExecuteSQL("CREATE TABLE t(id INT, name VARCHAR(256));")
+	testingpkg.Ok(t, err)
+	for ii := 0; ii < 10; ii++ {
+		_, err = db.ExecuteSQL(fmt.Sprintf("INSERT INTO t(id, name) VALUES (%d, 'name%d');", ii, ii))
+		testingpkg.Ok(t, err)
+	}
+	// log file is cleared and pages have LSNs of the records
+	db.Close()
+
+	db, err = Open("test.db")
+	testingpkg.Ok(t, err)
+	_, err = db.ExecuteSQL("INSERT INTO t(id, name) VALUES (10, 'name10');")
+	testingpkg.Ok(t, err)
+	// exit without flushing pages. records appended after reopen must be redone
+	db.log_manager_.Flush()
+	db.disk_manager_.ShutDown()
+
+	db, err = Open("test.db")
+	testingpkg.Ok(t, err)
+	defer db.Close()
+	result, err := db.ExecuteSQL("SELECT name FROM t WHERE id = 10;")
+	testingpkg.Ok(t, err)
+	testingpkg.Equals(t, [][]types.Value{{types.NewVarchar("name10")}}, result.Rows)
+}
+
+func TestUniqueConstraint(t *testing.T) {
+	os.Remove("test.db")
+	os.Remove("test.log")
+	defer os.Remove("test.db")
+	defer os.Remove("test.log")
+
+	db, err := Open("test.db")
+	testingpkg.Ok(t, err)
+
+	_, err = db.ExecuteSQL("CREATE TABLE staff(id INT PRIMARY KEY, email VARCHAR(256), dept INT, num INT, UNIQUE KEY email_uq (email), UNIQUE KEY dept_num_uq (dept, num) USING BTREE);")
+	testingpkg.Ok(t, err)
+	_, err = db.ExecuteSQL("INSERT INTO staff VALUES (1, 'a@example.com', 10, 1), (2, 'b@example.com', 10, 2);")
+	testingpkg.Ok(t, err)
+
+	countRows := func() int {
+		result, err := db.ExecuteSQL("SELECT id FROM staff;")
+		testingpkg.Ok(t, err)
+		return len(result.Rows)
+	}
+
+	_, err = db.ExecuteSQL("INSERT INTO staff VALUES (1, 'c@example.com', 20, 1);")
+	testingpkg.Equals(t, executors.ErrDuplicateKey, err)
+	_, err = db.ExecuteSQL("INSERT INTO staff VALUES (3, 'a@example.com', 20, 1);")
+	testingpkg.Equals(t, executors.ErrDuplicateKey, err)
+	_, err = db.ExecuteSQL("INSERT INTO staff VALUES (3, 'c@example.com', 10, 2);")
+	testingpkg.Equals(t, executors.ErrDuplicateKey, err)
+	// duplication in the same statement. whole statement is rolled back
+	_, err = db.ExecuteSQL("INSERT INTO staff VALUES (3, 'c@example.com', 20, 1), (4, 'c@example.com', 20, 2);")
+	testingpkg.Equals(t, executors.ErrDuplicateKey, err)
+	_, err = db.ExecuteSQL("INSERT INTO staff VALUES (NULL, 'd@example.com', 20, 1);")
+	testingpkg.Equals(t, executors.ErrNullPrimaryKey, err)
+	testingpkg.Equals(t, 2, countRows())
+
+	// keys which have NULL don't violate unique constraint
+	_, err = db.ExecuteSQL("INSERT INTO staff VALUES (3, NULL, 20, NULL), (4, NULL, 20, NULL);")
+	testingpkg.Ok(t, err)
+
+	// rolled back update restores the row and its index entries
+	_, err = db.ExecuteSQL("UPDATE staff SET id = 1 WHERE id = 2;")
+	testingpkg.Equals(t, executors.ErrDuplicateKey, err)
+	result, err := db.ExecuteSQL("SELECT email FROM staff WHERE id = 2;")
+	testingpkg.Ok(t, err)
+	testingpkg.Equals(t, [][]types.Value{{types.NewVarchar("b@example.com")}}, result.Rows)
+	_, err = db.ExecuteSQL("UPDATE staff SET email = 'z@example.com' WHERE id = 2;")
+	testingpkg.Ok(t, err)
+
+	// key of deleted row can be reused in the same transaction
+	txn := db.BeginTransaction()
+	_, err = db.ExecuteSQLWithTxn("DELETE FROM staff WHERE id = 1;", txn)
+	testingpkg.Ok(t, err)
+	_, err = db.ExecuteSQLWithTxn("INSERT INTO staff VALUES (1, 'a@example.com', 10, 1);", txn)
+	testingpkg.Ok(t, err)
+	db.AbortTransaction(txn)
+	// entries removed by aborted transaction are restored
+	_, err = db.ExecuteSQL("INSERT INTO staff VALUES (5, 'a@example.com', 30, 1);")
+	testingpkg.Equals(t, executors.ErrDuplicateKey, err)
+	testingpkg.Equals(t, 4, countRows())
+	db.Close()
+
+	// constraints are kept after reload
+	db, err = Open("test.db")
+	testingpkg.Ok(t, err)
+	defer db.Close()
+	_, err = db.ExecuteSQL("INSERT INTO staff VALUES (5, 'z@example.com', 30, 1);")
+	testingpkg.Equals(t, executors.ErrDuplicateKey, err)
+	_, err = db.ExecuteSQL("INSERT INTO staff VALUES (5, 'e@example.com', 30, 1);")
+	testingpkg.Ok(t, err)
+	testingpkg.Equals(t, 5, countRows())
+}
+
+func TestUniqueConstraintConcurrentInsert(t *testing.T) {
+	os.Remove("test.db")
+	os.Remove("test.log")
+	defer os.Remove("test.db")
+	defer os.Remove("test.log")
+
+	db, err := Open("test.db")
+	testingpkg.Ok(t, err)
+	defer db.Close()
+	// transactions which wait for each other are aborted soon
+	db.lock_manager_.SetLockWaitTimeout(200 * time.Millisecond)
+
+	_, err = db.ExecuteSQL("CREATE TABLE t(id INT PRIMARY KEY, name VARCHAR(256));")
+	testingpkg.Ok(t, err)
+
+	const keyNum = 20
+	const writerNum = 3
+	succeeded := make([]int32, keyNum)
+	var wg sync.WaitGroup
+	for ii := 0; ii < keyNum; ii++ {
+		for jj := 0; jj < writerNum; jj++ {
+			wg.Add(1)
+			go func(key int, writer int) {
+				defer wg.Done()
+				_, err := db.ExecuteSQL(fmt.Sprintf("INSERT INTO t VALUES (%d, 'writer%d');", key, writer))
+				if err == nil {
+					atomic.AddInt32(&succeeded[key], 1)
+				}
+			}(ii, jj)
+		}
+	}
+	wg.Wait()
+
+	// at most one of transactions inserting the same key is committed
+	for ii := 0; ii < keyNum; ii++ {
+		testingpkg.Assert(t, succeeded[ii] <= 1, "key %d is inserted %d times", ii, succeeded[ii])
+		result, err := db.ExecuteSQL(fmt.Sprintf("SELECT name FROM t WHERE id = %d;", ii))
+		testingpkg.Ok(t, err)
+		testingpkg.Equals(t, int(succeeded[ii]), len(result.Rows))
+	}
+
+	// insertion of the same key waits for the transaction which inserted the key first
+	db.lock_manager_.SetLockWaitTimeout(common.LockWaitTimeout)
+	for _, isCommitted := range []bool{true, false} {
+		txn := db.BeginTransaction()
+		_, err = db.ExecuteSQLWithTxn("INSERT INTO t VALUES (100, 'first');", txn)
+		testingpkg.Ok(t, err)
+
+		ch := make(chan error)
+		go func() {
+			_, err := db.ExecuteSQL("INSERT INTO t VALUES (100, 'second');")
+			ch <- err
+		}()
+		time.Sleep(100 * time.Millisecond)
+		select {
+		case <-ch:
+			t.Fatal("same key is inserted while the first transaction is not finished")
+		default:
+		}
+
+		if isCommitted {
+			db.CommitTransaction(txn)
+			testingpkg.Equals(t, executors.ErrDuplicateKey, <-ch)
+			_, err = db.ExecuteSQL("DELETE FROM t WHERE id = 100;")
+			testingpkg.Ok(t, err)
+		} else {
+			db.AbortTransaction(txn)
+			testingpkg.Ok(t, <-ch)
+			result, err := db.ExecuteSQL("SELECT name FROM t WHERE id = 100;")
+			testingpkg.Ok(t, err)
+			testingpkg.Equals(t, 1, len(result.Rows))
+			testingpkg.Equals(t, "second", result.Rows[0][0].ToVarchar())
+		}
+	}
+
+	// insertion of the key waits for the transaction which deleted the row having the key
+	for _, isCommitted := range []bool{true, false} {
+		_, err = db.ExecuteSQL("INSERT INTO t VALUES (200, 'orig');")
+		testingpkg.Ok(t, err)
+		txn := db.BeginTransaction()
+		_, err = db.ExecuteSQLWithTxn("DELETE FROM t WHERE name = 'orig';", txn)
+		testingpkg.Ok(t, err)
+
+		ch := make(chan error)
+		go func() {
+			_, err := db.ExecuteSQL("INSERT INTO t VALUES (200, 'dup');")
+			ch <- err
+		}()
+		time.Sleep(100 * time.Millisecond)
+		select {
+		case <-ch:
+			t.Fatal("key of deleted row is inserted while the deletion is not finished")
+		default:
+		}
+
+		if isCommitted {
+			db.CommitTransaction(txn)
+			testingpkg.Ok(t, <-ch)
+			_, err = db.ExecuteSQL("DELETE FROM t WHERE id = 200;")
+			testingpkg.Ok(t, err)
+		} else {
+			db.AbortTransaction(txn)
+			testingpkg.Equals(t, executors.ErrDuplicateKey, <-ch)
+			result, err := db.ExecuteSQL("SELECT name FROM t WHERE id = 200;")
+			testingpkg.Ok(t, err)
+			testingpkg.Equals(t, [][]types.Value{{types.NewVarchar("orig")}}, result.Rows)
+		}
+	}
+}
+
+func TestColumnConstraint(t *testing.T) {
+	os.Remove("test.db")
+	os.Remove("test.log")
+	defer os.Remove("test.db")
+	defer os.Remove("test.log")
+
+	db, err := Open("test.db")
+	testingpkg.Ok(t, err)
+
+	_, err = db.ExecuteSQL("CREATE TABLE item(id INT NOT NULL, name VARCHAR(256) DEFAULT 'noname', price FLOAT DEFAULT 1.5 CHECK (price > 0), stock INT CHECK (stock >= 0 AND stock <= 100));")
+	testingpkg.Ok(t, err)
+	_, err = db.ExecuteSQL("CREATE TABLE t(a INT CHECK (no_column > 0));")
+	testingpkg.Equals(t, planner.ErrColumnNotFound, err)
+	_, err = db.ExecuteSQL("CREATE TABLE t(a INT DEFAULT 'abc');")
+	testingpkg.Equals(t, planner.ErrTypeMismatch, err)
+
+	// omitted columns are filled with default value or NULL
+	_, err = db.ExecuteSQL("INSERT INTO item(id) VALUES (1);")
+	testingpkg.Ok(t, err)
+	result, err := db.ExecuteSQL("SELECT name, price, stock FROM item WHERE id = 1;")
+	testingpkg.Ok(t, err)
+	testingpkg.Equals(t, [][]types.Value{{types.NewVarchar("noname"), types.NewFloat(1.5), *types.NewInteger(0).SetNull()}}, result.Rows)
+
+	_, err = db.ExecuteSQL("INSERT INTO item(name) VALUES ('apple');")
+	testingpkg.Equals(t, executors.ErrNotNullViolation, err)
+	_, err = db.ExecuteSQL("INSERT INTO item VALUES (2, 'apple', 0, 10);")
+	testingpkg.Equals(t, executors.ErrCheckViolation, err)
+	_, err = db.ExecuteSQL("INSERT INTO item VALUES (2, 'apple', 2.5, 101);")
+	testingpkg.Equals(t, executors.ErrCheckViolation, err)
+	// NULL satisfies CHECK constraint
+	_, err = db.ExecuteSQL("INSERT INTO item VALUES (2, 'apple', NULL, 100);")
+	testingpkg.Ok(t, err)
+
+	_, err = db.ExecuteSQL("UPDATE item SET id = NULL WHERE id = 2;")
+	testingpkg.Equals(t, executors.ErrNotNullViolation, err)
+	_, err = db.ExecuteSQL("UPDATE item SET stock = -1 WHERE id = 2;")
+	testingpkg.Equals(t, executors.ErrCheckViolation, err)
+	result, err = db.ExecuteSQL("SELECT stock FROM item WHERE id = 2;")
+	testingpkg.Ok(t, err)
+	testingpkg.Equals(t, [][]types.Value{{types.NewInteger(100)}}, result.Rows)
+	db.Close()
+
+	// constraints are kept after reload
+	db, err = Open("test.db")
+	testingpkg.Ok(t, err)
+	defer db.Close()
+	_, err = db.ExecuteSQL("INSERT INTO item(name) VALUES ('orange');")
+	testingpkg.Equals(t, executors.ErrNotNullViolation, err)
+	_, err = db.ExecuteSQL("INSERT INTO item(id, stock) VALUES (3, 200);")
+	testingpkg.Equals(t, executors.ErrCheckViolation, err)
+	_, err = db.ExecuteSQL("INSERT INTO item(id, stock) VALUES (3, 50);")
+	testingpkg.Ok(t, err)
+	result, err = db.ExecuteSQL("SELECT name, price FROM item WHERE id = 3;")
+	testingpkg.Ok(t, err)
+	testingpkg.Equals(t, [][]types.Value{{types.NewVarchar("noname"), types.NewFloat(1.5)}}, result.Rows)
+}
+
+func TestForeignKey(t *testing.T) {
+	os.Remove("test.db")
+	os.Remove("test.log")
+	defer os.Remove("test.db")
+	defer os.Remove("test.log")
+
+	db, err := Open("test.db")
+	testingpkg.Ok(t, err)
+
+	_, err = db.ExecuteSQL("CREATE TABLE dept(id INT PRIMARY KEY, name VARCHAR(256));")
+	testingpkg.Ok(t, err)
+	_, err = db.ExecuteSQL("CREATE TABLE staff(id INT PRIMARY KEY, dept_id INT, FOREIGN KEY (dept_id) REFERENCES dept(id) ON DELETE CASCADE);")
+	testingpkg.Ok(t, err)
+	_, err = db.ExecuteSQL("CREATE TABLE task(id INT, staff_id INT REFERENCES staff(id) ON DELETE SET NULL, dept_id INT REFERENCES dept(id));")
+	testingpkg.Ok(t, err)
+	_, err = db.ExecuteSQL("CREATE TABLE t(a INT REFERENCES dept(name));")
+	testingpkg.Equals(t, planner.ErrReferencedKeyNotUnique, err)
+	_, err = db.ExecuteSQL("CREATE TABLE t(a INT REFERENCES no_table(id));")
+	testingpkg.Equals(t, planner.ErrTableNotFound, err)
+
+	countRows := func(table string) int {
+		result, err := db.ExecuteSQL("SELECT id FROM " + table + ";")
+		testingpkg.Ok(t, err)
+		return len(result.Rows)
+	}
+
+	_, err = db.ExecuteSQL("INSERT INTO dept VALUES (1, 'dev'), (2, 'sales'), (3, 'hr');")
+	testingpkg.Ok(t, err)
+	_, err = db.ExecuteSQL("INSERT INTO staff VALUES (10, 1), (11, 1), (20, 2), (30, NULL);")
+	testingpkg.Ok(t, err)
+	_, err = db.ExecuteSQL("INSERT INTO task VALUES (100, 10, 1), (101, 11, 1), (200, 20, 2), (300, 30, NULL);")
+	testingpkg.Ok(t, err)
+
+	// referenced row must exist on insert and update of referencing row
+	_, err = db.ExecuteSQL("INSERT INTO staff VALUES (40, 4);")
+	testingpkg.Equals(t, executors.ErrReferencedRowNotFound, err)
+	_, err = db.ExecuteSQL("UPDATE staff SET dept_id = 4 WHERE id = 30;")
+	testingpkg.Equals(t, executors.ErrReferencedRowNotFound, err)
+	_, err = db.ExecuteSQL("UPDATE staff SET dept_id = 3 WHERE id = 30;")
+	testingpkg.Ok(t, err)
+
+	// referenced key can't be changed
+	_, err = db.ExecuteSQL("UPDATE dept SET id = 5 WHERE id = 2;")
+	testingpkg.Equals(t, executors.ErrRowIsReferenced, err)
+	// RESTRICT (task.dept_id)
+	_, err = db.ExecuteSQL("DELETE FROM dept WHERE id = 2;")
+	testingpkg.Equals(t, executors.ErrRowIsReferenced, err)
+	testingpkg.Equals(t, 3, countRows("dept"))
+
+	// CASCADE (staff.dept_id) and SET NULL (task.staff_id) in a transaction which is aborted
+	_, err = db.ExecuteSQL("DELETE FROM task WHERE id = 300;")
+	testingpkg.Ok(t, err)
+	txn := db.BeginTransaction()
+	_, err = db.ExecuteSQLWithTxn("DELETE FROM dept WHERE id = 3;", txn)
+	testingpkg.Ok(t, err)
+	result, err := db.ExecuteSQLWithTxn("SELECT id FROM staff;", txn)
+	testingpkg.Ok(t, err)
+	testingpkg.Equals(t, 3, len(result.Rows))
+	db.AbortTransaction(txn)
+	testingpkg.Equals(t, 3, countRows("dept"))
+	testingpkg.Equals(t, 4, countRows("staff"))
+
+	_, err = db.ExecuteSQL("UPDATE task SET dept_id = NULL WHERE id = 101;")
+	testingpkg.Ok(t, err)
+	_, err = db.ExecuteSQL("DELETE FROM task WHERE id = 100;")
+	testingpkg.Ok(t, err)
+	_, err = db.ExecuteSQL("DELETE FROM dept WHERE id = 1;")
+	testingpkg.Ok(t, err)
+	result, err = db.ExecuteSQL("SELECT id FROM staff ORDER BY id;")
+	testingpkg.Ok(t, err)
+	testingpkg.Equals(t, [][]types.Value{{types.NewInteger(20)}, {types.NewInteger(30)}}, result.Rows)
+	result, err = db.ExecuteSQL("SELECT id FROM task WHERE staff_id IS NULL;")
+	testingpkg.Ok(t, err)
+	testingpkg.Equals(t, [][]types.Value{{types.NewInteger(101)}}, result.Rows)
+	db.Close()
+
+	// foreign keys are kept after reload
+	db, err = Open("test.db")
+	testingpkg.Ok(t, err)
+	defer db.Close()
+	_, err = db.ExecuteSQL("INSERT INTO staff VALUES (40, 4);")
+	testingpkg.Equals(t, executors.ErrReferencedRowNotFound, err)
+	_, err = db.ExecuteSQL("DELETE FROM dept WHERE id = 2;")
+	testingpkg.Equals(t, executors.ErrRowIsReferenced, err)
+	_, err = db.ExecuteSQL("DELETE FROM task WHERE id = 200;")
+	testingpkg.Ok(t, err)
+	_, err = db.ExecuteSQL("DELETE FROM dept WHERE id = 2;")
+	testingpkg.Ok(t, err)
+	testingpkg.Equals(t, 1, countRows("staff"))
+}
+
+func TestForeignKeyConcurrentWrite(t *testing.T) {
+	os.Remove("test.db")
+	os.Remove("test.log")
+	defer os.Remove("test.db")
+	defer os.Remove("test.log")
+
+	db, err := Open("test.db")
+	testingpkg.Ok(t, err)
+	defer db.Close()
+
+	_, err = db.ExecuteSQL("CREATE TABLE dept(id INT PRIMARY KEY, name VARCHAR(256));")
+	testingpkg.Ok(t, err)
+	_, err = db.ExecuteSQL("CREATE TABLE staff(id INT PRIMARY KEY, dept_id INT REFERENCES dept(id));")
+	testingpkg.Ok(t, err)
+	_, err = db.ExecuteSQL("INSERT INTO dept VALUES (10, 'sales'), (20, 'dev');")
+	testingpkg.Ok(t, err)
+
+	cases := []struct {
+		description string
+		parentWrite string
+	}{
+		{"delete", "DELETE FROM dept WHERE id = 10;"},
+		{"update key", "UPDATE dept SET id = 11 WHERE id = 10;"},
+	}
+	for ii, test := range cases {
+		t.Run(test.description, func(t *testing.T) {
+			// the transaction inserting the child row has read the referenced row
+			txn := db.BeginTransaction()
+			_, err := db.ExecuteSQLWithTxn("SELECT name FROM dept WHERE id = 10;", txn)
+			testingpkg.Ok(t, err)
+
+			ch := make(chan error)
+			go func() {
+				_, err := db.ExecuteSQL(test.parentWrite)
+				ch <- err
+			}()
+			time.Sleep(100 * time.Millisecond)
+			// the child row is inserted while the write on the referenced row is waiting
+			_, err = db.ExecuteSQLWithTxn(fmt.Sprintf("INSERT INTO staff VALUES (%d, 10);", ii), txn)
+			testingpkg.Ok(t, err)
+			time.Sleep(100 * time.Millisecond)
+			select {
+			case <-ch:
+				t.Fatal("referenced row is changed while the child row is not committed")
+			default:
+			}
+
+			db.CommitTransaction(txn)
+			testingpkg.Equals(t, executors.ErrRowIsReferenced, <-ch)
+			result, err := db.ExecuteSQL("SELECT name FROM dept WHERE id = 10;")
+			testingpkg.Ok(t, err)
+			testingpkg.Equals(t, 1, len(result.Rows))
+		})
+	}
+
+	// child row can't reference the row deleted by other transaction
+	txn := db.BeginTransaction()
+	_, err = db.ExecuteSQLWithTxn("DELETE FROM dept WHERE id = 20;", txn)
+	testingpkg.Ok(t, err)
+	ch := make(chan error)
+	go func() {
+		_, err := db.ExecuteSQL("INSERT INTO staff VALUES (100, 20);")
+		ch <- err
+	}()
+	time.Sleep(100 * time.Millisecond)
+	db.CommitTransaction(txn)
+	testingpkg.Assert(t, <-ch != nil, "child row referencing the deleted row is inserted")
+	result, err := db.ExecuteSQL("SELECT id FROM staff WHERE dept_id = 20;")
+	testingpkg.Ok(t, err)
+	testingpkg.Equals(t, 0, len(result.Rows))
+}
+
+func TestDeadlockMode(t *testing.T) {
+	modes := []struct {
+		description string
+		mode        access.DeadlockMode
+	}{
+		{"detection", access.DETECTION},
+		{"wait-die", access.WAIT_DIE},
+		{"wound-wait", access.WOUND_WAIT},
+	}
+	for _, test := range modes {
+		t.Run(test.description, func(t *testing.T) {
+			os.Remove("test.db")
+			os.Remove("test.log")
+			defer os.Remove("test.db")
+			defer os.Remove("test.log")
+
+			db, err := OpenWithOptions("test.db", &Options{DeadlockMode: test.mode})
+			testingpkg.Ok(t, err)
+			defer db.Close()
+
+			for _, table := range []string{"a", "b"} {
+				_, err = db.ExecuteSQL(fmt.Sprintf("CREATE TABLE %s(id INT, val INT);", table))
+				testingpkg.Ok(t, err)
+				_, err = db.ExecuteSQL(fmt.Sprintf("INSERT INTO %s VALUES (1, 0);", table))
+				testingpkg.Ok(t, err)
+			}
+
+			// each transaction writes a table and then writes the other one
+			txns := []*access.Transaction{db.BeginTransaction(), db.BeginTransaction()}
+			_, err = db.ExecuteSQLWithTxn("UPDATE a SET val = 1;", txns[0])
+			testingpkg.Ok(t, err)
+			_, err = db.ExecuteSQLWithTxn("UPDATE b SET val = 2;", txns[1])
+			testingpkg.Ok(t, err)
+
+			type result struct {
+				txnIdx int
+				err    error
+			}
+			ch := make(chan result)
+			for ii, query := range []string{"UPDATE b SET val = 1;", "UPDATE a SET val = 2;"} {
+				go func(txnIdx int, query string) {
+					_, err := db.ExecuteSQLWithTxn(query, txns[txnIdx])
+					ch <- result{txnIdx, err}
+				}(ii, query)
+			}
+
+			// deadlock is resolved before lock wait timeout
+			start := time.Now()
+			first := <-ch
+			testingpkg.Assert(t, first.err != nil, "both transactions proceeded in deadlock")
+			testingpkg.Assert(t, time.Since(start) < common.LockWaitTimeout, "deadlock is resolved by timeout")
+			db.AbortTransaction(txns[first.txnIdx])
+			second := <-ch
+			testingpkg.Ok(t, second.err)
+			db.CommitTransaction(txns[second.txnIdx])
+
+			expected := int32(second.txnIdx + 1)
+			for _, table := range []string{"a", "b"} {
+				res, err := db.ExecuteSQL(fmt.Sprintf("SELECT val FROM %s;", table))
+				testingpkg.Ok(t, err)
+				testingpkg.Equals(t, [][]types.Value{{types.NewInteger(expected)}}, res.Rows)
+			}
+		})
+	}
+}
+
+func TestDropTable(t *testing.T) {
+	os.Remove("test.db")
+	os.Remove("test.log")
+	defer os.Remove("test.db")
+	defer os.Remove("test.log")
+
+	db, err := Open("test.db")
+	testingpkg.Ok(t, err)
+
+	_, err = db.ExecuteSQL("CREATE TABLE dept(id INT PRIMARY KEY, name VARCHAR(256));")
+	testingpkg.Ok(t, err)
+	_, err = db.ExecuteSQL("CREATE TABLE staff(id INT, dept_id INT REFERENCES dept(id), INDEX id_name (id, dept_id));")
+	testingpkg.Ok(t, err)
+	_, err = db.ExecuteSQL("INSERT INTO dept VALUES (1, 'dev'), (2, 'sales');")
+	testingpkg.Ok(t, err)
+	_, err = db.ExecuteSQL("INSERT INTO staff VALUES (10, 1), (20, 2);")
+	testingpkg.Ok(t, err)
+
+	_, err = db.ExecuteSQL("DROP TABLE no_table;")
+	testingpkg.Equals(t, planner.ErrTableNotFound, err)
+	_, err = db.ExecuteSQL("DROP TABLE IF EXISTS no_table;")
+	testingpkg.Ok(t, err)
+	_, err = db.ExecuteSQL("DROP TABLE columns_catalog;")
+	testingpkg.Equals(t, planner.ErrNotSupported, err)
+	// referenced table can't be dropped before referencing table
+	_, err = db.ExecuteSQL("DROP TABLE dept;")
+	testingpkg.Equals(t, catalog.ErrTableIsReferenced, err)
+
+	// table is restored when the transaction is aborted
+	txn := db.BeginTransaction()
+	result, err := db.ExecuteSQLWithTxn("DROP TABLE staff;", txn)
+	testingpkg.Ok(t, err)
+	testingpkg.Equals(t, parser.DROP_TABLE, result.QueryType)
+	_, err = db.ExecuteSQLWithTxn("SELECT id FROM staff;", txn)
+	testingpkg.Equals(t, planner.ErrTableNotFound, err)
+	// name of the table is locked until the transaction finishes
+	_, err = db.ExecuteSQL("CREATE TABLE staff(id INT);")
+	testingpkg.Equals(t, planner.ErrTableAlreadyExists, err)
+	db.AbortTransaction(txn)
+	result, err = db.ExecuteSQL("SELECT id FROM staff WHERE dept_id = 2;")
+	testingpkg.Ok(t, err)
+	testingpkg.Equals(t, [][]types.Value{{types.NewInteger(20)}}, result.Rows)
+
+	// DROP TABLE waits for transactions using the table without blocking other statements
+	_, err = db.ExecuteSQL("CREATE TABLE memo(id INT);")
+	testingpkg.Ok(t, err)
+	txn = db.BeginTransaction()
+	_, err = db.ExecuteSQLWithTxn("SELECT id FROM memo;", txn)
+	testingpkg.Ok(t, err)
+	ch := make(chan error)
+	go func() {
+		_, err := db.ExecuteSQL("DROP TABLE memo;")
+		ch <- err
+	}()
+	time.Sleep(100 * time.Millisecond)
+	result, err = db.ExecuteSQL("SELECT id FROM staff WHERE dept_id = 2;")
+	testingpkg.Ok(t, err)
+	testingpkg.Equals(t, [][]types.Value{{types.NewInteger(20)}}, result.Rows)
+	select {
+	case <-ch:
+		t.Fatal("table is dropped while it is used by other transaction")
+	default:
+	}
+	db.CommitTransaction(txn)
+	testingpkg.Ok(t, <-ch)
+
+	_, err = db.ExecuteSQL("DROP TABLE staff, dept;")
+	testingpkg.Ok(t, err)
+	_, err = db.ExecuteSQL("SELECT id FROM dept;")
+	testingpkg.Equals(t, planner.ErrTableNotFound, err)
+
+	// table of the same name can be created again
+	_, err = db.ExecuteSQL("CREATE TABLE dept(id INT PRIMARY KEY, title VARCHAR(256));")
+	testingpkg.Ok(t, err)
+	_, err = db.ExecuteSQL("INSERT INTO dept VALUES (3, 'hr');")
+	testingpkg.Ok(t, err)
+	result, err = db.ExecuteSQL("SELECT * FROM dept WHERE id = 3;")
+	testingpkg.Ok(t, err)
+	testingpkg.Equals(t, [][]types.Value{{types.NewInteger(3), types.NewVarchar("hr")}}, result.Rows)
+
+	// table created in aborted transaction is removed
+	txn = db.BeginTransaction()
+	_, err = db.ExecuteSQLWithTxn("CREATE TABLE staff(id INT PRIMARY KEY);", txn)
+	testingpkg.Ok(t, err)
+	db.AbortTransaction(txn)
+	_, err = db.ExecuteSQL("SELECT id FROM staff;")
+	testingpkg.Equals(t, planner.ErrTableNotFound, err)
+	db.Close()
+
+	// dropped table doesn't appear after reload
+	db, err = Open("test.db")
+	testingpkg.Ok(t, err)
+	defer db.Close()
+	_, err = db.ExecuteSQL("SELECT id FROM staff;")
+	testingpkg.Equals(t, planner.ErrTableNotFound, err)
+	result, err = db.ExecuteSQL("SELECT title FROM dept;")
+	testingpkg.Ok(t, err)
+	testingpkg.Equals(t, [][]types.Value{{types.NewVarchar("hr")}}, result.Rows)
+}
+
+func TestAlterTable(t *testing.T) {
+	os.Remove("test.db")
+	os.Remove("test.log")
+	defer os.Remove("test.db")
+	defer os.Remove("test.log")
+
+	db, err := Open("test.db")
+	testingpkg.Ok(t, err)
+
+	_, err = db.ExecuteSQL("CREATE TABLE staff(id INT PRIMARY KEY, name VARCHAR(256), age INT CHECK (age >= 0));")
+	testingpkg.Ok(t, err)
+	_, err = db.ExecuteSQL("INSERT INTO staff VALUES (1, 'alice', 30), (2, 'bob', 40), (3, 'carol', 40);")
+	testingpkg.Ok(t, err)
+
+	// existing rows have default value of added column
+	_, err = db.ExecuteSQL("ALTER TABLE staff ADD COLUMN dept VARCHAR(256) DEFAULT 'dev';")
+	testingpkg.Ok(t, err)
+	result, err := db.ExecuteSQL("SELECT * FROM staff WHERE id = 2;")
+	testingpkg.Ok(t, err)
+	testingpkg.Equals(t, [][]types.Value{{types.NewInteger(2), types.NewVarchar("bob"), types.NewInteger(40), types.NewVarchar("dev")}}, result.Rows)
+	_, err = db.ExecuteSQL("ALTER TABLE staff ADD COLUMN salary INT NOT NULL;")
+	testingpkg.Equals(t, catalog.ErrExistingRowsViolateConstraint, err)
+	_, err = db.ExecuteSQL("ALTER TABLE staff ADD COLUMN name INT;")
+	testingpkg.Equals(t, planner.ErrColumnAlreadyExists, err)
+
+	// renamed column keeps its index and CHECK constraint
+	_, err = db.ExecuteSQL("ALTER TABLE staff RENAME COLUMN age TO years;")
+	testingpkg.Ok(t, err)
+	_, err = db.ExecuteSQL("INSERT INTO staff VALUES (4, 'dave', -1, 'dev');")
+	testingpkg.Equals(t, executors.ErrCheckViolation, err)
+	_, err = db.ExecuteSQL("INSERT INTO staff VALUES (1, 'dave', 20, 'dev');")
+	testingpkg.Equals(t, executors.ErrDuplicateKey, err)
+
+	_, err = db.ExecuteSQL("ALTER TABLE staff DROP COLUMN name;")
+	testingpkg.Ok(t, err)
+	result, err = db.ExecuteSQL("SELECT * FROM staff WHERE id = 3;")
+	testingpkg.Ok(t, err)
+	testingpkg.Equals(t, [][]types.Value{{types.NewInteger(3), types.NewInteger(40), types.NewVarchar("dev")}}, result.Rows)
+	_, err = db.ExecuteSQL("SELECT name FROM staff;")
+	testingpkg.Equals(t, planner.ErrColumnNotFound, err)
+
+	// index on existing column is filled with existing rows
+	_, err = db.ExecuteSQL("ALTER TABLE staff ADD UNIQUE (years);")
+	testingpkg.Equals(t, catalog.ErrExistingRowsViolateConstraint, err)
+	_, err = db.ExecuteSQL("ALTER TABLE staff ADD INDEX (years) USING BTREE;")
+	testingpkg.Ok(t, err)
+	result, err = db.ExecuteSQL("SELECT id FROM staff WHERE years >= 35 ORDER BY id;")
+	testingpkg.Ok(t, err)
+	testingpkg.Equals(t, [][]types.Value{{types.NewInteger(2)}, {types.NewInteger(3)}}, result.Rows)
+	_, err = db.ExecuteSQL("ALTER TABLE staff ADD INDEX (years);")
+	testingpkg.Equals(t, planner.ErrIndexAlreadyExists, err)
+
+	// changes are rolled back on abort
+	txn := db.BeginTransaction()
+	_, err = db.ExecuteSQLWithTxn("ALTER TABLE staff DROP COLUMN dept, ADD UNIQUE (id, years);", txn)
+	testingpkg.Ok(t, err)
+	db.AbortTransaction(txn)
+	result, err = db.ExecuteSQL("SELECT dept FROM staff WHERE id = 1;")
+	testingpkg.Ok(t, err)
+	testingpkg.Equals(t, [][]types.Value{{types.NewVarchar("dev")}}, result.Rows)
+	db.Close()
+
+	// schema and indexes are kept after reload
+	db, err = Open("test.db")
+	testingpkg.Ok(t, err)
+	defer db.Close()
+	result, err = db.ExecuteSQL("SELECT * FROM staff WHERE years = 30;")
+	testingpkg.Ok(t, err)
+	testingpkg.Equals(t, [][]types.Value{{types.NewInteger(1), types.NewInteger(30), types.NewVarchar("dev")}}, result.Rows)
+	_, err = db.ExecuteSQL("INSERT INTO staff VALUES (2, 20, 'hr');")
+	testingpkg.Equals(t, executors.ErrDuplicateKey, err)
+	_, err = db.ExecuteSQL("INSERT INTO staff VALUES (4, 20, 'hr');")
+	testingpkg.Ok(t, err)
+	result, err = db.ExecuteSQL("SELECT id FROM staff WHERE years < 35 ORDER BY id;")
+	testingpkg.Ok(t, err)
+	testingpkg.Equals(t, [][]types.Value{{types.NewInteger(1)}, {types.NewInteger(4)}}, result.Rows)
+
+	// column referenced by foreign key can't be dropped or renamed
+	_, err = db.ExecuteSQL("CREATE TABLE task(id INT, staff_id INT REFERENCES staff(id));")
+	testingpkg.Ok(t, err)
+	_, err = db.ExecuteSQL("ALTER TABLE staff DROP COLUMN id;")
+	testingpkg.Equals(t, planner.ErrColumnIsReferenced, err)
+	_, err = db.ExecuteSQL("ALTER TABLE staff RENAME COLUMN id TO staff_id;")
+	testingpkg.Equals(t, planner.ErrColumnIsReferenced, err)
+	_, err = db.ExecuteSQL("ALTER TABLE staff DROP COLUMN dept;")
+	testingpkg.Ok(t, err)
+	_, err = db.ExecuteSQL("INSERT INTO task VALUES (1, 5);")
+	testingpkg.Equals(t, executors.ErrReferencedRowNotFound, err)
+	_, err = db.ExecuteSQL("INSERT INTO task VALUES (1, 4);")
+	testingpkg.Ok(t, err)
+
+	// ALTER TABLE waits for transactions using the table without blocking other statements.
+	// columns bound to plans in the transaction are not changed meanwhile
+	txn = db.BeginTransaction()
+	_, err = db.ExecuteSQLWithTxn("SELECT id FROM staff;", txn)
+	testingpkg.Ok(t, err)
+	ch := make(chan error)
+	go func() {
+		_, err := db.ExecuteSQL("ALTER TABLE staff DROP COLUMN years;")
+		ch <- err
+	}()
+	time.Sleep(100 * time.Millisecond)
+	result, err = db.ExecuteSQL("SELECT staff_id FROM task;")
+	testingpkg.Ok(t, err)
+	testingpkg.Equals(t, [][]types.Value{{types.NewInteger(4)}}, result.Rows)
+	select {
+	case <-ch:
+		t.Fatal("table is altered while it is used by other transaction")
+	default:
+	}
+	result, err = db.ExecuteSQLWithTxn("SELECT years FROM staff WHERE id = 4;", txn)
+	testingpkg.Ok(t, err)
+	testingpkg.Equals(t, [][]types.Value{{types.NewInteger(20)}}, result.Rows)
+	db.CommitTransaction(txn)
+	testingpkg.Ok(t, <-ch)
+	_, err = db.ExecuteSQL("SELECT years FROM staff;")
+	testingpkg.Equals(t, planner.ErrColumnNotFound, err)
+}
+
+func TestCreateAndDropIndex(t *testing.T) {
+	os.Remove("test.db")
+	os.Remove("test.log")
+	defer os.Remove("test.db")
+	defer os.Remove("test.log")
+
+	// DDL waits for table lock held by other transaction until timeout
+	defer func(timeout time.Duration) { common.LockWaitTimeout = timeout }(common.LockWaitTimeout)
+	common.LockWaitTimeout = 100 * time.Millisecond
+
+	db, err := Open("test.db")
+	testingpkg.Ok(t, err)
+
+	_, err = db.ExecuteSQL("CREATE TABLE staff(id INT PRIMARY KEY, name VARCHAR(256), age INT);")
+	testingpkg.Ok(t, err)
+	_, err = db.ExecuteSQL("INSERT INTO staff VALUES (1, 'alice', 30), (2, 'bob', 40), (3, 'carol', 40);")
+	testingpkg.Ok(t, err)
+
+	// index is filled with existing rows
+	_, err = db.ExecuteSQL("CREATE UNIQUE INDEX age_uq ON staff (age);")
+	testingpkg.Equals(t, catalog.ErrExistingRowsViolateConstraint, err)
+	_, err = db.ExecuteSQL("CREATE INDEX age_idx ON staff (age) USING BTREE;")
+	testingpkg.Ok(t, err)
+	result, err := db.ExecuteSQL("SELECT id FROM staff WHERE age >= 35 ORDER BY id;")
+	testingpkg.Ok(t, err)
+	testingpkg.Equals(t, [][]types.Value{{types.NewInteger(2)}, {types.NewInteger(3)}}, result.Rows)
+	_, err = db.ExecuteSQL("CREATE INDEX age_idx ON staff (name);")
+	testingpkg.Equals(t, planner.ErrIndexAlreadyExists, err)
+	_, err = db.ExecuteSQL("CREATE INDEX age_idx2 ON staff (age);")
+	testingpkg.Equals(t, planner.ErrIndexAlreadyExists, err)
+	_, err = db.ExecuteSQL("CREATE INDEX name_idx ON nothing (name);")
+	testingpkg.Equals(t, planner.ErrTableNotFound, err)
+	_, err = db.ExecuteSQL("CREATE UNIQUE INDEX name_age ON staff (name, age);")
+	testingpkg.Ok(t, err)
+	_, err = db.ExecuteSQL("INSERT INTO staff VALUES (4, 'bob', 40);")
+	testingpkg.Equals(t, executors.ErrDuplicateKey, err)
+
+	// index can't be created while other transaction accesses the table
+	txn := db.BeginTransaction()
+	_, err = db.ExecuteSQLWithTxn("SELECT * FROM staff;", txn)
+	testingpkg.Ok(t, err)
+	_, err = db.ExecuteSQL("CREATE INDEX name_idx ON staff (name);")
+	testingpkg.Equals(t, access.ErrTableLockFailed, err)
+	db.CommitTransaction(txn)
+	_, err = db.ExecuteSQL("CREATE INDEX name_idx ON staff (name);")
+	testingpkg.Ok(t, err)
+
+	// waiting DDL doesn't block statements on other tables
+	db.lock_manager_.SetLockWaitTimeout(5 * time.Second)
+	_, err = db.ExecuteSQL("CREATE TABLE memo(id INT);")
+	testingpkg.Ok(t, err)
+	_, err = db.ExecuteSQL("CREATE INDEX id_age ON staff (id, age);")
+	testingpkg.Ok(t, err)
+	txn = db.BeginTransaction()
+	_, err = db.ExecuteSQLWithTxn("SELECT * FROM staff;", txn)
+	testingpkg.Ok(t, err)
+	ch := make(chan error)
+	go func() {
+		_, err := db.ExecuteSQL("DROP INDEX id_age ON staff;")
+		ch <- err
+	}()
+	time.Sleep(100 * time.Millisecond)
+	_, err = db.ExecuteSQL("INSERT INTO memo VALUES (1);")
+	testingpkg.Ok(t, err)
+	select {
+	case <-ch:
+		t.Fatal("index is dropped while the table is used by other transaction")
+	default:
+	}
+	db.CommitTransaction(txn)
+	testingpkg.Ok(t, <-ch)
+	db.lock_manager_.SetLockWaitTimeout(common.LockWaitTimeout)
+
+	// dropped index is restored on abort
+	txn = db.BeginTransaction()
+	_, err = db.ExecuteSQLWithTxn("DROP INDEX name_age ON staff;", txn)
+	testingpkg.Ok(t, err)
+	db.AbortTransaction(txn)
+	_, err = db.ExecuteSQL("INSERT INTO staff VALUES (4, 'bob', 40);")
+	testingpkg.Equals(t, executors.ErrDuplicateKey, err)
+	db.Close()
+
+	// names of indexes are kept after reload
+	db, err = Open("test.db")
+	testingpkg.Ok(t, err)
+	defer db.Close()
+	_, err = db.ExecuteSQL("DROP INDEX name_age ON staff;")
+	testingpkg.Ok(t, err)
+	_, err = db.ExecuteSQL("INSERT INTO staff VALUES (4, 'bob', 40);")
+	testingpkg.Ok(t, err)
+	_, err = db.ExecuteSQL("DROP INDEX age_idx ON staff;")
+	testingpkg.Ok(t, err)
+	_, err = db.ExecuteSQL("DROP INDEX age_idx ON staff;")
+	testingpkg.Equals(t, planner.ErrIndexNotFound, err)
+	_, err = db.ExecuteSQL("DROP INDEX IF EXISTS age_idx ON staff;")
+	testingpkg.Ok(t, err)
+	result, err = db.ExecuteSQL("SELECT id FROM staff WHERE age = 40 ORDER BY id;")
+	testingpkg.Ok(t, err)
+	testingpkg.Equals(t, [][]types.Value{{types.NewInteger(2)}, {types.NewInteger(3)}, {types.NewInteger(4)}}, result.Rows)
+	result, err = db.ExecuteSQL("SELECT id FROM staff WHERE name = 'bob' ORDER BY id;")
+	testingpkg.Ok(t, err)
+	testingpkg.Equals(t, [][]types.Value{{types.NewInteger(2)}, {types.NewInteger(4)}}, result.Rows)
+
+	// index used by foreign key can't be dropped
+	_, err = db.ExecuteSQL("CREATE TABLE task(id INT, staff_id INT REFERENCES staff(id));")
+	testingpkg.Ok(t, err)
+	_, err = db.ExecuteSQL("DROP INDEX id_index ON staff;")
+	testingpkg.Equals(t, planner.ErrIndexIsUsedByForeignKey, err)
+	_, err = db.ExecuteSQL("DROP INDEX staff_id_index ON task;")
+	testingpkg.Equals(t, planner.ErrIndexIsUsedByForeignKey, err)
+}
+
+func TestPhantomPrevention(t *testing.T) {
+	os.Remove("test.db")
+	os.Remove("test.log")
+	defer os.Remove("test.db")
+	defer os.Remove("test.log")
+
+	db, err := Open("test.db")
+	testingpkg.Ok(t, err)
+	defer db.Close()
+
+	_, err = db.ExecuteSQL("CREATE TABLE t(id INT, name VARCHAR(256), INDEX id_idx (id) USING BTREE);")
+	testingpkg.Ok(t, err)
+	_, err = db.ExecuteSQL("INSERT INTO t(id, name) VALUES (1, 'a'), (20, 'b');")
+	testingpkg.Ok(t, err)
+
+	cases := []struct {
+		description string
+		query       string
+		matched     string
+		unmatched   string
+	}{
+		// scanned with the index
+		{"range scan", "SELECT name FROM t WHERE id >= 10;", "INSERT INTO t(id, name) VALUES (30, 'c');", "INSERT INTO t(id, name) VALUES (5, 'c');"},
+		{"seq scan", "SELECT id FROM t WHERE name = 'b';", "INSERT INTO t(id, name) VALUES (40, 'b');", "INSERT INTO t(id, name) VALUES (40, 'd');"},
+		// row which is not read moves into the range
+		{"update", "SELECT name FROM t WHERE id >= 10;", "UPDATE t SET id = 15 WHERE id = 1;", "UPDATE t SET id = 3 WHERE id = 5;"},
+	}
+	for _, test := range cases {
+		t.Run(test.description, func(t *testing.T) {
+			txn := db.BeginTransaction()
+			result, err := db.ExecuteSQLWithTxn(test.query, txn)
+			testingpkg.Ok(t, err)
+			expected := result.Rows
+
+			ch := make(chan error)
+			go func() {
+				_, err := db.ExecuteSQL(test.matched)
+				ch <- err
+			}()
+			// row which doesn't match the condition is written without waiting
+			_, err = db.ExecuteSQL(test.unmatched)
+			testingpkg.Ok(t, err)
+			time.Sleep(100 * time.Millisecond)
+			select {
+			case <-ch:
+				t.Fatal("matching row is written while the scan is not finished")
+			default:
+			}
+
+			// repeated scan sees the same rows
+			result, err = db.ExecuteSQLWithTxn(test.query, txn)
+			testingpkg.Ok(t, err)
+			testingpkg.Equals(t, expected, result.Rows)
+			db.CommitTransaction(txn)
+
+			testingpkg.Ok(t, <-ch)
+			result, err = db.ExecuteSQL(test.query)
+			testingpkg.Ok(t, err)
+			testingpkg.Equals(t, len(expected)+1, len(result.Rows))
+		})
+	}
+}
@@ -0,0 +1,114 @@
+package samehada
+
+import (
+	"github.com/ryogrid/SamehadaDB/errors"
+	"github.com/ryogrid/SamehadaDB/parser"
+	"github.com/ryogrid/SamehadaDB/storage/access"
+)
+
+const ErrInFailedTxn = errors.Error("current transaction is aborted, commands ignored until end of transaction block")
+
+/**
+ * Session keeps transaction state of a client connection.
+ * a transaction is started with BEGIN (or START TRANSACTION) statement and finished
+ * with COMMIT or ROLLBACK. when no transaction is started, each statement is executed
+ * in its own transaction.
+ * after a statement in a transaction failed, the transaction is treated as failed and
+ * all statements are rejected until COMMIT or ROLLBACK (COMMIT rolls back the transaction)
+ */
+type Session struct {
+	db_       *SamehadaDB
+	txn_      *access.Transaction
+	isFailed_ bool
+}
+
+func (sdb *SamehadaDB) NewSession() *Session {
+	return &Session{sdb, nil, false}
+}
+
+func (s *Session) InTransaction() bool {
+	return s.txn_ != nil
+}
+
+// IsFailed returns true when a statement in current transaction failed
+func (s *Session) IsFailed() bool {
+	return s.txn_ != nil && s.isFailed_
+}
+
+func (s *Session) GetTransaction() *access.Transaction {
+	return s.txn_
+}
+
+// ExecuteSQL executes a statement on the session. on transaction control statements,
+// returned Result has QueryType of the statement. when COMMIT rolled back failed
+// transaction, QueryType is ROLLBACK
+func (s *Session) ExecuteSQL(sqlStr string) (*Result, error) {
+	qi, err := parseSQL(sqlStr)
+	if err != nil {
+		return nil, s.markFailed(err)
+	}
+
+	switch *qi.QueryType_ {
+	case parser.BEGIN:
+		if s.txn_ == nil {
+			s.txn_ = s.db_.BeginTransaction()
+			s.isFailed_ = false
+		}
+		return &Result{QueryType: parser.BEGIN}, nil
+	case parser.COMMIT:
+		queryType, err := s.commit()
+		if err != nil {
+			return nil, err
+		}
+		return &Result{QueryType: queryType}, nil
+	case parser.ROLLBACK:
+		s.rollback()
+		return &Result{QueryType: parser.ROLLBACK}, nil
+	}
+
+	if s.txn_ == nil {
+		return s.db_.ExecuteSQL(sqlStr)
+	}
+	if s.isFailed_ {
+		return nil, ErrInFailedTxn
+	}
+	result, err := s.db_.ExecuteSQLWithTxn(sqlStr, s.txn_)
+	if err != nil {
+		return nil, s.markFailed(err)
+	}
+	return result, nil
+}
+
+func (s *Session) markFailed(err error) error {
+	if s.txn_ != nil {
+		s.isFailed_ = true
+	}
+	return err
+}
+
+func (s *Session) commit() (parser.QueryType, error) {
+	if s.txn_ == nil {
+		return parser.COMMIT, nil
+	}
+	txn := s.txn_
+	s.txn_ = nil
+	if s.isFailed_ || txn.GetState() == access.ABORTED {
+		s.db_.AbortTransaction(txn)
+		return parser.ROLLBACK, nil
+	}
+	return parser.COMMIT, s.db_.CommitTransaction(txn)
+}
+
+func (s *Session) rollback() {
+	if s.txn_ == nil {
+		return
+	}
+	txn := s.txn_
+	s.txn_ = nil
+	s.db_.AbortTransaction(txn)
+}
+
+// Close aborts transaction which is not finished
+func (s *Session) Close() {
+	s.rollback()
+}
@@ -0,0 +1,364 @@
+package http_server
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/ryogrid/SamehadaDB/catalog"
+	"github.com/ryogrid/SamehadaDB/errors"
+	"github.com/ryogrid/SamehadaDB/planner"
+	"github.com/ryogrid/SamehadaDB/samehada"
+	"github.com/ryogrid/SamehadaDB/storage/access"
+	"github.com/ryogrid/SamehadaDB/types"
+)
+
+const ErrTxNotFound = errors.Error("transaction does not exist")
+const ErrInvalidRequest = errors.Error("invalid request body")
+const ErrMethodNotAllowed = errors.Error("method not allowed")
+const ErrNotFound = errors.Error("not found")
+const ErrServerClosed = errors.Error("server is closed")
+
+/**
+ * HttpServer exposes SamehadaDB with HTTP and JSON.
+ *
+ *   POST /query             {"sql": "...", "tx": <id>} -> {"columns": [...], "rows": [...], "rows_affected": n}
+ *   POST /tx                                          -> {"tx": <id>}
+ *   POST /tx/<id>/commit, POST /tx/<id>/abort
+ *   GET  /tables, GET /tables/<name>
+ *
+ * when "tx" is not specified, the statement is executed in its own transaction.
+ * transactions started with /tx remain until commit or abort is requested
+ * (or the server is closed)
+ */
+type HttpServer struct {
+	db_     *samehada.SamehadaDB
+	server_ *http.Server
+	// transactions started with /tx
+	txns_  map[types.TxnID]*txnEntry
+	mutex_ *sync.Mutex
+	// counts requests being handled. Close waits for them
+	wg_       *sync.WaitGroup
+	isClosed_ bool
+}
+
+// txnEntry serializes requests which use same transaction
+type txnEntry struct {
+	txn_   *access.Transaction
+	mutex_ *sync.Mutex
+	// true when a statement in the transaction failed. such transaction can't be committed
+	isFailed_ bool
+}
+
+type queryRequest struct {
+	SQL string       `json:"sql"`
+	Tx  *types.TxnID `json:"tx"`
+}
+
+type columnInfo struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+}
+
+type queryResponse struct {
+	Columns      []columnInfo    `json:"columns"`
+	Rows         [][]interface{} `json:"rows"`
+	RowsAffected int64           `json:"rows_affected"`
+}
+
+type txResponse struct {
+	Tx types.TxnID `json:"tx"`
+}
+
+type tableInfo struct {
+	Name    string            `json:"name"`
+	OID     uint32            `json:"oid"`
+	Columns []tableColumnInfo `json:"columns,omitempty"`
+}
+
+type tableColumnInfo struct {
+	Name    string `json:"name"`
+	Type    string `json:"type"`
+	Indexed bool   `json:"indexed"`
+}
+
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+func NewHttpServer(db *samehada.SamehadaDB) *HttpServer {
+	return &HttpServer{db, nil, make(map[types.TxnID]*txnEntry), new(sync.Mutex), new(sync.WaitGroup), false}
+}
+
+func (srv *HttpServer) ListenAndServe(addr string) error {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return srv.Serve(listener)
+}
+
+// Serve accepts requests on listener until Close is called
+func (srv *HttpServer) Serve(listener net.Listener) error {
+	srv.mutex_.Lock()
+	srv.server_ = &http.Server{Handler: srv}
+	server := srv.server_
+	srv.mutex_.Unlock()
+	return server.Serve(listener)
+}
+
+// Close stops the server and aborts transactions which are not finished.
+// it returns after requests being handled finished
+func (srv *HttpServer) Close() error {
+	srv.mutex_.Lock()
+	srv.isClosed_ = true
+	var err error = nil
+	if srv.server_ != nil {
+		err = srv.server_.Close()
+	}
+	srv.mutex_.Unlock()
+
+	srv.wg_.Wait()
+	srv.mutex_.Lock()
+	defer srv.mutex_.Unlock()
+	for txnId, entry := range srv.txns_ {
+		entry.mutex_.Lock()
+		srv.db_.AbortTransaction(entry.txn_)
+		entry.mutex_.Unlock()
+		delete(srv.txns_, txnId)
+	}
+	return err
+}
+
+func (srv *HttpServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	srv.mutex_.Lock()
+	if srv.isClosed_ {
+		srv.mutex_.Unlock()
+		writeError(w, http.StatusServiceUnavailable, ErrServerClosed)
+		return
+	}
+	srv.wg_.Add(1)
+	srv.mutex_.Unlock()
+	defer srv.wg_.Done()
+
+	path := strings.Trim(r.URL.Path, "/")
+	elems := strings.Split(path, "/")
+
+	switch {
+	case path == "query":
+		srv.requireMethod(w, r, http.MethodPost, srv.handleQuery)
+	case path == "tx":
+		srv.requireMethod(w, r, http.MethodPost, srv.handleBegin)
+	case len(elems) == 3 && elems[0] == "tx" && (elems[2] == "commit" || elems[2] == "abort"):
+		srv.requireMethod(w, r, http.MethodPost, func(w http.ResponseWriter, r *http.Request) {
+			srv.handleFinish(w, elems[1], elems[2] == "commit")
+		})
+	case path == "tables":
+		srv.requireMethod(w, r, http.MethodGet, srv.handleTables)
+	case len(elems) == 2 && elems[0] == "tables":
+		srv.requireMethod(w, r, http.MethodGet, func(w http.ResponseWriter, r *http.Request) {
+			srv.handleTable(w, elems[1])
+		})
+	default:
+		writeError(w, http.StatusNotFound, ErrNotFound)
+	}
+}
+
+func (srv *HttpServer) requireMethod(w http.ResponseWriter, r *http.Request, method string, handler http.HandlerFunc) {
+	if r.Method != method {
+		w.Header().Set("Allow", method)
+		writeError(w, http.StatusMethodNotAllowed, ErrMethodNotAllowed)
+		return
+	}
+	handler(w, r)
+}
+
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, &errorResponse{err.Error()})
+}
+
+// errorStatus returns HTTP status code corresponding to error of query execution
+func errorStatus(err error) int {
+	switch err {
+	case samehada.ErrTxnAborted, samehada.ErrInFailedTxn:
+		return http.StatusConflict
+	case ErrTxNotFound:
+		return http.StatusNotFound
+	case planner.ErrNotSupported:
+		return http.StatusNotImplemented
+	}
+	return http.StatusBadRequest
+}
+
+func (srv *HttpServer) handleQuery(w http.ResponseWriter, r *http.Request) {
+	req := new(queryRequest)
+	if err := json.NewDecoder(r.Body).Decode(req); err != nil || strings.TrimSpace(req.SQL) == "" {
+		writeError(w, http.StatusBadRequest, ErrInvalidRequest)
+		return
+	}
+
+	var result *samehada.Result
+	var err error
+	if req.Tx == nil {
+		result, err = srv.db_.ExecuteSQL(req.SQL)
+	} else {
+		entry := srv.getTxn(*req.Tx)
+		if entry == nil {
+			writeError(w, http.StatusNotFound, ErrTxNotFound)
+			return
+		}
+		entry.mutex_.Lock()
+		if entry.isFailed_ {
+			err = samehada.ErrInFailedTxn
+		} else {
+			result, err = srv.db_.ExecuteSQLWithTxn(req.SQL, entry.txn_)
+			entry.isFailed_ = err != nil
+		}
+		entry.mutex_.Unlock()
+	}
+	if err != nil {
+		writeError(w, errorStatus(err), err)
+		return
+	}
+
+	resp := &queryResponse{make([]columnInfo, 0), make([][]interface{}, 0), result.RowsAffected}
+	for ii, name := range result.ColumnNames {
+		resp.Columns = append(resp.Columns, columnInfo{name, typeName(result.ColumnTypes[ii])})
+	}
+	for _, row := range result.Rows {
+		vals := make([]interface{}, len(row))
+		for ii := range row {
+			vals[ii] = toJSONValue(&row[ii])
+		}
+		resp.Rows = append(resp.Rows, vals)
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func (srv *HttpServer) handleBegin(w http.ResponseWriter, r *http.Request) {
+	txn := srv.db_.BeginTransaction()
+	srv.mutex_.Lock()
+	srv.txns_[txn.GetTransactionId()] = &txnEntry{txn, new(sync.Mutex), false}
+	srv.mutex_.Unlock()
+	writeJSON(w, http.StatusCreated, &txResponse{txn.GetTransactionId()})
+}
+
+func (srv *HttpServer) getTxn(txnId types.TxnID) *txnEntry {
+	srv.mutex_.Lock()
+	defer srv.mutex_.Unlock()
+	return srv.txns_[txnId]
+}
+
+func (srv *HttpServer) handleFinish(w http.ResponseWriter, idStr string, isCommit bool) {
+	txnId, err := strconv.ParseInt(idStr, 10, 32)
+	if err != nil {
+		writeError(w, http.StatusNotFound, ErrTxNotFound)
+		return
+	}
+	srv.mutex_.Lock()
+	entry, ok := srv.txns_[types.TxnID(txnId)]
+	delete(srv.txns_, types.TxnID(txnId))
+	srv.mutex_.Unlock()
+	if !ok {
+		writeError(w, http.StatusNotFound, ErrTxNotFound)
+		return
+	}
+
+	entry.mutex_.Lock()
+	defer entry.mutex_.Unlock()
+	if isCommit && !entry.isFailed_ && entry.txn_.GetState() != access.ABORTED {
+		if err := srv.db_.CommitTransaction(entry.txn_); err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, &txResponse{types.TxnID(txnId)})
+		return
+	}
+	srv.db_.AbortTransaction(entry.txn_)
+	if isCommit {
+		// transaction in which a statement failed can't be committed
+		writeError(w, http.StatusConflict, samehada.ErrTxnAborted)
+		return
+	}
+	writeJSON(w, http.StatusOK, &txResponse{types.TxnID(txnId)})
+}
+
+func (srv *HttpServer) handleTables(w http.ResponseWriter, r *http.Request) {
+	ret := make([]tableInfo, 0)
+	for _, tableMetadata := range srv.db_.GetCatalog().GetAllTables() {
+		if catalog.IsSystemCatalog(tableMetadata.OID()) {
+			continue
+		}
+		ret = append(ret, tableInfo{tableMetadata.Name(), tableMetadata.OID(), nil})
+	}
+	writeJSON(w, http.StatusOK, ret)
+}
+
+// handleTable reads definition of the table in a transaction which locks the table,
+// so columns and indexes are not changed by DDL meanwhile
+func (srv *HttpServer) handleTable(w http.ResponseWriter, name string) {
+	catalog_ := srv.db_.GetCatalog()
+	txn := srv.db_.BeginTransaction()
+	defer srv.db_.AbortTransaction(txn)
+	tableMetadata := catalog_.GetTableByName(name)
+	if tableMetadata == nil || catalog.IsSystemCatalog(tableMetadata.OID()) {
+		writeError(w, http.StatusNotFound, planner.ErrTableNotFound)
+		return
+	}
+	if err := catalog_.LockTable(tableMetadata, access.INTENTION_SHARED, txn); err != nil {
+		writeError(w, errorStatus(err), err)
+		return
+	}
+	// the table may be altered or dropped while waiting for the lock
+	tableMetadata = catalog_.GetTableByName(name)
+	if tableMetadata == nil {
+		writeError(w, http.StatusNotFound, planner.ErrTableNotFound)
+		return
+	}
+
+	ret := tableInfo{tableMetadata.Name(), tableMetadata.OID(), make([]tableColumnInfo, 0)}
+	for ii, col := range tableMetadata.Schema().GetColumns() {
+		ret.Columns = append(ret.Columns, tableColumnInfo{col.GetColumnName(), typeName(col.GetType()), tableMetadata.GetIndex(ii) != nil})
+	}
+	writeJSON(w, http.StatusOK, ret)
+}
+
+func typeName(typeID types.TypeID) string {
+	switch typeID {
+	case types.Integer:
+		return "INT"
+	case types.Float:
+		return "FLOAT"
+	case types.Boolean:
+		return "BOOLEAN"
+	case types.Varchar:
+		return "VARCHAR"
+	}
+	return "UNKNOWN"
+}
+
+func toJSONValue(val *types.Value) interface{} {
+	if val.IsNull() {
+		return nil
+	}
+	switch val.ValueType() {
+	case types.Integer:
+		return val.ToInteger()
+	case types.Float:
+		return val.ToFloat()
+	case types.Boolean:
+		return val.ToBoolean()
+	case types.Varchar:
+		return val.ToVarchar()
+	}
+	return nil
+}
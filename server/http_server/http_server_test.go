@@ -0,0 +1,113 @@
+package http_server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/ryogrid/SamehadaDB/samehada"
+	testingpkg "github.com/ryogrid/SamehadaDB/testing"
+)
+
+func request(t *testing.T, method string, url string, body string, out interface{}) int {
+	req, err := http.NewRequest(method, url, strings.NewReader(body))
+	testingpkg.Ok(t, err)
+	resp, err := http.DefaultClient.Do(req)
+	testingpkg.Ok(t, err)
+	defer resp.Body.Close()
+	if out != nil {
+		testingpkg.Ok(t, json.NewDecoder(resp.Body).Decode(out))
+	}
+	return resp.StatusCode
+}
+
+func TestHttpServer(t *testing.T) {
+	os.Remove("test.db")
+	os.Remove("test.log")
+	defer os.Remove("test.db")
+	defer os.Remove("test.log")
+
+	db, err := samehada.Open("test.db")
+	testingpkg.Ok(t, err)
+	defer db.Close()
+
+	server := NewHttpServer(db)
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+	defer server.Close()
+
+	status := request(t, "POST", ts.URL+"/query", `{"sql": "CREATE TABLE name_age_list(id INT, name VARCHAR(256), weight FLOAT);"}`, nil)
+	testingpkg.Equals(t, http.StatusOK, status)
+	resp := new(queryResponse)
+	status = request(t, "POST", ts.URL+"/query", `{"sql": "INSERT INTO name_age_list(id, name, weight) VALUES (1, 'Ryo', 60.5), (2, 'Hanako', NULL);"}`, resp)
+	testingpkg.Equals(t, http.StatusOK, status)
+	testingpkg.Equals(t, int64(2), resp.RowsAffected)
+
+	resp = new(queryResponse)
+	status = request(t, "POST", ts.URL+"/query", `{"sql": "SELECT id, name, weight FROM name_age_list;"}`, resp)
+	testingpkg.Equals(t, http.StatusOK, status)
+	testingpkg.Equals(t, []columnInfo{{"id", "INT"}, {"name", "VARCHAR"}, {"weight", "FLOAT"}}, resp.Columns)
+	testingpkg.Equals(t, [][]interface{}{{float64(1), "Ryo", 60.5}, {float64(2), "Hanako", nil}}, resp.Rows)
+
+	errResp := new(errorResponse)
+	status = request(t, "POST", ts.URL+"/query", `{"sql": "SELECT * FROM not_exist;"}`, errResp)
+	testingpkg.Equals(t, http.StatusBadRequest, status)
+	testingpkg.SimpleAssert(t, errResp.Error != "")
+	status = request(t, "GET", ts.URL+"/query", "", nil)
+	testingpkg.Equals(t, http.StatusMethodNotAllowed, status)
+
+	// explicit transaction
+	tx := new(txResponse)
+	status = request(t, "POST", ts.URL+"/tx", "", tx)
+	testingpkg.Equals(t, http.StatusCreated, status)
+	status = request(t, "POST", ts.URL+"/query", fmt.Sprintf(`{"sql": "DELETE FROM name_age_list WHERE id = 1;", "tx": %d}`, tx.Tx), nil)
+	testingpkg.Equals(t, http.StatusOK, status)
+	status = request(t, "POST", ts.URL+fmt.Sprintf("/tx/%d/abort", tx.Tx), "", nil)
+	testingpkg.Equals(t, http.StatusOK, status)
+	status = request(t, "POST", ts.URL+fmt.Sprintf("/tx/%d/commit", tx.Tx), "", nil)
+	testingpkg.Equals(t, http.StatusNotFound, status)
+
+	tx = new(txResponse)
+	request(t, "POST", ts.URL+"/tx", "", tx)
+	request(t, "POST", ts.URL+"/query", fmt.Sprintf(`{"sql": "UPDATE name_age_list SET name = 'Ryo2' WHERE id = 1;", "tx": %d}`, tx.Tx), nil)
+	status = request(t, "POST", ts.URL+fmt.Sprintf("/tx/%d/commit", tx.Tx), "", nil)
+	testingpkg.Equals(t, http.StatusOK, status)
+
+	resp = new(queryResponse)
+	request(t, "POST", ts.URL+"/query", `{"sql": "SELECT name FROM name_age_list WHERE id = 1;"}`, resp)
+	testingpkg.Equals(t, [][]interface{}{{"Ryo2"}}, resp.Rows)
+
+	// transaction in which a statement failed is rolled back on commit
+	tx = new(txResponse)
+	request(t, "POST", ts.URL+"/tx", "", tx)
+	status = request(t, "POST", ts.URL+"/query", fmt.Sprintf(`{"sql": "UPDATE name_age_list SET name = 'Ryo3' WHERE id = 1;", "tx": %d}`, tx.Tx), nil)
+	testingpkg.Equals(t, http.StatusOK, status)
+	status = request(t, "POST", ts.URL+"/query", fmt.Sprintf(`{"sql": "SELECT * FROM not_exist;", "tx": %d}`, tx.Tx), nil)
+	testingpkg.Equals(t, http.StatusBadRequest, status)
+	status = request(t, "POST", ts.URL+"/query", fmt.Sprintf(`{"sql": "DELETE FROM name_age_list WHERE id = 2;", "tx": %d}`, tx.Tx), nil)
+	testingpkg.Equals(t, http.StatusConflict, status)
+	status = request(t, "POST", ts.URL+fmt.Sprintf("/tx/%d/commit", tx.Tx), "", nil)
+	testingpkg.Equals(t, http.StatusConflict, status)
+	resp = new(queryResponse)
+	request(t, "POST", ts.URL+"/query", `{"sql": "SELECT name FROM name_age_list WHERE id = 1;"}`, resp)
+	testingpkg.Equals(t, [][]interface{}{{"Ryo2"}}, resp.Rows)
+
+	// catalog
+	tables := make([]tableInfo, 0)
+	status = request(t, "GET", ts.URL+"/tables", "", &tables)
+	testingpkg.Equals(t, http.StatusOK, status)
+	testingpkg.Equals(t, 1, len(tables))
+	testingpkg.Equals(t, "name_age_list", tables[0].Name)
+
+	table := new(tableInfo)
+	status = request(t, "GET", ts.URL+"/tables/name_age_list", "", table)
+	testingpkg.Equals(t, http.StatusOK, status)
+	testingpkg.Equals(t, 3, len(table.Columns))
+	testingpkg.Equals(t, "VARCHAR", table.Columns[1].Type)
+	status = request(t, "GET", ts.URL+"/tables/not_exist", "", nil)
+	testingpkg.Equals(t, http.StatusNotFound, status)
+}
@@ -0,0 +1,98 @@
+package mysql_server
+
+import (
+	"net"
+	"sync"
+
+	"github.com/ryogrid/SamehadaDB/errors"
+	"github.com/ryogrid/SamehadaDB/samehada"
+)
+
+const ErrUnsupportedCommand = errors.Error("command is not supported")
+const ErrUnsupportedClient = errors.Error("client which doesn't support protocol 4.1 is not supported")
+const ErrEmptyQuery = errors.Error("query was empty")
+
+/**
+ * MySQLServer accepts connections of MySQL clients (protocol 4.1, handshake v10)
+ * and executes queries sent with COM_QUERY against SamehadaDB. results are sent as text resultsets.
+ * each connection (session) has at most one transaction at a time. when no transaction is
+ * started with BEGIN or START TRANSACTION, each statement is executed in its own transaction (autocommit).
+ * authentication is not implemented. any user is accepted
+ */
+type MySQLServer struct {
+	db_       *samehada.SamehadaDB
+	listener_ net.Listener
+	sessions_ map[*session]bool
+	mutex_    *sync.Mutex
+	// counts running sessions. Close waits for them
+	wg_       *sync.WaitGroup
+	isClosed_ bool
+	// used as connection id
+	nextSessionId_ uint32
+}
+
+func NewMySQLServer(db *samehada.SamehadaDB) *MySQLServer {
+	return &MySQLServer{db, nil, make(map[*session]bool), new(sync.Mutex), new(sync.WaitGroup), false, 1}
+}
+
+func (srv *MySQLServer) ListenAndServe(addr string) error {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return srv.Serve(listener)
+}
+
+// Serve accepts connections on listener until Close is called
+func (srv *MySQLServer) Serve(listener net.Listener) error {
+	srv.mutex_.Lock()
+	srv.listener_ = listener
+	srv.mutex_.Unlock()
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return err
+		}
+
+		srv.mutex_.Lock()
+		if srv.isClosed_ {
+			// connection accepted while closing is not served
+			srv.mutex_.Unlock()
+			conn.Close()
+			continue
+		}
+		s := newSession(srv.db_, conn, srv.nextSessionId_)
+		srv.nextSessionId_++
+		srv.sessions_[s] = true
+		srv.wg_.Add(1)
+		srv.mutex_.Unlock()
+
+		go func() {
+			defer srv.wg_.Done()
+			s.run()
+			srv.mutex_.Lock()
+			delete(srv.sessions_, s)
+			srv.mutex_.Unlock()
+		}()
+	}
+}
+
+// Close stops accepting connections and closes all connections.
+// it returns after all sessions finished. transactions of closed sessions are aborted
+func (srv *MySQLServer) Close() error {
+	srv.mutex_.Lock()
+	srv.isClosed_ = true
+	var err error = nil
+	if srv.listener_ != nil {
+		err = srv.listener_.Close()
+	}
+	for s := range srv.sessions_ {
+		s.conn_.Close()
+	}
+	srv.mutex_.Unlock()
+
+	// statement being executed is finished before its session notices the closed connection
+	srv.wg_.Wait()
+	return err
+}
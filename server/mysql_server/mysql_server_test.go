@@ -0,0 +1,172 @@
+package mysql_server
+
+import (
+	"bufio"
+	"encoding/binary"
+	"net"
+	"os"
+	"testing"
+
+	"github.com/ryogrid/SamehadaDB/samehada"
+	testingpkg "github.com/ryogrid/SamehadaDB/testing"
+)
+
+// testClient is a minimal MySQL client
+type testClient struct {
+	t    *testing.T
+	conn net.Conn
+	pio  *packetIO
+}
+
+func connectTestClient(t *testing.T, addr string) *testClient {
+	conn, err := net.Dial("tcp", addr)
+	testingpkg.Ok(t, err)
+	c := &testClient{t, conn, &packetIO{bufio.NewReader(conn), conn, 0}}
+
+	handshake, err := c.pio.readPacket()
+	testingpkg.Ok(t, err)
+	testingpkg.Equals(t, byte(10), handshake[0])
+
+	pb := new(packetBuilder)
+	pb.writeUint32(clientProtocol41 | clientSecureConnection | clientPluginAuth | clientMultiStatements)
+	pb.writeUint32(1 << 24)
+	pb.writeByte(charsetUTF8)
+	pb.writeBytes(make([]byte, 23))
+	pb.writeNullString("root")
+	pb.writeByte(0)
+	pb.writeNullString("mysql_native_password")
+	testingpkg.Ok(t, c.pio.writePacket(pb.buf.Bytes()))
+
+	ok, err := c.pio.readPacket()
+	testingpkg.Ok(t, err)
+	testingpkg.Equals(t, byte(0x00), ok[0])
+	return c
+}
+
+func (c *testClient) command(cmd byte, arg string) {
+	c.pio.seq_ = 0
+	testingpkg.Ok(c.t, c.pio.writePacket(append([]byte{cmd}, arg...)))
+}
+
+// readResult reads OK, ERR or a resultset and returns first byte of the
+// packet, rows and status flags
+func (c *testClient) readResult() (byte, [][]string, uint16) {
+	payload, err := c.pio.readPacket()
+	testingpkg.Ok(c.t, err)
+	switch payload[0] {
+	case 0x00:
+		pr := &packetReader{payload, 1}
+		pr.readLenEncInt()
+		pr.readLenEncInt()
+		flags, _ := pr.readBytes(2)
+		return 0x00, nil, binary.LittleEndian.Uint16(flags)
+	case 0xff:
+		return 0xff, [][]string{{string(payload[3:9]), string(payload[9:])}}, 0
+	}
+
+	pr := &packetReader{payload, 0}
+	colNum, _ := pr.readLenEncInt()
+	// column definitions and EOF
+	for ii := 0; ii < int(colNum)+1; ii++ {
+		_, err := c.pio.readPacket()
+		testingpkg.Ok(c.t, err)
+	}
+	rows := make([][]string, 0)
+	for {
+		payload, err := c.pio.readPacket()
+		testingpkg.Ok(c.t, err)
+		if payload[0] == 0xfe && len(payload) < 9 {
+			return 0x01, rows, binary.LittleEndian.Uint16(payload[3:])
+		}
+		pr := &packetReader{payload, 0}
+		row := make([]string, 0)
+		for !pr.isEnd() {
+			if pr.data[pr.pos] == 0xfb {
+				pr.pos++
+				row = append(row, "NULL")
+				continue
+			}
+			length, _ := pr.readLenEncInt()
+			data, _ := pr.readBytes(int(length))
+			row = append(row, string(data))
+		}
+		rows = append(rows, row)
+	}
+}
+
+func (c *testClient) query(query string) (byte, [][]string, uint16) {
+	c.command(comQuery, query)
+	return c.readResult()
+}
+
+func TestMySQLServer(t *testing.T) {
+	os.Remove("test.db")
+	os.Remove("test.log")
+	defer os.Remove("test.db")
+	defer os.Remove("test.log")
+
+	db, err := samehada.Open("test.db")
+	testingpkg.Ok(t, err)
+	defer db.Close()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	testingpkg.Ok(t, err)
+	server := NewMySQLServer(db)
+	go server.Serve(listener)
+	defer server.Close()
+
+	c := connectTestClient(t, listener.Addr().String())
+	defer c.conn.Close()
+
+	c.command(comPing, "")
+	kind, _, flags := c.readResult()
+	testingpkg.Equals(t, byte(0x00), kind)
+	testingpkg.Equals(t, uint16(serverStatusAutocommit), flags)
+
+	// variables queried by mysql client on connect
+	kind, rows, _ := c.query("select @@version_comment limit 1")
+	testingpkg.Equals(t, byte(0x01), kind)
+	testingpkg.Equals(t, [][]string{{"SamehadaDB"}}, rows)
+	kind, _, _ = c.query("SET NAMES utf8")
+	testingpkg.Equals(t, byte(0x00), kind)
+	kind, _, _ = c.query("SET autocommit=1")
+	testingpkg.Equals(t, byte(0x00), kind)
+	// mode without autocommit is not supported
+	kind, _, _ = c.query("SET autocommit=0")
+	testingpkg.Equals(t, byte(0xff), kind)
+	kind, _, _ = c.query("SET @@session.autocommit = OFF")
+	testingpkg.Equals(t, byte(0xff), kind)
+
+	kind, _, _ = c.query("CREATE TABLE name_age_list(id INT, name VARCHAR(256), age INT, weight FLOAT);")
+	testingpkg.Equals(t, byte(0x00), kind)
+	kind, _, _ = c.query("INSERT INTO name_age_list(id, name, age, weight) VALUES (1, 'Ryo', 30, 60.5), (2, 'Hanako', 25, NULL);")
+	testingpkg.Equals(t, byte(0x00), kind)
+	kind, rows, _ = c.query("SELECT id, name, weight FROM name_age_list;")
+	testingpkg.Equals(t, byte(0x01), kind)
+	testingpkg.Equals(t, [][]string{{"1", "Ryo", "60.5"}, {"2", "Hanako", "NULL"}}, rows)
+
+	kind, rows, _ = c.query("SELECT * FROM not_exist;")
+	testingpkg.Equals(t, byte(0xff), kind)
+	testingpkg.Equals(t, "#42S02", rows[0][0])
+
+	// multiple statements return multiple results
+	c.command(comQuery, "UPDATE name_age_list SET age = 31 WHERE id = 1; SELECT age FROM name_age_list WHERE id = 1;")
+	kind, _, flags = c.readResult()
+	testingpkg.Equals(t, byte(0x00), kind)
+	testingpkg.SimpleAssert(t, flags&serverStatusMoreResultsExit != 0)
+	kind, rows, flags = c.readResult()
+	testingpkg.Equals(t, byte(0x01), kind)
+	testingpkg.Equals(t, [][]string{{"31"}}, rows)
+	testingpkg.SimpleAssert(t, flags&serverStatusMoreResultsExit == 0)
+
+	// transaction
+	_, _, flags = c.query("START TRANSACTION;")
+	testingpkg.Equals(t, uint16(serverStatusInTrans), flags)
+	c.query("DELETE FROM name_age_list WHERE id = 2;")
+	_, _, flags = c.query("ROLLBACK;")
+	testingpkg.Equals(t, uint16(serverStatusAutocommit), flags)
+	_, rows, _ = c.query("SELECT id FROM name_age_list WHERE id = 2;")
+	testingpkg.Equals(t, 1, len(rows))
+
+	c.command(comQuit, "")
+}
@@ -0,0 +1,284 @@
+package mysql_server
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"strconv"
+
+	"github.com/ryogrid/SamehadaDB/errors"
+	"github.com/ryogrid/SamehadaDB/types"
+)
+
+const ErrMalformedPacket = errors.Error("malformed packet")
+const ErrPacketSequence = errors.Error("packet sequence is out of order")
+
+// max payload length of a packet. longer payload is split to multiple packets
+const maxPacketSize = 1<<24 - 1
+
+// capability flags
+const (
+	clientLongPassword     = 0x00000001
+	clientFoundRows        = 0x00000002
+	clientLongFlag         = 0x00000004
+	clientConnectWithDB    = 0x00000008
+	clientProtocol41       = 0x00000200
+	clientTransactions     = 0x00002000
+	clientSecureConnection = 0x00008000
+	clientMultiStatements  = 0x00010000
+	clientMultiResults     = 0x00020000
+	clientPluginAuth       = 0x00080000
+	clientPluginAuthLenEnc = 0x00200000
+)
+
+const serverCapabilities = clientLongPassword | clientFoundRows | clientLongFlag | clientConnectWithDB |
+	clientProtocol41 | clientTransactions | clientSecureConnection | clientMultiStatements |
+	clientMultiResults | clientPluginAuth | clientPluginAuthLenEnc
+
+// server status flags
+const (
+	serverStatusInTrans         = 0x0001
+	serverStatusAutocommit      = 0x0002
+	serverStatusMoreResultsExit = 0x0008
+)
+
+// commands
+const (
+	comQuit   = 0x01
+	comInitDB = 0x02
+	comQuery  = 0x03
+	comPing   = 0x0e
+)
+
+// column types which types of SamehadaDB are mapped to
+const (
+	mysqlTypeTiny      = 0x01
+	mysqlTypeLong      = 0x03
+	mysqlTypeFloat     = 0x04
+	mysqlTypeVarString = 0xfd
+)
+
+const charsetUTF8 = 33
+const charsetBinary = 63
+
+// packetIO reads and writes packets with sequence id
+type packetIO struct {
+	reader_ io.Reader
+	writer_ io.Writer
+	seq_    uint8
+}
+
+func (pio *packetIO) readPacket() ([]byte, error) {
+	ret := make([]byte, 0)
+	for {
+		header := make([]byte, 4)
+		if _, err := io.ReadFull(pio.reader_, header); err != nil {
+			return nil, err
+		}
+		length := int(uint32(header[0]) | uint32(header[1])<<8 | uint32(header[2])<<16)
+		if header[3] != pio.seq_ {
+			return nil, ErrPacketSequence
+		}
+		pio.seq_++
+		payload := make([]byte, length)
+		if _, err := io.ReadFull(pio.reader_, payload); err != nil {
+			return nil, err
+		}
+		ret = append(ret, payload...)
+		if length < maxPacketSize {
+			return ret, nil
+		}
+	}
+}
+
+func (pio *packetIO) writePacket(payload []byte) error {
+	for {
+		length := len(payload)
+		if length > maxPacketSize {
+			length = maxPacketSize
+		}
+		header := []byte{byte(length), byte(length >> 8), byte(length >> 16), pio.seq_}
+		pio.seq_++
+		if _, err := pio.writer_.Write(header); err != nil {
+			return err
+		}
+		if _, err := pio.writer_.Write(payload[:length]); err != nil {
+			return err
+		}
+		payload = payload[length:]
+		// packet of max size is followed by (possibly empty) packet
+		if length < maxPacketSize {
+			return nil
+		}
+	}
+}
+
+// packetBuilder builds payload of a packet
+type packetBuilder struct {
+	buf bytes.Buffer
+}
+
+func (pb *packetBuilder) writeByte(val byte) {
+	pb.buf.WriteByte(val)
+}
+
+func (pb *packetBuilder) writeUint16(val uint16) {
+	binary.Write(&pb.buf, binary.LittleEndian, val)
+}
+
+func (pb *packetBuilder) writeUint32(val uint32) {
+	binary.Write(&pb.buf, binary.LittleEndian, val)
+}
+
+func (pb *packetBuilder) writeBytes(val []byte) {
+	pb.buf.Write(val)
+}
+
+// writeNullString writes null terminated string
+func (pb *packetBuilder) writeNullString(val string) {
+	pb.buf.WriteString(val)
+	pb.buf.WriteByte(0)
+}
+
+func (pb *packetBuilder) writeLenEncInt(val uint64) {
+	switch {
+	case val < 251:
+		pb.buf.WriteByte(byte(val))
+	case val < 1<<16:
+		pb.buf.WriteByte(0xfc)
+		binary.Write(&pb.buf, binary.LittleEndian, uint16(val))
+	case val < 1<<24:
+		pb.buf.WriteByte(0xfd)
+		pb.buf.Write([]byte{byte(val), byte(val >> 8), byte(val >> 16)})
+	default:
+		pb.buf.WriteByte(0xfe)
+		binary.Write(&pb.buf, binary.LittleEndian, val)
+	}
+}
+
+func (pb *packetBuilder) writeLenEncString(val string) {
+	pb.writeLenEncInt(uint64(len(val)))
+	pb.buf.WriteString(val)
+}
+
+// packetReader reads fields from payload of a packet sent from client
+type packetReader struct {
+	data []byte
+	pos  int
+}
+
+func (pr *packetReader) readByte() (byte, error) {
+	if pr.pos+1 > len(pr.data) {
+		return 0, ErrMalformedPacket
+	}
+	ret := pr.data[pr.pos]
+	pr.pos++
+	return ret, nil
+}
+
+func (pr *packetReader) readUint32() (uint32, error) {
+	if pr.pos+4 > len(pr.data) {
+		return 0, ErrMalformedPacket
+	}
+	ret := binary.LittleEndian.Uint32(pr.data[pr.pos:])
+	pr.pos += 4
+	return ret, nil
+}
+
+func (pr *packetReader) readBytes(n int) ([]byte, error) {
+	if n < 0 || pr.pos+n > len(pr.data) {
+		return nil, ErrMalformedPacket
+	}
+	ret := pr.data[pr.pos : pr.pos+n]
+	pr.pos += n
+	return ret, nil
+}
+
+// readNullString reads null terminated string
+func (pr *packetReader) readNullString() (string, error) {
+	end := bytes.IndexByte(pr.data[pr.pos:], 0)
+	if end < 0 {
+		return "", ErrMalformedPacket
+	}
+	ret := string(pr.data[pr.pos : pr.pos+end])
+	pr.pos += end + 1
+	return ret, nil
+}
+
+func (pr *packetReader) readLenEncInt() (uint64, error) {
+	first, err := pr.readByte()
+	if err != nil {
+		return 0, err
+	}
+	var size int
+	switch first {
+	case 0xfc:
+		size = 2
+	case 0xfd:
+		size = 3
+	case 0xfe:
+		size = 8
+	default:
+		return uint64(first), nil
+	}
+	data, err := pr.readBytes(size)
+	if err != nil {
+		return 0, err
+	}
+	var ret uint64 = 0
+	for ii := size - 1; ii >= 0; ii-- {
+		ret = ret<<8 | uint64(data[ii])
+	}
+	return ret, nil
+}
+
+func (pr *packetReader) isEnd() bool {
+	return pr.pos >= len(pr.data)
+}
+
+func columnType(typeID types.TypeID) byte {
+	switch typeID {
+	case types.Integer:
+		return mysqlTypeLong
+	case types.Float:
+		return mysqlTypeFloat
+	case types.Boolean:
+		return mysqlTypeTiny
+	}
+	return mysqlTypeVarString
+}
+
+// columnLength returns max display length of the type which is sent on column definition
+func columnLength(typeID types.TypeID) uint32 {
+	switch typeID {
+	case types.Integer:
+		return 11
+	case types.Float:
+		return 12
+	case types.Boolean:
+		return 1
+	}
+	return 1024
+}
+
+// encodeValue encodes value to text protocol representation. nil is returned for NULL
+func encodeValue(val *types.Value) []byte {
+	if val.IsNull() {
+		return nil
+	}
+	switch val.ValueType() {
+	case types.Integer:
+		return []byte(strconv.Itoa(int(val.ToInteger())))
+	case types.Float:
+		return []byte(strconv.FormatFloat(float64(val.ToFloat()), 'g', -1, 32))
+	case types.Boolean:
+		// booleans are TINYINT(1) on MySQL
+		if val.ToBoolean() {
+			return []byte("1")
+		}
+		return []byte("0")
+	case types.Varchar:
+		return []byte(val.ToVarchar())
+	}
+	return []byte{}
+}
@@ -0,0 +1,384 @@
+package mysql_server
+
+import (
+	"bufio"
+	"crypto/rand"
+	"net"
+	"strings"
+
+	"github.com/ryogrid/SamehadaDB/parser"
+	"github.com/ryogrid/SamehadaDB/planner"
+	"github.com/ryogrid/SamehadaDB/samehada"
+	"github.com/ryogrid/SamehadaDB/types"
+)
+
+const serverVersion = "5.7.99-SamehadaDB"
+
+type session struct {
+	db_                 *samehada.SamehadaDB
+	conn_               net.Conn
+	writer_             *bufio.Writer
+	pio_                *packetIO
+	session_            *samehada.Session
+	id_                 uint32
+	clientCapabilities_ uint32
+}
+
+func newSession(db *samehada.SamehadaDB, conn net.Conn, id uint32) *session {
+	writer := bufio.NewWriter(conn)
+	return &session{db, conn, writer, &packetIO{bufio.NewReader(conn), writer, 0}, db.NewSession(), id, 0}
+}
+
+func (s *session) run() {
+	defer s.conn_.Close()
+	defer s.session_.Close()
+
+	if err := s.handshake(); err != nil {
+		if err != ErrPacketSequence {
+			s.sendError(err)
+			s.writer_.Flush()
+		}
+		return
+	}
+
+	for {
+		// sequence id is reset on each command
+		s.pio_.seq_ = 0
+		payload, err := s.pio_.readPacket()
+		if err != nil || len(payload) == 0 {
+			return
+		}
+
+		switch payload[0] {
+		case comQuit:
+			return
+		case comPing, comInitDB:
+			// there is only one database
+			err = s.sendOK(0)
+		case comQuery:
+			err = s.handleQuery(string(payload[1:]))
+		default:
+			err = ErrUnsupportedCommand
+		}
+
+		if err != nil {
+			s.sendError(err)
+		}
+		if s.writer_.Flush() != nil {
+			return
+		}
+	}
+}
+
+func (s *session) handshake() error {
+	// scramble is sent because clients require it though password is not checked
+	scramble := make([]byte, 20)
+	rand.Read(scramble)
+	for ii := range scramble {
+		scramble[ii] = scramble[ii]&0x7f | 0x01
+	}
+
+	pb := new(packetBuilder)
+	pb.writeByte(10)
+	pb.writeNullString(serverVersion)
+	pb.writeUint32(s.id_)
+	pb.writeBytes(scramble[:8])
+	pb.writeByte(0)
+	pb.writeUint16(uint16(serverCapabilities & 0xffff))
+	pb.writeByte(charsetUTF8)
+	pb.writeUint16(s.statusFlags())
+	pb.writeUint16(uint16(serverCapabilities >> 16))
+	pb.writeByte(byte(len(scramble) + 1))
+	pb.writeBytes(make([]byte, 10))
+	pb.writeBytes(scramble[8:])
+	pb.writeByte(0)
+	pb.writeNullString("mysql_native_password")
+	if err := s.pio_.writePacket(pb.buf.Bytes()); err != nil {
+		return err
+	}
+	if err := s.writer_.Flush(); err != nil {
+		return err
+	}
+
+	payload, err := s.pio_.readPacket()
+	if err != nil {
+		return err
+	}
+	pr := &packetReader{payload, 0}
+	capabilities, err := pr.readUint32()
+	if err != nil {
+		return err
+	}
+	if capabilities&clientProtocol41 == 0 {
+		return ErrUnsupportedClient
+	}
+	s.clientCapabilities_ = capabilities & serverCapabilities
+	// max packet size, charset and reserved bytes
+	if _, err := pr.readBytes(4 + 1 + 23); err != nil {
+		return err
+	}
+	// user name, auth response and database are ignored
+	if _, err := pr.readNullString(); err != nil {
+		return err
+	}
+
+	if err := s.sendOK(0); err != nil {
+		return err
+	}
+	return s.writer_.Flush()
+}
+
+func (s *session) statusFlags() uint16 {
+	if s.session_.InTransaction() {
+		return serverStatusInTrans
+	}
+	return serverStatusAutocommit
+}
+
+func (s *session) sendOK(affectedRows uint64) error {
+	return s.sendOKWithFlags(affectedRows, s.statusFlags())
+}
+
+func (s *session) sendOKWithFlags(affectedRows uint64, flags uint16) error {
+	pb := new(packetBuilder)
+	pb.writeByte(0x00)
+	pb.writeLenEncInt(affectedRows)
+	// last insert id
+	pb.writeLenEncInt(0)
+	pb.writeUint16(flags)
+	// number of warnings
+	pb.writeUint16(0)
+	return s.pio_.writePacket(pb.buf.Bytes())
+}
+
+func (s *session) sendEOF(flags uint16) error {
+	pb := new(packetBuilder)
+	pb.writeByte(0xfe)
+	pb.writeUint16(0)
+	pb.writeUint16(flags)
+	return s.pio_.writePacket(pb.buf.Bytes())
+}
+
+func (s *session) sendError(err error) error {
+	code, state := errorCode(err)
+	pb := new(packetBuilder)
+	pb.writeByte(0xff)
+	pb.writeUint16(code)
+	pb.writeByte('#')
+	pb.writeBytes([]byte(state))
+	pb.writeBytes([]byte(err.Error()))
+	return s.pio_.writePacket(pb.buf.Bytes())
+}
+
+// errorCode returns MySQL error number and SQLSTATE corresponding to the error
+func errorCode(err error) (uint16, string) {
+	switch err {
+	case planner.ErrTableNotFound:
+		// ER_NO_SUCH_TABLE
+		return 1146, "42S02"
+	case planner.ErrTableAlreadyExists:
+		// ER_TABLE_EXISTS_ERROR
+		return 1050, "42S01"
+	case planner.ErrColumnNotFound:
+		// ER_BAD_FIELD_ERROR
+		return 1054, "42S22"
+	case planner.ErrAmbiguousColumn:
+		// ER_NON_UNIQ_ERROR
+		return 1052, "23000"
+	case planner.ErrNotSupported:
+		// ER_NOT_SUPPORTED_YET
+		return 1235, "42000"
+	case ErrEmptyQuery:
+		// ER_EMPTY_QUERY
+		return 1065, "42000"
+	case ErrUnsupportedCommand, ErrMalformedPacket:
+		// ER_UNKNOWN_COM_ERROR
+		return 1047, "08S01"
+	case ErrUnsupportedClient:
+		// ER_NOT_SUPPORTED_AUTH_MODE
+		return 1251, "08004"
+	case samehada.ErrTxnAborted:
+		// ER_LOCK_DEADLOCK
+		return 1213, "40001"
+	case samehada.ErrInFailedTxn:
+		// ER_XA_RBROLLBACK
+		return 1402, "XA100"
+	}
+	// ER_UNKNOWN_ERROR
+	return 1105, "HY000"
+}
+
+func (s *session) handleQuery(query string) error {
+	stmts, rest := parser.SplitStatements(query)
+	if strings.TrimSpace(rest) != "" {
+		stmts = append(stmts, rest)
+	}
+	if len(stmts) == 0 {
+		return ErrEmptyQuery
+	}
+
+	for ii, stmt := range stmts {
+		result, err := s.execute(stmt)
+		if err != nil {
+			// rest of statements are not executed
+			return err
+		}
+		flags := s.statusFlags()
+		if ii < len(stmts)-1 {
+			flags |= serverStatusMoreResultsExit
+		}
+		if result == nil {
+			err = s.sendOKWithFlags(0, flags)
+		} else if result.QueryType == parser.SELECT {
+			err = s.sendResultSet(result, flags)
+		} else {
+			err = s.sendOKWithFlags(uint64(result.RowsAffected), flags)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *session) execute(stmt string) (*samehada.Result, error) {
+	trimmed := strings.ToUpper(strings.TrimSpace(stmt))
+	// clients set and read session variables on connect. setting is ignored
+	// (nil result is returned) and reading returns fixed values.
+	// disabling autocommit is refused because it changes meaning of following statements
+	if strings.HasPrefix(trimmed, "SET ") {
+		if disablesAutocommit(trimmed) {
+			return nil, planner.ErrNotSupported
+		}
+		return nil, nil
+	}
+	if strings.HasPrefix(trimmed, "SELECT @@") {
+		return selectVariables(stmt), nil
+	}
+	return s.session_.ExecuteSQL(stmt)
+}
+
+// disablesAutocommit returns true when the SET statement (in upper case) sets autocommit to off.
+// transaction must be started with BEGIN explicitly instead
+func disablesAutocommit(stmt string) bool {
+	assignments := strings.TrimSuffix(strings.TrimPrefix(stmt, "SET "), ";")
+	for _, assignment := range strings.Split(assignments, ",") {
+		nameAndValue := strings.SplitN(assignment, "=", 2)
+		if len(nameAndValue) != 2 {
+			continue
+		}
+		name := strings.TrimSpace(nameAndValue[0])
+		name = strings.TrimPrefix(strings.TrimPrefix(name, "SESSION "), "GLOBAL ")
+		name = strings.TrimPrefix(strings.TrimSpace(name), "@@")
+		name = strings.TrimPrefix(strings.TrimPrefix(name, "SESSION."), "GLOBAL.")
+		value := strings.Trim(strings.TrimSpace(nameAndValue[1]), "'\"")
+		if name == "AUTOCOMMIT" && (value == "0" || value == "OFF" || value == "FALSE") {
+			return true
+		}
+	}
+	return false
+}
+
+// selectVariables returns result of "SELECT @@name[, @@name...] [LIMIT n]"
+func selectVariables(stmt string) *samehada.Result {
+	items := strings.TrimSpace(stmt)
+	items = strings.TrimSuffix(items, ";")
+	items = items[len("SELECT"):]
+	if idx := strings.Index(strings.ToUpper(items), " LIMIT "); idx >= 0 {
+		items = items[:idx]
+	}
+
+	result := &samehada.Result{QueryType: parser.SELECT}
+	row := make([]types.Value, 0)
+	for _, item := range strings.Split(items, ",") {
+		item = strings.TrimSpace(item)
+		name := strings.ToLower(strings.TrimPrefix(item, "@@"))
+		name = strings.TrimPrefix(strings.TrimPrefix(name, "session."), "global.")
+
+		result.ColumnNames = append(result.ColumnNames, item)
+		result.ColumnTypes = append(result.ColumnTypes, types.Varchar)
+		if val, ok := systemVariables[name]; ok {
+			row = append(row, types.NewVarchar(val))
+		} else {
+			row = append(row, *types.NewVarchar("").SetNull())
+		}
+	}
+	result.Rows = [][]types.Value{row}
+	return result
+}
+
+var systemVariables = map[string]string{
+	"version":                  serverVersion,
+	"version_comment":          "SamehadaDB",
+	"max_allowed_packet":       "67108864",
+	"autocommit":               "1",
+	"tx_isolation":             "REPEATABLE-READ",
+	"transaction_isolation":    "REPEATABLE-READ",
+	"character_set_client":     "utf8",
+	"character_set_connection": "utf8",
+	"character_set_results":    "utf8",
+	"collation_connection":     "utf8_general_ci",
+	"sql_mode":                 "",
+	"time_zone":                "SYSTEM",
+	"lower_case_table_names":   "0",
+}
+
+func (s *session) sendResultSet(result *samehada.Result, flags uint16) error {
+	pb := new(packetBuilder)
+	pb.writeLenEncInt(uint64(len(result.ColumnNames)))
+	if err := s.pio_.writePacket(pb.buf.Bytes()); err != nil {
+		return err
+	}
+
+	for ii, name := range result.ColumnNames {
+		pb := new(packetBuilder)
+		// catalog, schema, table, org_table, name, org_name
+		pb.writeLenEncString("def")
+		pb.writeLenEncString("")
+		pb.writeLenEncString("")
+		pb.writeLenEncString("")
+		pb.writeLenEncString(name)
+		pb.writeLenEncString(name)
+		// length of fixed length fields
+		pb.writeLenEncInt(0x0c)
+		typeID := result.ColumnTypes[ii]
+		if typeID == types.Varchar {
+			pb.writeUint16(charsetUTF8)
+		} else {
+			pb.writeUint16(charsetBinary)
+		}
+		pb.writeUint32(columnLength(typeID))
+		pb.writeByte(columnType(typeID))
+		// flags, decimals and filler
+		pb.writeUint16(0)
+		if typeID == types.Float {
+			pb.writeByte(31)
+		} else {
+			pb.writeByte(0)
+		}
+		pb.writeUint16(0)
+		if err := s.pio_.writePacket(pb.buf.Bytes()); err != nil {
+			return err
+		}
+	}
+	if err := s.sendEOF(flags &^ serverStatusMoreResultsExit); err != nil {
+		return err
+	}
+
+	for _, row := range result.Rows {
+		pb := new(packetBuilder)
+		for ii := range row {
+			data := encodeValue(&row[ii])
+			if data == nil {
+				pb.writeByte(0xfb)
+				continue
+			}
+			pb.writeLenEncInt(uint64(len(data)))
+			pb.writeBytes(data)
+		}
+		if err := s.pio_.writePacket(pb.buf.Bytes()); err != nil {
+			return err
+		}
+	}
+	return s.sendEOF(flags)
+}
@@ -0,0 +1,296 @@
+package pg_server
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"math"
+	"strconv"
+
+	"github.com/ryogrid/SamehadaDB/errors"
+	"github.com/ryogrid/SamehadaDB/types"
+)
+
+const ErrMalformedMessage = errors.Error("malformed message")
+
+// messages longer than this are rejected without allocating buffer for them
+const maxMessageLength = 16 * 1024 * 1024
+
+// codes of startup packet
+const (
+	protocolVersion3  = 196608
+	sslRequestCode    = 80877103
+	cancelRequestCode = 80877102
+)
+
+// OIDs of PostgreSQL types which types of SamehadaDB are mapped to
+const (
+	oidBool    = 16
+	oidInt8    = 20
+	oidInt2    = 21
+	oidInt4    = 23
+	oidText    = 25
+	oidFloat4  = 700
+	oidFloat8  = 701
+	oidUnknown = 705
+	oidVarchar = 1043
+)
+
+const (
+	formatText   = 0
+	formatBinary = 1
+)
+
+// messageBuilder builds payload of a backend message
+type messageBuilder struct {
+	buf bytes.Buffer
+}
+
+func (mb *messageBuilder) writeByte(val byte) {
+	mb.buf.WriteByte(val)
+}
+
+func (mb *messageBuilder) writeInt16(val int16) {
+	binary.Write(&mb.buf, binary.BigEndian, val)
+}
+
+func (mb *messageBuilder) writeInt32(val int32) {
+	binary.Write(&mb.buf, binary.BigEndian, val)
+}
+
+func (mb *messageBuilder) writeBytes(val []byte) {
+	mb.buf.Write(val)
+}
+
+// writeString writes null terminated string
+func (mb *messageBuilder) writeString(val string) {
+	mb.buf.WriteString(val)
+	mb.buf.WriteByte(0)
+}
+
+// messageReader reads fields from payload of a frontend message
+type messageReader struct {
+	data []byte
+	pos  int
+}
+
+func (mr *messageReader) readByte() (byte, error) {
+	if mr.pos+1 > len(mr.data) {
+		return 0, ErrMalformedMessage
+	}
+	ret := mr.data[mr.pos]
+	mr.pos++
+	return ret, nil
+}
+
+func (mr *messageReader) readInt16() (int16, error) {
+	if mr.pos+2 > len(mr.data) {
+		return 0, ErrMalformedMessage
+	}
+	ret := int16(binary.BigEndian.Uint16(mr.data[mr.pos:]))
+	mr.pos += 2
+	return ret, nil
+}
+
+func (mr *messageReader) readInt32() (int32, error) {
+	if mr.pos+4 > len(mr.data) {
+		return 0, ErrMalformedMessage
+	}
+	ret := int32(binary.BigEndian.Uint32(mr.data[mr.pos:]))
+	mr.pos += 4
+	return ret, nil
+}
+
+func (mr *messageReader) readBytes(n int) ([]byte, error) {
+	if n < 0 || mr.pos+n > len(mr.data) {
+		return nil, ErrMalformedMessage
+	}
+	ret := mr.data[mr.pos : mr.pos+n]
+	mr.pos += n
+	return ret, nil
+}
+
+// readString reads null terminated string
+func (mr *messageReader) readString() (string, error) {
+	end := bytes.IndexByte(mr.data[mr.pos:], 0)
+	if end < 0 {
+		return "", ErrMalformedMessage
+	}
+	ret := string(mr.data[mr.pos : mr.pos+end])
+	mr.pos += end + 1
+	return ret, nil
+}
+
+// readMessage reads a typed message sent from frontend
+func readMessage(r io.Reader) (byte, []byte, error) {
+	header := make([]byte, 5)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return 0, nil, err
+	}
+	length := int32(binary.BigEndian.Uint32(header[1:]))
+	if length < 4 || length > maxMessageLength {
+		return 0, nil, ErrMalformedMessage
+	}
+	payload := make([]byte, length-4)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return 0, nil, err
+	}
+	return header[0], payload, nil
+}
+
+// readStartupMessage reads startup packet which has no type byte
+func readStartupMessage(r io.Reader) ([]byte, error) {
+	header := make([]byte, 4)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, err
+	}
+	length := int32(binary.BigEndian.Uint32(header))
+	if length < 8 || length > 10000 {
+		return nil, ErrMalformedMessage
+	}
+	payload := make([]byte, length-4)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return nil, err
+	}
+	return payload, nil
+}
+
+func writeMessage(w io.Writer, msgType byte, mb *messageBuilder) error {
+	header := make([]byte, 5)
+	header[0] = msgType
+	binary.BigEndian.PutUint32(header[1:], uint32(mb.buf.Len()+4))
+	if _, err := w.Write(header); err != nil {
+		return err
+	}
+	_, err := w.Write(mb.buf.Bytes())
+	return err
+}
+
+func typeOID(typeID types.TypeID) int32 {
+	switch typeID {
+	case types.Integer:
+		return oidInt4
+	case types.Float:
+		return oidFloat4
+	case types.Boolean:
+		return oidBool
+	case types.Varchar:
+		return oidVarchar
+	}
+	return oidUnknown
+}
+
+// typeSize returns size of the type which is sent on RowDescription. variable length is -1
+func typeSize(typeID types.TypeID) int16 {
+	switch typeID {
+	case types.Integer, types.Float:
+		return 4
+	case types.Boolean:
+		return 1
+	}
+	return -1
+}
+
+// encodeValue encodes value to field data of DataRow. nil is returned for NULL
+func encodeValue(val *types.Value, format int16) []byte {
+	if val.IsNull() {
+		return nil
+	}
+	if format == formatBinary {
+		buf := new(bytes.Buffer)
+		switch val.ValueType() {
+		case types.Integer:
+			binary.Write(buf, binary.BigEndian, val.ToInteger())
+		case types.Float:
+			binary.Write(buf, binary.BigEndian, math.Float32bits(val.ToFloat()))
+		case types.Boolean:
+			if val.ToBoolean() {
+				buf.WriteByte(1)
+			} else {
+				buf.WriteByte(0)
+			}
+		case types.Varchar:
+			buf.WriteString(val.ToVarchar())
+		}
+		return buf.Bytes()
+	}
+
+	switch val.ValueType() {
+	case types.Integer:
+		return []byte(strconv.Itoa(int(val.ToInteger())))
+	case types.Float:
+		return []byte(strconv.FormatFloat(float64(val.ToFloat()), 'g', -1, 32))
+	case types.Boolean:
+		if val.ToBoolean() {
+			return []byte("t")
+		}
+		return []byte("f")
+	case types.Varchar:
+		return []byte(val.ToVarchar())
+	}
+	return []byte{}
+}
+
+// paramToLiteral converts value of bound parameter to SQL literal.
+// text format values are passed as string literal and converted to type of
+// the column at planning
+func paramToLiteral(data []byte, oid int32, format int16) (string, error) {
+	if data == nil {
+		return "NULL", nil
+	}
+	if format == formatText {
+		return quoteString(string(data)), nil
+	}
+
+	switch oid {
+	case oidInt2:
+		if len(data) != 2 {
+			return "", ErrMalformedMessage
+		}
+		return strconv.Itoa(int(int16(binary.BigEndian.Uint16(data)))), nil
+	case oidInt4:
+		if len(data) != 4 {
+			return "", ErrMalformedMessage
+		}
+		return strconv.Itoa(int(int32(binary.BigEndian.Uint32(data)))), nil
+	case oidInt8:
+		if len(data) != 8 {
+			return "", ErrMalformedMessage
+		}
+		return strconv.FormatInt(int64(binary.BigEndian.Uint64(data)), 10), nil
+	case oidFloat4:
+		if len(data) != 4 {
+			return "", ErrMalformedMessage
+		}
+		return quoteString(strconv.FormatFloat(float64(math.Float32frombits(binary.BigEndian.Uint32(data))), 'g', -1, 32)), nil
+	case oidFloat8:
+		if len(data) != 8 {
+			return "", ErrMalformedMessage
+		}
+		return quoteString(strconv.FormatFloat(math.Float64frombits(binary.BigEndian.Uint64(data)), 'g', -1, 64)), nil
+	case oidBool:
+		if len(data) != 1 {
+			return "", ErrMalformedMessage
+		}
+		if data[0] != 0 {
+			return "TRUE", nil
+		}
+		return "FALSE", nil
+	case oidText, oidVarchar, oidUnknown:
+		return quoteString(string(data)), nil
+	}
+	return "", ErrUnsupportedParamType
+}
+
+func quoteString(val string) string {
+	ret := make([]byte, 0, len(val)+2)
+	ret = append(ret, '\'')
+	for ii := 0; ii < len(val); ii++ {
+		// parser treats backslash as escape character
+		if val[ii] == '\'' || val[ii] == '\\' {
+			ret = append(ret, val[ii])
+		}
+		ret = append(ret, val[ii])
+	}
+	return string(append(ret, '\''))
+}
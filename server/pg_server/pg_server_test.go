@@ -0,0 +1,273 @@
+package pg_server
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"net"
+	"os"
+	"testing"
+
+	"github.com/ryogrid/SamehadaDB/samehada"
+	testingpkg "github.com/ryogrid/SamehadaDB/testing"
+)
+
+// testClient is a minimal frontend of PostgreSQL protocol
+type testClient struct {
+	t      *testing.T
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+type testMessage struct {
+	msgType byte
+	payload []byte
+}
+
+func connectTestClient(t *testing.T, addr string) *testClient {
+	conn, err := net.Dial("tcp", addr)
+	testingpkg.Ok(t, err)
+	c := &testClient{t, conn, bufio.NewReader(conn)}
+
+	// SSL is requested and refused first as psql does
+	mb := new(messageBuilder)
+	mb.writeInt32(8)
+	mb.writeInt32(sslRequestCode)
+	_, err = conn.Write(mb.buf.Bytes())
+	testingpkg.Ok(t, err)
+	answer, err := c.reader.ReadByte()
+	testingpkg.Ok(t, err)
+	testingpkg.Equals(t, byte('N'), answer)
+
+	mb = new(messageBuilder)
+	mb.writeInt32(protocolVersion3)
+	mb.writeString("user")
+	mb.writeString("samehada")
+	mb.writeByte(0)
+	length := make([]byte, 4)
+	binary.BigEndian.PutUint32(length, uint32(mb.buf.Len()+4))
+	_, err = conn.Write(append(length, mb.buf.Bytes()...))
+	testingpkg.Ok(t, err)
+
+	msgs := c.receiveTillReady()
+	testingpkg.Equals(t, byte('R'), msgs[0].msgType)
+	testingpkg.Equals(t, byte('I'), msgs[len(msgs)-1].payload[0])
+	return c
+}
+
+func (c *testClient) send(msgType byte, mb *messageBuilder) {
+	testingpkg.Ok(c.t, writeMessage(c.conn, msgType, mb))
+}
+
+func (c *testClient) receiveTillReady() []testMessage {
+	ret := make([]testMessage, 0)
+	for {
+		msgType, payload, err := readMessage(c.reader)
+		testingpkg.Ok(c.t, err)
+		ret = append(ret, testMessage{msgType, payload})
+		if msgType == 'Z' {
+			return ret
+		}
+	}
+}
+
+// msgTypes returns types of messages and status of ReadyForQuery
+func msgTypes(msgs []testMessage) string {
+	ret := make([]byte, 0)
+	for _, msg := range msgs {
+		ret = append(ret, msg.msgType)
+	}
+	return string(ret) + string(msgs[len(msgs)-1].payload[0])
+}
+
+func (c *testClient) simpleQuery(query string) []testMessage {
+	mb := new(messageBuilder)
+	mb.writeString(query)
+	c.send('Q', mb)
+	return c.receiveTillReady()
+}
+
+// dataRow returns fields of DataRow message
+func dataRow(msg testMessage) []string {
+	mr := &messageReader{msg.payload, 0}
+	num, _ := mr.readInt16()
+	ret := make([]string, num)
+	for ii := range ret {
+		length, _ := mr.readInt32()
+		if length < 0 {
+			ret[ii] = "NULL"
+			continue
+		}
+		data, _ := mr.readBytes(int(length))
+		ret[ii] = string(data)
+	}
+	return ret
+}
+
+// errorCode returns SQLSTATE code of ErrorResponse message
+func errorCode(msg testMessage) string {
+	mr := &messageReader{msg.payload, 0}
+	for {
+		field, _ := mr.readByte()
+		if field == 0 {
+			return ""
+		}
+		val, _ := mr.readString()
+		if field == 'C' {
+			return val
+		}
+	}
+}
+
+func TestPgServer(t *testing.T) {
+	os.Remove("test.db")
+	os.Remove("test.log")
+	defer os.Remove("test.db")
+	defer os.Remove("test.log")
+
+	db, err := samehada.Open("test.db")
+	testingpkg.Ok(t, err)
+	defer db.Close()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	testingpkg.Ok(t, err)
+	server := NewPgServer(db)
+	go server.Serve(listener)
+	defer server.Close()
+
+	c := connectTestClient(t, listener.Addr().String())
+	defer c.conn.Close()
+
+	// simple query
+	msgs := c.simpleQuery("CREATE TABLE name_age_list(id INT, name VARCHAR(256), age INT);")
+	testingpkg.Equals(t, "CZI", msgTypes(msgs))
+	msgs = c.simpleQuery("INSERT INTO name_age_list(id, name, age) VALUES (1, 'Ryo', 30), (2, 'Hanako', 25); INSERT INTO name_age_list(id, name, age) VALUES (3, 'it''s', 20)")
+	testingpkg.Equals(t, "CCZI", msgTypes(msgs))
+	testingpkg.Equals(t, "INSERT 0 2\x00", string(msgs[0].payload))
+
+	msgs = c.simpleQuery("SELECT name, age FROM name_age_list WHERE age >= 25;")
+	testingpkg.Equals(t, "TDDCZI", msgTypes(msgs))
+	testingpkg.Equals(t, []string{"Ryo", "30"}, dataRow(msgs[1]))
+	testingpkg.Equals(t, []string{"Hanako", "25"}, dataRow(msgs[2]))
+	testingpkg.Equals(t, "SELECT 2\x00", string(msgs[3].payload))
+
+	msgs = c.simpleQuery("SELECT * FROM not_exist;")
+	testingpkg.Equals(t, "EZI", msgTypes(msgs))
+	testingpkg.Equals(t, "42P01", errorCode(msgs[0]))
+	msgs = c.simpleQuery("")
+	testingpkg.Equals(t, "IZI", msgTypes(msgs))
+
+	// transaction block
+	msgs = c.simpleQuery("BEGIN;")
+	testingpkg.Equals(t, "CZT", msgTypes(msgs))
+	msgs = c.simpleQuery("DELETE FROM name_age_list WHERE id = 1;")
+	testingpkg.Equals(t, "CZT", msgTypes(msgs))
+	msgs = c.simpleQuery("SELECT * FROM not_exist;")
+	testingpkg.Equals(t, "EZE", msgTypes(msgs))
+	msgs = c.simpleQuery("SELECT * FROM name_age_list;")
+	testingpkg.Equals(t, "EZE", msgTypes(msgs))
+	testingpkg.Equals(t, "25P02", errorCode(msgs[0]))
+	msgs = c.simpleQuery("COMMIT;")
+	testingpkg.Equals(t, "CZI", msgTypes(msgs))
+	testingpkg.Equals(t, "ROLLBACK\x00", string(msgs[0].payload))
+	msgs = c.simpleQuery("SELECT id FROM name_age_list WHERE id = 1;")
+	testingpkg.Equals(t, "TDCZI", msgTypes(msgs))
+
+	// extended query. types of parameters are inferred from columns
+	mb := new(messageBuilder)
+	mb.writeString("s1")
+	mb.writeString("SELECT id, name FROM name_age_list WHERE age = $1 OR name = $2;")
+	mb.writeInt16(0)
+	c.send('P', mb)
+	mb = new(messageBuilder)
+	mb.writeByte('S')
+	mb.writeString("s1")
+	c.send('D', mb)
+	mb = new(messageBuilder)
+	mb.writeString("")
+	mb.writeString("s1")
+	// first parameter is binary and second is text
+	mb.writeInt16(2)
+	mb.writeInt16(formatBinary)
+	mb.writeInt16(formatText)
+	mb.writeInt16(2)
+	mb.writeInt32(4)
+	mb.writeInt32(25)
+	mb.writeInt32(4)
+	mb.writeBytes([]byte("it's"))
+	// results are binary
+	mb.writeInt16(1)
+	mb.writeInt16(formatBinary)
+	c.send('B', mb)
+	mb = new(messageBuilder)
+	mb.writeString("")
+	mb.writeInt32(0)
+	c.send('E', mb)
+	c.send('S', new(messageBuilder))
+
+	msgs = c.receiveTillReady()
+	testingpkg.Equals(t, "1tT2DDCZI", msgTypes(msgs))
+	paramDesc := &messageReader{msgs[1].payload, 0}
+	paramNum, _ := paramDesc.readInt16()
+	testingpkg.Equals(t, int16(2), paramNum)
+	oid1, _ := paramDesc.readInt32()
+	oid2, _ := paramDesc.readInt32()
+	testingpkg.Equals(t, int32(oidInt4), oid1)
+	testingpkg.Equals(t, int32(oidVarchar), oid2)
+	testingpkg.Equals(t, []string{"\x00\x00\x00\x02", "Hanako"}, dataRow(msgs[4]))
+	testingpkg.Equals(t, []string{"\x00\x00\x00\x03", "it's"}, dataRow(msgs[5]))
+
+	// errors on extended query are reported once and rest messages are skipped till Sync
+	mb = new(messageBuilder)
+	mb.writeString("")
+	mb.writeString("not_exist")
+	mb.writeInt16(0)
+	mb.writeInt16(0)
+	mb.writeInt16(0)
+	c.send('B', mb)
+	mb = new(messageBuilder)
+	mb.writeString("")
+	mb.writeInt32(0)
+	c.send('E', mb)
+	c.send('S', new(messageBuilder))
+	msgs = c.receiveTillReady()
+	testingpkg.Equals(t, "EZI", msgTypes(msgs))
+	testingpkg.Equals(t, "26000", errorCode(msgs[0]))
+}
+
+func TestPgServerClose(t *testing.T) {
+	os.Remove("test.db")
+	os.Remove("test.log")
+	defer os.Remove("test.db")
+	defer os.Remove("test.log")
+
+	db, err := samehada.Open("test.db")
+	testingpkg.Ok(t, err)
+	defer db.Close()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	testingpkg.Ok(t, err)
+	server := NewPgServer(db)
+	go server.Serve(listener)
+
+	c := connectTestClient(t, listener.Addr().String())
+	defer c.conn.Close()
+	msgs := c.simpleQuery("CREATE TABLE t(id INT);")
+	testingpkg.Equals(t, "CZI", msgTypes(msgs))
+	msgs = c.simpleQuery("BEGIN; INSERT INTO t VALUES (1);")
+	testingpkg.Equals(t, "CCZT", msgTypes(msgs))
+
+	// transaction of the session is aborted before Close returns
+	testingpkg.Ok(t, server.Close())
+	testingpkg.Equals(t, 0, len(server.sessions_))
+	result, err := db.ExecuteSQL("SELECT id FROM t;")
+	testingpkg.Ok(t, err)
+	testingpkg.Equals(t, 0, len(result.Rows))
+
+	// too long message is rejected without reading its payload
+	mb := new(messageBuilder)
+	mb.writeByte('Q')
+	mb.writeInt32(maxMessageLength + 1)
+	_, _, err = readMessage(bytes.NewReader(mb.buf.Bytes()))
+	testingpkg.Equals(t, ErrMalformedMessage, err)
+}
@@ -0,0 +1,626 @@
+package pg_server
+
+import (
+	"bufio"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/ryogrid/SamehadaDB/parser"
+	"github.com/ryogrid/SamehadaDB/planner"
+	"github.com/ryogrid/SamehadaDB/samehada"
+	"github.com/ryogrid/SamehadaDB/types"
+)
+
+// preparedStatement is a statement created by Parse message
+type preparedStatement struct {
+	query_     string
+	paramOIDs_ []int32
+}
+
+// portal is a statement whose parameters are bound by Bind message
+type portal struct {
+	query_         string
+	resultFormats_ []int16
+	// result is kept when Describe message executes the portal before Execute message
+	result_ *samehada.Result
+}
+
+type session struct {
+	db_      *samehada.SamehadaDB
+	conn_    net.Conn
+	reader_  *bufio.Reader
+	writer_  *bufio.Writer
+	session_ *samehada.Session
+	id_      int32
+	stmts_   map[string]*preparedStatement
+	portals_ map[string]*portal
+	// on extended query protocol, messages are skipped until Sync after an error
+	skipTillSync_ bool
+}
+
+func newSession(db *samehada.SamehadaDB, conn net.Conn, id int32) *session {
+	return &session{db, conn, bufio.NewReader(conn), bufio.NewWriter(conn), db.NewSession(), id,
+		make(map[string]*preparedStatement), make(map[string]*portal), false}
+}
+
+func (s *session) run() {
+	defer s.conn_.Close()
+	defer s.session_.Close()
+
+	if err := s.startup(); err != nil {
+		return
+	}
+
+	for {
+		msgType, payload, err := readMessage(s.reader_)
+		if err != nil {
+			return
+		}
+		if s.skipTillSync_ && msgType != 'S' && msgType != 'X' {
+			continue
+		}
+
+		mr := &messageReader{payload, 0}
+		switch msgType {
+		case 'Q':
+			err = s.handleSimpleQuery(mr)
+		case 'P':
+			err = s.handleParse(mr)
+		case 'B':
+			err = s.handleBind(mr)
+		case 'D':
+			err = s.handleDescribe(mr)
+		case 'E':
+			err = s.handleExecute(mr)
+		case 'C':
+			err = s.handleClose(mr)
+		case 'S':
+			s.skipTillSync_ = false
+			err = s.sendReadyForQuery()
+		case 'H':
+			// all messages are flushed below
+		case 'X':
+			return
+		default:
+			err = ErrUnsupportedMessage
+		}
+
+		if err != nil {
+			s.sendError(err)
+			if msgType == 'Q' {
+				s.sendReadyForQuery()
+			} else {
+				s.skipTillSync_ = true
+			}
+		}
+		if s.writer_.Flush() != nil {
+			return
+		}
+	}
+}
+
+func (s *session) startup() error {
+	for {
+		payload, err := readStartupMessage(s.reader_)
+		if err != nil {
+			return err
+		}
+		mr := &messageReader{payload, 0}
+		code, _ := mr.readInt32()
+		switch code {
+		case sslRequestCode:
+			// SSL is not supported
+			if _, err := s.conn_.Write([]byte{'N'}); err != nil {
+				return err
+			}
+			continue
+		case protocolVersion3:
+		default:
+			// cancel request and older protocols are not supported
+			return ErrUnsupportedMessage
+		}
+		// parameters (user, database...) are ignored
+		break
+	}
+
+	writeMessage(s.writer_, 'R', s.newAuthenticationOk())
+	for _, param := range [][]string{
+		{"server_version", "9.6.0"},
+		{"server_encoding", "UTF8"},
+		{"client_encoding", "UTF8"},
+		{"DateStyle", "ISO, MDY"},
+		{"integer_datetimes", "on"},
+		{"standard_conforming_strings", "on"},
+	} {
+		mb := new(messageBuilder)
+		mb.writeString(param[0])
+		mb.writeString(param[1])
+		writeMessage(s.writer_, 'S', mb)
+	}
+	mb := new(messageBuilder)
+	mb.writeInt32(s.id_)
+	mb.writeInt32(0)
+	writeMessage(s.writer_, 'K', mb)
+	s.sendReadyForQuery()
+	return s.writer_.Flush()
+}
+
+func (s *session) newAuthenticationOk() *messageBuilder {
+	mb := new(messageBuilder)
+	mb.writeInt32(0)
+	return mb
+}
+
+func (s *session) sendReadyForQuery() error {
+	mb := new(messageBuilder)
+	switch {
+	case s.session_.IsFailed():
+		mb.writeByte('E')
+	case s.session_.InTransaction():
+		mb.writeByte('T')
+	default:
+		mb.writeByte('I')
+	}
+	return writeMessage(s.writer_, 'Z', mb)
+}
+
+func (s *session) sendError(err error) error {
+	mb := new(messageBuilder)
+	mb.writeByte('S')
+	mb.writeString("ERROR")
+	mb.writeByte('V')
+	mb.writeString("ERROR")
+	mb.writeByte('C')
+	mb.writeString(sqlState(err))
+	mb.writeByte('M')
+	mb.writeString(err.Error())
+	mb.writeByte(0)
+	return writeMessage(s.writer_, 'E', mb)
+}
+
+// sqlState returns SQLSTATE error code corresponding to the error
+func sqlState(err error) string {
+	switch err {
+	case planner.ErrTableNotFound:
+		return "42P01"
+	case planner.ErrTableAlreadyExists:
+		return "42P07"
+	case planner.ErrColumnNotFound:
+		return "42703"
+	case planner.ErrAmbiguousColumn:
+		return "42702"
+	case planner.ErrTypeMismatch:
+		return "42804"
+	case planner.ErrNotSupported, ErrUnsupportedMessage, ErrUnsupportedParamType:
+		return "0A000"
+	case ErrStatementNotFound:
+		return "26000"
+	case ErrPortalNotFound:
+		return "34000"
+	case ErrMalformedMessage:
+		return "08P01"
+	case samehada.ErrTxnAborted:
+		return "40001"
+	case samehada.ErrInFailedTxn:
+		return "25P02"
+	}
+	return "42000"
+}
+
+func (s *session) handleSimpleQuery(mr *messageReader) error {
+	query, err := mr.readString()
+	if err != nil {
+		return err
+	}
+
+	stmts, rest := parser.SplitStatements(query)
+	if strings.TrimSpace(rest) != "" {
+		stmts = append(stmts, rest)
+	}
+	if len(stmts) == 0 {
+		writeMessage(s.writer_, 'I', new(messageBuilder))
+		return s.sendReadyForQuery()
+	}
+
+	for _, stmt := range stmts {
+		result, err := s.session_.ExecuteSQL(stmt)
+		if err != nil {
+			// rest of statements are not executed
+			return err
+		}
+		if result.QueryType == parser.SELECT {
+			s.sendRowDescription(result.ColumnNames, result.ColumnTypes, nil)
+			s.sendDataRows(result, nil)
+		}
+		s.sendCommandComplete(result)
+	}
+	return s.sendReadyForQuery()
+}
+
+func (s *session) sendRowDescription(colNames []string, colTypes []types.TypeID, formats []int16) error {
+	mb := new(messageBuilder)
+	mb.writeInt16(int16(len(colNames)))
+	for ii, name := range colNames {
+		mb.writeString(name)
+		// table OID and column attribute number
+		mb.writeInt32(0)
+		mb.writeInt16(0)
+		mb.writeInt32(typeOID(colTypes[ii]))
+		mb.writeInt16(typeSize(colTypes[ii]))
+		// type modifier
+		mb.writeInt32(-1)
+		mb.writeInt16(formatAt(formats, ii))
+	}
+	return writeMessage(s.writer_, 'T', mb)
+}
+
+func (s *session) sendDataRows(result *samehada.Result, formats []int16) error {
+	for _, row := range result.Rows {
+		mb := new(messageBuilder)
+		mb.writeInt16(int16(len(row)))
+		for ii := range row {
+			data := encodeValue(&row[ii], formatAt(formats, ii))
+			if data == nil {
+				mb.writeInt32(-1)
+				continue
+			}
+			mb.writeInt32(int32(len(data)))
+			mb.writeBytes(data)
+		}
+		if err := writeMessage(s.writer_, 'D', mb); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *session) sendCommandComplete(result *samehada.Result) error {
+	mb := new(messageBuilder)
+	mb.writeString(commandTag(result))
+	return writeMessage(s.writer_, 'C', mb)
+}
+
+func commandTag(result *samehada.Result) string {
+	switch result.QueryType {
+	case parser.SELECT:
+		return "SELECT " + strconv.Itoa(len(result.Rows))
+	case parser.INSERT:
+		return "INSERT 0 " + strconv.FormatInt(result.RowsAffected, 10)
+	case parser.UPDATE:
+		return "UPDATE " + strconv.FormatInt(result.RowsAffected, 10)
+	case parser.DELETE:
+		return "DELETE " + strconv.FormatInt(result.RowsAffected, 10)
+	case parser.CREATE_TABLE:
+		return "CREATE TABLE"
+	case parser.DROP_TABLE:
+		return "DROP TABLE"
+	case parser.ALTER_TABLE:
+		return "ALTER TABLE"
+	case parser.CREATE_INDEX:
+		return "CREATE INDEX"
+	case parser.DROP_INDEX:
+		return "DROP INDEX"
+	case parser.BEGIN:
+		return "BEGIN"
+	case parser.COMMIT:
+		return "COMMIT"
+	case parser.ROLLBACK:
+		return "ROLLBACK"
+	}
+	return ""
+}
+
+// formatAt returns format code of idx-th item. format codes are specified for
+// each item, or one code is specified for all items, or not specified (text)
+func formatAt(formats []int16, idx int) int16 {
+	switch len(formats) {
+	case 0:
+		return formatText
+	case 1:
+		return formats[0]
+	}
+	if idx < len(formats) {
+		return formats[idx]
+	}
+	return formatText
+}
+
+func (s *session) handleParse(mr *messageReader) error {
+	name, err := mr.readString()
+	if err != nil {
+		return err
+	}
+	query, err := mr.readString()
+	if err != nil {
+		return err
+	}
+	paramNum, err := mr.readInt16()
+	if err != nil {
+		return err
+	}
+	paramOIDs := make([]int32, countParams(query))
+	for ii := 0; ii < int(paramNum); ii++ {
+		oid, err := mr.readInt32()
+		if err != nil {
+			return err
+		}
+		if ii < len(paramOIDs) {
+			paramOIDs[ii] = oid
+		}
+	}
+
+	// types of parameters which are not specified by client are decided with
+	// columns which the parameters are stored to or compared with
+	inferred := s.inferParamTypes(query)
+	for ii := range paramOIDs {
+		if paramOIDs[ii] == 0 {
+			if typeID, ok := inferred[ii]; ok {
+				paramOIDs[ii] = typeOID(typeID)
+			} else {
+				paramOIDs[ii] = oidText
+			}
+		}
+	}
+
+	s.stmts_[name] = &preparedStatement{query, paramOIDs}
+	return writeMessage(s.writer_, '1', new(messageBuilder))
+}
+
+// inferParamTypes returns map of index of parameter to type of it
+func (s *session) inferParamTypes(query string) (ret map[int]types.TypeID) {
+	ret = make(map[int]types.TypeID)
+	sentinels := make([]string, countParams(query))
+	for ii := range sentinels {
+		sentinels[ii] = quoteString(paramSentinel(ii))
+	}
+
+	// parser panics when it meets unsupported syntax
+	defer func() {
+		if r := recover(); r != nil {
+			ret = make(map[int]types.TypeID)
+		}
+	}()
+
+	boundQuery := replaceParams(query, sentinels)
+	qi, err := parser.ParseSQLStr(&boundQuery)
+	if err != nil {
+		return ret
+	}
+	for val, typeID := range planner.InferConstantTypes(qi, s.db_.GetCatalog()) {
+		if val.IsNull() || val.ValueType() != types.Varchar {
+			continue
+		}
+		for ii := range sentinels {
+			if val.ToVarchar() == paramSentinel(ii) {
+				ret[ii] = typeID
+			}
+		}
+	}
+	return ret
+}
+
+func paramSentinel(idx int) string {
+	return "__samehada_param_" + strconv.Itoa(idx+1) + "__"
+}
+
+func (s *session) handleBind(mr *messageReader) error {
+	portalName, err := mr.readString()
+	if err != nil {
+		return err
+	}
+	stmtName, err := mr.readString()
+	if err != nil {
+		return err
+	}
+	stmt, ok := s.stmts_[stmtName]
+	if !ok {
+		return ErrStatementNotFound
+	}
+
+	paramFormats, err := readInt16Array(mr)
+	if err != nil {
+		return err
+	}
+	paramNum, err := mr.readInt16()
+	if err != nil {
+		return err
+	}
+	if int(paramNum) != len(stmt.paramOIDs_) {
+		return ErrMalformedMessage
+	}
+	literals := make([]string, paramNum)
+	for ii := 0; ii < int(paramNum); ii++ {
+		length, err := mr.readInt32()
+		if err != nil {
+			return err
+		}
+		var data []byte = nil
+		if length >= 0 {
+			if data, err = mr.readBytes(int(length)); err != nil {
+				return err
+			}
+		}
+		if literals[ii], err = paramToLiteral(data, stmt.paramOIDs_[ii], formatAt(paramFormats, ii)); err != nil {
+			return err
+		}
+	}
+	resultFormats, err := readInt16Array(mr)
+	if err != nil {
+		return err
+	}
+
+	s.portals_[portalName] = &portal{replaceParams(stmt.query_, literals), resultFormats, nil}
+	return writeMessage(s.writer_, '2', new(messageBuilder))
+}
+
+func readInt16Array(mr *messageReader) ([]int16, error) {
+	num, err := mr.readInt16()
+	if err != nil {
+		return nil, err
+	}
+	ret := make([]int16, num)
+	for ii := range ret {
+		if ret[ii], err = mr.readInt16(); err != nil {
+			return nil, err
+		}
+	}
+	return ret, nil
+}
+
+func (s *session) handleDescribe(mr *messageReader) error {
+	kind, err := mr.readByte()
+	if err != nil {
+		return err
+	}
+	name, err := mr.readString()
+	if err != nil {
+		return err
+	}
+
+	if kind == 'S' {
+		stmt, ok := s.stmts_[name]
+		if !ok {
+			return ErrStatementNotFound
+		}
+		mb := new(messageBuilder)
+		mb.writeInt16(int16(len(stmt.paramOIDs_)))
+		for _, oid := range stmt.paramOIDs_ {
+			mb.writeInt32(oid)
+		}
+		writeMessage(s.writer_, 't', mb)
+
+		// NULL is used as parameter value because it can be converted to any type
+		nulls := make([]string, len(stmt.paramOIDs_))
+		for ii := range nulls {
+			nulls[ii] = "NULL"
+		}
+		colNames, colTypes, err := s.db_.DescribeSQL(replaceParams(stmt.query_, nulls), s.session_.GetTransaction())
+		if err != nil {
+			return err
+		}
+		if colNames == nil {
+			return writeMessage(s.writer_, 'n', new(messageBuilder))
+		}
+		return s.sendRowDescription(colNames, colTypes, nil)
+	}
+
+	p, ok := s.portals_[name]
+	if !ok {
+		return ErrPortalNotFound
+	}
+	if p.result_ == nil {
+		if p.result_, err = s.session_.ExecuteSQL(p.query_); err != nil {
+			return err
+		}
+	}
+	if p.result_.QueryType != parser.SELECT {
+		return writeMessage(s.writer_, 'n', new(messageBuilder))
+	}
+	return s.sendRowDescription(p.result_.ColumnNames, p.result_.ColumnTypes, p.resultFormats_)
+}
+
+func (s *session) handleExecute(mr *messageReader) error {
+	name, err := mr.readString()
+	if err != nil {
+		return err
+	}
+	// max number of rows is ignored. all rows are returned at once
+	if _, err := mr.readInt32(); err != nil {
+		return err
+	}
+
+	p, ok := s.portals_[name]
+	if !ok {
+		return ErrPortalNotFound
+	}
+	result := p.result_
+	if result == nil {
+		if result, err = s.session_.ExecuteSQL(p.query_); err != nil {
+			return err
+		}
+	}
+	// portal can't be executed twice
+	delete(s.portals_, name)
+
+	if result.QueryType == parser.SELECT {
+		s.sendDataRows(result, p.resultFormats_)
+	}
+	return s.sendCommandComplete(result)
+}
+
+func (s *session) handleClose(mr *messageReader) error {
+	kind, err := mr.readByte()
+	if err != nil {
+		return err
+	}
+	name, err := mr.readString()
+	if err != nil {
+		return err
+	}
+	if kind == 'S' {
+		delete(s.stmts_, name)
+	} else {
+		delete(s.portals_, name)
+	}
+	return writeMessage(s.writer_, '3', new(messageBuilder))
+}
+
+// forEachParam calls fn with position, length and index of each "$n" parameter
+// which is not in quoted string
+func forEachParam(query string, fn func(pos int, length int, idx int)) {
+	var quote byte = 0
+	for ii := 0; ii < len(query); ii++ {
+		ch := query[ii]
+		switch {
+		case quote != 0:
+			if ch == '\\' {
+				ii++
+			} else if ch == quote {
+				quote = 0
+			}
+		case ch == '\'' || ch == '"':
+			quote = ch
+		case ch == '$':
+			end := ii + 1
+			for end < len(query) && query[end] >= '0' && query[end] <= '9' {
+				end++
+			}
+			if end == ii+1 {
+				continue
+			}
+			idx, _ := strconv.Atoi(query[ii+1 : end])
+			if idx > 0 {
+				fn(ii, end-ii, idx-1)
+			}
+			ii = end - 1
+		}
+	}
+}
+
+func countParams(query string) int {
+	ret := 0
+	forEachParam(query, func(pos int, length int, idx int) {
+		if idx+1 > ret {
+			ret = idx + 1
+		}
+	})
+	return ret
+}
+
+// replaceParams replaces "$n" parameters with literals[n-1]
+func replaceParams(query string, literals []string) string {
+	var sb strings.Builder
+	last := 0
+	forEachParam(query, func(pos int, length int, idx int) {
+		sb.WriteString(query[last:pos])
+		if idx < len(literals) {
+			sb.WriteString(literals[idx])
+		} else {
+			sb.WriteString("NULL")
+		}
+		last = pos + length
+	})
+	sb.WriteString(query[last:])
+	return sb.String()
+}
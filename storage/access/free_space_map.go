@@ -0,0 +1,140 @@
+package access
+
+import (
+	"sync"
+
+	"github.com/ryogrid/SamehadaDB/storage/buffer"
+	"github.com/ryogrid/SamehadaDB/types"
+)
+
+// fsmGranularity is unit of recorded free space. recorded value is rounded down to multiple of it
+const fsmGranularity = uint32(32)
+
+// fsmBlockSize is number of pages whose maximum free space is summarized for skipping full pages
+const fsmBlockSize = 64
+
+// FreeSpaceMap tracks approximate free space of each page of a table heap.
+// TableHeap.InsertTuple uses it for jumping to a page which has room for the tuple.
+// it is kept on memory and is built from the page chain at first use after the table heap is opened.
+// recorded values may be stale (e.g. updated by other TableHeap object of the same pages),
+// so caller must check space of the page actually and record the correct value
+type FreeSpaceMap struct {
+	mutex   *sync.Mutex
+	isBuilt bool
+	// page ids in order of the page chain
+	pageIds    []types.PageID
+	positions  map[types.PageID]int
+	freeSpaces []uint32
+	// maximum of freeSpaces in each block of fsmBlockSize pages
+	blockMaxes []uint32
+}
+
+func NewFreeSpaceMap() *FreeSpaceMap {
+	ret := &FreeSpaceMap{mutex: new(sync.Mutex)}
+	ret.clear()
+	return ret
+}
+
+func (fsm *FreeSpaceMap) clear() {
+	fsm.pageIds = make([]types.PageID, 0)
+	fsm.positions = make(map[types.PageID]int)
+	fsm.freeSpaces = make([]uint32, 0)
+	fsm.blockMaxes = make([]uint32, 0)
+}
+
+// build records free space of all pages in the page chain which starts from firstPageId.
+// it does nothing when the map is already built
+func (fsm *FreeSpaceMap) build(bpm *buffer.BufferPoolManager, firstPageId types.PageID) {
+	fsm.mutex.Lock()
+	defer fsm.mutex.Unlock()
+	if fsm.isBuilt {
+		return
+	}
+
+	fsm.clear()
+	pageId := firstPageId
+	for pageId.IsValid() {
+		page_ := CastPageAsTablePage(bpm.FetchPage(pageId))
+		if page_ == nil {
+			// pages which are not recorded are found by walking the chain from the last page
+			break
+		}
+		page_.RLatch()
+		fsm.update(pageId, page_.getFreeSpaceRemaining())
+		nextPageId := page_.GetNextPageId()
+		page_.RUnlatch()
+		bpm.UnpinPage(pageId, false)
+		pageId = nextPageId
+	}
+	fsm.isBuilt = true
+}
+
+// markBuilt is used when the table heap is created and free space of its first page is recorded
+func (fsm *FreeSpaceMap) markBuilt() {
+	fsm.mutex.Lock()
+	defer fsm.mutex.Unlock()
+	fsm.isBuilt = true
+}
+
+// Update records free space of the page. the page is added to the tail when it is not recorded.
+// note: page latch must not be held when calling this
+func (fsm *FreeSpaceMap) Update(pageId types.PageID, freeSpace uint32) {
+	fsm.mutex.Lock()
+	defer fsm.mutex.Unlock()
+	fsm.update(pageId, freeSpace)
+}
+
+func (fsm *FreeSpaceMap) update(pageId types.PageID, freeSpace uint32) {
+	pos, ok := fsm.positions[pageId]
+	if !ok {
+		pos = len(fsm.pageIds)
+		fsm.pageIds = append(fsm.pageIds, pageId)
+		fsm.positions[pageId] = pos
+		fsm.freeSpaces = append(fsm.freeSpaces, 0)
+		if pos%fsmBlockSize == 0 {
+			fsm.blockMaxes = append(fsm.blockMaxes, 0)
+		}
+	}
+	fsm.freeSpaces[pos] = freeSpace - freeSpace%fsmGranularity
+
+	block := pos / fsmBlockSize
+	end := (block + 1) * fsmBlockSize
+	if end > len(fsm.freeSpaces) {
+		end = len(fsm.freeSpaces)
+	}
+	max := uint32(0)
+	for _, space := range fsm.freeSpaces[block*fsmBlockSize : end] {
+		if space > max {
+			max = space
+		}
+	}
+	fsm.blockMaxes[block] = max
+}
+
+// FindPage returns the page nearest to the head of the chain among pages recorded
+// to have free space of size bytes or more. InvalidPageID is returned when there is no such page
+func (fsm *FreeSpaceMap) FindPage(size uint32) types.PageID {
+	fsm.mutex.Lock()
+	defer fsm.mutex.Unlock()
+	for block, max := range fsm.blockMaxes {
+		if max < size {
+			continue
+		}
+		for pos := block * fsmBlockSize; pos < len(fsm.freeSpaces); pos++ {
+			if fsm.freeSpaces[pos] >= size {
+				return fsm.pageIds[pos]
+			}
+		}
+	}
+	return types.InvalidPageID
+}
+
+// GetLastPageId returns the last recorded page. pages may be appended after it
+func (fsm *FreeSpaceMap) GetLastPageId() types.PageID {
+	fsm.mutex.Lock()
+	defer fsm.mutex.Unlock()
+	if len(fsm.pageIds) == 0 {
+		return types.InvalidPageID
+	}
+	return fsm.pageIds[len(fsm.pageIds)-1]
+}
@@ -2,9 +2,15 @@ package access
 
 import (
 	"fmt"
+	"sort"
 	"sync"
+	"time"
 
+	"github.com/ryogrid/SamehadaDB/common"
+
+	"github.com/ryogrid/SamehadaDB/errors"
 	"github.com/ryogrid/SamehadaDB/storage/page"
+	"github.com/ryogrid/SamehadaDB/storage/tuple"
 	"github.com/ryogrid/SamehadaDB/types"
 )
 
@@ -22,9 +28,12 @@ const (
 type DeadlockMode int32
 
 const (
-	PREVENTION DeadlockMode = iota
+	PREVENTION DeadlockMode = iota // same as WOUND_WAIT
 	DETECTION
 	SS2PL_MODE
+	// prevention policies using transaction id as timestamp (smaller id is older)
+	WOUND_WAIT // older transaction aborts younger holders and waits. younger one waits
+	WAIT_DIE   // older transaction waits. younger one is aborted
 )
 
 type LockMode int32
@@ -32,26 +41,153 @@ type LockMode int32
 const (
 	SHARED LockMode = iota
 	EXCLUSIVE
+	// intention locks are acquired only on tables
+	INTENTION_SHARED
+	INTENTION_EXCLUSIVE
+	SHARED_INTENTION_EXCLUSIVE
 )
 
+// isCompatible returns true when locks of the modes can be held by different transactions at the same time
+func isCompatible(mode1 LockMode, mode2 LockMode) bool {
+	switch mode1 {
+	case INTENTION_SHARED:
+		return mode2 != EXCLUSIVE
+	case INTENTION_EXCLUSIVE:
+		return mode2 == INTENTION_SHARED || mode2 == INTENTION_EXCLUSIVE
+	case SHARED:
+		return mode2 == INTENTION_SHARED || mode2 == SHARED
+	case SHARED_INTENTION_EXCLUSIVE:
+		return mode2 == INTENTION_SHARED
+	default:
+		return false
+	}
+}
+
+// covers returns true when lock of held mode permits everything lock of mode permits
+func covers(held LockMode, mode LockMode) bool {
+	switch held {
+	case EXCLUSIVE:
+		return true
+	case SHARED_INTENTION_EXCLUSIVE:
+		return mode != EXCLUSIVE
+	case SHARED, INTENTION_EXCLUSIVE:
+		return mode == held || mode == INTENTION_SHARED
+	default:
+		return mode == held
+	}
+}
+
+// upgradedMode returns the weakest mode which covers both held and requested mode
+func upgradedMode(held LockMode, mode LockMode) LockMode {
+	if covers(held, mode) {
+		return held
+	}
+	if covers(mode, held) {
+		return mode
+	}
+	// SHARED and INTENTION_EXCLUSIVE
+	return SHARED_INTENTION_EXCLUSIVE
+}
+
+const ErrTableLockFailed = errors.Error("lock on the table could not be acquired")
+const ErrLockWaitTimeout = errors.Error("lock wait timeout exceeded")
+const ErrLockConflict = errors.Error("lock is held by other transaction")
+const ErrUpgradeConflict = errors.Error("other transaction is already upgrading the lock")
+const ErrDeadlock = errors.Error("transaction is aborted to avoid deadlock")
+
 type LockRequest struct {
 	txn_id    types.TxnID
 	lock_mode LockMode
 	granted   bool
+	// for aborting the transaction when it is chosen as victim of deadlock
+	txn *Transaction
+	// set on requests in queues of predicate locks (see predicate_lock.go)
+	predicate Predicate
+	tuples    []*tuple.Tuple
 }
 
-func NewLockRequest(txn_id types.TxnID, lock_mode LockMode) *LockRequest {
+func NewLockRequest(txn *Transaction, lock_mode LockMode) *LockRequest {
 	ret := new(LockRequest)
-	ret.txn_id = txn_id
+	ret.txn_id = txn.GetTransactionId()
+	ret.txn = txn
 	ret.lock_mode = lock_mode
 	ret.granted = false
 	return ret
 }
 
+// LockRequestQueue keeps lock requests on a RID in FIFO order.
+// granted requests are always placed before waiting requests
 type LockRequestQueue struct {
 	request_queue []*LockRequest
-	//std::condition_variable cv  // for notifying blocked transactions on this rid
-	upgrading bool
+	cv            *sync.Cond // for notifying blocked transactions on this rid
+	upgrading     bool
+}
+
+func newLockRequestQueue(mutex *sync.Mutex) *LockRequestQueue {
+	return &LockRequestQueue{make([]*LockRequest, 0), sync.NewCond(mutex), false}
+}
+
+// conflicts returns true when req must wait for r which is placed before req in the queue
+func conflicts(r *LockRequest, req *LockRequest) bool {
+	if req.predicate != nil || req.tuples != nil {
+		return conflictsOnPredicate(r, req)
+	}
+	return !r.granted || !isCompatible(r.lock_mode, req.lock_mode)
+}
+
+// isGrantable returns true when all requests before req are granted and compatible with req.
+// a request of the same transaction is skipped because it is the lock which is being upgraded
+func (queue *LockRequestQueue) isGrantable(req *LockRequest) bool {
+	for _, r := range queue.request_queue {
+		if r == req {
+			return true
+		}
+		if r.txn_id == req.txn_id {
+			continue
+		}
+		if conflicts(r, req) {
+			return false
+		}
+	}
+	return true
+}
+
+// blockers returns requests before req which prevent req from being granted
+func (queue *LockRequestQueue) blockers(req *LockRequest) []*LockRequest {
+	ret := make([]*LockRequest, 0)
+	for _, r := range queue.request_queue {
+		if r == req {
+			break
+		}
+		if r.txn_id != req.txn_id && conflicts(r, req) {
+			ret = append(ret, r)
+		}
+	}
+	return ret
+}
+
+func (queue *LockRequestQueue) remove(req *LockRequest) {
+	for ii, r := range queue.request_queue {
+		if r == req {
+			queue.request_queue = append(queue.request_queue[:ii], queue.request_queue[ii+1:]...)
+			return
+		}
+	}
+}
+
+// removeTxn removes requests of the transaction and returns true when one of them was removed
+func (queue *LockRequestQueue) removeTxn(txn_id types.TxnID) bool {
+	removed := false
+	requests := make([]*LockRequest, 0, len(queue.request_queue))
+	for _, r := range queue.request_queue {
+		if r.txn_id == txn_id {
+			removed = true
+			continue
+		}
+		requests = append(requests, r)
+	}
+	queue.request_queue = requests
+	return removed
 }
 
 /**
@@ -63,15 +199,22 @@ type LockManager struct {
 
 	mutex                  *sync.Mutex
 	enable_cycle_detection bool
-	//cycle_detection_thread *std::thread
 
-	// /** Lock table for lock requests. */
-	// lock_table map[page.RID]*LockRequestQueue
-	// /** Waits-for graph representation. */
-	// waits_for map[types.TxnID][]types.TxnID
+	/** Lock table for lock requests. */
+	lock_table map[page.RID]*LockRequestQueue
+	/** Waits-for graph representation. */
+	waits_for map[types.TxnID][]types.TxnID
 
-	shared_lock_table    map[page.RID][]types.TxnID
-	exclusive_lock_table map[page.RID]types.TxnID
+	// a transaction waiting for a lock longer than this gets ErrLockWaitTimeout
+	lock_wait_timeout time.Duration
+
+	// lock table for lock requests on tables (key is OID of the table)
+	table_lock_table map[uint32]*LockRequestQueue
+	// row locks are escalated to table lock when a transaction holds more row locks than this in a table
+	escalation_threshold int
+
+	// lock table for predicate locks and tuples written against them (key is OID of the table)
+	predicate_lock_table map[uint32]*LockRequestQueue
 }
 
 /**
@@ -84,33 +227,50 @@ func NewLockManager(two_pl_mode TwoPLMode, deadlock_mode DeadlockMode /*= Deadlo
 	ret.two_pl_mode = two_pl_mode
 	ret.deadlock_mode = deadlock_mode
 	ret.mutex = new(sync.Mutex)
-	ret.shared_lock_table = make(map[page.RID][]types.TxnID)
-	ret.exclusive_lock_table = make(map[page.RID]types.TxnID)
-	// // If Detection() is enabled, we should launch a background cycle detection thread.
-	// if ret.Detection() {
-	// 	ret.enable_cycle_detection = true
-	// 	//ret.cycle_detection_thread = new std::thread(&LockManager::RunCycleDetection, this)
-	// 	//LOG_INFO("Cycle detection thread launched")
-	// }
+	ret.lock_table = make(map[page.RID]*LockRequestQueue)
+	ret.lock_wait_timeout = common.LockWaitTimeout
+	ret.table_lock_table = make(map[uint32]*LockRequestQueue)
+	ret.escalation_threshold = common.LockEscalationThreshold
+	ret.predicate_lock_table = make(map[uint32]*LockRequestQueue)
+	ret.waits_for = make(map[types.TxnID][]types.TxnID)
+	// If Detection() is enabled, we should launch a background cycle detection goroutine.
+	if ret.Detection() {
+		ret.enable_cycle_detection = true
+		go ret.RunCycleDetection()
+	}
 	return ret
 }
 
-// ~LockManager() {
-//  if (Detection()) {
-//    enable_cycle_detection = false
-//    cycle_detection_thread.join()
-//    delete cycle_detection_thread
-//    LOG_INFO("Cycle detection thread stopped")
-//  }
-// }
+// StopCycleDetection stops the background cycle detection goroutine launched in DETECTION mode
+func (lock_manager *LockManager) StopCycleDetection() {
+	lock_manager.mutex.Lock()
+	defer lock_manager.mutex.Unlock()
+	lock_manager.enable_cycle_detection = false
+}
 
-func (lock_manager *LockManager) Detection() bool  { return lock_manager.deadlock_mode == DETECTION }
-func (lock_manager *LockManager) Prevention() bool { return lock_manager.deadlock_mode == PREVENTION }
+func (lock_manager *LockManager) Detection() bool { return lock_manager.deadlock_mode == DETECTION }
+func (lock_manager *LockManager) Prevention() bool {
+	return lock_manager.deadlock_mode == PREVENTION || lock_manager.deadlock_mode == WOUND_WAIT || lock_manager.deadlock_mode == WAIT_DIE
+}
+
+// SetLockWaitTimeout changes how long lock requests wait for conflicting locks to be released
+func (lock_manager *LockManager) SetLockWaitTimeout(timeout time.Duration) {
+	lock_manager.mutex.Lock()
+	defer lock_manager.mutex.Unlock()
+	lock_manager.lock_wait_timeout = timeout
+}
+
+// SetLockEscalationThreshold changes number of row locks in a table which causes lock escalation
+func (lock_manager *LockManager) SetLockEscalationThreshold(threshold int) {
+	lock_manager.mutex.Lock()
+	defer lock_manager.mutex.Unlock()
+	lock_manager.escalation_threshold = threshold
+}
 
 /*
 * [LOCK_NOTE]: For all locking functions, we:
 * 1. return false if the transaction is aborted; and
-* 2. block on wait, return true when the lock request is granted; and
+* 2. block on wait, return nil when the lock request is granted and ErrLockWaitTimeout when waiting timed out; and
 * 3. it is undefined behavior to try locking an already locked RID in the same transaction, i.e. the transaction
 *    is responsible for keeping track of its current locks.
  */
@@ -146,107 +306,243 @@ func isContainTxnID(list []types.TxnID, txnID types.TxnID) bool {
 	return false
 }
 
+func (lock_manager *LockManager) getQueue(rid *page.RID) *LockRequestQueue {
+	queue, ok := lock_manager.lock_table[*rid]
+	if !ok {
+		queue = newLockRequestQueue(lock_manager.mutex)
+		lock_manager.lock_table[*rid] = queue
+	}
+	return queue
+}
+
+// deleteQueueIfEmpty removes queue of the RID which has no request for saving memory
+func (lock_manager *LockManager) deleteQueueIfEmpty(rid *page.RID) {
+	if queue, ok := lock_manager.lock_table[*rid]; ok && len(queue.request_queue) == 0 {
+		delete(lock_manager.lock_table, *rid)
+	}
+}
+
+func (lock_manager *LockManager) getTableQueue(oid uint32) *LockRequestQueue {
+	queue, ok := lock_manager.table_lock_table[oid]
+	if !ok {
+		queue = newLockRequestQueue(lock_manager.mutex)
+		lock_manager.table_lock_table[oid] = queue
+	}
+	return queue
+}
+
+// queues returns queues of rows, tables and predicates
+func (lock_manager *LockManager) queues() []*LockRequestQueue {
+	ret := make([]*LockRequestQueue, 0, len(lock_manager.lock_table)+len(lock_manager.table_lock_table)+len(lock_manager.predicate_lock_table))
+	for _, queue := range lock_manager.lock_table {
+		ret = append(ret, queue)
+	}
+	for _, queue := range lock_manager.table_lock_table {
+		ret = append(ret, queue)
+	}
+	for _, queue := range lock_manager.predicate_lock_table {
+		ret = append(ret, queue)
+	}
+	return ret
+}
+
+// waitForGrant blocks until req is granted. when it is not granted until timeout, wait is false
+// or the transaction is aborted by deadlock detection, req is removed from the queue and an error is returned.
+// lock_manager.mutex must be held when calling this
+func (lock_manager *LockManager) waitForGrant(queue *LockRequestQueue, req *LockRequest, wait bool) error {
+	if !queue.isGrantable(req) {
+		if !wait {
+			lock_manager.cancelRequest(queue, req)
+			return ErrLockConflict
+		}
+
+		isTimedOut := false
+		timer := time.AfterFunc(lock_manager.lock_wait_timeout, func() {
+			lock_manager.mutex.Lock()
+			isTimedOut = true
+			queue.cv.Broadcast()
+			lock_manager.mutex.Unlock()
+		})
+		defer timer.Stop()
+		for !queue.isGrantable(req) {
+			if lock_manager.Prevention() {
+				lock_manager.preventDeadlock(queue, req)
+			}
+			if req.txn.GetState() == ABORTED {
+				lock_manager.cancelRequest(queue, req)
+				return ErrDeadlock
+			}
+			if isTimedOut {
+				lock_manager.cancelRequest(queue, req)
+				return ErrLockWaitTimeout
+			}
+			queue.cv.Wait()
+		}
+	}
+	req.granted = true
+	return nil
+}
+
+// preventDeadlock applies wound-wait or wait-die policy to req and its blockers.
+// aborted transactions notice it in waitForGrant or when they check their state
+func (lock_manager *LockManager) preventDeadlock(queue *LockRequestQueue, req *LockRequest) {
+	for _, blocker := range queue.blockers(req) {
+		if blocker.txn_id < req.txn_id {
+			if lock_manager.deadlock_mode == WAIT_DIE {
+				// younger requester dies
+				req.txn.SetState(ABORTED)
+				return
+			}
+			continue
+		}
+		// older requester wounds younger blocker. it releases locks on its abort.
+		// committing or already aborted blocker is not wounded because it releases locks soon
+		if lock_manager.deadlock_mode != WAIT_DIE && blocker.txn.abortIfGrowing() {
+			lock_manager.wakeUp(blocker.txn_id)
+		}
+	}
+}
+
+// wakeUp notifies the transaction waiting for a lock
+func (lock_manager *LockManager) wakeUp(txn_id types.TxnID) {
+	for _, queue := range lock_manager.queues() {
+		for _, r := range queue.request_queue {
+			if r.txn_id == txn_id && !r.granted {
+				queue.cv.Broadcast()
+				return
+			}
+		}
+	}
+}
+
+func (lock_manager *LockManager) cancelRequest(queue *LockRequestQueue, req *LockRequest) {
+	queue.remove(req)
+	// requests behind the removed one may become grantable
+	queue.cv.Broadcast()
+}
+
 /**
 * Acquire a lock on RID in shared mode. See [LOCK_NOTE] in header file.
 * @param txn the transaction requesting the shared lock
 * @param rid the RID to be locked in shared mode
-* @return true if the lock is granted, false otherwise
+* @return nil if the lock is granted, error otherwise
  */
-func (lock_manager *LockManager) LockShared(txn *Transaction, rid *page.RID) bool {
+func (lock_manager *LockManager) LockShared(txn *Transaction, rid *page.RID) error {
 	//fmt.Printf("called LockShared, %v\n", rid)
 	lock_manager.mutex.Lock()
 	defer lock_manager.mutex.Unlock()
-	slock_set := txn.GetSharedLockSet()
-	if txnID, ok := lock_manager.exclusive_lock_table[*rid]; ok {
-		if txnID == txn.GetTransactionId() {
-			return true
-		} else {
-			return false
-		}
-	} else {
-		if arr, ok := lock_manager.shared_lock_table[*rid]; ok {
-			if isContainTxnID(arr, txn.GetTransactionId()) {
-				return true
-			} else {
-				cur_arr := lock_manager.shared_lock_table[*rid]
-				cur_arr = append(cur_arr, txn.GetTransactionId())
-				lock_manager.shared_lock_table[*rid] = cur_arr
-				slock_set = append(slock_set, *rid)
-				txn.SetSharedLockSet(slock_set)
-				return true
-			}
-		} else {
-			new_arr := make([]types.TxnID, 0)
-			new_arr = append(new_arr, txn.GetTransactionId())
-			lock_manager.shared_lock_table[*rid] = new_arr
-			slock_set = append(slock_set, *rid)
-			txn.SetSharedLockSet(slock_set)
-			return true
-		}
+	if txn.IsSharedLocked(rid) || txn.IsExclusiveLocked(rid) {
+		return nil
+	}
+
+	queue := lock_manager.getQueue(rid)
+	req := NewLockRequest(txn, SHARED)
+	queue.request_queue = append(queue.request_queue, req)
+	if err := lock_manager.waitForGrant(queue, req, true); err != nil {
+		lock_manager.deleteQueueIfEmpty(rid)
+		return err
 	}
+	txn.SetSharedLockSet(append(txn.GetSharedLockSet(), *rid))
+	return nil
 }
 
 /**
 * Acquire a lock on RID in exclusive mode. See [LOCK_NOTE] in header file.
+* when the transaction holds a shared lock on the RID, it is upgraded.
 * @param txn the transaction requesting the exclusive lock
 * @param rid the RID to be locked in exclusive mode
-* @return true if the lock is granted, false otherwise
+* @return nil if the lock is granted, error otherwise
  */
-func (lock_manager *LockManager) LockExclusive(txn *Transaction, rid *page.RID) bool {
+func (lock_manager *LockManager) LockExclusive(txn *Transaction, rid *page.RID) error {
 	//fmt.Printf("called LockExclusive, %v\n", rid)
+	return lock_manager.lockExclusive(txn, rid, true)
+}
+
+// tryLockExclusive acquires an exclusive lock on RID without waiting.
+// it is used for locking a new tuple under the page latch
+func (lock_manager *LockManager) tryLockExclusive(txn *Transaction, rid *page.RID) error {
+	return lock_manager.lockExclusive(txn, rid, false)
+}
+
+func (lock_manager *LockManager) lockExclusive(txn *Transaction, rid *page.RID, wait bool) error {
 	lock_manager.mutex.Lock()
 	defer lock_manager.mutex.Unlock()
-	exlock_set := txn.GetExclusiveLockSet()
-	if txnID, ok := lock_manager.exclusive_lock_table[*rid]; ok {
-		if txnID == txn.GetTransactionId() {
-			return true
-		} else {
-			return false
-		}
-	} else {
-		if arr, ok := lock_manager.shared_lock_table[*rid]; ok {
-			if len(arr) != 0 {
-				return false
-			}
-		}
+	if txn.IsExclusiveLocked(rid) {
+		return nil
+	}
+	if txn.IsSharedLocked(rid) {
+		return lock_manager.upgradeRow(txn, rid, wait)
+	}
 
-		lock_manager.exclusive_lock_table[*rid] = txn.GetTransactionId()
-		exlock_set = append(exlock_set, *rid)
-		txn.SetExclusiveLockSet(exlock_set)
-		return true
+	queue := lock_manager.getQueue(rid)
+	req := NewLockRequest(txn, EXCLUSIVE)
+	queue.request_queue = append(queue.request_queue, req)
+	if err := lock_manager.waitForGrant(queue, req, wait); err != nil {
+		lock_manager.deleteQueueIfEmpty(rid)
+		return err
 	}
+	txn.SetExclusiveLockSet(append(txn.GetExclusiveLockSet(), *rid))
+	return nil
 }
 
 /**
 * Upgrade a lock from a shared lock to an exclusive access.
+* the upgrade request takes priority over waiting requests.
 * @param txn the transaction requesting the lock upgrade
 * @param rid the RID that should already be locked in shared mode by the requesting transaction
-* @return true if the upgrade is successful, false otherwise
+* @return nil if the upgrade is successful, error otherwise
  */
-func (lock_manager *LockManager) LockUpgrade(txn *Transaction, rid *page.RID) bool {
+func (lock_manager *LockManager) LockUpgrade(txn *Transaction, rid *page.RID) error {
 	//fmt.Printf("called LockUpgrade %v\n", rid)
 	lock_manager.mutex.Lock()
 	defer lock_manager.mutex.Unlock()
-	slock_set := txn.GetSharedLockSet()
-	elock_set := txn.GetExclusiveLockSet()
-	if txn.IsSharedLocked(rid) {
-		if txnID, ok := lock_manager.exclusive_lock_table[*rid]; ok {
-			if txnID == txn.GetTransactionId() {
-				return true
-			} else {
-				return false
-			}
-		} else {
-			lock_manager.exclusive_lock_table[*rid] = txn.GetTransactionId()
-			elock_set = append(elock_set, *rid)
-			txn.SetExclusiveLockSet(elock_set)
-			slock_set = removeRID(slock_set, *rid)
-			txn.SetSharedLockSet(slock_set)
-			return true
-		}
-	} else {
+	if !txn.IsSharedLocked(rid) {
 		panic("LockUpgrade: RID is not locked in shared mode")
 	}
+	return lock_manager.upgradeRow(txn, rid, true)
+}
+
+func (lock_manager *LockManager) upgradeRow(txn *Transaction, rid *page.RID, wait bool) error {
+	if err := lock_manager.upgrade(lock_manager.getQueue(rid), txn, EXCLUSIVE, wait); err != nil {
+		return err
+	}
+	txn.SetSharedLockSet(removeRID(txn.GetSharedLockSet(), *rid))
+	txn.SetExclusiveLockSet(append(txn.GetExclusiveLockSet(), *rid))
+	return nil
+}
+
+// upgrade replaces the granted request of txn in the queue with a request of lock_mode
+func (lock_manager *LockManager) upgrade(queue *LockRequestQueue, txn *Transaction, lock_mode LockMode, wait bool) error {
+	if queue.upgrading {
+		// two transactions waiting for upgrade on the same lock never proceed
+		return ErrUpgradeConflict
+	}
+
+	// the request is placed right after granted requests
+	req := NewLockRequest(txn, lock_mode)
+	pos := 0
+	for pos < len(queue.request_queue) && queue.request_queue[pos].granted {
+		pos++
+	}
+	queue.request_queue = append(queue.request_queue, nil)
+	copy(queue.request_queue[pos+1:], queue.request_queue[pos:])
+	queue.request_queue[pos] = req
+
+	queue.upgrading = true
+	err := lock_manager.waitForGrant(queue, req, wait)
+	queue.upgrading = false
+	if err != nil {
+		return err
+	}
+
+	// the held lock is replaced with the new one
+	for _, r := range queue.request_queue {
+		if r.txn_id == req.txn_id && r != req {
+			queue.remove(r)
+			break
+		}
+	}
+	return nil
 }
 
 /**
@@ -259,46 +555,156 @@ func (lock_manager *LockManager) Unlock(txn *Transaction, rid_list []page.RID) b
 	lock_manager.mutex.Lock()
 	defer lock_manager.mutex.Unlock()
 	for _, locked_rid := range rid_list {
-		// slock_set := txn.GetSharedLockSet()
-		// slock_set = removeRID(slock_set, locked_rid)
-		// elock_set := txn.GetExclusiveLockSet()
-		// elock_set = removeRID(elock_set, locked_rid)
-
-		if _, ok := lock_manager.exclusive_lock_table[locked_rid]; ok {
-			if lock_manager.exclusive_lock_table[locked_rid] == txn.GetTransactionId() {
-				// fmt.Println("delete exclusive_lock_table entry")
-				// fmt.Println(locked_rid)
-				delete(lock_manager.exclusive_lock_table, locked_rid)
-			}
+		queue, ok := lock_manager.lock_table[locked_rid]
+		if !ok || !queue.removeTxn(txn.GetTransactionId()) {
+			continue
 		}
-		if arr, ok := lock_manager.shared_lock_table[locked_rid]; ok {
-			if isContainTxnID(arr, txn.GetTransactionId()) {
-				// fmt.Println("remove txnid from shared_lock_table entry")
-				// fmt.Println(txn.GetTransactionId())
-				lock_manager.shared_lock_table[locked_rid] = removeTxnID(arr, txn.GetTransactionId())
-			}
+		if len(queue.request_queue) == 0 {
+			delete(lock_manager.lock_table, locked_rid)
 		}
+		queue.cv.Broadcast()
 	}
-	// txn.SetSharedLockSet(slock_set)
-	// txn.SetExclusiveLockSet(elock_set)
 
 	return true
 }
 
+/**
+* Acquire a lock on the table. X lock is taken by DDL. DML takes IS or IX lock before locking rows.
+* a lock already held by the transaction is upgraded to the mode covering both of them.
+* @param txn the transaction requesting the lock
+* @param oid the OID of the table to be locked
+* @param lock_mode mode of the lock
+* @return nil if the lock is granted, error otherwise
+ */
+func (lock_manager *LockManager) LockTable(txn *Transaction, oid uint32, lock_mode LockMode) error {
+	lock_manager.mutex.Lock()
+	defer lock_manager.mutex.Unlock()
+	return lock_manager.lockTable(txn, oid, lock_mode, true)
+}
+
+func (lock_manager *LockManager) lockTable(txn *Transaction, oid uint32, lock_mode LockMode, wait bool) error {
+	queue := lock_manager.getTableQueue(oid)
+	if held, ok := txn.GetTableLockMode(oid); ok {
+		new_mode := upgradedMode(held, lock_mode)
+		if new_mode == held {
+			return nil
+		}
+		if err := lock_manager.upgrade(queue, txn, new_mode, wait); err != nil {
+			return err
+		}
+		txn.AddIntoTableLockSet(oid, new_mode)
+		return nil
+	}
+
+	req := NewLockRequest(txn, lock_mode)
+	queue.request_queue = append(queue.request_queue, req)
+	if err := lock_manager.waitForGrant(queue, req, wait); err != nil {
+		return err
+	}
+	txn.AddIntoTableLockSet(oid, lock_mode)
+	return nil
+}
+
+/**
+* Acquire a lock on RID of the table. intention lock on the table is acquired before the row lock.
+* the row lock is not acquired when the table lock of the transaction covers it (e.g. after lock escalation).
+* @param txn the transaction requesting the lock
+* @param oid the OID of the table which has the row
+* @param rid the RID to be locked
+* @param lock_mode SHARED or EXCLUSIVE
+* @return nil if the lock is granted, error otherwise
+ */
+func (lock_manager *LockManager) LockRow(txn *Transaction, oid uint32, rid *page.RID, lock_mode LockMode) error {
+	if covered, err := lock_manager.lockTableForRow(txn, oid, lock_mode); covered || err != nil {
+		return err
+	}
+	isLocked := txn.IsSharedLocked(rid) || txn.IsExclusiveLocked(rid)
+	var err error
+	if lock_mode == SHARED {
+		err = lock_manager.LockShared(txn, rid)
+	} else {
+		err = lock_manager.LockExclusive(txn, rid)
+	}
+	if err != nil {
+		return err
+	}
+	if !isLocked {
+		lock_manager.onRowLocked(txn, oid)
+	}
+	return nil
+}
+
+// lockTableForRow acquires intention lock on the table for locking its row in lock_mode.
+// returns true when the row lock is not needed because the table lock covers it
+func (lock_manager *LockManager) lockTableForRow(txn *Transaction, oid uint32, lock_mode LockMode) (bool, error) {
+	lock_manager.mutex.Lock()
+	defer lock_manager.mutex.Unlock()
+	if held, ok := txn.GetTableLockMode(oid); ok && covers(held, lock_mode) {
+		return true, nil
+	}
+	intention := INTENTION_SHARED
+	if lock_mode == EXCLUSIVE {
+		intention = INTENTION_EXCLUSIVE
+	}
+	return false, lock_manager.lockTable(txn, oid, intention, true)
+}
+
+// onRowLocked counts row locks of the table held by txn and escalates them to table lock
+// when the count exceeds the threshold. escalation is given up without waiting when other
+// transactions hold conflicting locks on the table.
+// TODO: (SDB) row locks acquired before escalation are kept until the transaction finishes
+func (lock_manager *LockManager) onRowLocked(txn *Transaction, oid uint32) {
+	lock_manager.mutex.Lock()
+	defer lock_manager.mutex.Unlock()
+	txn.row_lock_counts[oid]++
+	if txn.row_lock_counts[oid] <= lock_manager.escalation_threshold {
+		return
+	}
+	mode := EXCLUSIVE
+	if held, _ := txn.GetTableLockMode(oid); held == INTENTION_SHARED {
+		// the transaction only reads the table
+		mode = SHARED
+	}
+	lock_manager.lockTable(txn, oid, mode, false)
+}
+
+/**
+* Release the locks on tables held by the transaction.
+* @param txn the transaction releasing the locks
+* @param oids OIDs of the tables locked by the transaction
+ */
+func (lock_manager *LockManager) UnlockTables(txn *Transaction, oids []uint32) {
+	lock_manager.mutex.Lock()
+	defer lock_manager.mutex.Unlock()
+	for _, oid := range oids {
+		if queue, ok := lock_manager.table_lock_table[oid]; ok && queue.removeTxn(txn.GetTransactionId()) {
+			queue.cv.Broadcast()
+		}
+	}
+}
+
 func (lock_manager *LockManager) PrintLockTables() {
-	fmt.Printf("len of shared_lock_table at Unlock %d\n", len(lock_manager.shared_lock_table))
-	fmt.Printf("len of exclusive_lock_table at Unlock %d\n", len(lock_manager.exclusive_lock_table))
-	for k, v := range lock_manager.shared_lock_table {
-		fmt.Printf("%v: %v\n", k, v)
+	fmt.Printf("len of lock_table at Unlock %d\n", len(lock_manager.lock_table))
+	for k, queue := range lock_manager.lock_table {
+		fmt.Printf("%v:", k)
+		for _, req := range queue.request_queue {
+			fmt.Printf(" %v", *req)
+		}
+		fmt.Println("")
 	}
-	for k, v := range lock_manager.exclusive_lock_table {
-		fmt.Printf("%v: %v\n", k, v)
+	for oid, queue := range lock_manager.table_lock_table {
+		fmt.Printf("table %d:", oid)
+		for _, req := range queue.request_queue {
+			fmt.Printf(" %v", *req)
+		}
+		fmt.Println("")
 	}
 }
 
 func (lock_manager *LockManager) ClearLockTablesForDebug() {
-	lock_manager.shared_lock_table = make(map[page.RID][]types.TxnID, 0)
-	lock_manager.exclusive_lock_table = make(map[page.RID]types.TxnID, 0)
+	lock_manager.lock_table = make(map[page.RID]*LockRequestQueue, 0)
+	lock_manager.table_lock_table = make(map[uint32]*LockRequestQueue, 0)
+	lock_manager.predicate_lock_table = make(map[uint32]*LockRequestQueue, 0)
 }
 
 /*** Graph API ***/
@@ -307,42 +713,140 @@ func (lock_manager *LockManager) ClearLockTablesForDebug() {
  */
 
 /** Adds an edge from t1 -> t2. */
-func (lock_manager *LockManager) AddEdge(t1 types.TxnID, t2 types.TxnID) { /* assert(Detection()) */ }
+func (lock_manager *LockManager) AddEdge(t1 types.TxnID, t2 types.TxnID) {
+	if !isContainTxnID(lock_manager.waits_for[t1], t2) {
+		lock_manager.waits_for[t1] = append(lock_manager.waits_for[t1], t2)
+	}
+}
 
 /** Removes an edge from t1 -> t2. */
-func (lock_manager *LockManager) RemoveEdge(t1 types.TxnID, t2 types.TxnID) { /* assert(Detection()) */
+func (lock_manager *LockManager) RemoveEdge(t1 types.TxnID, t2 types.TxnID) {
+	edges := removeTxnID(lock_manager.waits_for[t1], t2)
+	if len(edges) == 0 {
+		delete(lock_manager.waits_for, t1)
+	} else {
+		lock_manager.waits_for[t1] = edges
+	}
 }
 
 /**
 * Checks if the graph has a cycle, returning the newest transaction ID in the cycle if so.
+* nodes and edges are visited in ascending order of transaction ID for deterministic result.
 * @param[out] txn_id if the graph has a cycle, will contain the newest transaction ID
 * @return false if the graph has no cycle, otherwise stores the newest transaction ID in the cycle to txn_id
  */
 func (lock_manager *LockManager) HasCycle(txn_id *types.TxnID) bool {
-	/*
-	   BUSTUB_ASSERT(Detection(), "Detection should be enabled!")
-	*/
+	visited := make(map[types.TxnID]bool)
+	for _, start := range lock_manager.sortedNodes() {
+		if visited[start] {
+			continue
+		}
+		path := make([]types.TxnID, 0)
+		onPath := make(map[types.TxnID]bool)
+		if lock_manager.findCycle(start, visited, &path, onPath, txn_id) {
+			return true
+		}
+	}
+	return false
+}
+
+// findCycle searches a cycle with DFS. path keeps transactions from start of the search to cur
+func (lock_manager *LockManager) findCycle(cur types.TxnID, visited map[types.TxnID]bool, path *[]types.TxnID, onPath map[types.TxnID]bool, txn_id *types.TxnID) bool {
+	visited[cur] = true
+	onPath[cur] = true
+	*path = append(*path, cur)
+
+	next := append(make([]types.TxnID, 0), lock_manager.waits_for[cur]...)
+	sort.Slice(next, func(i, j int) bool { return next[i] < next[j] })
+	for _, t := range next {
+		if onPath[t] {
+			// the cycle consists of transactions on path after t
+			newest := t
+			for ii := len(*path) - 1; (*path)[ii] != t; ii-- {
+				if (*path)[ii] > newest {
+					newest = (*path)[ii]
+				}
+			}
+			*txn_id = newest
+			return true
+		}
+		if !visited[t] && lock_manager.findCycle(t, visited, path, onPath, txn_id) {
+			return true
+		}
+	}
+
+	onPath[cur] = false
+	*path = (*path)[:len(*path)-1]
 	return false
 }
 
-// /** @return the set of all edges in the graph, used for testing only! */
-// func (lock_manager *LockManager) GetEdgeList() std::vector<std::pair<txn_id_t, txn_id_t>> {
-// /*
-//   BUSTUB_ASSERT(Detection(), "Detection should be enabled!")
-// */
-//   return {}
-// }
+func (lock_manager *LockManager) sortedNodes() []types.TxnID {
+	nodes := make([]types.TxnID, 0, len(lock_manager.waits_for))
+	for t := range lock_manager.waits_for {
+		nodes = append(nodes, t)
+	}
+	sort.Slice(nodes, func(i, j int) bool { return nodes[i] < nodes[j] })
+	return nodes
+}
+
+/** @return the set of all edges in the graph, used for testing only! */
+func (lock_manager *LockManager) GetEdgeList() [][2]types.TxnID {
+	ret := make([][2]types.TxnID, 0)
+	for _, t1 := range lock_manager.sortedNodes() {
+		for _, t2 := range lock_manager.waits_for[t1] {
+			ret = append(ret, [2]types.TxnID{t1, t2})
+		}
+	}
+	return ret
+}
+
+// buildWaitsForGraph makes edges from each waiting request to requests before it which block it.
+// lock_manager.mutex must be held when calling this
+// returned map has queue on which each transaction is waiting
+func (lock_manager *LockManager) buildWaitsForGraph() map[types.TxnID]*LockRequestQueue {
+	lock_manager.waits_for = make(map[types.TxnID][]types.TxnID)
+	waiting := make(map[types.TxnID]*LockRequestQueue)
+	for _, queue := range lock_manager.queues() {
+		for _, req := range queue.request_queue {
+			if req.granted {
+				continue
+			}
+			waiting[req.txn_id] = queue
+			for _, r := range queue.blockers(req) {
+				lock_manager.AddEdge(req.txn_id, r.txn_id)
+			}
+		}
+	}
+	return waiting
+}
 
 /** Runs cycle detection in the background. */
 func (lock_manager *LockManager) RunCycleDetection() {
-	/*
-	   	BUSTUB_ASSERT(Detection(), "Detection should be enabled!")
-	     while (enable_cycle_detection) {
-	       std::this_thread::sleep_for(cycle_detection_interval)
-	       {
-	         std::unique_lock<std::mutex> l(latch)
-	         continue
-	       }
-	     }
-	*/
+	for {
+		time.Sleep(common.CycleDetectionInterval)
+		lock_manager.mutex.Lock()
+		if !lock_manager.enable_cycle_detection {
+			lock_manager.mutex.Unlock()
+			return
+		}
+
+		waiting := lock_manager.buildWaitsForGraph()
+		var victim types.TxnID
+		for lock_manager.HasCycle(&victim) {
+			// the newest transaction in the cycle is aborted and wakes up in waitForGrant
+			queue := waiting[victim]
+			for _, req := range queue.request_queue {
+				if req.txn_id == victim && !req.granted {
+					req.txn.SetState(ABORTED)
+				}
+			}
+			queue.cv.Broadcast()
+			delete(lock_manager.waits_for, victim)
+			for _, t := range lock_manager.sortedNodes() {
+				lock_manager.RemoveEdge(t, victim)
+			}
+		}
+		lock_manager.waits_for = make(map[types.TxnID][]types.TxnID)
+		lock_manager.mutex.Unlock()
+	}
 }
@@ -0,0 +1,341 @@
+package access
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ryogrid/SamehadaDB/common"
+	"github.com/ryogrid/SamehadaDB/storage/page"
+	"github.com/ryogrid/SamehadaDB/storage/tuple"
+	testingpkg "github.com/ryogrid/SamehadaDB/testing"
+	"github.com/ryogrid/SamehadaDB/types"
+)
+
+func TestLockManagerBlocksUntilUnlock(t *testing.T) {
+	lock_manager := NewLockManager(STRICT, SS2PL_MODE)
+	txn1 := NewTransaction(types.TxnID(1))
+	txn2 := NewTransaction(types.TxnID(2))
+	rid := &page.RID{}
+	rid.Set(types.PageID(0), 0)
+
+	testingpkg.Ok(t, lock_manager.LockExclusive(txn1, rid))
+
+	ch := make(chan error)
+	go func() {
+		ch <- lock_manager.LockShared(txn2, rid)
+	}()
+	select {
+	case <-ch:
+		t.Fatal("shared lock is granted while exclusive lock is held")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	lock_manager.Unlock(txn1, txn1.GetExclusiveLockSet())
+	testingpkg.Ok(t, <-ch)
+	testingpkg.Assert(t, txn2.IsSharedLocked(rid), "shared lock is not recorded")
+}
+
+func TestLockManagerWaitTimeout(t *testing.T) {
+	lock_manager := NewLockManager(STRICT, SS2PL_MODE)
+	lock_manager.SetLockWaitTimeout(50 * time.Millisecond)
+	txn1 := NewTransaction(types.TxnID(1))
+	txn2 := NewTransaction(types.TxnID(2))
+	rid := &page.RID{}
+	rid.Set(types.PageID(0), 0)
+
+	testingpkg.Ok(t, lock_manager.LockShared(txn1, rid))
+	testingpkg.Equals(t, ErrLockWaitTimeout, lock_manager.LockExclusive(txn2, rid))
+	testingpkg.Assert(t, !txn2.IsExclusiveLocked(rid), "timed out lock is recorded")
+
+	// timed out request does not remain in the queue
+	lock_manager.Unlock(txn1, txn1.GetSharedLockSet())
+	testingpkg.Ok(t, lock_manager.LockExclusive(txn2, rid))
+}
+
+func TestLockManagerUpgradeHasPriority(t *testing.T) {
+	lock_manager := NewLockManager(STRICT, SS2PL_MODE)
+	txn1 := NewTransaction(types.TxnID(1))
+	txn2 := NewTransaction(types.TxnID(2))
+	txn3 := NewTransaction(types.TxnID(3))
+	rid := &page.RID{}
+	rid.Set(types.PageID(0), 0)
+
+	testingpkg.Ok(t, lock_manager.LockShared(txn1, rid))
+	testingpkg.Ok(t, lock_manager.LockShared(txn2, rid))
+
+	granted := make(chan types.TxnID, 2)
+	go func() {
+		testingpkg.Ok(t, lock_manager.LockExclusive(txn3, rid))
+		granted <- txn3.GetTransactionId()
+		lock_manager.Unlock(txn3, txn3.GetExclusiveLockSet())
+	}()
+	time.Sleep(50 * time.Millisecond)
+	go func() {
+		// placed before the waiting request of txn3
+		testingpkg.Ok(t, lock_manager.LockUpgrade(txn1, rid))
+		granted <- txn1.GetTransactionId()
+		lock_manager.Unlock(txn1, txn1.GetExclusiveLockSet())
+	}()
+	time.Sleep(50 * time.Millisecond)
+
+	lock_manager.Unlock(txn2, txn2.GetSharedLockSet())
+	testingpkg.Equals(t, types.TxnID(1), <-granted)
+	testingpkg.Equals(t, types.TxnID(3), <-granted)
+}
+
+func TestWaitsForGraph(t *testing.T) {
+	lock_manager := NewLockManager(STRICT, SS2PL_MODE)
+	lock_manager.AddEdge(types.TxnID(1), types.TxnID(2))
+	lock_manager.AddEdge(types.TxnID(2), types.TxnID(3))
+	var victim types.TxnID
+	testingpkg.Assert(t, !lock_manager.HasCycle(&victim), "graph has no cycle")
+
+	lock_manager.AddEdge(types.TxnID(3), types.TxnID(1))
+	testingpkg.Equals(t, 3, len(lock_manager.GetEdgeList()))
+	testingpkg.Assert(t, lock_manager.HasCycle(&victim), "cycle is not found")
+	testingpkg.Equals(t, types.TxnID(3), victim)
+
+	lock_manager.RemoveEdge(types.TxnID(3), types.TxnID(1))
+	testingpkg.Assert(t, !lock_manager.HasCycle(&victim), "removed edge remains")
+	testingpkg.Equals(t, [][2]types.TxnID{{1, 2}, {2, 3}}, lock_manager.GetEdgeList())
+}
+
+func TestDeadlockDetection(t *testing.T) {
+	lock_manager := NewLockManager(STRICT, DETECTION)
+	defer lock_manager.StopCycleDetection()
+	txn1 := NewTransaction(types.TxnID(1))
+	txn2 := NewTransaction(types.TxnID(2))
+	rid1 := &page.RID{}
+	rid1.Set(types.PageID(0), 0)
+	rid2 := &page.RID{}
+	rid2.Set(types.PageID(0), 1)
+
+	testingpkg.Ok(t, lock_manager.LockExclusive(txn1, rid1))
+	testingpkg.Ok(t, lock_manager.LockExclusive(txn2, rid2))
+
+	ch := make(chan error)
+	go func() {
+		ch <- lock_manager.LockExclusive(txn1, rid2)
+	}()
+	time.Sleep(50 * time.Millisecond)
+
+	// txn2 is newer than txn1, so it is chosen as victim
+	testingpkg.Equals(t, ErrDeadlock, lock_manager.LockExclusive(txn2, rid1))
+	testingpkg.Equals(t, ABORTED, txn2.GetState())
+
+	lock_manager.Unlock(txn2, txn2.GetExclusiveLockSet())
+	testingpkg.Ok(t, <-ch)
+	testingpkg.Assert(t, txn1.GetState() != ABORTED, "older transaction is aborted")
+}
+
+func TestWaitDie(t *testing.T) {
+	lock_manager := NewLockManager(STRICT, WAIT_DIE)
+	txn1 := NewTransaction(types.TxnID(1))
+	txn2 := NewTransaction(types.TxnID(2))
+	rid1 := &page.RID{}
+	rid1.Set(types.PageID(0), 0)
+	rid2 := &page.RID{}
+	rid2.Set(types.PageID(0), 1)
+
+	testingpkg.Ok(t, lock_manager.LockExclusive(txn1, rid1))
+	testingpkg.Ok(t, lock_manager.LockShared(txn2, rid2))
+
+	// younger transaction dies
+	testingpkg.Equals(t, ErrDeadlock, lock_manager.LockShared(txn2, rid1))
+	testingpkg.Equals(t, ABORTED, txn2.GetState())
+
+	// older transaction waits
+	ch := make(chan error)
+	go func() {
+		ch <- lock_manager.LockExclusive(txn1, rid2)
+	}()
+	time.Sleep(50 * time.Millisecond)
+	lock_manager.Unlock(txn2, txn2.GetSharedLockSet())
+	testingpkg.Ok(t, <-ch)
+	testingpkg.Assert(t, txn1.GetState() != ABORTED, "older transaction is aborted")
+}
+
+func TestWoundWait(t *testing.T) {
+	lock_manager := NewLockManager(STRICT, WOUND_WAIT)
+	lock_manager.SetLockWaitTimeout(50 * time.Millisecond)
+	txn1 := NewTransaction(types.TxnID(1))
+	txn2 := NewTransaction(types.TxnID(2))
+	rid1 := &page.RID{}
+	rid1.Set(types.PageID(0), 0)
+	rid2 := &page.RID{}
+	rid2.Set(types.PageID(0), 1)
+
+	testingpkg.Ok(t, lock_manager.LockExclusive(txn1, rid1))
+	testingpkg.Ok(t, lock_manager.LockExclusive(txn2, rid2))
+
+	// younger transaction waits
+	testingpkg.Equals(t, ErrLockWaitTimeout, lock_manager.LockShared(txn2, rid1))
+	testingpkg.Assert(t, txn2.GetState() != ABORTED, "younger transaction is aborted on wait")
+
+	// older transaction wounds younger holder and waits for its abort
+	ch := make(chan error)
+	go func() {
+		ch <- lock_manager.LockExclusive(txn1, rid2)
+	}()
+	time.Sleep(20 * time.Millisecond)
+	lock_manager.Unlock(txn2, txn2.GetExclusiveLockSet())
+	testingpkg.Ok(t, <-ch)
+	testingpkg.Equals(t, ABORTED, txn2.GetState())
+
+	// committing holder is not wounded. older transaction waits for release of its locks
+	txn3 := NewTransaction(types.TxnID(3))
+	rid3 := &page.RID{}
+	rid3.Set(types.PageID(0), 2)
+	testingpkg.Ok(t, lock_manager.LockExclusive(txn3, rid3))
+	txn3.SetState(COMMITTED)
+	go func() {
+		ch <- lock_manager.LockShared(txn1, rid3)
+	}()
+	time.Sleep(20 * time.Millisecond)
+	testingpkg.Equals(t, COMMITTED, txn3.GetState())
+	lock_manager.Unlock(txn3, txn3.GetExclusiveLockSet())
+	testingpkg.Ok(t, <-ch)
+}
+
+func TestLockCompatibility(t *testing.T) {
+	modes := []LockMode{INTENTION_SHARED, INTENTION_EXCLUSIVE, SHARED, SHARED_INTENTION_EXCLUSIVE, EXCLUSIVE}
+	expected := [][]bool{
+		{true, true, true, true, false},
+		{true, true, false, false, false},
+		{true, false, true, false, false},
+		{true, false, false, false, false},
+		{false, false, false, false, false},
+	}
+	for ii, mode1 := range modes {
+		for jj, mode2 := range modes {
+			testingpkg.Equals(t, expected[ii][jj], isCompatible(mode1, mode2))
+		}
+	}
+	testingpkg.Equals(t, SHARED_INTENTION_EXCLUSIVE, upgradedMode(SHARED, INTENTION_EXCLUSIVE))
+	testingpkg.Equals(t, EXCLUSIVE, upgradedMode(INTENTION_EXCLUSIVE, EXCLUSIVE))
+	testingpkg.Equals(t, SHARED, upgradedMode(SHARED, INTENTION_SHARED))
+}
+
+func TestLockRowTakesIntentionLock(t *testing.T) {
+	lock_manager := NewLockManager(STRICT, SS2PL_MODE)
+	lock_manager.SetLockWaitTimeout(50 * time.Millisecond)
+	txn1 := NewTransaction(types.TxnID(1))
+	txn2 := NewTransaction(types.TxnID(2))
+	txn3 := NewTransaction(types.TxnID(3))
+	rid1 := &page.RID{}
+	rid1.Set(types.PageID(0), 0)
+	rid2 := &page.RID{}
+	rid2.Set(types.PageID(0), 1)
+
+	testingpkg.Ok(t, lock_manager.LockRow(txn1, 1, rid1, EXCLUSIVE))
+	mode, _ := txn1.GetTableLockMode(1)
+	testingpkg.Equals(t, INTENTION_EXCLUSIVE, mode)
+	testingpkg.Ok(t, lock_manager.LockRow(txn2, 1, rid2, SHARED))
+	mode, _ = txn2.GetTableLockMode(1)
+	testingpkg.Equals(t, INTENTION_SHARED, mode)
+
+	// DDL waits for writers and readers of the table
+	testingpkg.Equals(t, ErrLockWaitTimeout, lock_manager.LockTable(txn3, 1, EXCLUSIVE))
+	testingpkg.Equals(t, ErrLockWaitTimeout, lock_manager.LockTable(txn3, 1, SHARED))
+	lock_manager.Unlock(txn1, txn1.GetExclusiveLockSet())
+	lock_manager.UnlockTables(txn1, txn1.GetTableLockSet())
+	testingpkg.Ok(t, lock_manager.LockTable(txn3, 1, SHARED))
+
+	// S and IX of the same transaction is upgraded to SIX
+	testingpkg.Ok(t, lock_manager.LockRow(txn3, 1, rid1, EXCLUSIVE))
+	mode, _ = txn3.GetTableLockMode(1)
+	testingpkg.Equals(t, SHARED_INTENTION_EXCLUSIVE, mode)
+	// reading rows is covered by SIX
+	testingpkg.Ok(t, lock_manager.LockRow(txn3, 1, rid2, SHARED))
+	testingpkg.Assert(t, !txn3.IsSharedLocked(rid2), "row lock is acquired under table lock")
+}
+
+func TestLockEscalation(t *testing.T) {
+	lock_manager := NewLockManager(STRICT, SS2PL_MODE)
+	lock_manager.SetLockEscalationThreshold(2)
+	lock_manager.SetLockWaitTimeout(50 * time.Millisecond)
+	txn1 := NewTransaction(types.TxnID(1))
+	txn2 := NewTransaction(types.TxnID(2))
+
+	rids := make([]*page.RID, 4)
+	for ii := range rids {
+		rids[ii] = &page.RID{}
+		rids[ii].Set(types.PageID(0), uint32(ii))
+	}
+	for ii := 0; ii < 3; ii++ {
+		testingpkg.Ok(t, lock_manager.LockRow(txn1, 1, rids[ii], SHARED))
+	}
+	mode, _ := txn1.GetTableLockMode(1)
+	testingpkg.Equals(t, SHARED, mode)
+
+	// rows are not locked after escalation
+	testingpkg.Ok(t, lock_manager.LockRow(txn1, 1, rids[3], SHARED))
+	testingpkg.Assert(t, !txn1.IsSharedLocked(rids[3]), "row lock is acquired after escalation")
+	testingpkg.Equals(t, ErrLockWaitTimeout, lock_manager.LockRow(txn2, 1, rids[3], EXCLUSIVE))
+
+	// escalation is given up when other transaction holds conflicting lock
+	testingpkg.Ok(t, lock_manager.LockRow(txn2, 2, rids[0], SHARED))
+	for ii := 0; ii < 3; ii++ {
+		testingpkg.Ok(t, lock_manager.LockRow(txn1, 2, rids[ii+1], EXCLUSIVE))
+	}
+	mode, _ = txn1.GetTableLockMode(2)
+	testingpkg.Equals(t, INTENTION_EXCLUSIVE, mode)
+}
+
+func TestPredicateLock(t *testing.T) {
+	defer func(enabled bool) { common.EnableLogging = enabled }(common.EnableLogging)
+	common.EnableLogging = true
+	lock_manager := NewLockManager(STRICT, SS2PL_MODE)
+	lock_manager.SetLockWaitTimeout(50 * time.Millisecond)
+	txn1 := NewTransaction(types.TxnID(1))
+	txn2 := NewTransaction(types.TxnID(2))
+	matched := tuple.NewTuple(nil, 1, []byte{1})
+	unmatched := tuple.NewTuple(nil, 1, []byte{0})
+	predicate := func(tuple_ *tuple.Tuple) bool { return tuple_.Data()[0] == 1 }
+
+	testingpkg.Ok(t, lock_manager.LockPredicate(txn1, 1, predicate))
+	testingpkg.Ok(t, lock_manager.LockInsertion(txn2, 1, unmatched))
+	testingpkg.Ok(t, lock_manager.LockInsertion(txn2, 2, matched))
+	testingpkg.Equals(t, ErrLockWaitTimeout, lock_manager.LockInsertion(txn2, 1, matched))
+
+	ch := make(chan error)
+	go func() {
+		ch <- lock_manager.LockInsertion(txn2, 1, matched)
+	}()
+	time.Sleep(20 * time.Millisecond)
+	// repeated scan of the reader doesn't wait for the waiting writer
+	testingpkg.Ok(t, lock_manager.LockPredicate(txn1, 1, predicate))
+	lock_manager.UnlockPredicates(txn1)
+	testingpkg.Ok(t, <-ch)
+
+	// reader waits for the writer of matching tuple
+	testingpkg.Equals(t, ErrLockWaitTimeout, lock_manager.LockPredicate(txn1, 1, predicate))
+	lock_manager.UnlockPredicates(txn2)
+	testingpkg.Ok(t, lock_manager.LockPredicate(txn1, 1, predicate))
+}
+
+func TestInsertionLocksAreCoalesced(t *testing.T) {
+	defer func(enabled bool) { common.EnableLogging = enabled }(common.EnableLogging)
+	common.EnableLogging = true
+	lock_manager := NewLockManager(STRICT, SS2PL_MODE)
+	lock_manager.SetLockWaitTimeout(50 * time.Millisecond)
+	txn1 := NewTransaction(types.TxnID(1))
+	txn2 := NewTransaction(types.TxnID(2))
+	predicate := func(tuple_ *tuple.Tuple) bool { return tuple_.Data()[0] == 99 }
+
+	for ii := 0; ii < 100; ii++ {
+		testingpkg.Ok(t, lock_manager.LockInsertion(txn2, 1, tuple.NewTuple(nil, 1, []byte{byte(ii)})))
+	}
+	// written tuples are kept in one request
+	testingpkg.Equals(t, 1, len(lock_manager.predicate_lock_table[1].request_queue))
+	testingpkg.Equals(t, 100, len(lock_manager.predicate_lock_table[1].request_queue[0].tuples))
+	testingpkg.Equals(t, ErrLockWaitTimeout, lock_manager.LockPredicate(txn1, 1, predicate))
+
+	lock_manager.UnlockPredicates(txn2)
+	testingpkg.Ok(t, lock_manager.LockPredicate(txn1, 1, predicate))
+
+	// locks are not acquired without logging
+	common.EnableLogging = false
+	testingpkg.Ok(t, lock_manager.LockInsertion(txn2, 1, tuple.NewTuple(nil, 1, []byte{99})))
+	testingpkg.Equals(t, 1, len(lock_manager.predicate_lock_table[1].request_queue))
+}
@@ -0,0 +1,139 @@
+package access
+
+import (
+	"github.com/ryogrid/SamehadaDB/common"
+	"github.com/ryogrid/SamehadaDB/storage/tuple"
+	"github.com/ryogrid/SamehadaDB/types"
+)
+
+// Predicate returns true when the tuple is in the set of rows read by a scan
+type Predicate func(tuple_ *tuple.Tuple) bool
+
+// predicate locks prevent phantoms. row locks protect only rows which exist when they are read,
+// so a scan locks its condition with LockPredicate and writers lock new values of rows with LockInsertion.
+// they conflict when the written tuple matches the predicate, then later one waits like other locks
+// (it times out and takes part in deadlock detection and prevention).
+// both are held until the transaction finishes because a reader must not miss a row which
+// is written by uncommitted transaction at a position it has already passed.
+// tuples written by a transaction are kept in one request per table, so the queue doesn't grow with
+// number of written rows. both locks are acquired only when logging is enabled like exclusive row locks,
+// because readers and writers are not isolated without them.
+// note: no lock is needed when the transaction holds SHARED or EXCLUSIVE lock on the table
+
+// conflictsOnPredicate returns true when one of r and req is predicate lock and the other
+// is lock on the tuple which matches the predicate.
+// waiting requests are passed because a transaction repeating a scan must not wait for
+// the writer which waits for its first scan
+func conflictsOnPredicate(r *LockRequest, req *LockRequest) bool {
+	if !r.granted {
+		return false
+	}
+	if r.predicate != nil && req.tuples != nil {
+		return matchesAny(r.predicate, req.tuples)
+	}
+	if r.tuples != nil && req.predicate != nil {
+		return matchesAny(req.predicate, r.tuples)
+	}
+	return false
+}
+
+func matchesAny(predicate Predicate, tuples []*tuple.Tuple) bool {
+	for _, tuple_ := range tuples {
+		if predicate(tuple_) {
+			return true
+		}
+	}
+	return false
+}
+
+// insertionRequestOf returns granted request holding tuples written by the transaction other than req
+func (queue *LockRequestQueue) insertionRequestOf(txn_id types.TxnID, req *LockRequest) *LockRequest {
+	for _, r := range queue.request_queue {
+		if r != req && r.txn_id == txn_id && r.granted && r.tuples != nil {
+			return r
+		}
+	}
+	return nil
+}
+
+func (lock_manager *LockManager) getPredicateQueue(oid uint32) *LockRequestQueue {
+	queue, ok := lock_manager.predicate_lock_table[oid]
+	if !ok {
+		queue = newLockRequestQueue(lock_manager.mutex)
+		lock_manager.predicate_lock_table[oid] = queue
+	}
+	return queue
+}
+
+/**
+* Acquire a lock on rows of the table which match the predicate, including rows inserted later.
+* it waits for transactions which wrote matching tuples.
+* @param txn the transaction requesting the lock
+* @param oid the OID of the table which is scanned
+* @param predicate condition of the scan
+* @return nil if the lock is granted, error otherwise
+ */
+func (lock_manager *LockManager) LockPredicate(txn *Transaction, oid uint32, predicate Predicate) error {
+	if !common.EnableLogging {
+		return nil
+	}
+	lock_manager.mutex.Lock()
+	defer lock_manager.mutex.Unlock()
+	if held, ok := txn.GetTableLockMode(oid); ok && covers(held, SHARED) {
+		return nil
+	}
+	req := NewLockRequest(txn, SHARED)
+	req.predicate = predicate
+	queue := lock_manager.getPredicateQueue(oid)
+	queue.request_queue = append(queue.request_queue, req)
+	return lock_manager.waitForGrant(queue, req, true)
+}
+
+/**
+* Acquire a lock on values of the tuple which is inserted to the table or is new version of updated row.
+* it waits for transactions which hold predicate locks matching the tuple.
+* @param txn the transaction requesting the lock
+* @param oid the OID of the table which is written
+* @param tuple_ the tuple to be written
+* @return nil if the lock is granted, error otherwise
+ */
+func (lock_manager *LockManager) LockInsertion(txn *Transaction, oid uint32, tuple_ *tuple.Tuple) error {
+	if !common.EnableLogging {
+		return nil
+	}
+	lock_manager.mutex.Lock()
+	defer lock_manager.mutex.Unlock()
+	if held, ok := txn.GetTableLockMode(oid); ok && covers(held, EXCLUSIVE) {
+		return nil
+	}
+	req := NewLockRequest(txn, EXCLUSIVE)
+	req.tuples = []*tuple.Tuple{tuple_}
+	queue := lock_manager.getPredicateQueue(oid)
+	queue.request_queue = append(queue.request_queue, req)
+	if err := lock_manager.waitForGrant(queue, req, true); err != nil {
+		return err
+	}
+	// granted tuple is moved to the request which holds tuples written before
+	if held := queue.insertionRequestOf(txn.GetTransactionId(), req); held != nil {
+		held.tuples = append(held.tuples, tuple_)
+		queue.remove(req)
+	}
+	return nil
+}
+
+/**
+* Release predicate locks and locks on written tuples held by the transaction.
+* @param txn the transaction releasing the locks
+ */
+func (lock_manager *LockManager) UnlockPredicates(txn *Transaction) {
+	lock_manager.mutex.Lock()
+	defer lock_manager.mutex.Unlock()
+	for oid, queue := range lock_manager.predicate_lock_table {
+		if queue.removeTxn(txn.GetTransactionId()) {
+			queue.cv.Broadcast()
+		}
+		if len(queue.request_queue) == 0 {
+			delete(lock_manager.predicate_lock_table, oid)
+		}
+	}
+}
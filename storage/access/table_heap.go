@@ -21,6 +21,11 @@ type TableHeap struct {
 	firstPageId  types.PageID
 	log_manager  *recovery.LogManager
 	lock_manager *LockManager
+	// TODO: (SDB) free space map is not persisted. it is rebuilt by scanning all pages of the table at first insertion after open
+	freeSpaceMap *FreeSpaceMap
+	// OID of the table. intention lock on the table is acquired before row locks when it is set
+	oid    uint32
+	hasOID bool
 }
 
 // NewTableHeap creates a table heap without a  (open table)
@@ -30,14 +35,25 @@ func NewTableHeap(bpm *buffer.BufferPoolManager, log_manager *recovery.LogManage
 	firstPage := CastPageAsTablePage(p)
 	firstPage.WLatch()
 	firstPage.Init(p.ID(), types.InvalidPageID, log_manager, lock_manager, txn)
+	freeSpace := firstPage.getFreeSpaceRemaining()
 	firstPage.WUnlatch()
 	bpm.UnpinPage(p.ID(), true)
-	return &TableHeap{bpm, p.ID(), log_manager, lock_manager}
+
+	freeSpaceMap := NewFreeSpaceMap()
+	freeSpaceMap.Update(p.ID(), freeSpace)
+	freeSpaceMap.markBuilt()
+	return &TableHeap{bpm, p.ID(), log_manager, lock_manager, freeSpaceMap, 0, false}
 }
 
 // InitTableHeap ...
 func InitTableHeap(bpm *buffer.BufferPoolManager, pageId types.PageID, log_manager *recovery.LogManager, lock_manager *LockManager) *TableHeap {
-	return &TableHeap{bpm, pageId, log_manager, lock_manager}
+	return &TableHeap{bpm, pageId, log_manager, lock_manager, NewFreeSpaceMap(), 0, false}
+}
+
+// SetOID makes row locks of the table heap acquired with intention lock on the table of the OID
+func (t *TableHeap) SetOID(oid uint32) {
+	t.oid = oid
+	t.hasOID = true
 }
 
 // GetFirstPageId returns firstPageId
@@ -48,21 +64,55 @@ func (t *TableHeap) GetFirstPageId() types.PageID {
 // InsertTuple inserts a tuple into the table
 // PAY ATTENTION: index entry is not inserted
 //
-// It fetches the first page and tries to insert the tuple there.
-// If the tuple is too large (>= page_size):
-// 1. It tries to insert in the next page
+// It looks up a page which has enough space with the free space map and tries to insert the tuple there.
+// If no page has enough space:
+// 1. It tries to insert in the last page and the pages following it
 // 2. If there is no next page, it creates a new page and insert in it
 func (t *TableHeap) InsertTuple(tuple_ *tuple.Tuple, txn *Transaction) (rid *page.RID, err error) {
-	currentPage := CastPageAsTablePage(t.bpm.FetchPage(t.firstPageId))
+	lock_manager, err := t.lockTableForInsert(txn)
+	if err != nil {
+		return nil, err
+	}
+	freeSpaceMap := t.getFreeSpaceMap()
+	requiredSpace := tuple_.Size() + sizeTuple
+	for pageId := freeSpaceMap.FindPage(requiredSpace); pageId.IsValid(); pageId = freeSpaceMap.FindPage(requiredSpace) {
+		page_ := CastPageAsTablePage(t.bpm.FetchPage(pageId))
+		if page_ == nil {
+			break
+		}
+		page_.WLatch()
+		rid, err = page_.InsertTuple(tuple_, t.log_manager, lock_manager, txn)
+		freeSpace := page_.getFreeSpaceRemaining()
+		page_.WUnlatch()
+		t.bpm.UnpinPage(pageId, err == nil)
+		// recorded free space may be stale. the correct value is recorded before retrying
+		freeSpaceMap.Update(pageId, freeSpace)
+		if err == nil {
+			t.onRowInserted(lock_manager, txn)
+			txn.AddIntoWriteSet(NewWriteRecord(*rid, INSERT, new(tuple.Tuple), t))
+			return rid, nil
+		}
+		if err != ErrNotEnoughSpace {
+			return nil, err
+		}
+	}
+
+	lastPageId := freeSpaceMap.GetLastPageId()
+	if !lastPageId.IsValid() {
+		lastPageId = t.firstPageId
+	}
+	currentPage := CastPageAsTablePage(t.bpm.FetchPage(lastPageId))
 
 	// Insert into the first page with enough space. If no such page exists, create a new page and insert into that.
 	// INVARIANT: currentPage is WLatched if you leave the loop normally.
 
 	for {
 		currentPage.WLatch()
-		rid, err = currentPage.InsertTuple(tuple_, t.log_manager, t.lock_manager, txn)
+		rid, err = currentPage.InsertTuple(tuple_, t.log_manager, lock_manager, txn)
+		freeSpace := currentPage.getFreeSpaceRemaining()
 		if err == nil || err == ErrEmptyTuple {
 			currentPage.WUnlatch()
+			freeSpaceMap.Update(currentPage.GetTablePageId(), freeSpace)
 			break
 		}
 		if rid == nil && err != nil && err != ErrEmptyTuple && err != ErrNotEnoughSpace {
@@ -74,6 +124,7 @@ func (t *TableHeap) InsertTuple(tuple_ *tuple.Tuple, txn *Transaction) (rid *pag
 		if nextPageId.IsValid() {
 			t.bpm.UnpinPage(currentPage.GetTablePageId(), false)
 			currentPage.WUnlatch()
+			freeSpaceMap.Update(currentPage.GetTablePageId(), freeSpace)
 			currentPage = CastPageAsTablePage(t.bpm.FetchPage(nextPageId))
 			//currentPage.WLatch()
 		} else {
@@ -87,20 +138,57 @@ func (t *TableHeap) InsertTuple(tuple_ *tuple.Tuple, txn *Transaction) (rid *pag
 			newPage.Init(p.ID(), currentPage.GetTablePageId(), t.log_manager, t.lock_manager, txn)
 			t.bpm.UnpinPage(currentPage.GetTablePageId(), true)
 			currentPage.RUnlatch()
+			freeSpaceMap.Update(currentPage.GetTablePageId(), freeSpace)
 			currentPage = newPage
 		}
 	}
 	//currentPage.WUnlatch()
 
 	t.bpm.UnpinPage(currentPage.GetTablePageId(), true)
+	t.onRowInserted(lock_manager, txn)
 	// Update the transaction's write set.
 	txn.AddIntoWriteSet(NewWriteRecord(*rid, INSERT, new(tuple.Tuple), t))
 	return rid, nil
 }
 
+// lockTableForInsert acquires intention lock on the table for inserting a row and returns
+// lock manager which is passed to the page for locking the new row.
+// nil is returned when the table lock held by txn covers the row lock
+func (t *TableHeap) lockTableForInsert(txn *Transaction) (*LockManager, error) {
+	if !common.EnableLogging || !t.hasOID {
+		return t.lock_manager, nil
+	}
+	covered, err := t.lock_manager.lockTableForRow(txn, t.oid, EXCLUSIVE)
+	if err != nil {
+		txn.SetState(ABORTED)
+		return nil, err
+	}
+	if covered {
+		return nil, nil
+	}
+	return t.lock_manager, nil
+}
+
+// onRowInserted counts the lock on the inserted row for lock escalation
+func (t *TableHeap) onRowInserted(lock_manager *LockManager, txn *Transaction) {
+	if common.EnableLogging && t.hasOID && lock_manager != nil {
+		lock_manager.onRowLocked(txn, t.oid)
+	}
+}
+
+// getFreeSpaceMap returns free space map of the table heap.
+// the map is built at first call when the table heap is opened with InitTableHeap
+func (t *TableHeap) getFreeSpaceMap() *FreeSpaceMap {
+	t.freeSpaceMap.build(t.bpm, t.firstPageId)
+	return t.freeSpaceMap
+}
+
 // if specified nil to update_col_idxs and schema_, all data of existed tuple is replaced one of new_tuple
 // if specified not nil, new_tuple also should have all columns defined in schema. but not update target value can be dummy value
 func (t *TableHeap) UpdateTuple(tuple_ *tuple.Tuple, update_col_idxs []int, schema_ *schema.Schema, rid page.RID, txn *Transaction) (bool, *page.RID) {
+	if !t.lockExclusive(&rid, txn) {
+		return false, nil
+	}
 	// Find the page which contains the tuple.
 	page_ := CastPageAsTablePage(t.bpm.FetchPage(rid.GetPageId()))
 	// If the page could not be found, then abort the transaction.
@@ -113,9 +201,12 @@ func (t *TableHeap) UpdateTuple(tuple_ *tuple.Tuple, update_col_idxs []int, sche
 	old_tuple.SetRID(new(page.RID))
 
 	page_.WLatch()
-	is_updated, err, need_follow_tuple := page_.UpdateTuple(tuple_, update_col_idxs, schema_, old_tuple, &rid, txn, t.lock_manager, t.log_manager)
+	// the row is already locked
+	is_updated, err, need_follow_tuple := page_.UpdateTuple(tuple_, update_col_idxs, schema_, old_tuple, &rid, txn, nil, t.log_manager)
+	freeSpace := page_.getFreeSpaceRemaining()
 	page_.WUnlatch()
 	t.bpm.UnpinPage(page_.GetTablePageId(), is_updated)
+	t.freeSpaceMap.Update(rid.GetPageId(), freeSpace)
 
 	var new_rid *page.RID = nil
 	if is_updated == false && err == ErrNotEnoughSpace {
@@ -151,6 +242,9 @@ func (t *TableHeap) UpdateTuple(tuple_ *tuple.Tuple, update_col_idxs []int, sche
 
 func (t *TableHeap) MarkDelete(rid *page.RID, txn *Transaction) bool {
 	// TODO(Amadou): remove empty page
+	if !t.lockExclusive(rid, txn) {
+		return false
+	}
 	// Find the page which contains the tuple.
 	page_ := CastPageAsTablePage(t.bpm.FetchPage(rid.GetPageId()))
 	// If the page could not be found, then abort the transaction.
@@ -160,7 +254,8 @@ func (t *TableHeap) MarkDelete(rid *page.RID, txn *Transaction) bool {
 	}
 	// Otherwise, mark the tuple as deleted.
 	page_.WLatch()
-	is_marked := page_.MarkDelete(rid, txn, t.lock_manager, t.log_manager)
+	// the row is already locked
+	is_marked := page_.MarkDelete(rid, txn, nil, t.log_manager)
 	page_.WUnlatch()
 	t.bpm.UnpinPage(page_.GetTablePageId(), true)
 	if is_marked {
@@ -171,22 +266,62 @@ func (t *TableHeap) MarkDelete(rid *page.RID, txn *Transaction) bool {
 	return is_marked
 }
 
+// lockExclusive acquires an exclusive lock on the tuple before latching its page,
+// because waiting for the lock with the latch blocks the holder of the lock
+func (t *TableHeap) lockExclusive(rid *page.RID, txn *Transaction) bool {
+	if !common.EnableLogging || txn.IsExclusiveLocked(rid) {
+		return true
+	}
+	return t.lockRow(rid, EXCLUSIVE, txn)
+}
+
+// lockRow acquires a lock on the row. intention lock on the table is acquired together when OID is set
+func (t *TableHeap) lockRow(rid *page.RID, lock_mode LockMode, txn *Transaction) bool {
+	var err error
+	if t.hasOID {
+		err = t.lock_manager.LockRow(txn, t.oid, rid, lock_mode)
+	} else if lock_mode == SHARED {
+		err = t.lock_manager.LockShared(txn, rid)
+	} else {
+		err = t.lock_manager.LockExclusive(txn, rid)
+	}
+	if err != nil {
+		txn.SetState(ABORTED)
+		return false
+	}
+	return true
+}
+
+// isExclusiveLocked returns true when txn holds exclusive lock on the row or on the table.
+// it is always true when logging is disabled because locks are not acquired
+func (t *TableHeap) isExclusiveLocked(rid *page.RID, txn *Transaction) bool {
+	if !common.EnableLogging || txn.IsExclusiveLocked(rid) {
+		return true
+	}
+	mode, ok := txn.GetTableLockMode(t.oid)
+	return t.hasOID && ok && mode == EXCLUSIVE
+}
+
 func (t *TableHeap) ApplyDelete(rid *page.RID, txn *Transaction) {
 	// Find the page which contains the tuple.
 	page_ := CastPageAsTablePage(t.bpm.FetchPage(rid.GetPageId()))
 	common.SH_Assert(page_ != nil, "Couldn't find a page containing that RID.")
+	common.SH_Assert(t.isExclusiveLocked(rid, txn), "We must own the exclusive lock!")
 	// Delete the tuple from the page.
 	page_.WLatch()
 	page_.ApplyDelete(rid, txn, t.log_manager)
 	//t.lock_manager.Unlock(txn, []page.RID{*rid})
+	freeSpace := page_.getFreeSpaceRemaining()
 	page_.WUnlatch()
 	t.bpm.UnpinPage(page_.GetTablePageId(), true)
+	t.freeSpaceMap.Update(rid.GetPageId(), freeSpace)
 }
 
 func (t *TableHeap) RollbackDelete(rid *page.RID, txn *Transaction) {
 	// Find the page which contains the tuple.
 	page_ := CastPageAsTablePage(t.bpm.FetchPage(rid.GetPageId()))
 	common.SH_Assert(page_ != nil, "Couldn't find a page containing that RID.")
+	common.SH_Assert(t.isExclusiveLocked(rid, txn), "We must own an exclusive lock on the RID.")
 	// Rollback the delete.
 	page_.WLatch()
 	page_.RollbackDelete(rid, txn, t.log_manager)
@@ -196,18 +331,35 @@ func (t *TableHeap) RollbackDelete(rid *page.RID, txn *Transaction) {
 
 // GetTuple reads a tuple from the table
 func (t *TableHeap) GetTuple(rid *page.RID, txn *Transaction) *tuple.Tuple {
-	if !txn.IsSharedLocked(rid) && !txn.IsExclusiveLocked(rid) && !t.lock_manager.LockShared(txn, rid) {
-		txn.SetState(ABORTED)
+	if !txn.IsSharedLocked(rid) && !txn.IsExclusiveLocked(rid) && !t.lockRow(rid, SHARED, txn) {
 		return nil
 	}
 	page := CastPageAsTablePage(t.bpm.FetchPage(rid.GetPageId()))
 	defer t.bpm.UnpinPage(page.ID(), false)
 	page.RLatch()
-	ret := page.GetTuple(rid, t.log_manager, t.lock_manager, txn)
+	// the row is already locked
+	ret := page.GetTuple(rid, t.log_manager, nil, txn)
 	page.RUnlatch()
 	return ret
 }
 
+// GetTupleIfExists is same as GetTuple but nil is returned without aborting the transaction
+// when the tuple is already deleted. it is used for rows found with indexes, because
+// an index may return a row whose insertion was rolled back while waiting for the lock
+func (t *TableHeap) GetTupleIfExists(rid *page.RID, txn *Transaction) *tuple.Tuple {
+	if !txn.IsSharedLocked(rid) && !txn.IsExclusiveLocked(rid) && !t.lockRow(rid, SHARED, txn) {
+		return nil
+	}
+	page := CastPageAsTablePage(t.bpm.FetchPage(rid.GetPageId()))
+	defer t.bpm.UnpinPage(page.ID(), false)
+	page.RLatch()
+	defer page.RUnlatch()
+	if rid.GetSlotNum() >= page.GetTupleCount() || IsDeleted(page.GetTupleSize(rid.GetSlotNum())) {
+		return nil
+	}
+	return page.GetTuple(rid, t.log_manager, nil, txn)
+}
+
 // GetFirstTuple reads the first tuple from the table
 func (t *TableHeap) GetFirstTuple(txn *Transaction) *tuple.Tuple {
 	var rid *page.RID = nil
@@ -230,6 +382,42 @@ func (t *TableHeap) GetFirstTuple(txn *Transaction) *tuple.Tuple {
 	return t.GetTuple(rid, txn)
 }
 
+// Drop releases all pages of the table heap.
+// the table heap must not be used after calling this.
+// when a page can't be released, the rest are released and the first error is returned
+func (t *TableHeap) Drop() error {
+	var ret error
+	pageId := t.firstPageId
+	for pageId.IsValid() {
+		page := CastPageAsTablePage(t.bpm.FetchPage(pageId))
+		nextPageId := page.GetNextPageId()
+		t.bpm.UnpinPage(pageId, false)
+		if err := t.bpm.DeletePage(pageId); err != nil && ret == nil {
+			ret = err
+		}
+		pageId = nextPageId
+	}
+	t.firstPageId = common.InvalidPageID
+	return ret
+}
+
+// GetMaxPageLSN returns the largest LSN of pages of the table heap.
+// InvalidLSN is returned when no page is modified with logging
+func (t *TableHeap) GetMaxPageLSN() types.LSN {
+	ret := types.LSN(common.InvalidLSN)
+	pageId := t.firstPageId
+	for pageId.IsValid() {
+		page := CastPageAsTablePage(t.bpm.FetchPage(pageId))
+		if page.GetLSN() > ret {
+			ret = page.GetLSN()
+		}
+		nextPageId := page.GetNextPageId()
+		t.bpm.UnpinPage(pageId, false)
+		pageId = nextPageId
+	}
+	return ret
+}
+
 // Iterator returns a iterator for this table heap
 func (t *TableHeap) Iterator(txn *Transaction) *TableHeapIterator {
 	return NewTableHeapIterator(t, t.lock_manager, txn)
@@ -161,3 +161,57 @@ func TestTableHeapFourCol(t *testing.T) {
 
 	txn_mgr.Commit(txn)
 }
+
+func TestTableHeapReusesFreeSpace(t *testing.T) {
+	dm := disk.NewDiskManagerTest()
+	defer dm.ShutDown()
+	log_manager := recovery.NewLogManager(&dm)
+	bpm := buffer.NewBufferPoolManager(10, dm, log_manager)
+	lock_manager := NewLockManager(STRICT, SS2PL_MODE)
+	txn_mgr := NewTransactionManager(lock_manager, log_manager)
+	txn := txn_mgr.Begin(nil)
+
+	th := NewTableHeap(bpm, log_manager, lock_manager, txn)
+
+	columnA := column.NewColumn("a", types.Integer, false, nil)
+	columnB := column.NewColumn("b", types.Integer, false, nil)
+	schema_ := schema.NewSchema([]*column.Column{columnA, columnB})
+	newTuple := func(i int) *tuple.Tuple {
+		row := make([]types.Value, 0)
+		row = append(row, types.NewInteger(int32(i*2)))
+		row = append(row, types.NewInteger(int32((i+1)*2)))
+		return tuple.NewTupleFromSchema(row, schema_)
+	}
+
+	// 5 pages are used (226 tuples per page)
+	for i := 0; i < 1000; i++ {
+		_, err := th.InsertTuple(newTuple(i), txn)
+		testingpkg.Ok(t, err)
+	}
+	txn_mgr.Commit(txn)
+
+	// free space of first page is made with deletion
+	txn = txn_mgr.Begin(nil)
+	for i := 0; i < 10; i++ {
+		rid := &page.RID{}
+		rid.Set(types.PageID(0), uint32(i))
+		testingpkg.Assert(t, th.MarkDelete(rid, txn), "MarkDelete failed")
+	}
+	txn_mgr.Commit(txn)
+
+	txn = txn_mgr.Begin(nil)
+	rid, err := th.InsertTuple(newTuple(1000), txn)
+	testingpkg.Ok(t, err)
+	testingpkg.Equals(t, types.PageID(0), rid.GetPageId())
+
+	// free space map is rebuilt from pages when the table heap is opened again
+	reopened := InitTableHeap(bpm, th.GetFirstPageId(), log_manager, lock_manager)
+	rid, err = reopened.InsertTuple(newTuple(1001), txn)
+	testingpkg.Ok(t, err)
+	testingpkg.Equals(t, types.PageID(0), rid.GetPageId())
+	txn_mgr.Commit(txn)
+
+	// no page is appended
+	bpm.FlushAllPages()
+	testingpkg.Equals(t, int64(20480), dm.Size())
+}
@@ -87,12 +87,12 @@ func (tp *TablePage) InsertTuple(tuple *tuple.Tuple, log_manager *recovery.LogMa
 	rid := &page.RID{}
 	rid.Set(tp.GetTablePageId(), slot)
 
-	if common.EnableLogging {
+	if common.EnableLogging && lock_manager != nil {
 		// Acquire an exclusive lock on the new tuple.
-		locked := lock_manager.LockExclusive(txn, rid)
-		if !locked {
+		// lock on reused slot may be held by other transaction. it is not waited because the page is latched
+		if err := lock_manager.tryLockExclusive(txn, rid); err != nil {
 			txn.SetState(ABORTED)
-			return nil, errors.Error("could not acquire an exclusive lock on the new tuple")
+			return nil, err
 			// fmt.Printf("Locking a new tuple should always work. rid: %v\n", rid)
 			// lock_manager.PrintLockTables()
 			// os.Stdout.Sync()
@@ -183,12 +183,13 @@ func (tp *TablePage) UpdateTuple(new_tuple *tuple.Tuple, update_col_idxs []int,
 
 	if common.EnableLogging {
 		// Acquire an exclusive lock, upgrading from shared if necessary.
-		if txn.IsSharedLocked(rid) {
-			if !lock_manager.LockUpgrade(txn, rid) {
+		// lock_manager is nil when the caller already locked the row
+		if lock_manager != nil && txn.IsSharedLocked(rid) {
+			if lock_manager.LockUpgrade(txn, rid) != nil {
 				txn.SetState(ABORTED)
 				return false, nil, nil
 			}
-		} else if !txn.IsExclusiveLocked(rid) && !lock_manager.LockExclusive(txn, rid) {
+		} else if lock_manager != nil && !txn.IsExclusiveLocked(rid) && lock_manager.LockExclusive(txn, rid) != nil {
 			txn.SetState(ABORTED)
 			return false, nil, nil
 		}
@@ -239,12 +240,13 @@ func (tp *TablePage) MarkDelete(rid *page.RID, txn *Transaction, lock_manager *L
 
 	if common.EnableLogging {
 		// Acquire an exclusive lock, upgrading from a shared lock if necessary.
-		if txn.IsSharedLocked(rid) {
-			if !lock_manager.LockUpgrade(txn, rid) {
+		// lock_manager is nil when the caller already locked the row
+		if lock_manager != nil && txn.IsSharedLocked(rid) {
+			if lock_manager.LockUpgrade(txn, rid) != nil {
 				txn.SetState(ABORTED)
 				return false
 			}
-		} else if !txn.IsExclusiveLocked(rid) && !lock_manager.LockExclusive(txn, rid) {
+		} else if lock_manager != nil && !txn.IsExclusiveLocked(rid) && lock_manager.LockExclusive(txn, rid) != nil {
 			txn.SetState(ABORTED)
 			return false
 		}
@@ -284,7 +286,7 @@ func (table_page *TablePage) ApplyDelete(rid *page.RID, txn *Transaction, log_ma
 	//delete_tuple.allocated = true
 
 	if common.EnableLogging {
-		common.SH_Assert(txn.IsExclusiveLocked(rid), "We must own the exclusive lock!")
+		// exclusive lock is checked by TableHeap because it may be held on the table instead of the row
 		log_record := recovery.NewLogRecordInsertDelete(txn.GetTransactionId(), txn.GetPrevLSN(), recovery.APPLYDELETE, *rid, delete_tuple)
 		lsn := log_manager.AppendLogRecord(log_record)
 		table_page.SetLSN(lsn)
@@ -315,7 +317,7 @@ func (table_page *TablePage) ApplyDelete(rid *page.RID, txn *Transaction, log_ma
 func (tp *TablePage) RollbackDelete(rid *page.RID, txn *Transaction, log_manager *recovery.LogManager) {
 	// Log the rollback.
 	if common.EnableLogging {
-		common.SH_Assert(txn.IsExclusiveLocked(rid), "We must own an exclusive lock on the RID.")
+		// exclusive lock is checked by TableHeap because it may be held on the table instead of the row
 		dummy_tuple := new(tuple.Tuple)
 		log_record := recovery.NewLogRecordInsertDelete(txn.GetTransactionId(), txn.GetPrevLSN(), recovery.ROLLBACKDELETE, *rid, dummy_tuple)
 		lsn := log_manager.AppendLogRecord(log_record)
@@ -445,8 +447,9 @@ func (tp *TablePage) GetTuple(rid *page.RID, log_manager *recovery.LogManager, l
 	}
 
 	// Otherwise we have a valid tuple, try to acquire at least a shared access.
-	if common.EnableLogging {
-		if !txn.IsSharedLocked(rid) && !txn.IsExclusiveLocked(rid) && !lock_manager.LockShared(txn, rid) {
+	// lock_manager is nil when the caller already locked the row
+	if common.EnableLogging && lock_manager != nil {
+		if !txn.IsSharedLocked(rid) && !txn.IsExclusiveLocked(rid) && lock_manager.LockShared(txn, rid) != nil {
 			txn.SetState(ABORTED)
 			return nil
 		}
@@ -464,7 +467,7 @@ func (tp *TablePage) GetTupleFirstRID() *page.RID {
 	// Find and return the first valid tuple.
 	tupleCount := tp.GetTupleCount()
 	for ii := uint32(0); ii < tupleCount; ii++ {
-		if tp.GetTupleSize(ii) > 0 {
+		if !IsDeleted(tp.GetTupleSize(ii)) {
 			firstRID.Set(tp.GetTablePageId(), ii)
 			return firstRID
 		}
@@ -483,7 +486,7 @@ func (tp *TablePage) GetNextTupleRID(curRID *page.RID, isNextPage bool) *page.RI
 		init_val = uint32(curRID.GetSlotNum() + 1)
 	}
 	for ii := init_val; ii < tupleCount; ii++ {
-		if tp.GetTupleSize(ii) > 0 {
+		if !IsDeleted(tp.GetTupleSize(ii)) {
 			nextRID.Set(tp.GetTablePageId(), ii)
 			return nextRID
 		}
@@ -3,6 +3,8 @@
 package access
 
 import (
+	"sync/atomic"
+
 	"github.com/ryogrid/SamehadaDB/common"
 	"github.com/ryogrid/SamehadaDB/storage/page"
 	"github.com/ryogrid/SamehadaDB/storage/tuple"
@@ -60,11 +62,35 @@ func NewWriteRecord(rid page.RID, wtype WType, tuple *tuple.Tuple, table *TableH
 	return ret
 }
 
+// IndexEntryModifier is operations of index which are used for rollback of index entries.
+// it is implemented by index.Index (defined here for avoiding import cycle)
+type IndexEntryModifier interface {
+	InsertEntry(*tuple.Tuple, page.RID, *Transaction)
+	DeleteEntry(*tuple.Tuple, page.RID, *Transaction)
+}
+
+/**
+ * IndexWriteRecord tracks an insertion or deletion of index entry.
+ * the entry is deleted or inserted again on abort
+ */
+type IndexWriteRecord struct {
+	rid   page.RID
+	wtype WType
+	// tuple which has key of the entry
+	tuple  *tuple.Tuple
+	index_ IndexEntryModifier
+}
+
+func NewIndexWriteRecord(rid page.RID, wtype WType, tuple *tuple.Tuple, index_ IndexEntryModifier) *IndexWriteRecord {
+	return &IndexWriteRecord{rid, wtype, tuple, index_}
+}
+
 /**
  * Transaction tracks information related to a transaction.
  */
 type Transaction struct {
 	/** The current transaction state. */
+	// it is accessed atomically because lock manager changes state of other transactions on deadlock
 	state TransactionState
 
 	// /** The thread ID, used in single-threaded transactions. */
@@ -75,6 +101,12 @@ type Transaction struct {
 
 	// /** The undo set of the access. */
 	write_set []*WriteRecord
+	// undo set of index entries
+	index_write_set []*IndexWriteRecord
+	// functions which are called on commit or abort for changes not tracked with write sets
+	// (e.g. catalog on memory and release of pages of dropped table)
+	commit_actions []func() error
+	abort_actions  []func()
 
 	/** The LSN of the last record written by the access. */
 	prev_lsn types.LSN
@@ -88,6 +120,10 @@ type Transaction struct {
 	shared_lock_set []page.RID
 	// /** LockManager: the set of exclusive-locked tuples held by this access. */
 	exclusive_lock_set []page.RID
+	// LockManager: the set of locked tables (OID -> mode) held by this transaction
+	table_lock_set map[uint32]LockMode
+	// LockManager: number of row locks held in each table (OID -> count) for lock escalation
+	row_lock_counts map[uint32]int
 }
 
 func NewTransaction(txn_id types.TxnID) *Transaction {
@@ -96,11 +132,16 @@ func NewTransaction(txn_id types.TxnID) *Transaction {
 		// std::this_thread::get_id(),
 		txn_id,
 		make([]*WriteRecord, 0),
+		make([]*IndexWriteRecord, 0),
+		make([]func() error, 0),
+		make([]func(), 0),
 		common.InvalidLSN,
 		// deque<*Page>,
 		// unordered_set<PageID>
 		make([]page.RID, 0),
 		make([]page.RID, 0),
+		make(map[uint32]LockMode),
+		make(map[uint32]int),
 	}
 }
 
@@ -119,6 +160,28 @@ func (txn *Transaction) AddIntoWriteSet(write_record *WriteRecord) {
 	txn.write_set = append(txn.write_set, write_record)
 }
 
+func (txn *Transaction) GetIndexWriteSet() []*IndexWriteRecord { return txn.index_write_set }
+
+func (txn *Transaction) SetIndexWriteSet(index_write_set []*IndexWriteRecord) {
+	txn.index_write_set = index_write_set
+}
+
+func (txn *Transaction) AddIntoIndexWriteSet(index_write_record *IndexWriteRecord) {
+	txn.index_write_set = append(txn.index_write_set, index_write_record)
+}
+
+// AddCommitAction registers a function which is called on commit of the transaction.
+// error of the function is returned from TransactionManager.Commit
+func (txn *Transaction) AddCommitAction(action func() error) {
+	txn.commit_actions = append(txn.commit_actions, action)
+}
+
+// AddAbortAction registers a function which is called on abort of the transaction.
+// registered functions are called in reverse order
+func (txn *Transaction) AddAbortAction(action func()) {
+	txn.abort_actions = append(txn.abort_actions, action)
+}
+
 // /** @return the set of resources under a shared lock */
 func (txn *Transaction) GetSharedLockSet() []page.RID {
 	ret := txn.shared_lock_set
@@ -134,6 +197,26 @@ func (txn *Transaction) GetExclusiveLockSet() []page.RID {
 func (txn *Transaction) SetSharedLockSet(set []page.RID)    { txn.shared_lock_set = set }
 func (txn *Transaction) SetExclusiveLockSet(set []page.RID) { txn.exclusive_lock_set = set }
 
+// GetTableLockSet returns OIDs of tables locked by this transaction
+func (txn *Transaction) GetTableLockSet() []uint32 {
+	ret := make([]uint32, 0, len(txn.table_lock_set))
+	for oid := range txn.table_lock_set {
+		ret = append(ret, oid)
+	}
+	return ret
+}
+
+// GetTableLockMode returns the mode of lock on the table held by this transaction.
+// second return value is false when the table is not locked
+func (txn *Transaction) GetTableLockMode(oid uint32) (LockMode, bool) {
+	mode, ok := txn.table_lock_set[oid]
+	return mode, ok
+}
+
+func (txn *Transaction) AddIntoTableLockSet(oid uint32, lock_mode LockMode) {
+	txn.table_lock_set[oid] = lock_mode
+}
+
 func isContainsRID(list []page.RID, rid page.RID) bool {
 	for _, r := range list {
 		if rid == r {
@@ -158,13 +241,23 @@ func (txn *Transaction) IsExclusiveLocked(rid *page.RID) bool {
 }
 
 /** @return the current state of the transaction */
-func (txn *Transaction) GetState() TransactionState { return txn.state }
+func (txn *Transaction) GetState() TransactionState {
+	return TransactionState(atomic.LoadInt32((*int32)(&txn.state)))
+}
 
 /**
 * Set the state of the access.
 * @param state new state
  */
-func (txn *Transaction) SetState(state TransactionState) { txn.state = state }
+func (txn *Transaction) SetState(state TransactionState) {
+	atomic.StoreInt32((*int32)(&txn.state), int32(state))
+}
+
+// abortIfGrowing marks the transaction as aborted only when it is in GROWING state and
+// returns true when it is marked. it is used for aborting other transaction
+func (txn *Transaction) abortIfGrowing() bool {
+	return atomic.CompareAndSwapInt32((*int32)(&txn.state), int32(GROWING), int32(ABORTED))
+}
 
 /** @return the previous LSN */
 func (txn *Transaction) GetPrevLSN() types.LSN { return txn.prev_lsn }
@@ -53,7 +53,9 @@ func (transaction_manager *TransactionManager) Begin(txn *Transaction) *Transact
 	return txn_ret
 }
 
-func (transaction_manager *TransactionManager) Commit(txn *Transaction) {
+// Commit commits txn. error is returned when a commit action failed.
+// txn is committed even in the case, so the error is only for reporting
+func (transaction_manager *TransactionManager) Commit(txn *Transaction) error {
 	txn.SetState(COMMITTED)
 
 	// Perform all deletes before we commit.
@@ -64,15 +66,14 @@ func (transaction_manager *TransactionManager) Commit(txn *Transaction) {
 		rid := item.rid
 		if item.wtype == DELETE {
 			// Note that this also releases the lock when holding the page latch.
-			pageID := rid.GetPageId()
-			tpage := CastPageAsTablePage(table.bpm.FetchPage(pageID))
-			tpage.WLatch()
-			tpage.ApplyDelete(&item.rid, txn, transaction_manager.log_manager)
-			tpage.WUnlatch()
+			// free space made by the deletion is recorded to free space map of the table
+			table.ApplyDelete(&rid, txn)
 		}
 		write_set = write_set[:len(write_set)-1]
 	}
 	txn.SetWriteSet(write_set)
+	// index entries are already applied
+	txn.SetIndexWriteSet(make([]*IndexWriteRecord, 0))
 
 	if common.EnableLogging {
 		log_record := recovery.NewLogRecordTxn(txn.GetTransactionId(), txn.GetPrevLSN(), recovery.COMMIT)
@@ -81,17 +82,44 @@ func (transaction_manager *TransactionManager) Commit(txn *Transaction) {
 		transaction_manager.log_manager.Flush()
 	}
 
+	// commit actions release pages which may be reused by other transactions at once,
+	// so they are called after the COMMIT record is persisted. otherwise the transaction
+	// can be undone on recovery after its pages are overwritten
+	var err error
+	for _, action := range txn.commit_actions {
+		if actionErr := action(); actionErr != nil && err == nil {
+			err = actionErr
+		}
+	}
+	txn.commit_actions = make([]func() error, 0)
+	txn.abort_actions = make([]func(), 0)
+
 	// Release all the locks.
 	transaction_manager.mutex.Lock()
 	transaction_manager.releaseLocks(txn)
 	transaction_manager.mutex.Unlock()
 	// Release the global transaction latch.
 	transaction_manager.global_txn_latch.RUnlock()
+	return err
 }
 
 func (transaction_manager *TransactionManager) Abort(txn *Transaction) {
 	txn.SetState(ABORTED)
 
+	// Rollback index entries in reverse order of modification.
+	// note: index pages are not logged, so they are not recovered if system crashes on the way
+	index_write_set := txn.GetIndexWriteSet()
+	for len(index_write_set) != 0 {
+		item := index_write_set[len(index_write_set)-1]
+		if item.wtype == INSERT {
+			item.index_.DeleteEntry(item.tuple, item.rid, txn)
+		} else if item.wtype == DELETE {
+			item.index_.InsertEntry(item.tuple, item.rid, txn)
+		}
+		index_write_set = index_write_set[:len(index_write_set)-1]
+	}
+	txn.SetIndexWriteSet(index_write_set)
+
 	// Rollback before releasing the access.
 	write_set := txn.GetWriteSet()
 	for len(write_set) != 0 {
@@ -102,11 +130,7 @@ func (transaction_manager *TransactionManager) Abort(txn *Transaction) {
 		} else if item.wtype == INSERT {
 			rid := item.rid
 			// Note that this also releases the lock when holding the page latch.
-			pageID := rid.GetPageId()
-			tpage := CastPageAsTablePage(table.bpm.FetchPage(pageID))
-			tpage.WLatch()
-			tpage.ApplyDelete(&item.rid, txn, transaction_manager.log_manager)
-			tpage.WUnlatch()
+			table.ApplyDelete(&rid, txn)
 		} else if item.wtype == UPDATE {
 			table.UpdateTuple(item.tuple, nil, nil, item.rid, txn)
 		}
@@ -114,6 +138,12 @@ func (transaction_manager *TransactionManager) Abort(txn *Transaction) {
 	}
 	txn.SetWriteSet(write_set)
 
+	for ii := len(txn.abort_actions) - 1; ii >= 0; ii-- {
+		txn.abort_actions[ii]()
+	}
+	txn.commit_actions = make([]func() error, 0)
+	txn.abort_actions = make([]func(), 0)
+
 	if common.EnableLogging {
 		log_record := recovery.NewLogRecordTxn(txn.GetTransactionId(), txn.GetPrevLSN(), recovery.ABORT)
 		lsn := transaction_manager.log_manager.AppendLogRecord(log_record)
@@ -141,6 +171,8 @@ func (transaction_manager *TransactionManager) releaseLocks(txn *Transaction) {
 	lock_set = append(lock_set, txn.GetExclusiveLockSet()...)
 	lock_set = append(lock_set, txn.GetSharedLockSet()...)
 	transaction_manager.lock_manager.Unlock(txn, lock_set)
+	transaction_manager.lock_manager.UnlockTables(txn, txn.GetTableLockSet())
+	transaction_manager.lock_manager.UnlockPredicates(txn)
 	// for _, locked_rid := range lock_set {
 	// 	transaction_manager.lock_manager.Unlock(txn, &locked_rid)
 	// }
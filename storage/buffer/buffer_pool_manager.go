@@ -167,6 +167,8 @@ func (b *BufferPoolManager) DeletePage(pageID types.PageID) error {
 	var ok bool
 	b.mutex.Lock()
 	if frameID, ok = b.pageTable[pageID]; !ok {
+		// page is not on memory. but it should be deallocated on disk
+		b.diskManager.DeallocatePage(pageID)
 		b.mutex.Unlock()
 		return nil
 	}
@@ -118,3 +118,30 @@ func TestSample(t *testing.T) {
 	testingpkg.Equals(t, (*page.Page)(nil), bpm.NewPage())
 	testingpkg.Equals(t, (*page.Page)(nil), bpm.FetchPage(types.PageID(0)))
 }
+
+func TestDeletePageReusesPageId(t *testing.T) {
+	poolSize := uint32(2)
+
+	dm := disk.NewDiskManagerTest()
+	defer dm.ShutDown()
+	bpm := NewBufferPoolManager(poolSize, dm, recovery.NewLogManager(&dm))
+
+	page0 := bpm.NewPage()
+	page1 := bpm.NewPage()
+
+	// Scenario: pinned page can't be deleted
+	testingpkg.Assert(t, bpm.DeletePage(page0.ID()) != nil, "pinned page should not be deleted")
+
+	// Scenario: page on memory and page evicted from buffer pool are both deallocated
+	testingpkg.Ok(t, bpm.UnpinPage(page0.ID(), true))
+	testingpkg.Ok(t, bpm.UnpinPage(page1.ID(), true))
+	page2 := bpm.NewPage()
+	testingpkg.Equals(t, types.PageID(2), page2.ID())
+	testingpkg.Ok(t, bpm.UnpinPage(page2.ID(), true))
+	testingpkg.Ok(t, bpm.DeletePage(types.PageID(0)))
+	testingpkg.Ok(t, bpm.DeletePage(types.PageID(1)))
+
+	// Scenario: deallocated page ids are reused
+	reused := map[types.PageID]bool{bpm.NewPage().ID(): true, bpm.NewPage().ID(): true}
+	testingpkg.Equals(t, map[types.PageID]bool{0: true, 1: true}, reused)
+}
@@ -26,6 +26,13 @@ type DiskManagerImpl struct {
 	size         int64
 	flush_log    bool
 	numFlushes   uint64
+	// deallocated pages which are reused by AllocatePage
+	freePageIDs []types.PageID
+	// same pages as freePageIDs for detecting deallocation of a free page
+	isFreePage map[types.PageID]bool
+	// header page at the head of db file. it is nil when db file was created before
+	// header page was introduced. pages are not shifted and free pages are not persisted on such file
+	header *headerPage
 }
 
 // NewDiskManagerImpl returns a DiskManager instance
@@ -60,14 +67,40 @@ func NewDiskManagerImpl(dbFilename string) DiskManager {
 	file_1.Seek(fileInfo_1.Size(), io.SeekStart)
 
 	fileSize := fileInfo.Size()
-	nPages := fileSize / common.PageSize
+	d := &DiskManagerImpl{file, dbFilename, file_1, logfname, types.PageID(0), 0, fileSize, false, 0, make([]types.PageID, 0), make(map[types.PageID]bool), nil}
+	header, err := readHeaderPage(file, fileSize)
+	if err != nil {
+		log.Fatalln("can't read header page of db file")
+		return nil
+	}
+	if header != nil {
+		d.header = header
+		// header page is not counted
+		d.size = 0
+		if fileSize > common.PageSize {
+			d.size = fileSize - common.PageSize
+		}
+		d.nextPageID, d.freePageIDs = header.load(d.size / common.PageSize)
+		for _, pageID := range d.freePageIDs {
+			d.isFreePage[pageID] = true
+		}
+		return d
+	}
 
-	nextPageID := types.PageID(0)
+	// db file without header page
+	nPages := fileSize / common.PageSize
 	if nPages > 0 {
-		nextPageID = types.PageID(int32(nPages + 1))
+		d.nextPageID = types.PageID(int32(nPages + 1))
 	}
+	return d
+}
 
-	return &DiskManagerImpl{file, dbFilename, file_1, logfname, nextPageID, 0, fileSize, false, 0}
+// offsetOf returns offset of the page in db file
+func (d *DiskManagerImpl) offsetOf(pageId types.PageID) int64 {
+	if d.header != nil {
+		return int64(pageId+1) * common.PageSize
+	}
+	return int64(pageId) * common.PageSize
 }
 
 // ShutDown closes of the database file
@@ -78,7 +111,7 @@ func (d *DiskManagerImpl) ShutDown() {
 
 // Write a page to the database file
 func (d *DiskManagerImpl) WritePage(pageId types.PageID, pageData []byte) error {
-	offset := int64(pageId * common.PageSize)
+	offset := d.offsetOf(pageId)
 	d.db.Seek(offset, io.SeekStart)
 	bytesWritten, err := d.db.Write(pageData)
 	if err != nil {
@@ -89,8 +122,9 @@ func (d *DiskManagerImpl) WritePage(pageId types.PageID, pageData []byte) error
 		return errors.New("bytes written not equals page size")
 	}
 
-	if offset >= d.size {
-		d.size = offset + int64(bytesWritten)
+	// size of header page is not included
+	if dataEnd := int64(pageId+1) * common.PageSize; dataEnd > d.size {
+		d.size = dataEnd
 	}
 
 	d.db.Sync()
@@ -99,7 +133,7 @@ func (d *DiskManagerImpl) WritePage(pageId types.PageID, pageData []byte) error
 
 // Read a page from the database file
 func (d *DiskManagerImpl) ReadPage(pageID types.PageID, pageData []byte) error {
-	offset := int64(pageID * common.PageSize)
+	offset := d.offsetOf(pageID)
 
 	fileInfo, err := d.db.Stat()
 	if err != nil {
@@ -126,17 +160,46 @@ func (d *DiskManagerImpl) ReadPage(pageID types.PageID, pageData []byte) error {
 }
 
 //  AllocatePage allocates a new page
-//  For now just keep an increasing counter
+//  deallocated pages are reused first, otherwise keep an increasing counter
 func (d *DiskManagerImpl) AllocatePage() types.PageID {
+	if len(d.freePageIDs) > 0 {
+		ret := d.freePageIDs[len(d.freePageIDs)-1]
+		d.freePageIDs = d.freePageIDs[:len(d.freePageIDs)-1]
+		delete(d.isFreePage, ret)
+		if d.header != nil {
+			// reuse must be persisted before contents of the page is written
+			d.header.setAllocated(ret, true)
+			d.header.flush(d.db, d.nextPageID)
+		}
+		return ret
+	}
 	ret := d.nextPageID
 	d.nextPageID++
+	if d.header != nil {
+		// pages stored after next page id recorded in header page are treated as allocated at reopen.
+		// so header page is not written here
+		d.header.setAllocated(ret, true)
+	}
 	return ret
 }
 
 // DeallocatePage deallocates page
-// Need bitmap in header page for tracking pages
-// This does not actually need to do anything for now.
-func (d *DiskManagerImpl) DeallocatePage(pageID types.PageID) {}
+// the page is kept in free page list and reused by AllocatePage.
+// pages are tracked with allocation bitmap in header page and free pages are reused after reopen.
+// TODO: (SDB) pages which are out of range of the bitmap and pages of db file without header page
+//             are reused only until shutdown
+func (d *DiskManagerImpl) DeallocatePage(pageID types.PageID) {
+	if d.isFreePage[pageID] {
+		// already deallocated. the page must not be reused twice
+		return
+	}
+	if d.header != nil && d.header.isTracked(pageID) {
+		d.header.setAllocated(pageID, false)
+		d.header.flush(d.db, d.nextPageID)
+	}
+	d.freePageIDs = append(d.freePageIDs, pageID)
+	d.isFreePage[pageID] = true
+}
 
 // GetNumWrites returns the number of disk writes
 func (d *DiskManagerImpl) GetNumWrites() uint64 {
@@ -245,3 +308,16 @@ func (d *DiskManagerImpl) GetLogFileSize() int64 {
 
 	return fileInfo.Size()
 }
+
+/**
+ * Discard all contents of the log file.
+ * Call this only when all changes recorded in the log are persisted to db file
+ */
+func (d *DiskManagerImpl) GCLogFile() error {
+	err := d.log.Truncate(0)
+	if err != nil {
+		return err
+	}
+	_, err = d.log.Seek(0, io.SeekStart)
+	return err
+}
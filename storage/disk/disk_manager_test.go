@@ -4,10 +4,13 @@
 package disk
 
 import (
+	"io/ioutil"
+	"os"
 	"testing"
 
 	"github.com/ryogrid/SamehadaDB/common"
 	testingpkg "github.com/ryogrid/SamehadaDB/testing"
+	"github.com/ryogrid/SamehadaDB/types"
 )
 
 func TestReadWritePage(t *testing.T) {
@@ -41,3 +44,50 @@ func memset(buffer []byte, value int) {
 		buffer[i] = 0
 	}
 }
+
+func TestDeallocatedPageIsReusedAfterReopen(t *testing.T) {
+	f, err := ioutil.TempFile("", "samehada.")
+	testingpkg.Ok(t, err)
+	path := f.Name()
+	f.Close()
+	os.Remove(path)
+
+	dm := NewDiskManagerImpl(path)
+	data := make([]byte, common.PageSize)
+	for ii := 0; ii < 3; ii++ {
+		pageID := dm.AllocatePage()
+		testingpkg.Equals(t, types.PageID(ii), pageID)
+		dm.WritePage(pageID, data)
+	}
+	// header page is not counted
+	testingpkg.Equals(t, int64(3*common.PageSize), dm.Size())
+	dm.DeallocatePage(types.PageID(1))
+	dm.ShutDown()
+
+	dm = NewDiskManagerImpl(path)
+	defer dm.RemoveLogFile()
+	defer dm.RemoveDBFile()
+	defer dm.ShutDown()
+	testingpkg.Equals(t, int64(3*common.PageSize), dm.Size())
+	testingpkg.Equals(t, types.PageID(1), dm.AllocatePage())
+	testingpkg.Equals(t, types.PageID(3), dm.AllocatePage())
+}
+
+func TestDoubleDeallocation(t *testing.T) {
+	dm := NewDiskManagerTest()
+	defer dm.ShutDown()
+	impl := dm.(*DiskManagerTest).DiskManager.(*DiskManagerImpl)
+
+	// page tracked with the bitmap of header page
+	tracked := dm.AllocatePage()
+	// page out of range of the bitmap
+	impl.nextPageID = headerBitmapCapacity
+	untracked := dm.AllocatePage()
+	for _, pageID := range []types.PageID{tracked, untracked} {
+		dm.DeallocatePage(pageID)
+		dm.DeallocatePage(pageID)
+		testingpkg.Equals(t, pageID, dm.AllocatePage())
+		// the page is not reused again
+		testingpkg.Assert(t, dm.AllocatePage() != pageID, "page %d is allocated twice", pageID)
+	}
+}
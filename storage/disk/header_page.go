@@ -0,0 +1,107 @@
+package disk
+
+import (
+	"encoding/binary"
+	"os"
+
+	"github.com/ryogrid/SamehadaDB/common"
+	"github.com/ryogrid/SamehadaDB/types"
+)
+
+// magic number at the head of header page ("SDBH")
+const headerPageMagic = uint32(0x48424453)
+const offsetHeaderNextPageId = 4
+const offsetHeaderBitmap = 8
+
+// headerBitmapCapacity is number of pages which can be tracked with the allocation bitmap
+const headerBitmapCapacity = (common.PageSize - offsetHeaderBitmap) * 8
+
+// headerPage is the first page of db file. it tracks allocation of pages for reusing deallocated pages after reopen.
+// page of page id N is placed at (N + 1) * PageSize in db file.
+//
+//	Header page format (size in bytes):
+//	------------------------------------------------------------------
+//	| Magic (4) | NextPageId (4) | Allocation bitmap (PageSize - 8) |
+//	------------------------------------------------------------------
+//
+// N-th bit of the bitmap is set when page of page id N is allocated
+type headerPage struct {
+	// next page id recorded in db file
+	nextPageID types.PageID
+	bitmap     []byte
+}
+
+// readHeaderPage reads header page of db file. header page is written when the file is empty.
+// nil is returned when the file was created before header page was introduced
+func readHeaderPage(file *os.File, fileSize int64) (*headerPage, error) {
+	if fileSize == 0 {
+		ret := &headerPage{types.PageID(0), make([]byte, common.PageSize-offsetHeaderBitmap)}
+		return ret, ret.flush(file, types.PageID(0))
+	}
+
+	buf := make([]byte, common.PageSize)
+	if _, err := file.ReadAt(buf, 0); err != nil {
+		return nil, err
+	}
+	// first page of db file without header page is a table page. it starts with page id 0
+	if binary.LittleEndian.Uint32(buf) != headerPageMagic {
+		return nil, nil
+	}
+	nextPageID := types.PageID(binary.LittleEndian.Uint32(buf[offsetHeaderNextPageId:]))
+	return &headerPage{nextPageID, buf[offsetHeaderBitmap:]}, nil
+}
+
+// load returns next page id and deallocated pages. numPages is number of pages stored in db file.
+// pages which are in db file but are not recorded in header page (header page was not written
+// after they were allocated) are treated as allocated
+func (h *headerPage) load(numPages int64) (types.PageID, []types.PageID) {
+	nextPageID := h.nextPageID
+	if types.PageID(numPages) > nextPageID {
+		nextPageID = types.PageID(numPages)
+	}
+	for pageID := h.nextPageID; pageID < nextPageID; pageID++ {
+		h.setAllocated(pageID, true)
+	}
+
+	// pages of smaller page id are reused first (free page list is popped from its tail)
+	freePageIDs := make([]types.PageID, 0)
+	for pageID := nextPageID - 1; pageID >= 0; pageID-- {
+		if h.isTracked(pageID) && !h.isAllocated(pageID) {
+			freePageIDs = append(freePageIDs, pageID)
+		}
+	}
+	return nextPageID, freePageIDs
+}
+
+func (h *headerPage) isTracked(pageID types.PageID) bool {
+	return pageID >= 0 && pageID < headerBitmapCapacity
+}
+
+func (h *headerPage) isAllocated(pageID types.PageID) bool {
+	return h.bitmap[pageID/8]&(1<<uint(pageID%8)) != 0
+}
+
+// setAllocated does nothing when the page is out of range of the bitmap
+func (h *headerPage) setAllocated(pageID types.PageID, isAllocated bool) {
+	if !h.isTracked(pageID) {
+		return
+	}
+	if isAllocated {
+		h.bitmap[pageID/8] |= 1 << uint(pageID%8)
+	} else {
+		h.bitmap[pageID/8] &^= 1 << uint(pageID%8)
+	}
+}
+
+// flush writes the header page to the head of db file
+func (h *headerPage) flush(file *os.File, nextPageID types.PageID) error {
+	h.nextPageID = nextPageID
+	buf := make([]byte, common.PageSize)
+	binary.LittleEndian.PutUint32(buf, headerPageMagic)
+	binary.LittleEndian.PutUint32(buf[offsetHeaderNextPageId:], uint32(nextPageID))
+	copy(buf[offsetHeaderBitmap:], h.bitmap)
+	if _, err := file.WriteAt(buf, 0); err != nil {
+		return err
+	}
+	return file.Sync()
+}
@@ -0,0 +1,116 @@
+package index
+
+import (
+	"github.com/ryogrid/SamehadaDB/container/btree"
+	"github.com/ryogrid/SamehadaDB/storage/access"
+	"github.com/ryogrid/SamehadaDB/storage/buffer"
+	"github.com/ryogrid/SamehadaDB/storage/page"
+	"github.com/ryogrid/SamehadaDB/storage/table/schema"
+	"github.com/ryogrid/SamehadaDB/storage/tuple"
+	"github.com/ryogrid/SamehadaDB/types"
+)
+
+type BPlusTreeIndex struct {
+	container *btree.BPlusTree
+	metadata  *IndexMetadata
+	// idx of target column on table.
+	// on index of multiple columns, key attrs of metadata are used instead
+	col_idx uint32
+}
+
+func NewBPlusTreeIndex(metadata *IndexMetadata, buffer_pool_manager *buffer.BufferPoolManager, col_idx uint32) *BPlusTreeIndex {
+	ret := new(BPlusTreeIndex)
+	ret.metadata = metadata
+	ret.container = btree.NewBPlusTree(buffer_pool_manager)
+	ret.col_idx = col_idx
+	return ret
+}
+
+// OpenBPlusTreeIndex opens B+tree index whose header page is headerPageId
+func OpenBPlusTreeIndex(metadata *IndexMetadata, buffer_pool_manager *buffer.BufferPoolManager, col_idx uint32,
+	headerPageId types.PageID) (*BPlusTreeIndex, error) {
+	container, err := btree.OpenBPlusTree(buffer_pool_manager, headerPageId)
+	if err != nil {
+		return nil, err
+	}
+	return &BPlusTreeIndex{container, metadata, col_idx}, nil
+}
+
+// Return the metadata object associated with the index
+func (btidx *BPlusTreeIndex) GetMetadata() *IndexMetadata { return btidx.metadata }
+
+func (btidx *BPlusTreeIndex) GetIndexColumnCount() uint32 {
+	return btidx.metadata.GetIndexColumnCount()
+}
+func (btidx *BPlusTreeIndex) GetName() *string { return btidx.metadata.GetName() }
+func (btidx *BPlusTreeIndex) GetTupleSchema() *schema.Schema {
+	return btidx.metadata.GetTupleSchema()
+}
+func (btidx *BPlusTreeIndex) GetKeyAttrs() []uint32 { return btidx.metadata.GetKeyAttrs() }
+func (btidx *BPlusTreeIndex) GetHeaderPageId() types.PageID {
+	return btidx.container.GetHeaderPageId()
+}
+func (btidx *BPlusTreeIndex) Clear() { btidx.container.Clear() }
+func (btidx *BPlusTreeIndex) Drop()  { btidx.container.Drop() }
+
+// encodeKey returns encoded key value of the tuple and whether the value was truncated.
+// on index of multiple columns, the key is ordered by key columns lexicographically
+func (btidx *BPlusTreeIndex) encodeKey(key *tuple.Tuple) ([]byte, bool) {
+	if btidx.GetIndexColumnCount() <= 1 {
+		val := key.GetValue(btidx.GetTupleSchema(), btidx.col_idx)
+		return EncodeOrderedKey(&val)
+	}
+	vals := make([]types.Value, 0, btidx.GetIndexColumnCount())
+	for _, colIdx := range btidx.GetKeyAttrs() {
+		vals = append(vals, key.GetValue(btidx.GetTupleSchema(), colIdx))
+	}
+	return EncodeOrderedKeys(vals, btree.MaxKeySize)
+}
+
+func (btidx *BPlusTreeIndex) InsertEntry(key *tuple.Tuple, rid page.RID, transaction *access.Transaction) {
+	keyData, _ := btidx.encodeKey(key)
+	btidx.container.Insert(keyData, PackRIDtoUint64(&rid))
+}
+
+func (btidx *BPlusTreeIndex) DeleteEntry(key *tuple.Tuple, rid page.RID, transaction *access.Transaction) {
+	keyData, _ := btidx.encodeKey(key)
+	btidx.container.Remove(keyData, PackRIDtoUint64(&rid))
+}
+
+func (btidx *BPlusTreeIndex) ScanKey(key *tuple.Tuple, transaction *access.Transaction) []page.RID {
+	keyData, _ := btidx.encodeKey(key)
+	return unpackRIDs(btidx.container.GetValue(keyData))
+}
+
+// ScanRange returns RIDs of entries whose keys are between low and high in key order.
+// nil low or high means the range is not bounded on the side. entries of NULL are not returned.
+// when a bound is long varchar which is truncated, the bound is treated as inclusive,
+// so the result may contain entries out of the range
+func (btidx *BPlusTreeIndex) ScanRange(low *tuple.Tuple, lowInclusive bool, high *tuple.Tuple, highInclusive bool, transaction *access.Transaction) []page.RID {
+	// smallest non NULL key
+	lowData := []byte{0x01}
+	if low != nil {
+		var isTruncated bool
+		lowData, isTruncated = btidx.encodeKey(low)
+		lowInclusive = lowInclusive || isTruncated
+	}
+	var highData []byte = nil
+	if high != nil {
+		var isTruncated bool
+		highData, isTruncated = btidx.encodeKey(high)
+		highInclusive = highInclusive || isTruncated
+	}
+	if lowData[0] == 0x00 || (highData != nil && highData[0] == 0x00) {
+		// comparison with NULL is never true
+		return []page.RID{}
+	}
+	return unpackRIDs(btidx.container.ScanRange(lowData, lowInclusive, highData, highInclusive))
+}
+
+func unpackRIDs(packed_values []uint64) []page.RID {
+	ret := make([]page.RID, 0, len(packed_values))
+	for _, packed_val := range packed_values {
+		ret = append(ret, UnpackUint64toRID(packed_val))
+	}
+	return ret
+}
@@ -0,0 +1,93 @@
+package index
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/ryogrid/SamehadaDB/recovery"
+	"github.com/ryogrid/SamehadaDB/storage/buffer"
+	"github.com/ryogrid/SamehadaDB/storage/disk"
+	"github.com/ryogrid/SamehadaDB/storage/page"
+	"github.com/ryogrid/SamehadaDB/storage/table/column"
+	"github.com/ryogrid/SamehadaDB/storage/table/schema"
+	"github.com/ryogrid/SamehadaDB/storage/tuple"
+	testingpkg "github.com/ryogrid/SamehadaDB/testing"
+	"github.com/ryogrid/SamehadaDB/types"
+)
+
+func TestEncodeOrderedKey(t *testing.T) {
+	ordered := [][]types.Value{
+		{*types.NewInteger(0).SetNull(), types.NewInteger(-100), types.NewInteger(-1), types.NewInteger(0), types.NewInteger(1), types.NewInteger(100)},
+		{*types.NewFloat(0).SetNull(), types.NewFloat(-10.5), types.NewFloat(-0.5), types.NewFloat(0), types.NewFloat(0.5), types.NewFloat(10.5)},
+		{*types.NewVarchar("").SetNull(), types.NewVarchar(""), types.NewVarchar("a"), types.NewVarchar("a\x00"), types.NewVarchar("ab"), types.NewVarchar("b")},
+	}
+	for _, values := range ordered {
+		for ii := 0; ii < len(values)-1; ii++ {
+			cur, _ := EncodeOrderedKey(&values[ii])
+			next, _ := EncodeOrderedKey(&values[ii+1])
+			testingpkg.SimpleAssert(t, bytes.Compare(cur, next) < 0)
+			// prefix free
+			testingpkg.SimpleAssert(t, !bytes.HasPrefix(next, cur))
+		}
+	}
+
+	longStr := types.NewVarchar(strings.Repeat("a", MaxIndexedVarcharLen+1))
+	_, isTruncated := EncodeOrderedKey(&longStr)
+	testingpkg.SimpleAssert(t, isTruncated)
+
+	// truncated value is ordered between the prefix and greater values, and it is prefix free
+	prefix := strings.Repeat("a", MaxIndexedVarcharLen)
+	truncatedOrdered := []types.Value{types.NewVarchar(prefix), types.NewVarchar(prefix + "a"), types.NewVarchar(prefix[:MaxIndexedVarcharLen-1] + "b")}
+	for ii := 0; ii < len(truncatedOrdered)-1; ii++ {
+		cur, _ := EncodeOrderedKey(&truncatedOrdered[ii])
+		next, _ := EncodeOrderedKey(&truncatedOrdered[ii+1])
+		testingpkg.SimpleAssert(t, bytes.Compare(cur, next) < 0)
+		testingpkg.SimpleAssert(t, !bytes.HasPrefix(next, cur) && !bytes.HasPrefix(cur, next))
+	}
+
+	// order of multi column keys is not reversed by values following truncated value
+	lower, _ := EncodeOrderedKeys([]types.Value{types.NewVarchar(prefix + "a"), types.NewInteger(1)}, 1024)
+	upper, isTruncated := EncodeOrderedKeys([]types.Value{types.NewVarchar(prefix + "b"), types.NewInteger(0)}, 1024)
+	testingpkg.SimpleAssert(t, isTruncated)
+	testingpkg.SimpleAssert(t, bytes.Compare(lower, upper) <= 0)
+}
+
+func TestBPlusTreeIndex(t *testing.T) {
+	diskManager := disk.NewDiskManagerTest()
+	defer diskManager.ShutDown()
+	bpm := buffer.NewBufferPoolManager(uint32(32), diskManager, recovery.NewLogManager(&diskManager))
+
+	schema_ := schema.NewSchema([]*column.Column{
+		column.NewColumn("a", types.Integer, true, nil),
+		column.NewColumn("b", types.Varchar, false, nil)})
+	im := NewIndexMetadata("a_index", "test", schema_, []uint32{0})
+	index_ := NewBPlusTreeIndex(im, bpm, 0)
+
+	keyTuple := func(val types.Value) *tuple.Tuple {
+		return tuple.GenTupleForHashIndexSearch(schema_, 0, val)
+	}
+	for ii := 0; ii < 1000; ii++ {
+		// rows are inserted from page 100000 whose id can't be packed to 16 bits
+		rid := page.RID{PageId: types.PageID(100000 + ii/10), SlotNum: uint32(ii % 10)}
+		index_.InsertEntry(keyTuple(types.NewInteger(int32(500-ii))), rid, nil)
+	}
+	index_.InsertEntry(keyTuple(*types.NewInteger(0).SetNull()), page.RID{PageId: 1, SlotNum: 0}, nil)
+
+	rids := index_.ScanKey(keyTuple(types.NewInteger(500)), nil)
+	testingpkg.Equals(t, []page.RID{{PageId: 100000, SlotNum: 0}}, rids)
+
+	var rangeIndex RangeScanIndex = index_
+	rids = rangeIndex.ScanRange(keyTuple(types.NewInteger(-10)), true, keyTuple(types.NewInteger(10)), false, nil)
+	testingpkg.Equals(t, 20, len(rids))
+	// key order
+	testingpkg.Equals(t, page.RID{PageId: 100051, SlotNum: 0}, rids[0])
+	testingpkg.Equals(t, page.RID{PageId: 100049, SlotNum: 1}, rids[19])
+
+	// NULL is not included on unbounded range
+	testingpkg.Equals(t, 1000, len(rangeIndex.ScanRange(nil, true, nil, true, nil)))
+	testingpkg.Equals(t, 0, len(rangeIndex.ScanRange(keyTuple(*types.NewInteger(0).SetNull()), true, nil, true, nil)))
+
+	index_.DeleteEntry(keyTuple(types.NewInteger(500)), page.RID{PageId: 100000, SlotNum: 0}, nil)
+	testingpkg.Equals(t, 0, len(index_.ScanKey(keyTuple(types.NewInteger(500)), nil)))
+}
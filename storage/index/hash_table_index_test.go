@@ -1,11 +1,17 @@
 package index
 
 import (
-	"fmt"
 	"testing"
 
+	"github.com/ryogrid/SamehadaDB/recovery"
+	"github.com/ryogrid/SamehadaDB/storage/buffer"
+	"github.com/ryogrid/SamehadaDB/storage/disk"
 	"github.com/ryogrid/SamehadaDB/storage/page"
+	"github.com/ryogrid/SamehadaDB/storage/table/column"
+	"github.com/ryogrid/SamehadaDB/storage/table/schema"
+	"github.com/ryogrid/SamehadaDB/storage/tuple"
 	testingpkg "github.com/ryogrid/SamehadaDB/testing"
+	"github.com/ryogrid/SamehadaDB/types"
 )
 
 func TestPackAndUnpackRID(t *testing.T) {
@@ -13,10 +19,43 @@ func TestPackAndUnpackRID(t *testing.T) {
 	rid.PageId = 55
 	rid.SlotNum = 1027
 
-	packed_val := PackRIDtoUint32(rid)
-	fmt.Println(packed_val)
-	unpacked_val := UnpackUint32toRID(packed_val)
+	packed_val := PackRIDtoUint64(rid)
+	unpacked_val := UnpackUint64toRID(packed_val)
 
 	testingpkg.Assert(t, unpacked_val.PageId == 55, "")
 	testingpkg.Assert(t, unpacked_val.SlotNum == 1027, "")
+
+	// values which exceed 16 bits are not truncated
+	rid.PageId = 0x7fffffff
+	rid.SlotNum = 0xffffffff
+	unpacked_val = UnpackUint64toRID(PackRIDtoUint64(rid))
+	testingpkg.Equals(t, *rid, unpacked_val)
+}
+
+func TestHashTableIndexHighPageId(t *testing.T) {
+	diskManager := disk.NewDiskManagerTest()
+	defer diskManager.ShutDown()
+	bpm := buffer.NewBufferPoolManager(uint32(32), diskManager, recovery.NewLogManager(&diskManager))
+
+	schema_ := schema.NewSchema([]*column.Column{
+		column.NewColumn("a", types.Integer, true, nil),
+		column.NewColumn("b", types.Varchar, false, nil)})
+	im := NewIndexMetadata("a_index", "test", schema_, []uint32{0})
+	index_ := NewLinearProbeHashTableIndex(im, bpm, 0, 1)
+
+	keyTuple := func(val int32) *tuple.Tuple {
+		return tuple.GenTupleForHashIndexSearch(schema_, 0, types.NewInteger(val))
+	}
+	// rows on pages and slots whose ids can't be packed to 16 bits
+	for ii := 0; ii < 1000; ii++ {
+		rid := page.RID{PageId: types.PageID(70000 + ii*1000), SlotNum: uint32(65536 + ii)}
+		index_.InsertEntry(keyTuple(int32(ii)), rid, nil)
+	}
+	for ii := 0; ii < 1000; ii++ {
+		rids := index_.ScanKey(keyTuple(int32(ii)), nil)
+		testingpkg.Equals(t, []page.RID{{PageId: types.PageID(70000 + ii*1000), SlotNum: uint32(65536 + ii)}}, rids)
+	}
+
+	index_.DeleteEntry(keyTuple(10), page.RID{PageId: 80000, SlotNum: 65546}, nil)
+	testingpkg.Equals(t, 0, len(index_.ScanKey(keyTuple(10), nil)))
 }
@@ -3,8 +3,10 @@ package index
 import (
 	"github.com/ryogrid/SamehadaDB/storage/access"
 	"github.com/ryogrid/SamehadaDB/storage/page"
+	"github.com/ryogrid/SamehadaDB/storage/table/column"
 	"github.com/ryogrid/SamehadaDB/storage/table/schema"
 	"github.com/ryogrid/SamehadaDB/storage/tuple"
+	"github.com/ryogrid/SamehadaDB/types"
 )
 
 /**
@@ -23,6 +25,8 @@ type IndexMetadata struct {
 	key_attrs []uint32
 	// schema of the indexed key
 	tuple_schema *schema.Schema
+	// constraint enforced through the index (UNIQUE or PRIMARY KEY)
+	constraint column.IndexConstraint
 }
 
 func NewIndexMetadata(index_name string, table_name string, tuple_schema *schema.Schema,
@@ -38,6 +42,7 @@ func NewIndexMetadata(index_name string, table_name string, tuple_schema *schema
 
 func (im *IndexMetadata) GetName() *string      { return &im.name }
 func (im *IndexMetadata) GetTableName() *string { return &im.table_name }
+func (im *IndexMetadata) SetName(index_name string) { im.name = index_name }
 
 // Returns a schema object pointer that represents the indexed key
 func (im *IndexMetadata) GetTupleSchema() *schema.Schema { return im.tuple_schema }
@@ -51,6 +56,14 @@ func (im *IndexMetadata) GetIndexColumnCount() uint32 { return uint32(len(im.key
 //  columns
 func (im *IndexMetadata) GetKeyAttrs() []uint32 { return im.key_attrs }
 
+func (im *IndexMetadata) GetConstraint() column.IndexConstraint { return im.constraint }
+func (im *IndexMetadata) SetConstraint(constraint column.IndexConstraint) {
+	im.constraint = constraint
+}
+
+// IsUnique returns true when duplicated keys are not allowed on the index
+func (im *IndexMetadata) IsUnique() bool { return im.constraint != column.IndexConstraintNone }
+
 /*
    // Get a string representation for debugging
    std::string ToString() const {
@@ -102,6 +115,12 @@ type Index interface {
 	// delete the index entry linked to given tuple
 	DeleteEntry(*tuple.Tuple, page.RID, *access.Transaction)
 	ScanKey(*tuple.Tuple, *access.Transaction) []page.RID
+	// remove all entries. it is used for rebuilding the index
+	Clear()
+	// release all pages of the index. it is used for dropping the index
+	Drop()
+	// page id from which the index is reopened
+	GetHeaderPageId() types.PageID
 
 	/*
 	      // Get a string representation for debugging
@@ -114,3 +133,11 @@ type Index interface {
 	      }
 	*/
 }
+
+// RangeScanIndex is an index which keeps keys in order and can return
+// entries in a range of keys (B+tree)
+type RangeScanIndex interface {
+	Index
+	// nil low or high means the range is not bounded on the side
+	ScanRange(low *tuple.Tuple, lowInclusive bool, high *tuple.Tuple, highInclusive bool, transaction *access.Transaction) []page.RID
+}
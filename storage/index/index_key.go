@@ -0,0 +1,100 @@
+package index
+
+import (
+	"encoding/binary"
+	"math"
+
+	"github.com/ryogrid/SamehadaDB/types"
+)
+
+// max length of varchar value which is used as key of ordered index.
+// longer values are truncated, so entries of the values can't be distinguished by the index
+const MaxIndexedVarcharLen = 256
+
+// terminators of encoded varchar. truncated value is terminated differently from
+// the value which equals to the truncated prefix, and ordered after it
+var varcharTerminator = []byte{0x00, 0x00}
+var truncatedVarcharTerminator = []byte{0x00, 0x01}
+
+/**
+ * EncodeOrderedKey encodes value to byte sequence which is ordered by bytes.Compare
+ * in the same order as original values, and which is not prefix of other encoded
+ * values (prefix free). so encoded values can be concatenated for multi column keys.
+ *
+ * NULL: 0x00
+ * others: 0x01 + big endian value whose sign bit is flipped (numbers)
+ *         or escaped bytes (0x00 -> 0x00 0xff) terminated by 0x00 0x00 (varchar)
+ *
+ * varchar longer than MaxIndexedVarcharLen is truncated and terminated by 0x00 0x01 instead.
+ * values which have the same prefix are encoded to the same key, but order to other values
+ * is kept and the encoded key is still prefix free.
+ * returned bool is true when varchar value was truncated
+ */
+func EncodeOrderedKey(val *types.Value) ([]byte, bool) {
+	if val.IsNull() {
+		return []byte{0x00}, false
+	}
+
+	ret := []byte{0x01}
+	isTruncated := false
+	buf := make([]byte, 4)
+	switch val.ValueType() {
+	case types.Integer:
+		binary.BigEndian.PutUint32(buf, uint32(val.ToInteger())^(1<<31))
+		ret = append(ret, buf...)
+	case types.Float:
+		bits := math.Float32bits(val.ToFloat())
+		if bits&(1<<31) != 0 {
+			// negative values are ordered reversely on the bits
+			bits = ^bits
+		} else {
+			bits |= 1 << 31
+		}
+		binary.BigEndian.PutUint32(buf, bits)
+		ret = append(ret, buf...)
+	case types.Boolean:
+		if val.ToBoolean() {
+			ret = append(ret, 1)
+		} else {
+			ret = append(ret, 0)
+		}
+	case types.Varchar:
+		str := val.ToVarchar()
+		terminator := varcharTerminator
+		if len(str) > MaxIndexedVarcharLen {
+			str = str[:MaxIndexedVarcharLen]
+			terminator = truncatedVarcharTerminator
+			isTruncated = true
+		}
+		for ii := 0; ii < len(str); ii++ {
+			ret = append(ret, str[ii])
+			if str[ii] == 0x00 {
+				ret = append(ret, 0xff)
+			}
+		}
+		ret = append(ret, terminator...)
+	}
+	return ret, isTruncated
+}
+
+// EncodeOrderedKeys encodes values of multi column key by concatenating encoded values.
+// values after truncated varchar are not encoded, because order of keys which have the same
+// truncated value is decided by the truncated part, not by following values.
+// when the result is longer than maxLen, it is truncated and returned bool is true
+func EncodeOrderedKeys(vals []types.Value, maxLen int) ([]byte, bool) {
+	ret := make([]byte, 0)
+	isTruncated := false
+	for ii := range vals {
+		encoded, truncated := EncodeOrderedKey(&vals[ii])
+		ret = append(ret, encoded...)
+		if truncated {
+			isTruncated = true
+			break
+		}
+	}
+	if len(ret) > maxLen {
+		ret = ret[:maxLen]
+		isTruncated = true
+	}
+	return ret, isTruncated
+}
@@ -1,9 +1,7 @@
 package index
 
 import (
-	"bytes"
-	"encoding/binary"
-
+	"github.com/ryogrid/SamehadaDB/common"
 	hash "github.com/ryogrid/SamehadaDB/container/hash"
 	"github.com/ryogrid/SamehadaDB/storage/access"
 	"github.com/ryogrid/SamehadaDB/storage/buffer"
@@ -19,7 +17,8 @@ type LinearProbeHashTableIndex struct {
 	// container
 	container hash.LinearProbeHashTable
 	metadata  *IndexMetadata
-	// idx of target column on table
+	// idx of target column on table.
+	// on index of multiple columns, key attrs of metadata are used instead
 	col_idx uint32
 }
 
@@ -32,6 +31,16 @@ func NewLinearProbeHashTableIndex(metadata *IndexMetadata, buffer_pool_manager *
 	return ret
 }
 
+// OpenLinearProbeHashTableIndex opens hash index whose header page is headerPageId
+func OpenLinearProbeHashTableIndex(metadata *IndexMetadata, buffer_pool_manager *buffer.BufferPoolManager, col_idx uint32,
+	headerPageId types.PageID) (*LinearProbeHashTableIndex, error) {
+	container, err := hash.OpenLinearProbeHashTable(buffer_pool_manager, headerPageId)
+	if err != nil {
+		return nil, err
+	}
+	return &LinearProbeHashTableIndex{*container, metadata, col_idx}, nil
+}
+
 // Return the metadata object associated with the index
 func (htidx *LinearProbeHashTableIndex) GetMetadata() *IndexMetadata { return htidx.metadata }
 
@@ -43,59 +52,56 @@ func (htidx *LinearProbeHashTableIndex) GetTupleSchema() *schema.Schema {
 	return htidx.metadata.GetTupleSchema()
 }
 func (htidx *LinearProbeHashTableIndex) GetKeyAttrs() []uint32 { return htidx.metadata.GetKeyAttrs() }
+func (htidx *LinearProbeHashTableIndex) GetHeaderPageId() types.PageID {
+	return htidx.container.GetHeaderPageId()
+}
 
-func (htidx *LinearProbeHashTableIndex) InsertEntry(key *tuple.Tuple, rid page.RID, transaction *access.Transaction) {
+// Clear removes all entries. number of blocks is reset to common.BucketSize
+func (htidx *LinearProbeHashTableIndex) Clear() { htidx.container.Clear(common.BucketSize) }
+func (htidx *LinearProbeHashTableIndex) Drop()  { htidx.container.Drop() }
+
+// keyBytes returns serialized key of the tuple. serialized values of key columns are
+// concatenated on index of multiple columns (serialized varchar has its length, so the result is unique)
+func (htidx *LinearProbeHashTableIndex) keyBytes(key *tuple.Tuple) []byte {
 	tupleSchema_ := htidx.GetTupleSchema()
-	keyDataInBytes := key.GetValueInBytes(tupleSchema_, htidx.col_idx)
+	if htidx.GetIndexColumnCount() <= 1 {
+		return key.GetValueInBytes(tupleSchema_, htidx.col_idx)
+	}
+	ret := make([]byte, 0)
+	for _, colIdx := range htidx.GetKeyAttrs() {
+		ret = append(ret, key.GetValueInBytes(tupleSchema_, colIdx)...)
+	}
+	return ret
+}
 
-	htidx.container.Insert(keyDataInBytes, PackRIDtoUint32(&rid))
+func (htidx *LinearProbeHashTableIndex) InsertEntry(key *tuple.Tuple, rid page.RID, transaction *access.Transaction) {
+	keyDataInBytes := htidx.keyBytes(key)
+
+	htidx.container.Insert(keyDataInBytes, PackRIDtoUint64(&rid))
 }
 
 func (htidx *LinearProbeHashTableIndex) DeleteEntry(key *tuple.Tuple, rid page.RID, transaction *access.Transaction) {
-	tupleSchema_ := htidx.GetTupleSchema()
-	keyDataInBytes := key.GetValueInBytes(tupleSchema_, htidx.col_idx)
+	keyDataInBytes := htidx.keyBytes(key)
 
-	htidx.container.Remove(keyDataInBytes, PackRIDtoUint32(&rid))
+	htidx.container.Remove(keyDataInBytes, PackRIDtoUint64(&rid))
 }
 
 func (htidx *LinearProbeHashTableIndex) ScanKey(key *tuple.Tuple, transaction *access.Transaction) []page.RID {
-	tupleSchema_ := htidx.GetTupleSchema()
-	keyDataInBytes := key.GetValueInBytes(tupleSchema_, htidx.col_idx)
+	keyDataInBytes := htidx.keyBytes(key)
 
 	packed_values := htidx.container.GetValue(keyDataInBytes)
 	var ret_arr []page.RID
 	for _, packed_val := range packed_values {
-		ret_arr = append(ret_arr, UnpackUint32toRID(packed_val))
+		ret_arr = append(ret_arr, UnpackUint64toRID(packed_val))
 	}
 	return ret_arr
 }
 
-func PackRIDtoUint32(value *page.RID) uint32 {
-	buf1 := new(bytes.Buffer)
-	buf2 := new(bytes.Buffer)
-	pack_buf := make([]byte, 4)
-	binary.Write(buf1, binary.LittleEndian, value.PageId)
-	binary.Write(buf2, binary.LittleEndian, value.SlotNum)
-	pageIdInBytes := buf1.Bytes()
-	slotNumInBytes := buf2.Bytes()
-	copy(pack_buf[:2], pageIdInBytes[:2])
-	copy(pack_buf[2:], slotNumInBytes[:2])
-	return binary.LittleEndian.Uint32(pack_buf)
+// PackRIDtoUint64 packs RID without truncation. packed values are ordered by page id and slot number
+func PackRIDtoUint64(value *page.RID) uint64 {
+	return uint64(uint32(value.PageId))<<32 | uint64(value.SlotNum)
 }
 
-func UnpackUint32toRID(value uint32) page.RID {
-	packed_buf := new(bytes.Buffer)
-	binary.Write(packed_buf, binary.LittleEndian, value)
-	packedDataInBytes := packed_buf.Bytes()
-	var PageId types.PageID
-	var SlotNum uint32
-	buf := make([]byte, 4)
-	copy(buf[:2], packedDataInBytes[:2])
-	PageId = types.PageID(binary.LittleEndian.Uint32(buf))
-	copy(buf[:2], packedDataInBytes[2:])
-	SlotNum = binary.LittleEndian.Uint32(buf)
-	ret := new(page.RID)
-	ret.PageId = PageId
-	ret.SlotNum = SlotNum
-	return *ret
+func UnpackUint64toRID(value uint64) page.RID {
+	return page.RID{PageId: types.PageID(int32(value >> 32)), SlotNum: uint32(value)}
 }
@@ -0,0 +1,57 @@
+package page
+
+import (
+	"encoding/binary"
+
+	"github.com/ryogrid/SamehadaDB/common"
+	"github.com/ryogrid/SamehadaDB/types"
+)
+
+/**
+ *
+ * Header Page for B+tree. it keeps page id of current root node
+ * because root node is changed when it is split.
+ *
+ * Header format (size in byte, 16 bytes in total):
+ * -------------------------------------------------------------
+ * | PageId (4) | LSN (4) | RootPageId (4) | Magic (4)
+ * -------------------------------------------------------------
+ *
+ * Magic is used for detecting that the page is not a header of B+tree.
+ */
+type BPlusTreeHeaderPage struct {
+	data [common.PageSize]byte
+}
+
+const (
+	offsetBTreeHeaderRootPageId = 8
+	offsetBTreeHeaderMagic      = 12
+	bPlusTreeHeaderMagic        = 0x42545248 // "BTRH"
+)
+
+// Init initializes the header. root page id is set separately
+func (page *BPlusTreeHeaderPage) Init(pageId types.PageID) {
+	page.SetPageId(pageId)
+	binary.LittleEndian.PutUint32(page.data[offsetBTreeHeaderMagic:], bPlusTreeHeaderMagic)
+}
+
+// IsValid returns whether the page is initialized as header of B+tree whose header page is pageId
+func (page *BPlusTreeHeaderPage) IsValid(pageId types.PageID) bool {
+	return page.GetPageId() == pageId && binary.LittleEndian.Uint32(page.data[offsetBTreeHeaderMagic:]) == bPlusTreeHeaderMagic
+}
+
+func (page *BPlusTreeHeaderPage) GetPageId() types.PageID {
+	return types.PageID(int32(binary.LittleEndian.Uint32(page.data[0:])))
+}
+
+func (page *BPlusTreeHeaderPage) SetPageId(pageId types.PageID) {
+	binary.LittleEndian.PutUint32(page.data[0:], uint32(pageId))
+}
+
+func (page *BPlusTreeHeaderPage) GetRootPageId() types.PageID {
+	return types.PageID(int32(binary.LittleEndian.Uint32(page.data[offsetBTreeHeaderRootPageId:])))
+}
+
+func (page *BPlusTreeHeaderPage) SetRootPageId(pageId types.PageID) {
+	binary.LittleEndian.PutUint32(page.data[offsetBTreeHeaderRootPageId:], uint32(pageId))
+}
@@ -0,0 +1,245 @@
+package page
+
+import (
+	"bytes"
+	"encoding/binary"
+
+	"github.com/ryogrid/SamehadaDB/common"
+	"github.com/ryogrid/SamehadaDB/types"
+)
+
+/**
+ * Node (internal or leaf) page of B+tree. keys are variable length byte sequences
+ * and stored in ascending order of bytes.Compare.
+ *
+ * Node format (size in byte):
+ *  ---------------------------------------------------------------------------------------
+ * | PageId (4) | LSN (4) | NodeType (4) | NumKeys (4) | NextPageId (4) | FreeSpaceOffset (4) |
+ *  ---------------------------------------------------------------------------------------
+ * | LeftmostChild (4) | Slot(1) | ... | Slot(n) | ... free space ... | Entry(n) | ... | Entry(1) |
+ *  ---------------------------------------------------------------------------------------
+ *
+ *  Slot: | Offset (2) | Length (2) |
+ *  Entry of leaf node: | Key |
+ *  Entry of internal node: | Key | Child (4) |
+ *
+ * on internal node, LeftmostChild points the node which has keys smaller than first key
+ * and Child of i-th entry points the node which has keys equal to or larger than i-th key.
+ * NextPageId of leaf node points right sibling leaf.
+ */
+type BPlusTreeNodePage struct {
+	data [common.PageSize]byte
+}
+
+// BPlusTreeNodeEntry is a key and child pair which is used when entries are moved
+// among nodes. Child is not used on leaf node
+type BPlusTreeNodeEntry struct {
+	Key   []byte
+	Child types.PageID
+}
+
+const (
+	BPlusTreeLeafNode     = 1
+	BPlusTreeInternalNode = 2
+)
+
+const (
+	offsetBTreeNodeType         = 8
+	offsetBTreeNumKeys          = 12
+	offsetBTreeNextPageId       = 16
+	offsetBTreeFreeSpaceOffset  = 20
+	offsetBTreeLeftmostChild    = 24
+	sizeBTreeNodeHeader         = 28
+	sizeBTreeSlot               = 4
+	sizeBTreeChild              = 4
+	BPlusTreeNodeCapacity       = common.PageSize - sizeBTreeNodeHeader
+	BPlusTreeMaxEntrySizeInNode = BPlusTreeNodeCapacity / 4
+	// max key length. a node can store at least 4 entries
+	BPlusTreeMaxKeySize = BPlusTreeMaxEntrySizeInNode - sizeBTreeSlot - sizeBTreeChild
+)
+
+func (page *BPlusTreeNodePage) getUint32(offset int) uint32 {
+	return binary.LittleEndian.Uint32(page.data[offset:])
+}
+
+func (page *BPlusTreeNodePage) setUint32(offset int, val uint32) {
+	binary.LittleEndian.PutUint32(page.data[offset:], val)
+}
+
+func (page *BPlusTreeNodePage) Init(pageId types.PageID, nodeType uint32) {
+	page.setUint32(0, uint32(pageId))
+	page.setUint32(offsetBTreeNodeType, nodeType)
+	page.setUint32(offsetBTreeNumKeys, 0)
+	page.SetNextPageId(common.InvalidPageID)
+	page.setUint32(offsetBTreeFreeSpaceOffset, common.PageSize)
+	page.SetLeftmostChild(common.InvalidPageID)
+}
+
+func (page *BPlusTreeNodePage) GetPageId() types.PageID {
+	return types.PageID(int32(page.getUint32(0)))
+}
+
+func (page *BPlusTreeNodePage) IsLeaf() bool {
+	return page.getUint32(offsetBTreeNodeType) == BPlusTreeLeafNode
+}
+
+func (page *BPlusTreeNodePage) NumKeys() int {
+	return int(page.getUint32(offsetBTreeNumKeys))
+}
+
+func (page *BPlusTreeNodePage) GetNextPageId() types.PageID {
+	return types.PageID(int32(page.getUint32(offsetBTreeNextPageId)))
+}
+
+func (page *BPlusTreeNodePage) SetNextPageId(pageId types.PageID) {
+	page.setUint32(offsetBTreeNextPageId, uint32(pageId))
+}
+
+func (page *BPlusTreeNodePage) GetLeftmostChild() types.PageID {
+	return types.PageID(int32(page.getUint32(offsetBTreeLeftmostChild)))
+}
+
+func (page *BPlusTreeNodePage) SetLeftmostChild(pageId types.PageID) {
+	page.setUint32(offsetBTreeLeftmostChild, uint32(pageId))
+}
+
+func (page *BPlusTreeNodePage) slot(idx int) (offset int, length int) {
+	pos := sizeBTreeNodeHeader + idx*sizeBTreeSlot
+	return int(binary.LittleEndian.Uint16(page.data[pos:])), int(binary.LittleEndian.Uint16(page.data[pos+2:]))
+}
+
+func (page *BPlusTreeNodePage) setSlot(idx int, offset int, length int) {
+	pos := sizeBTreeNodeHeader + idx*sizeBTreeSlot
+	binary.LittleEndian.PutUint16(page.data[pos:], uint16(offset))
+	binary.LittleEndian.PutUint16(page.data[pos+2:], uint16(length))
+}
+
+// KeyAt returns key of idx-th entry. returned slice refers data of the page
+func (page *BPlusTreeNodePage) KeyAt(idx int) []byte {
+	offset, length := page.slot(idx)
+	if !page.IsLeaf() {
+		length -= sizeBTreeChild
+	}
+	return page.data[offset : offset+length]
+}
+
+// ChildAt returns child of idx-th entry of internal node
+func (page *BPlusTreeNodePage) ChildAt(idx int) types.PageID {
+	offset, length := page.slot(idx)
+	return types.PageID(int32(page.getUint32(offset + length - sizeBTreeChild)))
+}
+
+// EntrySize returns size which an entry having the key uses on the node
+func (page *BPlusTreeNodePage) EntrySize(key []byte) int {
+	if page.IsLeaf() {
+		return sizeBTreeSlot + len(key)
+	}
+	return sizeBTreeSlot + len(key) + sizeBTreeChild
+}
+
+// FreeSpace returns size of space which is not used by slots and entries
+func (page *BPlusTreeNodePage) FreeSpace() int {
+	used := 0
+	for ii := 0; ii < page.NumKeys(); ii++ {
+		_, length := page.slot(ii)
+		used += sizeBTreeSlot + length
+	}
+	return BPlusTreeNodeCapacity - used
+}
+
+// LowerBound returns index of first entry whose key is equal to or larger than key
+func (page *BPlusTreeNodePage) LowerBound(key []byte) int {
+	low, high := 0, page.NumKeys()
+	for low < high {
+		mid := (low + high) / 2
+		if bytes.Compare(page.KeyAt(mid), key) < 0 {
+			low = mid + 1
+		} else {
+			high = mid
+		}
+	}
+	return low
+}
+
+// UpperBound returns index of first entry whose key is larger than key
+func (page *BPlusTreeNodePage) UpperBound(key []byte) int {
+	low, high := 0, page.NumKeys()
+	for low < high {
+		mid := (low + high) / 2
+		if bytes.Compare(page.KeyAt(mid), key) <= 0 {
+			low = mid + 1
+		} else {
+			high = mid
+		}
+	}
+	return low
+}
+
+// LookupChild returns child of internal node which key should be stored in
+func (page *BPlusTreeNodePage) LookupChild(key []byte) types.PageID {
+	idx := page.UpperBound(key)
+	if idx == 0 {
+		return page.GetLeftmostChild()
+	}
+	return page.ChildAt(idx - 1)
+}
+
+// InsertAt inserts an entry as idx-th entry. false is returned when there is no space
+func (page *BPlusTreeNodePage) InsertAt(idx int, key []byte, child types.PageID) bool {
+	entrySize := page.EntrySize(key)
+	if page.FreeSpace() < entrySize {
+		return false
+	}
+	numKeys := page.NumKeys()
+	freeSpaceOffset := int(page.getUint32(offsetBTreeFreeSpaceOffset))
+	if freeSpaceOffset-(entrySize-sizeBTreeSlot) < sizeBTreeNodeHeader+(numKeys+1)*sizeBTreeSlot {
+		// space left by removed entries is reclaimed
+		page.SetEntries(page.Entries())
+		freeSpaceOffset = int(page.getUint32(offsetBTreeFreeSpaceOffset))
+	}
+
+	dataLen := entrySize - sizeBTreeSlot
+	offset := freeSpaceOffset - dataLen
+	copy(page.data[offset:], key)
+	if !page.IsLeaf() {
+		page.setUint32(offset+len(key), uint32(child))
+	}
+	slotPos := sizeBTreeNodeHeader + idx*sizeBTreeSlot
+	copy(page.data[slotPos+sizeBTreeSlot:], page.data[slotPos:sizeBTreeNodeHeader+numKeys*sizeBTreeSlot])
+	page.setSlot(idx, offset, dataLen)
+	page.setUint32(offsetBTreeFreeSpaceOffset, uint32(offset))
+	page.setUint32(offsetBTreeNumKeys, uint32(numKeys+1))
+	return true
+}
+
+// RemoveAt removes idx-th entry. the space used by the entry is reclaimed at next insertion
+func (page *BPlusTreeNodePage) RemoveAt(idx int) {
+	numKeys := page.NumKeys()
+	slotPos := sizeBTreeNodeHeader + idx*sizeBTreeSlot
+	copy(page.data[slotPos:], page.data[slotPos+sizeBTreeSlot:sizeBTreeNodeHeader+numKeys*sizeBTreeSlot])
+	page.setUint32(offsetBTreeNumKeys, uint32(numKeys-1))
+}
+
+// Entries returns copy of all entries
+func (page *BPlusTreeNodePage) Entries() []BPlusTreeNodeEntry {
+	ret := make([]BPlusTreeNodeEntry, page.NumKeys())
+	for ii := range ret {
+		key := page.KeyAt(ii)
+		ret[ii].Key = append(make([]byte, 0, len(key)), key...)
+		if !page.IsLeaf() {
+			ret[ii].Child = page.ChildAt(ii)
+		}
+	}
+	return ret
+}
+
+// SetEntries replaces all entries. entries must be sorted and fit in the node
+func (page *BPlusTreeNodePage) SetEntries(entries []BPlusTreeNodeEntry) {
+	page.setUint32(offsetBTreeNumKeys, 0)
+	page.setUint32(offsetBTreeFreeSpaceOffset, common.PageSize)
+	for ii, entry := range entries {
+		if !page.InsertAt(ii, entry.Key, entry.Child) {
+			panic("entries overflow B+tree node")
+		}
+	}
+}
@@ -5,7 +5,7 @@ package page
 
 type HashTablePair struct {
 	key   uint32
-	value uint32
+	value uint64 // packed RID (32bit page id + 32bit slot number)
 }
 
 const sizeOfHashTablePair = 16
@@ -26,7 +26,7 @@ const BlockArraySize = 4 * 4096 / (4*sizeOfHashTablePair + 1)
 type HashTableBlockPage struct {
 	occuppied [(BlockArraySize-1)/8 + 1]byte // 256 bits
 	readable  [(BlockArraySize-1)/8 + 1]byte // 256 bits
-	array     [BlockArraySize]HashTablePair  // 252 * 16 bits
+	array     [BlockArraySize]HashTablePair  // 252 * 16 bytes
 }
 
 // Gets the key at an index in the block
@@ -35,12 +35,12 @@ func (page *HashTableBlockPage) KeyAt(index uint32) uint32 {
 }
 
 // Gets the value at an index in the block
-func (page *HashTableBlockPage) ValueAt(index uint32) uint32 {
+func (page *HashTableBlockPage) ValueAt(index uint32) uint64 {
 	return page.array[index].value
 }
 
 // Attempts to insert a key and value into an index in the baccess.
-func (page *HashTableBlockPage) Insert(index uint32, key uint32, value uint32) bool {
+func (page *HashTableBlockPage) Insert(index uint32, key uint32, value uint64) bool {
 	if page.IsOccupied(index) {
 		return false
 	}
@@ -0,0 +1,31 @@
+package page
+
+import (
+	"github.com/ryogrid/SamehadaDB/common"
+	"github.com/ryogrid/SamehadaDB/types"
+)
+
+// number of block page ids which a directory page holds
+const DirectoryArraySize = common.PageSize / 4
+
+/**
+ * Directory page of linear probing hash table. it holds page ids of
+ * block pages. i-th block of the table is pointed by
+ * (i % DirectoryArraySize)-th entry of (i / DirectoryArraySize)-th directory page.
+ *
+ * Directory format (size in byte):
+ *  ----------------------------------------------------------
+ * | BlockPageId(1) (4) | BlockPageId(2) (4) | ... | BlockPageId(n) (4) |
+ *  ----------------------------------------------------------
+ */
+type HashTableDirectoryPage struct {
+	blockPageIds [DirectoryArraySize]types.PageID
+}
+
+func (page *HashTableDirectoryPage) GetBlockPageId(index uint32) types.PageID {
+	return page.blockPageIds[index]
+}
+
+func (page *HashTableDirectoryPage) SetBlockPageId(index uint32, pageId types.PageID) {
+	page.blockPageIds[index] = pageId
+}
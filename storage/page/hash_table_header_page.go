@@ -3,27 +3,43 @@
 
 package page
 
-import "github.com/ryogrid/SamehadaDB/types"
+import (
+	"github.com/ryogrid/SamehadaDB/common"
+	"github.com/ryogrid/SamehadaDB/types"
+)
+
+// version of format of hash table pages. it is bumped when the format is changed
+// version 2: values are 64bit packed RIDs and block pages are pointed via directory pages
+const HashTableFormatVersion = 2
+
+// max number of directory pages which a header page can hold
+const HeaderDirectoryArraySize = (common.PageSize - 48) / 4
 
 /**
  *
- * Header Page for linear probing hash table.
+ * Header Page for linear probing hash table. block pages are pointed
+ * via directory pages because number of them grows as the table is resized.
  *
- * Header format (size in byte, 16 bytes in total):
- * -------------------------------------------------------------
- * | LSN (4) | Size (4) | PageId(4) | NextBlockIndex(4)
- * -------------------------------------------------------------
+ * Header format (size in byte, 48 bytes + directory page ids):
+ * -------------------------------------------------------------------------------------
+ * | PageId (4) | Version (4) | LSN (8) | NextIndex (4) | padding (4) | Size (8) |
+ * -------------------------------------------------------------------------------------
+ * | NumBlocks (4) | padding (4) | NumOccupied (8) | DirectoryPageId(1) | ... | DirectoryPageId(n) |
+ * -------------------------------------------------------------------------------------
  */
 type HashTableHeaderPage struct {
-	pageId       types.PageID
-	lsn          int    // log sequence number
-	nextIndex    uint32 // the next index to add a new entry to blockPageIds
-	size         int    // the number of key/value pairs the hash table can hold
-	blockPageIds [1020]types.PageID
+	pageId      types.PageID
+	version     uint32 // HashTableFormatVersion when the table was created
+	lsn         int    // log sequence number
+	nextIndex   uint32 // the next index to add a new entry to dirPageIds
+	size        int    // the number of key/value pairs the hash table can hold
+	numBlocks   uint32 // the number of block pages
+	numOccupied int    // the number of occupied slots. removed slots are included
+	dirPageIds  [HeaderDirectoryArraySize]types.PageID
 }
 
-func (page *HashTableHeaderPage) GetBlockPageId(index uint32) types.PageID {
-	return page.blockPageIds[index]
+func (page *HashTableHeaderPage) GetDirectoryPageId(index uint32) types.PageID {
+	return page.dirPageIds[index]
 }
 
 func (page *HashTableHeaderPage) GetPageId() types.PageID {
@@ -34,6 +50,14 @@ func (page *HashTableHeaderPage) SetPageId(pageId types.PageID) {
 	page.pageId = pageId
 }
 
+func (page *HashTableHeaderPage) GetVersion() uint32 {
+	return page.version
+}
+
+func (page *HashTableHeaderPage) SetVersion(version uint32) {
+	page.version = version
+}
+
 func (page *HashTableHeaderPage) GetLSN() int {
 	return page.lsn
 }
@@ -42,15 +66,29 @@ func (page *HashTableHeaderPage) SetLSN(lsn int) {
 	page.lsn = lsn
 }
 
-func (page *HashTableHeaderPage) AddBlockPageId(pageId types.PageID) {
-	page.blockPageIds[page.nextIndex] = pageId
+func (page *HashTableHeaderPage) AddDirectoryPageId(pageId types.PageID) {
+	common.SH_Assert(page.nextIndex < HeaderDirectoryArraySize, "too many directory pages of hash table")
+	page.dirPageIds[page.nextIndex] = pageId
 	page.nextIndex++
 }
 
-func (page *HashTableHeaderPage) NumBlocks() uint32 {
+func (page *HashTableHeaderPage) NumDirectories() uint32 {
 	return page.nextIndex
 }
 
+// ClearDirectoryPageIds forgets all directory pages. it is used when the table is resized
+func (page *HashTableHeaderPage) ClearDirectoryPageIds() {
+	page.nextIndex = 0
+}
+
+func (page *HashTableHeaderPage) NumBlocks() uint32 {
+	return page.numBlocks
+}
+
+func (page *HashTableHeaderPage) SetNumBlocks(numBlocks uint32) {
+	page.numBlocks = numBlocks
+}
+
 func (page *HashTableHeaderPage) SetSize(size int) {
 	page.size = size
 }
@@ -58,3 +96,11 @@ func (page *HashTableHeaderPage) SetSize(size int) {
 func (page *HashTableHeaderPage) GetSize() int {
 	return page.size
 }
+
+func (page *HashTableHeaderPage) GetNumOccupied() int {
+	return page.numOccupied
+}
+
+func (page *HashTableHeaderPage) SetNumOccupied(numOccupied int) {
+	page.numOccupied = numOccupied
+}
@@ -7,14 +7,78 @@ import (
 	"github.com/ryogrid/SamehadaDB/types"
 )
 
+// kind of index data structure
+type IndexKind int32
+
+const (
+	IndexKindHash IndexKind = iota
+	IndexKindBTree
+)
+
+// constraint which is enforced through index
+type IndexConstraint int32
+
+const (
+	IndexConstraintNone IndexConstraint = iota
+	// duplicated keys are not allowed. keys which have NULL are not checked
+	IndexConstraintUnique
+	// duplicated keys and NULL are not allowed
+	IndexConstraintPrimaryKey
+)
+
+// action on referencing rows when referenced row is deleted
+type ForeignKeyAction int32
+
+const (
+	// deletion of referenced row fails
+	ForeignKeyActionRestrict ForeignKeyAction = iota
+	// referencing rows are deleted together
+	ForeignKeyActionCascade
+	// referencing column of referencing rows is set to NULL
+	ForeignKeyActionSetNull
+)
+
+// ForeignKey is reference from a column to a column of other table (parent table).
+// referenced column must have UNIQUE or PRIMARY KEY constraint
+type ForeignKey struct {
+	refTableOID   uint32
+	refColumnName string
+	onDelete      ForeignKeyAction
+}
+
+func NewForeignKey(refTableOID uint32, refColumnName string, onDelete ForeignKeyAction) *ForeignKey {
+	return &ForeignKey{refTableOID, refColumnName, onDelete}
+}
+
+func (fk *ForeignKey) GetRefTableOID() uint32 {
+	return fk.refTableOID
+}
+
+func (fk *ForeignKey) GetRefColumnName() string {
+	return fk.refColumnName
+}
+
+func (fk *ForeignKey) GetOnDelete() ForeignKeyAction {
+	return fk.onDelete
+}
+
 type Column struct {
-	columnName     string
-	columnType     types.TypeID
-	fixedLength    uint32 // For a non-inlined column, this is the size of a pointer. Otherwise, the size of the fixed length column
-	variableLength uint32 // For an inlined column, 0. Otherwise, the length of the variable length column
-	columnOffset   uint32 // Column offset in the tuple
-	hasIndex       bool   // whether the column has index data
-	isLeft         bool   // when temporal schema, this is used for join
+	columnName      string
+	columnType      types.TypeID
+	fixedLength     uint32 // For a non-inlined column, this is the size of a pointer. Otherwise, the size of the fixed length column
+	variableLength  uint32 // For an inlined column, 0. Otherwise, the length of the variable length column
+	columnOffset    uint32 // Column offset in the tuple
+	hasIndex        bool   // whether the column has index data
+	indexKind       IndexKind
+	indexConstraint IndexConstraint
+	isNullable      bool
+	// nil when DEFAULT is not specified. omitted column is filled with NULL then
+	defaultValue *types.Value
+	// condition of CHECK constraint in SQL text. empty string when it is not specified
+	checkExpr string
+	// nil when the column doesn't reference other table
+	foreignKey *ForeignKey
+	isLeft     bool // when temporal schema, this is used for join
 	// should be pointer of subtype of expression.Expression
 	// this member is used and needed at temporarily created table (schema) on query execution
 	expr_ interface{}
@@ -23,10 +87,10 @@ type Column struct {
 // expr argument should be pointer of subtype of expression.Expression
 func NewColumn(name string, columnType types.TypeID, hasIndex bool, expr interface{}) *Column {
 	if columnType != types.Varchar {
-		return &Column{name, columnType, columnType.Size(), 0, 0, hasIndex, true, expr}
+		return &Column{name, columnType, columnType.Size(), 0, 0, hasIndex, IndexKindHash, IndexConstraintNone, true, nil, "", nil, true, expr}
 	}
 
-	return &Column{name, types.Varchar, 4, 255, 0, hasIndex, true, expr}
+	return &Column{name, types.Varchar, 4, 255, 0, hasIndex, IndexKindHash, IndexConstraintNone, true, nil, "", nil, true, expr}
 }
 
 func (c *Column) IsInlined() bool {
@@ -65,6 +129,10 @@ func (c *Column) GetColumnName() string {
 	return c.columnName
 }
 
+func (c *Column) SetColumnName(columnName string) {
+	c.columnName = columnName
+}
+
 func (c *Column) HasIndex() bool {
 	return c.hasIndex
 }
@@ -73,6 +141,54 @@ func (c *Column) SetHasIndex(hasIndex bool) {
 	c.hasIndex = hasIndex
 }
 
+func (c *Column) GetIndexKind() IndexKind {
+	return c.indexKind
+}
+
+func (c *Column) SetIndexKind(indexKind IndexKind) {
+	c.indexKind = indexKind
+}
+
+func (c *Column) GetIndexConstraint() IndexConstraint {
+	return c.indexConstraint
+}
+
+func (c *Column) SetIndexConstraint(indexConstraint IndexConstraint) {
+	c.indexConstraint = indexConstraint
+}
+
+func (c *Column) IsNullable() bool {
+	return c.isNullable
+}
+
+func (c *Column) SetIsNullable(isNullable bool) {
+	c.isNullable = isNullable
+}
+
+func (c *Column) GetDefaultValue() *types.Value {
+	return c.defaultValue
+}
+
+func (c *Column) SetDefaultValue(defaultValue *types.Value) {
+	c.defaultValue = defaultValue
+}
+
+func (c *Column) GetCheckExpr() string {
+	return c.checkExpr
+}
+
+func (c *Column) SetCheckExpr(checkExpr string) {
+	c.checkExpr = checkExpr
+}
+
+func (c *Column) GetForeignKey() *ForeignKey {
+	return c.foreignKey
+}
+
+func (c *Column) SetForeignKey(foreignKey *ForeignKey) {
+	c.foreignKey = foreignKey
+}
+
 func (c *Column) IsLeft() bool {
 	return c.isLeft
 }
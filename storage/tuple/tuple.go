@@ -62,30 +62,29 @@ func NewTupleFromSchema(values []types.Value, schema_ *schema.Schema) *Tuple {
 // generated tuple filled only specifed column only due to use methods
 // defined on Index interface
 func GenTupleForHashIndexSearch(schema_ *schema.Schema, colIndex uint32, keyVal types.Value) *Tuple {
+	return GenTupleForIndexSearch(schema_, []uint32{colIndex}, []types.Value{keyVal})
+}
+
+// generate tuple obj for search of index whose key consists of multiple columns.
+// keyVals[i] is set to column keyAttrs[i] and other columns are filled with dummy values
+func GenTupleForIndexSearch(schema_ *schema.Schema, keyAttrs []uint32, keyVals []types.Value) *Tuple {
 	colmuns := schema_.GetColumns()
 	values := make([]types.Value, 0)
-	for idx, columnObj := range colmuns {
+	for _, columnObj := range colmuns {
 		switch columnObj.GetType() {
 		case types.Integer:
-			if idx == int(colIndex) {
-				values = append(values, keyVal)
-			} else {
-				values = append(values, types.NewInteger(0))
-			}
+			values = append(values, types.NewInteger(0))
 		case types.Float:
-			if idx == int(colIndex) {
-				values = append(values, keyVal)
-			} else {
-				values = append(values, types.NewFloat(0.0))
-			}
+			values = append(values, types.NewFloat(0.0))
 		case types.Varchar:
-			if idx == int(colIndex) {
-				values = append(values, keyVal)
-			} else {
-				values = append(values, types.NewVarchar(""))
-			}
+			values = append(values, types.NewVarchar(""))
+		case types.Boolean:
+			values = append(values, types.NewBoolean(false))
 		}
 	}
+	for ii, colIndex := range keyAttrs {
+		values[colIndex] = keyVals[ii]
+	}
 	return NewTupleFromSchema(values, schema_)
 }
 